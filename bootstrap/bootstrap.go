@@ -0,0 +1,221 @@
+// Package bootstrap forms a new cluster from nodes that are all started the same way
+// Each node polls its peers until the expected number of them agree on the servers of the cluster,
+// then every one of them bootstraps raft with that same configuration
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/discovery"
+	"github.com/kavinaravind/go-raft-message-queue/model"
+	"github.com/kavinaravind/go-raft-message-queue/store"
+)
+
+// ErrClusterExists is returned when a peer is already part of a cluster, which the node should join instead
+var ErrClusterExists = errors.New("a peer is already part of a cluster")
+
+// Node is the node bootstrapping the cluster, it is implemented by the store
+type Node interface {
+	// BootstrapStatus is used to get the state of the node while the cluster is formed
+	BootstrapStatus() (store.BootstrapStatus, error)
+
+	// SetBootstrapCandidates is used to publish the ids of the servers the node would bootstrap the cluster with
+	SetBootstrapCandidates(ids []string)
+
+	// Bootstrap is used to bootstrap the cluster with the given servers as voters
+	Bootstrap(servers []store.Server) error
+}
+
+// Config is the configuration of the bootstrap
+type Config struct {
+	// Expect is the number of servers the cluster is bootstrapped with
+	Expect int
+
+	// Peers is used to find the nodes that may form the cluster, which may include this node
+	Peers discovery.Peers
+
+	// Interval is how often the peers are polled, a second if zero
+	Interval time.Duration
+
+	// HTTPClient is the client the peers are polled with, a client with a 5 second timeout if nil
+	HTTPClient *http.Client
+
+	// Logger is the logger instance, the default logger if nil
+	Logger *slog.Logger
+}
+
+// Run is used to wait until the expected number of servers are found and to bootstrap the cluster with them
+// It returns nil once the node is bootstrapped, including when it already was, and ErrClusterExists when
+// a peer is already part of a cluster, in which case the node has to join it rather than bootstrap a new one
+func Run(ctx context.Context, node Node, conf Config) error {
+	if conf.Expect < 1 {
+		return fmt.Errorf("expected at least 1 server, got %d", conf.Expect)
+	}
+	if conf.Interval == 0 {
+		conf.Interval = time.Second
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if conf.Logger == nil {
+		conf.Logger = slog.Default()
+	}
+
+	ticker := time.NewTicker(conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		done, err := round(ctx, node, conf)
+		if done || err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// round is used to poll the peers once, and to bootstrap the cluster if they agree on its servers
+func round(ctx context.Context, node Node, conf Config) (bool, error) {
+	self, err := node.BootstrapStatus()
+	if err != nil {
+		return false, err
+	}
+	if self.Bootstrapped {
+		return true, nil
+	}
+
+	addresses, err := conf.Peers(ctx)
+	if err != nil {
+		conf.Logger.Warn("Failed to get peers", "error", err)
+		return false, nil
+	}
+
+	servers := map[string]store.Server{self.Self.ID: self.Self}
+	var peers []model.BootstrapStatus
+	for _, peer := range probe(ctx, conf.HTTPClient, addresses, conf.Logger) {
+		if peer.ID == self.Self.ID {
+			continue
+		}
+		if peer.Bootstrapped {
+			return false, fmt.Errorf("%w: %s", ErrClusterExists, peer.ID)
+		}
+		if known, ok := servers[peer.ID]; ok && known.RaftAddress != peer.RaftAddress {
+			conf.Logger.Warn("Peers share a server id", "id", peer.ID, "raft_addresses", []string{known.RaftAddress, peer.RaftAddress})
+			return false, nil
+		}
+
+		servers[peer.ID] = store.Server{
+			Member:      store.Member{ID: peer.ID, Address: peer.Address},
+			RaftAddress: peer.RaftAddress,
+			Voter:       true,
+		}
+		peers = append(peers, peer)
+	}
+
+	ids := make([]string, 0, len(servers))
+	for id := range servers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	node.SetBootstrapCandidates(ids)
+
+	if len(ids) > conf.Expect {
+		conf.Logger.Warn("Found more servers than expected", "expected", conf.Expect, "found", ids)
+		return false, nil
+	}
+	if len(ids) < conf.Expect {
+		conf.Logger.Info("Waiting for servers", "expected", conf.Expect, "found", ids)
+		return false, nil
+	}
+
+	// Every peer must have seen the same servers, otherwise they may bootstrap different clusters
+	for _, peer := range peers {
+		if !slices.Equal(peer.Candidates, ids) {
+			conf.Logger.Info("Waiting for peers to agree on the servers", "peer", peer.ID, "candidates", peer.Candidates)
+			return false, nil
+		}
+	}
+
+	configuration := make([]store.Server, 0, len(ids))
+	for _, id := range ids {
+		configuration = append(configuration, servers[id])
+	}
+	if err := node.Bootstrap(configuration); err != nil {
+		return false, err
+	}
+
+	conf.Logger.Info("Bootstrapped cluster", "servers", ids)
+	return true, nil
+}
+
+// probe is used to get the bootstrap status of every peer that responds, in no particular order
+func probe(ctx context.Context, httpClient *http.Client, addresses []string, logger *slog.Logger) []model.BootstrapStatus {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var statuses []model.BootstrapStatus
+
+	for _, address := range addresses {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+
+			status, err := status(ctx, httpClient, address)
+			if err != nil {
+				logger.Debug("Failed to get bootstrap status of peer", "peer", address, "error", err)
+				return
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			statuses = append(statuses, status)
+		}(address)
+	}
+	wg.Wait()
+
+	return statuses
+}
+
+// status is used to get the bootstrap status of the node at the HTTP address
+func status(ctx context.Context, httpClient *http.Client, address string) (model.BootstrapStatus, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(address, "/")+"/bootstrap", nil)
+	if err != nil {
+		return model.BootstrapStatus{}, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return model.BootstrapStatus{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return model.BootstrapStatus{}, fmt.Errorf("request failed with status %d", resp.StatusCode)
+	}
+
+	var status model.BootstrapStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return model.BootstrapStatus{}, fmt.Errorf("failed to decode bootstrap status: %w", err)
+	}
+	if status.ID == "" {
+		return model.BootstrapStatus{}, errors.New("bootstrap status has no id")
+	}
+	return status, nil
+}
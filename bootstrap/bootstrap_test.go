@@ -0,0 +1,82 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/discovery"
+	"github.com/kavinaravind/go-raft-message-queue/model"
+	"github.com/kavinaravind/go-raft-message-queue/server"
+	"github.com/kavinaravind/go-raft-message-queue/testcluster"
+)
+
+func TestRun(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cluster := testcluster.New[model.Payload](t, 4, testcluster.WithLogger(logger), testcluster.WithoutBootstrap())
+	nodes := cluster.Nodes()
+
+	var addresses []string
+	for _, node := range nodes {
+		srv := httptest.NewServer(server.NewServer(node.Store, logger).Handler())
+		t.Cleanup(srv.Close)
+		addresses = append(addresses, srv.Listener.Addr().String())
+	}
+
+	run := func(ctx context.Context, i int, expect int, peers []string) error {
+		return Run(ctx, nodes[i].Store, Config{Expect: expect, Peers: discovery.Static(peers), Interval: 10 * time.Millisecond, Logger: logger})
+	}
+
+	// With more servers than expected, no node bootstraps
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	errs := make(chan error, 4)
+	for i := range nodes {
+		go func(i int) { errs <- run(ctx, i, 3, addresses) }(i)
+	}
+	for range nodes {
+		if err := <-errs; !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected no bootstrap with 4 servers, got: %v", err)
+		}
+	}
+	cancel()
+
+	// Every node started the same way bootstraps the same cluster
+	ctx, cancel = context.WithTimeout(context.Background(), testcluster.DefaultTimeout)
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		go func(i int) { errs <- run(ctx, i, 3, addresses[:3]) }(i)
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("expected the cluster to be bootstrapped, got: %v", err)
+		}
+	}
+
+	leader := cluster.Leader()
+	servers, err := leader.Store.Servers()
+	if err != nil || len(servers) != 3 {
+		t.Fatalf("expected 3 servers, got %v, %v", servers, err)
+	}
+	if err := leader.Store.Send("", model.Payload{ContentType: "text/plain", Body: []byte("hello")}); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+
+	// Bootstrapping again does nothing
+	for i := 0; i < 3; i++ {
+		if err := run(ctx, i, 3, addresses[:3]); err != nil {
+			t.Errorf("expected node%d to be bootstrapped already, got: %v", i+1, err)
+		}
+	}
+	if servers, _ := leader.Store.Servers(); len(servers) != 3 {
+		t.Errorf("expected 3 servers, got %v", servers)
+	}
+
+	// A node started later finds the existing cluster
+	if err := run(ctx, 3, 3, addresses); !errors.Is(err, ErrClusterExists) {
+		t.Errorf("expected the cluster to exist, got: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/kavinaravind/go-raft-message-queue/model"
+)
+
+// Queues is used to list the queues along with the number of messages in each
+func (c *Client[T]) Queues(ctx context.Context) ([]model.QueueInfo, error) {
+	var queues []model.QueueInfo
+	err := c.do(ctx, true, func(leader string) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, leader+"/queues", nil)
+	}, func(resp *http.Response) error {
+		var body struct {
+			Queues []model.QueueInfo `json:"queues"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return fmt.Errorf("failed to decode queues: %w", err)
+		}
+		queues = body.Queues
+		return nil
+	})
+	return queues, err
+}
+
+// CreateQueue is used to create an empty queue, it reports whether the queue did not already exist
+func (c *Client[T]) CreateQueue(ctx context.Context, queue string) (bool, error) {
+	var created bool
+	err := c.do(ctx, true, func(leader string) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPut, leader+"/queue?"+url.Values{"queue": {queue}}.Encode(), nil)
+	}, func(resp *http.Response) error {
+		created = resp.StatusCode == http.StatusCreated
+		return nil
+	})
+	return created, err
+}
+
+// DeleteQueue is used to delete a queue along with its messages
+func (c *Client[T]) DeleteQueue(ctx context.Context, queue string) error {
+	return c.do(ctx, false, func(leader string) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodDelete, leader+"/queue?"+url.Values{"queue": {queue}}.Encode(), nil)
+	}, nil)
+}
+
+// PurgeQueue is used to delete every message of a queue, and returns how many were deleted
+func (c *Client[T]) PurgeQueue(ctx context.Context, queue string) (int, error) {
+	var purged int
+	err := c.do(ctx, false, func(leader string) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPost, leader+"/queue/purge?"+url.Values{"queue": {queue}}.Encode(), nil)
+	}, func(resp *http.Response) error {
+		var body struct {
+			Purged int `json:"purged"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		purged = body.Purged
+		return nil
+	})
+	return purged, err
+}
+
+// Peek is used to get up to max payloads from the front of a queue without removing them
+func (c *Client[T]) Peek(ctx context.Context, queue string, max int) ([]model.Payload, error) {
+	var payloads []model.Payload
+	err := c.do(ctx, true, func(leader string) (*http.Request, error) {
+		query := url.Values{"queue": {queue}, "max": {strconv.Itoa(max)}}
+		return http.NewRequestWithContext(ctx, http.MethodGet, leader+"/peek?"+query.Encode(), nil)
+	}, func(resp *http.Response) error {
+		var body struct {
+			Messages []struct {
+				ContentType string
+				Data        json.RawMessage
+			}
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return fmt.Errorf("failed to decode messages: %w", err)
+		}
+
+		payloads = make([]model.Payload, 0, len(body.Messages))
+		for _, message := range body.Messages {
+			payload, err := decodeData(message.ContentType, message.Data)
+			if err != nil {
+				return err
+			}
+			payloads = append(payloads, payload)
+		}
+		return nil
+	})
+	return payloads, err
+}
+
+// decodeData is used to get the payload of a message rendered in a response
+// JSON payloads are embedded as is, any other payload as a base64 string
+func decodeData(contentType string, data json.RawMessage) (model.Payload, error) {
+	if contentType == "" || model.IsJSONContentType(contentType) {
+		return model.Payload{ContentType: contentType, Body: data}, nil
+	}
+
+	var body []byte
+	if err := json.Unmarshal(data, &body); err != nil {
+		return model.Payload{}, fmt.Errorf("failed to decode %s payload: %w", contentType, err)
+	}
+	return model.Payload{ContentType: contentType, Body: body}, nil
+}
+
+// Join is used to add a node to the cluster, with the address of its raft transport and of its HTTP server
+func (c *Client[T]) Join(ctx context.Context, id, raftAddress, httpAddress string) error {
+	body, err := json.Marshal(map[string]string{"id": id, "address": raftAddress, "http_address": httpAddress})
+	if err != nil {
+		return err
+	}
+
+	// Joining a node that is already part of the cluster does nothing, so the join is idempotent
+	return c.do(ctx, true, func(leader string) (*http.Request, error) {
+		return newJSONRequest(ctx, leader+"/join", body)
+	}, nil)
+}
+
+// Remove is used to remove a node from the cluster
+func (c *Client[T]) Remove(ctx context.Context, id string) error {
+	body, err := json.Marshal(map[string]string{"id": id})
+	if err != nil {
+		return err
+	}
+
+	return c.do(ctx, false, func(leader string) (*http.Request, error) {
+		return newJSONRequest(ctx, leader+"/cluster/remove", body)
+	}, nil)
+}
+
+// TransferLeadership is used to hand leadership to the given node, or to the most up to date node if empty
+func (c *Client[T]) TransferLeadership(ctx context.Context, id string) error {
+	body, err := json.Marshal(map[string]string{"id": id})
+	if err != nil {
+		return err
+	}
+
+	err = c.do(ctx, false, func(leader string) (*http.Request, error) {
+		return newJSONRequest(ctx, leader+"/cluster/transfer", body)
+	}, nil)
+	if err == nil {
+		c.lock.Lock()
+		c.leader = ""
+		c.lock.Unlock()
+	}
+	return err
+}
+
+// Backup is used to take a snapshot of the state on the leader and to write it to w, and returns the number of bytes written
+// The backup is only written once the leader has taken it, so a failed attempt writes nothing and is retried
+func (c *Client[T]) Backup(ctx context.Context, w io.Writer) (int64, error) {
+	var written int64
+	err := c.do(ctx, true, func(leader string) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, leader+"/admin/backup", nil)
+	}, func(resp *http.Response) error {
+		var err error
+		written, err = io.Copy(w, resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		if resp.ContentLength >= 0 && written != resp.ContentLength {
+			return fmt.Errorf("backup cut short after %d of %d bytes", written, resp.ContentLength)
+		}
+		return nil
+	})
+	return written, err
+}
+
+// Restore is used to replace the state of the cluster with a backup, which is read from the start on every attempt
+// Restoring the same backup again leaves the same state, so the restore is retried like an idempotent request
+func (c *Client[T]) Restore(ctx context.Context, backup io.ReadSeeker) error {
+	return c.do(ctx, true, func(leader string) (*http.Request, error) {
+		if _, err := backup.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, leader+"/admin/restore", io.NopCloser(backup))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	}, nil)
+}
+
+// newJSONRequest is used to create a POST request with a JSON body
+func newJSONRequest(ctx context.Context, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", model.JSONContentType)
+	return req, nil
+}
@@ -0,0 +1,412 @@
+// Package client is a Go client of the message queue
+// It discovers the leader from a list of seed nodes and retries requests that failed with a transient error
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/model"
+)
+
+// ErrNoLeader is returned when none of the known nodes knows the HTTP address of a leader
+var ErrNoLeader = errors.New("no leader found")
+
+// idempotencyKeyHeader is the header carrying the key a send is deduplicated by
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// options are the options of a client
+type options struct {
+	httpClient   *http.Client
+	attempts     int
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	pollInterval time.Duration
+}
+
+// Option is used to configure a client
+type Option func(*options)
+
+// WithHTTPClient is used to set the HTTP client requests are made with
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithRetries is used to set the number of times a failed request is retried, 0 disables retries
+func WithRetries(retries int) Option {
+	return func(o *options) {
+		o.attempts = retries + 1
+	}
+}
+
+// WithBackoff is used to set the delay before the first retry, which doubles on every retry up to max
+func WithBackoff(min, max time.Duration) Option {
+	return func(o *options) {
+		o.minBackoff = min
+		o.maxBackoff = max
+	}
+}
+
+// WithPollInterval is used to set how often a subscription reads a stream that has no new entries
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.pollInterval = interval
+	}
+}
+
+// Client is a client of the message queue for messages of type T, which are sent and received as JSON
+// It is safe for concurrent use
+type Client[T any] struct {
+	options
+
+	// lock protects the fields below
+	lock sync.Mutex
+
+	// nodes are the base URLs of the seeds and the nodes discovered from them, in the order they are tried
+	nodes []string
+
+	// leader is the base URL of the current leader, empty until it is discovered
+	leader string
+}
+
+// New creates a new client of the cluster the seed nodes are part of
+// Seeds are HTTP addresses such as localhost:3000, the scheme defaults to http
+func New[T any](seeds []string, opts ...Option) *Client[T] {
+	o := options{
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		attempts:     10,
+		minBackoff:   50 * time.Millisecond,
+		maxBackoff:   2 * time.Second,
+		pollInterval: time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c := &Client[T]{options: o}
+	for _, seed := range seeds {
+		c.addNode(baseURL(seed))
+	}
+	return c
+}
+
+// baseURL is used to get the base URL of a node from its address
+func baseURL(address string) string {
+	if strings.Contains(address, "://") {
+		return strings.TrimSuffix(address, "/")
+	}
+	return "http://" + address
+}
+
+// addNode is used to remember a node to discover the leader from, it must be called with the lock held
+func (c *Client[T]) addNode(node string) {
+	for _, known := range c.nodes {
+		if known == node {
+			return
+		}
+	}
+	c.nodes = append(c.nodes, node)
+}
+
+// Send is used to send a message to the named queue
+// The message is sent with a random idempotency key, so it is enqueued once however many times it is retried
+func (c *Client[T]) Send(ctx context.Context, queue string, data T) error {
+	return c.SendIdempotent(ctx, queue, newKey(), data)
+}
+
+// SendIdempotent is used to send a message to the named queue with the given idempotency key
+// The message is not enqueued again if a message was sent to the queue with the same key recently
+func (c *Client[T]) SendIdempotent(ctx context.Context, queue, key string, data T) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	return c.sendPayload(ctx, queue, key, model.Payload{ContentType: model.JSONContentType, Body: body})
+}
+
+// SendPayload is used to send a payload of any content type to the named queue, with a random idempotency key
+func (c *Client[T]) SendPayload(ctx context.Context, queue string, payload model.Payload) error {
+	return c.sendPayload(ctx, queue, newKey(), payload)
+}
+
+// SendPayloadIdempotent is used to send a payload of any content type to the named queue with the given idempotency key
+func (c *Client[T]) SendPayloadIdempotent(ctx context.Context, queue, key string, payload model.Payload) error {
+	return c.sendPayload(ctx, queue, key, payload)
+}
+
+// sendPayload is used to send a payload to the named queue with the given idempotency key
+func (c *Client[T]) sendPayload(ctx context.Context, queue, key string, payload model.Payload) error {
+	return c.do(ctx, true, func(leader string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, leader+"/send?"+url.Values{"queue": {queue}}.Encode(), bytes.NewReader(payload.Body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", payload.ContentType)
+		req.Header.Set(idempotencyKeyHeader, key)
+		return req, nil
+	}, nil)
+}
+
+// Receive is used to take a message from the named queue, ok is false if the queue is empty
+// A receive is only retried when it is known not to have taken effect, as a message received twice is lost
+func (c *Client[T]) Receive(ctx context.Context, queue string) (data T, ok bool, err error) {
+	payload, ok, err := c.ReceivePayload(ctx, queue)
+	if err != nil || !ok {
+		return data, false, err
+	}
+	if !payload.IsJSON() {
+		return data, false, fmt.Errorf("received a message with content type %q, which is not JSON", payload.ContentType)
+	}
+	if err := json.Unmarshal(payload.Body, &data); err != nil {
+		return data, false, fmt.Errorf("failed to decode message: %w", err)
+	}
+	return data, true, nil
+}
+
+// ReceivePayload is used to take a payload of any content type from the named queue, ok is false if the queue is empty
+func (c *Client[T]) ReceivePayload(ctx context.Context, queue string) (payload model.Payload, ok bool, err error) {
+	err = c.do(ctx, false, func(leader string) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, leader+"/recieve?"+url.Values{"queue": {queue}}.Encode(), nil)
+	}, func(resp *http.Response) error {
+		// Payloads that are not JSON are returned as is
+		contentType := resp.Header.Get("Content-Type")
+		if !model.IsJSONContentType(contentType) {
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return fmt.Errorf("failed to read message: %w", err)
+			}
+			payload, ok = model.NewPayload(contentType, body), true
+			return nil
+		}
+
+		var body struct {
+			Data  json.RawMessage
+			Empty bool
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		if !body.Empty {
+			payload, ok = model.Payload{ContentType: model.JSONContentType, Body: body.Data}, true
+		}
+		return nil
+	})
+
+	// A queue that was never sent to is empty
+	var e *model.Error
+	if errors.As(err, &e) && e.Code == model.CodeQueueNotFound {
+		return model.Payload{}, false, nil
+	}
+	return payload, ok, err
+}
+
+// Cluster is used to get the nodes of the cluster and its leader, as known by the first node that responds
+func (c *Client[T]) Cluster(ctx context.Context) (model.Cluster, error) {
+	c.lock.Lock()
+	nodes := append([]string(nil), c.nodes...)
+	c.lock.Unlock()
+
+	var errs []error
+	for _, node := range nodes {
+		cluster, err := c.cluster(ctx, node)
+		if err == nil {
+			return cluster, nil
+		}
+		errs = append(errs, err)
+	}
+	return model.Cluster{}, errors.Join(errs...)
+}
+
+// cluster is used to get the cluster as known by a node
+func (c *Client[T]) cluster(ctx context.Context, node string) (model.Cluster, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, node+"/cluster", nil)
+	if err != nil {
+		return model.Cluster{}, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return model.Cluster{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return model.Cluster{}, readError(resp)
+	}
+
+	var cluster model.Cluster
+	if err := json.NewDecoder(resp.Body).Decode(&cluster); err != nil {
+		return model.Cluster{}, fmt.Errorf("failed to decode cluster: %w", err)
+	}
+	return cluster, nil
+}
+
+// discover is used to find the leader from the known nodes, the nodes of the cluster are remembered along the way
+func (c *Client[T]) discover(ctx context.Context) (string, error) {
+	c.lock.Lock()
+	leader := c.leader
+	nodes := append([]string(nil), c.nodes...)
+	c.lock.Unlock()
+
+	if leader != "" {
+		return leader, nil
+	}
+
+	for _, node := range nodes {
+		cluster, err := c.cluster(ctx, node)
+		if err != nil {
+			continue
+		}
+
+		c.lock.Lock()
+		for _, n := range cluster.Nodes {
+			if n.Address != "" {
+				c.addNode(baseURL(n.Address))
+			}
+		}
+		if cluster.Leader != "" {
+			c.leader = baseURL(cluster.Leader)
+			leader = c.leader
+		}
+		c.lock.Unlock()
+
+		if leader != "" {
+			return leader, nil
+		}
+	}
+	return "", ErrNoLeader
+}
+
+// follow is used to forget the current leader, and to use the leader hinted by a failed request if any
+func (c *Client[T]) follow(failed string, hint string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.leader != failed {
+		return
+	}
+	c.leader = ""
+	if hint != "" && baseURL(hint) != failed {
+		c.leader = baseURL(hint)
+		c.addNode(c.leader)
+	}
+}
+
+// do is used to make a request to the leader, retrying with backoff while it fails with a transient error
+// Requests that are not idempotent are only retried if they are known not to have taken effect
+func (c *Client[T]) do(ctx context.Context, idempotent bool, newRequest func(leader string) (*http.Request, error), handle func(*http.Response) error) error {
+	var err error
+	for attempt := 0; attempt < c.attempts; attempt++ {
+		if attempt > 0 {
+			if sleepErr := sleep(ctx, c.backoff(attempt)); sleepErr != nil {
+				return errors.Join(sleepErr, err)
+			}
+		}
+
+		var retry bool
+		retry, err = c.try(ctx, idempotent, newRequest, handle)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// try is used to make a single attempt of a request, it reports whether the error can be retried
+func (c *Client[T]) try(ctx context.Context, idempotent bool, newRequest func(leader string) (*http.Request, error), handle func(*http.Response) error) (bool, error) {
+	leader, err := c.discover(ctx)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+
+	req, err := newRequest(leader)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// The request was not sent if the connection could not be made, so any request can be retried
+		c.follow(leader, "")
+		var opErr *net.OpError
+		sent := !errors.As(err, &opErr) || opErr.Op != "dial"
+		return ctx.Err() == nil && (idempotent || !sent), err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		err := readError(resp)
+		var e *model.Error
+		if !errors.As(err, &e) {
+			return false, err
+		}
+		if e.Code.Retryable() || e.Code.MayHaveApplied() {
+			c.follow(leader, e.Leader)
+		}
+		return e.Code.Retryable() || (idempotent && e.Code.MayHaveApplied()), err
+	}
+
+	if handle == nil {
+		return false, nil
+	}
+	return false, handle(resp)
+}
+
+// readError is used to read the error of a failed response
+func readError(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("request failed with status %d: %w", resp.StatusCode, err)
+	}
+
+	e := &model.Error{}
+	if err := json.Unmarshal(body, e); err != nil || e.Code == "" {
+		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return e
+}
+
+// backoff is used to get the delay before a retry, with jitter so that clients do not retry in lockstep
+func (c *Client[T]) backoff(attempt int) time.Duration {
+	delay := float64(c.minBackoff) * math.Pow(2, float64(attempt-1))
+	if delay > float64(c.maxBackoff) {
+		delay = float64(c.maxBackoff)
+	}
+	return time.Duration(delay/2 + mathrand.Float64()*delay/2)
+}
+
+// sleep is used to wait for the delay unless the context is done first
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// newKey is used to generate a random idempotency key
+func newKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
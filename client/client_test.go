@@ -0,0 +1,419 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/model"
+	"github.com/kavinaravind/go-raft-message-queue/server"
+	"github.com/kavinaravind/go-raft-message-queue/testcluster"
+)
+
+type order struct {
+	ID    int    `json:"id"`
+	Item  string `json:"item"`
+	Notes string `json:"notes,omitempty"`
+}
+
+// setup is used to start a cluster with an HTTP server for every node, whose addresses are registered with the cluster
+func setup(t *testing.T, n int) (*testcluster.Cluster[model.Payload], []string) {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cluster := testcluster.New[model.Payload](t, n, testcluster.WithLogger(logger))
+
+	var addresses []string
+	for _, node := range cluster.Nodes() {
+		srv := httptest.NewServer(server.NewServer(node.Store, logger).Handler())
+		t.Cleanup(srv.Close)
+		addresses = append(addresses, srv.Listener.Addr().String())
+	}
+
+	leader := cluster.Leader()
+	for i, node := range cluster.Nodes() {
+		if err := leader.Store.RegisterMember(node.ID, addresses[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cluster.WaitForReplication()
+
+	return cluster, addresses
+}
+
+// addressOf is used to get the HTTP address of a node of the cluster
+func addressOf(cluster *testcluster.Cluster[model.Payload], addresses []string, node *testcluster.Node[model.Payload]) string {
+	for i, n := range cluster.Nodes() {
+		if n == node {
+			return addresses[i]
+		}
+	}
+	return ""
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+	cluster, addresses := setup(t, 3)
+	ctx := context.Background()
+
+	// The leader is discovered from a follower
+	c := New[order]([]string{addressOf(cluster, addresses, cluster.Followers()[0])})
+
+	t.Run("Send and Receive", func(t *testing.T) {
+		sent := []order{{ID: 1, Item: "apple"}, {ID: 2, Item: "pear", Notes: "ripe"}, {}}
+		for _, o := range sent {
+			if err := c.Send(ctx, "orders", o); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		}
+
+		for _, expected := range sent {
+			o, ok, err := c.Receive(ctx, "orders")
+			if err != nil || !ok {
+				t.Fatalf("expected a message, got ok %t and error %v", ok, err)
+			}
+			if o != expected {
+				t.Errorf("expected %v, got %v", expected, o)
+			}
+		}
+
+		if _, ok, err := c.Receive(ctx, "orders"); err != nil || ok {
+			t.Errorf("expected the queue to be empty, got ok %t and error %v", ok, err)
+		}
+		if _, ok, err := c.Receive(ctx, "missing"); err != nil || ok {
+			t.Errorf("expected a queue never sent to to be empty, got ok %t and error %v", ok, err)
+		}
+	})
+
+	t.Run("SendIdempotent", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if err := c.SendIdempotent(ctx, "idempotent", "key", order{ID: i}); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		}
+
+		if o, ok, err := c.Receive(ctx, "idempotent"); err != nil || !ok || o.ID != 0 {
+			t.Fatalf("expected the first message, got %v, ok %t and error %v", o, ok, err)
+		}
+		if _, ok, err := c.Receive(ctx, "idempotent"); err != nil || ok {
+			t.Errorf("expected the retries not to be enqueued, got ok %t and error %v", ok, err)
+		}
+	})
+
+	t.Run("Cluster", func(t *testing.T) {
+		cl, err := c.Cluster(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		leader := cluster.Leader()
+		if cl.LeaderID != leader.ID || cl.Leader != addressOf(cluster, addresses, leader) {
+			t.Errorf("expected the leader %s, got %s at %s", leader.ID, cl.LeaderID, cl.Leader)
+		}
+		if len(cl.Nodes) != 3 {
+			t.Errorf("expected 3 nodes, got %v", cl.Nodes)
+		}
+	})
+}
+
+func TestClientFailover(t *testing.T) {
+	t.Parallel()
+	cluster, addresses := setup(t, 3)
+	ctx := context.Background()
+	c := New[order](addresses, WithBackoff(10*time.Millisecond, 100*time.Millisecond))
+
+	if err := c.Send(ctx, "orders", order{ID: 1}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	// The client finds the new leader once the old one is gone
+	cluster.Kill(cluster.Leader())
+	if err := c.Send(ctx, "orders", order{ID: 2}); err != nil {
+		t.Fatalf("expected the send to be retried against the new leader, got: %v", err)
+	}
+
+	for _, id := range []int{1, 2} {
+		o, ok, err := c.Receive(ctx, "orders")
+		if err != nil || !ok || o.ID != id {
+			t.Fatalf("expected order %d, got %v, ok %t and error %v", id, o, ok, err)
+		}
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	// No node can be reached, so there is no leader to send to
+	c := New[order]([]string{"127.0.0.1:1"}, WithRetries(2), WithBackoff(time.Millisecond, time.Millisecond))
+	if err := c.Send(ctx, "orders", order{}); !errors.Is(err, ErrNoLeader) {
+		t.Errorf("expected %v, got: %v", ErrNoLeader, err)
+	}
+
+	// Errors that cannot be retried are returned as is
+	_, addresses := setup(t, 1)
+	c = New[order](addresses)
+	if err := c.Ack(ctx, Entry[order]{Stream: "orders"}); err == nil {
+		t.Error("expected a commit without a group to fail")
+	} else if e := (*model.Error)(nil); !errors.As(err, &e) || e.Code != model.CodeBadRequest {
+		t.Errorf("expected a %s error, got: %v", model.CodeBadRequest, err)
+	}
+
+	// A done context stops the retries
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := c.Receive(cancelled, "orders"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got: %v", context.Canceled, err)
+	}
+}
+
+func TestClientShuttingDown(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	// The node is the leader, but fails every request as it is shutting down
+	var attempts atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cluster" {
+			json.NewEncoder(w).Encode(model.Cluster{Leader: srv.Listener.Addr().String()})
+			return
+		}
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(model.Error{Code: model.CodeShuttingDown, Message: "node is shutting down"})
+	}))
+	t.Cleanup(srv.Close)
+	c := New[order]([]string{srv.Listener.Addr().String()}, WithRetries(3), WithBackoff(time.Millisecond, time.Millisecond))
+
+	// The receive may have been committed before the node stopped, so retrying it could lose a message
+	if _, _, err := c.Receive(ctx, "orders"); err == nil {
+		t.Fatal("expected the receive to fail")
+	} else if e := (*model.Error)(nil); !errors.As(err, &e) || e.Code != model.CodeShuttingDown {
+		t.Errorf("expected a %s error, got: %v", model.CodeShuttingDown, err)
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("expected the receive not to be retried, got %d attempts", n)
+	}
+
+	// An idempotent send is retried until the retries run out
+	attempts.Store(0)
+	if err := c.Send(ctx, "orders", order{ID: 1}); err == nil {
+		t.Fatal("expected the send to fail")
+	}
+	if n := attempts.Load(); n != 4 {
+		t.Errorf("expected the send to be retried, got %d attempts", n)
+	}
+}
+
+func TestClientSubscribe(t *testing.T) {
+	t.Parallel()
+	_, addresses := setup(t, 3)
+	ctx := context.Background()
+	c := New[order](addresses, WithPollInterval(10*time.Millisecond))
+
+	for i := 0; i < 5; i++ {
+		if offset, err := c.Append(ctx, "orders", order{ID: i}); err != nil || offset != uint64(i) {
+			t.Fatalf("expected offset %d, got %d and error %v", i, offset, err)
+		}
+	}
+
+	// The first subscription acknowledges three entries and stops
+	done := errors.New("done")
+	var received []int
+	err := c.Subscribe(ctx, "orders", "billing", func(entry Entry[order]) error {
+		received = append(received, entry.Data.ID)
+		if err := c.Ack(ctx, entry); err != nil {
+			return err
+		}
+		if len(received) == 3 {
+			return done
+		}
+		return nil
+	})
+	if !errors.Is(err, done) {
+		t.Fatalf("expected the handler error, got: %v", err)
+	}
+
+	// The next one continues after the last entry acknowledged, and sees entries as they are appended
+	subscribeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	go func() {
+		if _, err := c.Append(ctx, "orders", order{ID: 5}); err != nil {
+			t.Errorf("expected no error, got: %v", err)
+		}
+	}()
+	err = c.Subscribe(subscribeCtx, "orders", "billing", func(entry Entry[order]) error {
+		received = append(received, entry.Data.ID)
+		if len(received) == 6 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the subscription to stop with the context, got: %v", err)
+	}
+
+	for i, id := range received {
+		if id != i {
+			t.Fatalf("expected the entries 0 to 5 in order, got %v", received)
+		}
+	}
+}
+
+func TestClientAdmin(t *testing.T) {
+	t.Parallel()
+	cluster, addresses := setup(t, 3)
+	ctx := context.Background()
+	c := New[order](addresses, WithBackoff(10*time.Millisecond, 100*time.Millisecond))
+
+	t.Run("Queues", func(t *testing.T) {
+		if created, err := c.CreateQueue(ctx, "orders"); err != nil || !created {
+			t.Fatalf("expected the queue to be created, got %t and error %v", created, err)
+		}
+		if created, err := c.CreateQueue(ctx, "orders"); err != nil || created {
+			t.Errorf("expected the queue to exist already, got %t and error %v", created, err)
+		}
+
+		if err := c.Send(ctx, "orders", order{ID: 1}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if err := c.SendPayload(ctx, "orders", model.NewPayload("text/plain", []byte("hello"))); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		queues, err := c.Queues(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(queues) != 2 || queues[0] != (model.QueueInfo{Name: "default"}) || queues[1] != (model.QueueInfo{Name: "orders", Depth: 2}) {
+			t.Errorf("expected the default queue and 2 orders, got %v", queues)
+		}
+
+		// Peeked payloads keep their content type, and are left in the queue
+		payloads, err := c.Peek(ctx, "orders", 10)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(payloads) != 2 || string(payloads[0].Body) != `{"id":1,"item":""}` || payloads[1].ContentType != "text/plain" || string(payloads[1].Body) != "hello" {
+			t.Errorf("expected the order and the text, got %v", payloads)
+		}
+
+		if purged, err := c.PurgeQueue(ctx, "orders"); err != nil || purged != 2 {
+			t.Errorf("expected 2 messages purged, got %d and error %v", purged, err)
+		}
+		if err := c.DeleteQueue(ctx, "orders"); err != nil {
+			t.Errorf("expected no error, got: %v", err)
+		}
+
+		var e *model.Error
+		if _, err := c.Peek(ctx, "orders", 10); !errors.As(err, &e) || e.Code != model.CodeQueueNotFound {
+			t.Errorf("expected a %s error, got: %v", model.CodeQueueNotFound, err)
+		}
+	})
+
+	t.Run("TransferLeadership", func(t *testing.T) {
+		target := cluster.Followers()[0]
+		if err := c.TransferLeadership(ctx, target.ID); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		cl, err := c.Cluster(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if cl.LeaderID != target.ID {
+			t.Errorf("expected %s to lead, got %s", target.ID, cl.LeaderID)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		removed := cluster.Followers()[0]
+		if err := c.Remove(ctx, removed.ID); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		var e *model.Error
+		if err := c.Remove(ctx, removed.ID); !errors.As(err, &e) || e.Code != model.CodeNodeNotFound {
+			t.Errorf("expected a %s error, got: %v", model.CodeNodeNotFound, err)
+		}
+
+		cl, err := c.Cluster(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		for _, node := range cl.Nodes {
+			if node.ID == removed.ID {
+				t.Errorf("expected %s to be removed, got %v", removed.ID, cl.Nodes)
+			}
+		}
+	})
+}
+
+func TestClientBackup(t *testing.T) {
+	t.Parallel()
+	source, sourceAddresses := setup(t, 3)
+	target, targetAddresses := setup(t, 3)
+	ctx := context.Background()
+
+	// Both are sent through a follower, and reach the leader of their cluster
+	from := New[order]([]string{addressOf(source, sourceAddresses, source.Followers()[0])})
+	to := New[order]([]string{addressOf(target, targetAddresses, target.Followers()[0])})
+
+	for i := 1; i <= 3; i++ {
+		if err := from.Send(ctx, "orders", order{ID: i, Item: "book"}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	if err := to.Send(ctx, "orders", order{ID: 99}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	var backup bytes.Buffer
+	written, err := from.Backup(ctx, &backup)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if written == 0 || written != int64(backup.Len()) {
+		t.Errorf("expected %d bytes written, got %d", backup.Len(), written)
+	}
+
+	if err := to.Restore(ctx, bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	target.WaitForReplication()
+
+	// Every node of the new cluster holds the backed up state
+	leader := target.Leader()
+	expected, _ := leader.Store.StateHash()
+	for _, node := range target.Followers() {
+		if current, _ := node.Store.StateHash(); current.String() != expected.String() {
+			t.Errorf("expected %s to have the state hash %s, got %s", node.ID, expected, current)
+		}
+	}
+
+	// A follower that takes over serves the restored messages
+	if err := to.TransferLeadership(ctx, target.Followers()[0].ID); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	payloads, err := to.Peek(ctx, "orders", 10)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(payloads) != 3 || string(payloads[0].Body) != `{"id":1,"item":"book"}` {
+		t.Errorf("expected the 3 backed up orders, got %v", payloads)
+	}
+
+	var e *model.Error
+	if err := to.Restore(ctx, strings.NewReader("not a backup")); !errors.As(err, &e) || e.Code != model.CodeBadRequest {
+		t.Errorf("expected a %s error, got: %v", model.CodeBadRequest, err)
+	}
+}
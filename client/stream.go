@@ -0,0 +1,133 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/model"
+)
+
+// Entry is an entry of a stream delivered to a subscription
+type Entry[T any] struct {
+	// Stream and Group are the stream the entry was read from and the consumer group it was delivered to
+	Stream string
+	Group  string
+
+	// Offset is the position of the entry in the stream
+	Offset uint64
+
+	// Timestamp is the time the entry was appended
+	Timestamp time.Time
+
+	// Data is the message of the entry
+	Data T
+}
+
+// Ack is used to commit an entry and every entry before it for the consumer group of the entry
+// A subscription of the group that restarts continues after the last entry acknowledged
+func (c *Client[T]) Ack(ctx context.Context, entry Entry[T]) error {
+	body, err := json.Marshal(map[string]any{"group": entry.Group, "offset": entry.Offset + 1})
+	if err != nil {
+		return err
+	}
+
+	// Committing an offset sets it, so the commit is idempotent
+	return c.do(ctx, true, func(leader string) (*http.Request, error) {
+		return newJSONRequest(ctx, leader+"/stream/commit?"+url.Values{"stream": {entry.Stream}}.Encode(), body)
+	}, nil)
+}
+
+// Subscribe is used to deliver the entries of the stream to the handler, in order, as they are appended
+// Delivery starts after the last entry acknowledged by the consumer group, or at the oldest retained entry
+// Entries are delivered at least once, an entry that is not acknowledged is delivered again once the subscription restarts
+// It blocks until the context is done or the handler returns an error, which is returned
+func (c *Client[T]) Subscribe(ctx context.Context, stream, group string, handler func(Entry[T]) error) error {
+	if group == "" {
+		return errors.New("missing group")
+	}
+
+	// The first read starts at the committed offset of the group, the following ones where the last one ended
+	query := url.Values{"stream": {stream}, "group": {group}}
+	for {
+		var entries []Entry[T]
+		var next uint64
+		err := c.do(ctx, true, func(leader string) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, http.MethodGet, leader+"/stream/read?"+query.Encode(), nil)
+		}, func(resp *http.Response) error {
+			var body struct {
+				Entries []struct {
+					Offset    uint64
+					Timestamp time.Time
+					Data      json.RawMessage
+				}
+				Next uint64
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				return fmt.Errorf("failed to decode entries: %w", err)
+			}
+
+			entries = make([]Entry[T], 0, len(body.Entries))
+			for _, e := range body.Entries {
+				entry := Entry[T]{Stream: stream, Group: group, Offset: e.Offset, Timestamp: e.Timestamp}
+				if err := json.Unmarshal(e.Data, &entry.Data); err != nil {
+					return fmt.Errorf("failed to decode entry %d: %w", e.Offset, err)
+				}
+				entries = append(entries, entry)
+			}
+			next = body.Next
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if err := handler(entry); err != nil {
+				return err
+			}
+		}
+
+		query = url.Values{"stream": {stream}, "offset": {strconv.FormatUint(next, 10)}}
+		if len(entries) == 0 {
+			if err := sleep(ctx, c.pollInterval); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Append is used to append a message to the named stream, and returns the offset of the entry
+// An append is only retried when it is known not to have taken effect, as it would otherwise be appended twice
+func (c *Client[T]) Append(ctx context.Context, stream string, data T) (uint64, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	var offset uint64
+	err = c.do(ctx, false, func(leader string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, leader+"/stream/append?"+url.Values{"stream": {stream}}.Encode(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", model.JSONContentType)
+		return req, nil
+	}, func(resp *http.Response) error {
+		var body struct {
+			Offset uint64
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return fmt.Errorf("failed to decode offset: %w", err)
+		}
+		offset = body.Offset
+		return nil
+	})
+	return offset, err
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/model"
+)
+
+// runSend is used to send a message read from a file or stdin
+// Without a content type, messages that are valid JSON are sent as JSON
+func runSend(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	queue := flags.String("queue", "", "The queue to send to, the default queue if empty")
+	file := flags.String("file", "", "The file to read the message from, stdin if empty or -")
+	contentType := flags.String("content-type", "", "The content type of the message")
+	key := flags.String("key", "", "The idempotency key of the message, a random key if empty")
+	if err := e.parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	var body []byte
+	var err error
+	if *file == "" || *file == "-" {
+		body, err = io.ReadAll(e.stdin)
+	} else {
+		body, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+
+	ctx, cancel := e.request(ctx)
+	defer cancel()
+
+	payload := model.Payload{ContentType: *contentType, Body: body}
+	if *key == "" {
+		err = e.client.SendPayload(ctx, *queue, payload)
+	} else {
+		err = e.client.SendPayloadIdempotent(ctx, *queue, *key, payload)
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.out.result(struct {
+		Sent bool `json:"sent"`
+	}{true}, "")
+}
+
+// runReceive is used to take up to n messages from a queue, stopping early once it is empty
+func runReceive(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("receive", flag.ContinueOnError)
+	queue := flags.String("queue", "", "The queue to receive from, the default queue if empty")
+	n := flags.Int("n", 1, "The maximum number of messages to receive")
+	if err := e.parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	if *n <= 0 {
+		return errUsage
+	}
+
+	ctx, cancel := e.request(ctx)
+	defer cancel()
+
+	var messages []message
+	for len(messages) < *n {
+		payload, ok, err := e.client.ReceivePayload(ctx, *queue)
+		if err != nil {
+			// The messages already taken are lost if they are not printed
+			_ = e.out.messages(messages)
+			return err
+		}
+		if !ok {
+			break
+		}
+		messages = append(messages, newMessage(payload))
+	}
+	return e.out.messages(messages)
+}
+
+// runTail is used to take messages from a queue as they arrive, until interrupted
+func runTail(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	queue := flags.String("queue", "", "The queue to receive from, the default queue if empty")
+	interval := flags.Duration("interval", time.Second, "The time to wait before polling an empty queue again")
+	if err := e.parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	for {
+		reqCtx, cancel := e.request(ctx)
+		payload, ok, err := e.client.ReceivePayload(reqCtx, *queue)
+		cancel()
+
+		// A message taken before the interrupt is printed, as it is lost otherwise
+		if err == nil && ok {
+			if err := e.out.line(newMessage(payload)); err != nil {
+				return err
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// runPeek is used to show messages at the front of a queue without taking them
+func runPeek(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("peek", flag.ContinueOnError)
+	queue := flags.String("queue", "", "The queue to peek, the default queue if empty")
+	max := flags.Int("max", 10, "The maximum number of messages to show")
+	if err := e.parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	if *max <= 0 {
+		return errUsage
+	}
+
+	ctx, cancel := e.request(ctx)
+	defer cancel()
+
+	payloads, err := e.client.Peek(ctx, *queue, *max)
+	if err != nil {
+		return err
+	}
+
+	messages := make([]message, 0, len(payloads))
+	for _, payload := range payloads {
+		messages = append(messages, newMessage(payload))
+	}
+	return e.out.messages(messages)
+}
+
+// runPurge is used to delete every message of a queue
+func runPurge(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	queue := flags.String("queue", "", "The queue to purge, the default queue if empty")
+	if err := e.parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	ctx, cancel := e.request(ctx)
+	defer cancel()
+
+	purged, err := e.client.PurgeQueue(ctx, *queue)
+	if err != nil {
+		return err
+	}
+
+	return e.out.result(struct {
+		Purged int `json:"purged"`
+	}{purged}, fmt.Sprintf("Purged %d messages", purged))
+}
+
+// runQueue is used to create, list or delete queues
+func runQueue(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	ctx, cancel := e.request(ctx)
+	defer cancel()
+
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return errUsage
+		}
+		queues, err := e.client.Queues(ctx)
+		if err != nil {
+			return err
+		}
+		if queues == nil {
+			queues = []model.QueueInfo{}
+		}
+
+		rows := make([][]string, 0, len(queues))
+		for _, queue := range queues {
+			rows = append(rows, []string{queue.Name, strconv.Itoa(queue.Depth)})
+		}
+		return e.out.table(queues, []string{"NAME", "DEPTH"}, rows)
+	case "create":
+		if len(args) != 2 {
+			return errUsage
+		}
+		created, err := e.client.CreateQueue(ctx, args[1])
+		if err != nil {
+			return err
+		}
+
+		text := "Created queue " + args[1]
+		if !created {
+			text = "Queue " + args[1] + " already exists"
+		}
+		return e.out.result(struct {
+			Created bool `json:"created"`
+		}{created}, text)
+	case "delete":
+		if len(args) != 2 {
+			return errUsage
+		}
+		if err := e.client.DeleteQueue(ctx, args[1]); err != nil {
+			return err
+		}
+		return e.out.result(struct {
+			Deleted bool `json:"deleted"`
+		}{true}, "Deleted queue "+args[1])
+	default:
+		return errUsage
+	}
+}
+
+// runCluster is used to show the nodes of the cluster, add or remove a node, or transfer leadership
+func runCluster(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	ctx, cancel := e.request(ctx)
+	defer cancel()
+
+	switch args[0] {
+	case "status":
+		if len(args) != 1 {
+			return errUsage
+		}
+		cluster, err := e.client.Cluster(ctx)
+		if err != nil {
+			return err
+		}
+
+		rows := make([][]string, 0, len(cluster.Nodes))
+		for _, node := range cluster.Nodes {
+			rows = append(rows, []string{node.ID, node.Address, node.RaftAddress, strconv.FormatBool(node.Voter), strconv.FormatBool(node.Leader)})
+		}
+		return e.out.table(cluster, []string{"ID", "ADDRESS", "RAFT ADDRESS", "VOTER", "LEADER"}, rows)
+	case "join":
+		if len(args) != 3 && len(args) != 4 {
+			return errUsage
+		}
+		var httpAddress string
+		if len(args) == 4 {
+			httpAddress = args[3]
+		}
+		if err := e.client.Join(ctx, args[1], args[2], httpAddress); err != nil {
+			return err
+		}
+		return e.out.result(struct {
+			Joined bool `json:"joined"`
+		}{true}, "Node "+args[1]+" joined the cluster")
+	case "remove":
+		if len(args) != 2 {
+			return errUsage
+		}
+		if err := e.client.Remove(ctx, args[1]); err != nil {
+			return err
+		}
+		return e.out.result(struct {
+			Removed bool `json:"removed"`
+		}{true}, "Node "+args[1]+" removed from the cluster")
+	case "transfer":
+		if len(args) > 2 {
+			return errUsage
+		}
+		var id string
+		if len(args) == 2 {
+			id = args[1]
+		}
+		if err := e.client.TransferLeadership(ctx, id); err != nil {
+			return err
+		}
+		return e.out.result(struct {
+			Transferred bool `json:"transferred"`
+		}{true}, "Leadership transferred")
+	default:
+		return errUsage
+	}
+}
+
+// runBackup is used to write a backup of the state of the cluster to a file or stdout
+// The file is only replaced once the whole backup has been written
+func runBackup(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	file := flags.String("file", "", "The file to write the backup to, stdout if empty or -")
+	if err := e.parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	ctx, cancel := e.request(ctx)
+	defer cancel()
+
+	if *file == "" || *file == "-" {
+		_, err := e.client.Backup(ctx, e.out.w)
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(*file), filepath.Base(*file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	written, err := e.client.Backup(ctx, tmp)
+	if err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), *file); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	return e.out.result(struct {
+		File  string `json:"file"`
+		Bytes int64  `json:"bytes"`
+	}{*file, written}, fmt.Sprintf("Wrote backup of %d bytes to %s", written, *file))
+}
+
+// runRestore is used to replace the state of the cluster with a backup read from a file or stdin
+func runRestore(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	file := flags.String("file", "", "The file to read the backup from, stdin if empty or -")
+	if err := e.parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	// The backup is sent again on a retry, so stdin is read in full first
+	var backup io.ReadSeeker
+	if *file == "" || *file == "-" {
+		data, err := io.ReadAll(e.stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		backup = bytes.NewReader(data)
+	} else {
+		f, err := os.Open(*file)
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		defer f.Close()
+		backup = f
+	}
+
+	ctx, cancel := e.request(ctx)
+	defer cancel()
+
+	if err := e.client.Restore(ctx, backup); err != nil {
+		return err
+	}
+
+	return e.out.result(struct {
+		Restored bool `json:"restored"`
+	}{true}, "Restored backup")
+}
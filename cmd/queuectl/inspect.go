@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/consensus"
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+	"github.com/kavinaravind/go-raft-message-queue/model"
+	"github.com/kavinaravind/go-raft-message-queue/store"
+)
+
+// legacyUpgrader converts the comments held by logs and snapshots written before opaque payloads to JSON payloads
+var legacyUpgrader = store.NewLegacyUpgrader(model.UpgradeLegacyPayload, model.LegacyData.Payload)
+
+// runInspect is used to read the raft state a node keeps in its directory, without starting raft or reaching the cluster
+func runInspect(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	flags := flag.NewFlagSet("inspect "+args[0], flag.ContinueOnError)
+	dir := flags.String("dir", "/tmp", "The base directory the node stores its Raft data in")
+	logStore := flags.String("log-store", string(consensus.LogStoreBolt), "The backend the node stores the Raft log with (bolt or wal)")
+
+	var inspect func(stores *consensus.Stores) error
+	switch args[0] {
+	case "state":
+		inspect = func(stores *consensus.Stores) error {
+			return inspectState(e, stores)
+		}
+	case "log":
+		from := flags.Uint64("from", 0, "The index of the first entry, the first entry of the log if 0")
+		n := flags.Int("n", 0, "The maximum number of entries, every entry if 0")
+		inspect = func(stores *consensus.Stores) error {
+			return inspectLog(e, stores.Log, *from, *n)
+		}
+	case "snapshots":
+		inspect = func(stores *consensus.Stores) error {
+			return inspectSnapshots(e, stores.Snapshots)
+		}
+	case "snapshot":
+		id := flags.String("id", "", "The id of the snapshot, the latest if empty")
+		inspect = func(stores *consensus.Stores) error {
+			return inspectSnapshot(e, stores.Snapshots, *id)
+		}
+	default:
+		return errUsage
+	}
+	if err := e.parse(flags, args[1:], 0, 0); err != nil {
+		return err
+	}
+
+	backend, err := consensus.ParseLogStore(*logStore)
+	if err != nil {
+		return err
+	}
+	stores, closer, err := consensus.OpenStores(backend, *dir)
+	if err != nil {
+		return fmt.Errorf("failed to open the raft data: %w", err)
+	}
+	defer closer.Close()
+
+	return inspect(stores)
+}
+
+// stableState is the output model of the state raft keeps in the stable store, along with the range of the log
+type stableState struct {
+	CurrentTerm       uint64 `json:"current_term"`
+	LastVoteTerm      uint64 `json:"last_vote_term"`
+	LastVoteCandidate string `json:"last_vote_candidate"`
+	FirstIndex        uint64 `json:"first_index"`
+	LastIndex         uint64 `json:"last_index"`
+}
+
+// inspectState is used to print the term and vote of the node and the range of its log
+func inspectState(e *env, stores *consensus.Stores) error {
+	stable, err := consensus.ReadStableState(stores.Stable)
+	if err != nil {
+		return err
+	}
+	state := stableState{CurrentTerm: stable.CurrentTerm, LastVoteTerm: stable.LastVoteTerm, LastVoteCandidate: stable.LastVoteCandidate}
+	if state.FirstIndex, err = stores.Log.FirstIndex(); err != nil {
+		return err
+	}
+	if state.LastIndex, err = stores.Log.LastIndex(); err != nil {
+		return err
+	}
+
+	return e.out.table(state, []string{"CURRENT TERM", "LAST VOTE TERM", "LAST VOTE", "FIRST INDEX", "LAST INDEX"}, [][]string{{
+		strconv.FormatUint(state.CurrentTerm, 10),
+		strconv.FormatUint(state.LastVoteTerm, 10),
+		state.LastVoteCandidate,
+		strconv.FormatUint(state.FirstIndex, 10),
+		strconv.FormatUint(state.LastIndex, 10),
+	}})
+}
+
+// logEntry is the output model of an entry of the raft log
+type logEntry struct {
+	Index         uint64           `json:"index"`
+	Term          uint64           `json:"term"`
+	Type          string           `json:"type"`
+	AppendedAt    *time.Time       `json:"appended_at,omitempty"`
+	Command       *logCommand      `json:"command,omitempty"`
+	Configuration []snapshotServer `json:"configuration,omitempty"`
+	Error         string           `json:"error,omitempty"`
+}
+
+// logCommand is the output model of a command of the store decoded from a log entry
+type logCommand struct {
+	Encoding      string           `json:"encoding"`
+	Operation     string           `json:"operation"`
+	Queue         string           `json:"queue,omitempty"`
+	Stream        string           `json:"stream,omitempty"`
+	Group         string           `json:"group,omitempty"`
+	Offset        uint64           `json:"offset,omitempty"`
+	Key           string           `json:"key,omitempty"`
+	Message       *message         `json:"message,omitempty"`
+	Retention     *ds.Retention    `json:"retention,omitempty"`
+	Schema        json.RawMessage  `json:"schema,omitempty"`
+	Compatibility string           `json:"compatibility,omitempty"`
+	Timestamp     time.Time        `json:"timestamp"`
+	Hash          *store.StateHash `json:"hash,omitempty"`
+	Member        *store.Member    `json:"member,omitempty"`
+}
+
+// inspectLog is used to print up to n entries of the raft log starting at the given index
+func inspectLog(e *env, log raft.LogStore, from uint64, n int) error {
+	first, err := log.FirstIndex()
+	if err != nil {
+		return err
+	}
+	last, err := log.LastIndex()
+	if err != nil {
+		return err
+	}
+	if from < first {
+		from = first
+	}
+
+	entries := []logEntry{}
+	rows := [][]string{}
+	for index := from; index != 0 && index <= last && (n == 0 || len(entries) < n); index++ {
+		var l raft.Log
+		if err := log.GetLog(index, &l); err != nil {
+			return fmt.Errorf("failed to read entry %d: %w", index, err)
+		}
+
+		entry := newLogEntry(&l)
+		entries = append(entries, entry)
+		rows = append(rows, []string{strconv.FormatUint(entry.Index, 10), strconv.FormatUint(entry.Term, 10), entry.Type, entry.summary()})
+	}
+	return e.out.table(entries, []string{"INDEX", "TERM", "TYPE", "CONTENT"}, rows)
+}
+
+// newLogEntry is used to render an entry of the raft log, decoding its command or configuration
+func newLogEntry(l *raft.Log) logEntry {
+	entry := logEntry{Index: l.Index, Term: l.Term, Type: l.Type.String()}
+	if !l.AppendedAt.IsZero() {
+		entry.AppendedAt = &l.AppendedAt
+	}
+
+	switch l.Type {
+	case raft.LogCommand:
+		c, err := store.DecodeLogCommand(l.Data, legacyUpgrader)
+		if err != nil {
+			entry.Error = err.Error()
+			break
+		}
+		entry.Command = newLogCommand(c)
+	case raft.LogConfiguration:
+		configuration, err := decodeConfiguration(l.Data)
+		if err != nil {
+			entry.Error = err.Error()
+			break
+		}
+		entry.Configuration = newSnapshotServers(configuration)
+	}
+	return entry
+}
+
+// decodeConfiguration is used to decode a configuration entry, which raft panics on if it is corrupt
+func decodeConfiguration(data []byte) (configuration raft.Configuration, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid configuration: %v", r)
+		}
+	}()
+	return raft.DecodeConfiguration(data), nil
+}
+
+// newLogCommand is used to render a command, with the fields its operation uses
+func newLogCommand(c *store.LogCommand[model.Payload]) *logCommand {
+	rendered := &logCommand{
+		Encoding:      c.Encoding.String(),
+		Operation:     store.OperationName(c.Operation),
+		Queue:         c.Queue,
+		Stream:        c.Stream,
+		Group:         c.Group,
+		Offset:        c.Offset,
+		Key:           c.Key,
+		Compatibility: c.Compatibility,
+		Timestamp:     c.Timestamp,
+		Hash:          c.Hash,
+		Member:        c.Member,
+	}
+
+	switch c.Operation {
+	case store.Send, store.Append:
+		m := newMessage(c.Message.Data)
+		rendered.Message = &m
+	case store.Retain:
+		rendered.Retention = &c.Retention
+	case store.RegisterSchema:
+		rendered.Schema = c.Schema
+		if !json.Valid(c.Schema) {
+			rendered.Schema, _ = json.Marshal(c.Schema)
+		}
+	}
+	return rendered
+}
+
+// summary is used to describe the content of the entry on a single line
+func (e logEntry) summary() string {
+	switch {
+	case e.Error != "":
+		return "error: " + e.Error
+	case e.Command != nil:
+		c := e.Command
+		summary := c.Operation
+		for _, field := range []struct{ name, value string }{
+			{"queue", c.Queue},
+			{"stream", c.Stream},
+			{"group", c.Group},
+			{"key", c.Key},
+		} {
+			if field.value != "" {
+				summary += " " + field.name + "=" + field.value
+			}
+		}
+		if c.Offset != 0 {
+			summary += " offset=" + strconv.FormatUint(c.Offset, 10)
+		}
+		if c.Member != nil {
+			summary += " member=" + c.Member.ID + " address=" + c.Member.Address
+		}
+		if c.Message != nil {
+			summary += " " + c.Message.text()
+		}
+		return summary
+	case e.Configuration != nil:
+		summary := "servers="
+		for i, server := range e.Configuration {
+			if i > 0 {
+				summary += ","
+			}
+			summary += server.ID + "@" + server.Address
+		}
+		return summary
+	default:
+		return ""
+	}
+}
+
+// snapshotServer is the output model of a server of a raft configuration
+type snapshotServer struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	Suffrage string `json:"suffrage"`
+}
+
+// newSnapshotServers is used to render the servers of a raft configuration
+func newSnapshotServers(configuration raft.Configuration) []snapshotServer {
+	servers := make([]snapshotServer, 0, len(configuration.Servers))
+	for _, server := range configuration.Servers {
+		servers = append(servers, snapshotServer{ID: string(server.ID), Address: string(server.Address), Suffrage: server.Suffrage.String()})
+	}
+	return servers
+}
+
+// snapshotMeta is the output model of the metadata raft keeps for a snapshot
+type snapshotMeta struct {
+	ID                 string           `json:"id"`
+	Index              uint64           `json:"index"`
+	Term               uint64           `json:"term"`
+	Size               int64            `json:"size"`
+	Version            int              `json:"version"`
+	ConfigurationIndex uint64           `json:"configuration_index"`
+	Configuration      []snapshotServer `json:"configuration"`
+}
+
+// inspectSnapshots is used to print the metadata of the snapshots, the latest first
+func inspectSnapshots(e *env, snapshots raft.SnapshotStore) error {
+	metas, err := snapshots.List()
+	if err != nil {
+		return err
+	}
+
+	rendered := make([]snapshotMeta, 0, len(metas))
+	rows := make([][]string, 0, len(metas))
+	for _, meta := range metas {
+		m := snapshotMeta{
+			ID:                 meta.ID,
+			Index:              meta.Index,
+			Term:               meta.Term,
+			Size:               meta.Size,
+			Version:            int(meta.Version),
+			ConfigurationIndex: meta.ConfigurationIndex,
+			Configuration:      newSnapshotServers(meta.Configuration),
+		}
+		rendered = append(rendered, m)
+		rows = append(rows, []string{m.ID, strconv.FormatUint(m.Index, 10), strconv.FormatUint(m.Term, 10), strconv.FormatInt(m.Size, 10), strconv.Itoa(len(m.Configuration))})
+	}
+	return e.out.table(rendered, []string{"ID", "INDEX", "TERM", "SIZE", "SERVERS"}, rows)
+}
+
+// snapshotContents is the output model of the state held in a snapshot
+type snapshotContents struct {
+	Snapshot        snapshotMeta              `json:"snapshot"`
+	Compression     string                    `json:"compression"`
+	Size            int64                     `json:"size"`
+	CompressedSize  int64                     `json:"compressed_size"`
+	Queues          map[string][]message      `json:"queues"`
+	Streams         map[string]snapshotStream `json:"streams"`
+	Schemas         map[string]snapshotSchema `json:"schemas"`
+	Members         map[string]string         `json:"members"`
+	IdempotencyKeys int                       `json:"idempotency_keys"`
+	StateHash       *store.StateHash          `json:"state_hash,omitempty"`
+}
+
+// snapshotStream is the output model of a stream held in a snapshot
+type snapshotStream struct {
+	NextOffset uint64            `json:"next_offset"`
+	Groups     map[string]uint64 `json:"groups"`
+	Retention  ds.Retention      `json:"retention"`
+	Entries    []streamEntry     `json:"entries"`
+}
+
+// streamEntry is the output model of an entry of a stream
+type streamEntry struct {
+	Offset    uint64    `json:"offset"`
+	Timestamp time.Time `json:"timestamp"`
+	message
+}
+
+// snapshotSchema is the output model of the schemas of a queue held in a snapshot
+type snapshotSchema struct {
+	Compatibility string            `json:"compatibility"`
+	Versions      []json.RawMessage `json:"versions"`
+}
+
+// inspectSnapshot is used to print the state held in a snapshot as JSON, whatever the output format
+func inspectSnapshot(e *env, snapshots raft.SnapshotStore, id string) error {
+	if id == "" {
+		metas, err := snapshots.List()
+		if err != nil {
+			return err
+		}
+		if len(metas) == 0 {
+			return fmt.Errorf("no snapshots found")
+		}
+		id = metas[0].ID
+	}
+
+	meta, rc, err := snapshots.Open(id)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot %s: %w", id, err)
+	}
+	defer rc.Close()
+
+	contents, err := store.ReadSnapshotContents(rc, legacyUpgrader)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot %s: %w", id, err)
+	}
+	// The whole snapshot is read so that its checksum is verified
+	if _, err := io.Copy(io.Discard, rc); err != nil {
+		return fmt.Errorf("failed to read snapshot %s: %w", id, err)
+	}
+
+	rendered := snapshotContents{
+		Snapshot: snapshotMeta{
+			ID:                 meta.ID,
+			Index:              meta.Index,
+			Term:               meta.Term,
+			Size:               meta.Size,
+			Version:            int(meta.Version),
+			ConfigurationIndex: meta.ConfigurationIndex,
+			Configuration:      newSnapshotServers(meta.Configuration),
+		},
+		Compression:     contents.Metrics.Compression.String(),
+		Size:            contents.Metrics.Size,
+		CompressedSize:  contents.Metrics.CompressedSize,
+		Queues:          map[string][]message{},
+		Streams:         map[string]snapshotStream{},
+		Schemas:         map[string]snapshotSchema{},
+		Members:         contents.Members,
+		IdempotencyKeys: contents.IdempotencyKeys,
+		StateHash:       contents.Hash,
+	}
+	for name, queue := range contents.Queues {
+		messages := make([]message, 0, len(queue.Messages))
+		for _, m := range queue.Messages {
+			messages = append(messages, newMessage(m.Data))
+		}
+		rendered.Queues[name] = messages
+	}
+	for name, stream := range contents.Streams {
+		s := snapshotStream{NextOffset: stream.NextOffset, Groups: stream.Groups, Retention: stream.Retention, Entries: []streamEntry{}}
+		for _, segment := range stream.Segments {
+			for _, entry := range segment.Entries {
+				s.Entries = append(s.Entries, streamEntry{Offset: entry.Offset, Timestamp: entry.Timestamp, message: newMessage(entry.Data)})
+			}
+		}
+		rendered.Streams[name] = s
+	}
+	for name, subject := range contents.Schemas {
+		s := snapshotSchema{Compatibility: string(subject.Compatibility), Versions: []json.RawMessage{}}
+		for _, version := range subject.Versions {
+			s.Versions = append(s.Versions, version.Schema)
+		}
+		rendered.Schemas[name] = s
+	}
+
+	return e.out.encode(rendered)
+}
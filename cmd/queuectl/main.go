@@ -0,0 +1,161 @@
+// Command queuectl is a command line client of the message queue
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/client"
+)
+
+// The environment variables the global flags default to
+const (
+	envEndpoint = "QUEUECTL_ENDPOINT"
+	envOutput   = "QUEUECTL_OUTPUT"
+	envTimeout  = "QUEUECTL_TIMEOUT"
+)
+
+// errUsage is returned when a command is used incorrectly, so that its usage is printed
+var errUsage = errors.New("invalid usage")
+
+// env is the context a command runs in
+type env struct {
+	client *client.Client[json.RawMessage]
+	out    *printer
+	stdin  io.Reader
+	stderr io.Writer
+
+	// timeout is the time each request may take, commands that run until interrupted apply it per request
+	timeout time.Duration
+}
+
+// command is a subcommand of queuectl
+type command struct {
+	usage   string
+	summary string
+	run     func(ctx context.Context, e *env, args []string) error
+}
+
+// commands are the subcommands of queuectl by name
+var commands = map[string]command{
+	"send":    {"send [-queue name] [-file path] [-content-type type] [-key key]", "Send a message read from a file or stdin", runSend},
+	"receive": {"receive [-queue name] [-n count]", "Take messages from a queue", runReceive},
+	"tail":    {"tail [-queue name] [-interval duration]", "Take messages from a queue as they arrive, until interrupted", runTail},
+	"peek":    {"peek [-queue name] [-max count]", "Show messages at the front of a queue without taking them", runPeek},
+	"purge":   {"purge [-queue name]", "Delete every message of a queue", runPurge},
+	"queue":   {"queue create|list|delete [name]", "Create, list or delete queues", runQueue},
+	"cluster": {"cluster status|join|remove|transfer [args]", "Show the nodes of the cluster, add or remove a node, or transfer leadership", runCluster},
+	"backup":  {"backup [-file path]", "Write a backup of every queue, stream and schema to a file or stdout", runBackup},
+	"restore": {"restore [-file path]", "Replace the state of a new cluster with a backup read from a file or stdin", runRestore},
+	"inspect": {"inspect state|log|snapshots|snapshot [-dir path] [-log-store backend] [args]", "Read the Raft log, term, vote and snapshots of a stopped node from its directory", runInspect},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Getenv, os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run is used to run queuectl with the given arguments and environment, and returns the exit code
+func run(ctx context.Context, args []string, getenv func(string) string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("queuectl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	endpoint := flags.String("endpoint", envOr(getenv, envEndpoint, "localhost:3000"), "Comma separated HTTP addresses of nodes of the cluster (env "+envEndpoint+")")
+	output := flags.String("output", envOr(getenv, envOutput, "table"), "The output format, table or json (env "+envOutput+")")
+	timeout := flags.Duration("timeout", 30*time.Second, "The time a command may take, including retries (env "+envTimeout+")")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: queuectl [flags] command [args]\n\nCommands:\n")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(stderr, "  %-10s %s\n", name, commands[name].summary)
+		}
+		fmt.Fprintf(stderr, "\nFlags:\n")
+		flags.PrintDefaults()
+	}
+
+	if value := getenv(envTimeout); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid %s: %v\n", envTimeout, err)
+			return 2
+		}
+		*timeout = parsed
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	out, err := newPrinter(*output, stdout)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", flags.Arg(0))
+		flags.Usage()
+		return 2
+	}
+
+	e := &env{
+		client:  client.New[json.RawMessage](strings.Split(*endpoint, ",")),
+		out:     out,
+		stdin:   stdin,
+		stderr:  stderr,
+		timeout: *timeout,
+	}
+	if err := cmd.run(ctx, e, flags.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(stderr, "Usage: queuectl %s\n", cmd.usage)
+			return 2
+		}
+		fmt.Fprintln(stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// envOr is used to get an environment variable, or the fallback if it is not set
+func envOr(getenv func(string) string, key, fallback string) string {
+	if value := getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// request is used to get the context of a single request, bounded by the timeout
+func (e *env) request(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, e.timeout)
+}
+
+// parse is used to parse the flags of a command, and to check the number of arguments that follow them
+func (e *env) parse(flags *flag.FlagSet, args []string, min, max int) error {
+	flags.SetOutput(e.stderr)
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() < min || flags.NArg() > max {
+		return errUsage
+	}
+	return nil
+}
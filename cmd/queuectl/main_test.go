@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/consensus"
+	"github.com/kavinaravind/go-raft-message-queue/model"
+	"github.com/kavinaravind/go-raft-message-queue/server"
+	"github.com/kavinaravind/go-raft-message-queue/store"
+	"github.com/kavinaravind/go-raft-message-queue/testcluster"
+)
+
+// setup is used to start a single node cluster with an HTTP server, and to get its address
+func setup(t *testing.T) string {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cluster := testcluster.New[model.Payload](t, 1, testcluster.WithLogger(logger))
+	leader := cluster.Leader()
+
+	srv := httptest.NewServer(server.NewServer(leader.Store, logger).Handler())
+	t.Cleanup(srv.Close)
+
+	address := srv.Listener.Addr().String()
+	if err := leader.Store.RegisterMember(leader.ID, address); err != nil {
+		t.Fatal(err)
+	}
+	return address
+}
+
+// queuectl is used to run queuectl against the endpoint, and to get its exit code and output
+func queuectl(t *testing.T, ctx context.Context, endpoint, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+
+	getenv := func(key string) string {
+		if key == envEndpoint {
+			return endpoint
+		}
+		return ""
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run(ctx, args, getenv, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestQueuectl(t *testing.T) {
+	endpoint := setup(t)
+	ctx := context.Background()
+
+	expect := func(t *testing.T, stdin string, expected string, args ...string) {
+		t.Helper()
+		code, stdout, stderr := queuectl(t, ctx, endpoint, stdin, args...)
+		if code != 0 {
+			t.Fatalf("expected %v to succeed, got exit code %d: %s", args, code, stderr)
+		}
+		if stdout != expected {
+			t.Errorf("expected %v to print:\n%s\ngot:\n%s", args, expected, stdout)
+		}
+	}
+
+	t.Run("send", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "message.txt")
+		if err := os.WriteFile(file, []byte("hello"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		expect(t, "", "Created queue orders\n", "queue", "create", "orders")
+		expect(t, `{"id": 1}`, "", "send", "-queue", "orders")
+		expect(t, "", "", "send", "-queue", "orders", "-file", file, "-content-type", "text/plain")
+		expect(t, "\x00\x01", "", "send", "-queue", "orders", "-content-type", "application/octet-stream", "-key", "binary")
+		expect(t, "\x00\x01", "", "send", "-queue", "orders", "-content-type", "application/octet-stream", "-key", "binary")
+	})
+
+	t.Run("queue list", func(t *testing.T) {
+		expect(t, "", "NAME     DEPTH\ndefault  0\norders   3\n", "queue", "list")
+		expect(t, "", "[\n  {\n    \"name\": \"default\",\n    \"depth\": 0\n  },\n  {\n    \"name\": \"orders\",\n    \"depth\": 3\n  }\n]\n", "-output", "json", "queue", "list")
+	})
+
+	t.Run("peek", func(t *testing.T) {
+		expect(t, "", "{\"id\":1}\nhello\nAAE=\n", "peek", "-queue", "orders")
+
+		code, stdout, _ := queuectl(t, ctx, endpoint, "", "-output", "json", "peek", "-queue", "orders", "-max", "2")
+		var messages []message
+		if err := json.Unmarshal([]byte(stdout), &messages); code != 0 || err != nil {
+			t.Fatalf("expected JSON messages, got exit code %d and error %v", code, err)
+		}
+		if len(messages) != 2 || messages[1].ContentType != "text/plain" || string(messages[1].Data) != `"hello"` {
+			t.Errorf("expected the order and the text, got %v", messages)
+		}
+	})
+
+	t.Run("receive", func(t *testing.T) {
+		expect(t, "", "{\"id\":1}\nhello\n", "receive", "-queue", "orders", "-n", "2")
+		expect(t, "", "[\n  {\n    \"content_type\": \"application/octet-stream\",\n    \"data\": \"AAE=\"\n  }\n]\n", "-output", "json", "receive", "-queue", "orders", "-n", "5")
+		expect(t, "", "[]\n", "-output", "json", "receive", "-queue", "orders")
+	})
+
+	t.Run("tail", func(t *testing.T) {
+		expect(t, `"tailed"`, "", "send", "-queue", "orders")
+
+		tailCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		code, stdout, stderr := queuectl(t, tailCtx, endpoint, "", "-output", "json", "tail", "-queue", "orders", "-interval", "10ms")
+		if code != 0 || stdout != "{\"content_type\":\"application/json\",\"data\":\"tailed\"}\n" {
+			t.Errorf("expected the message to be tailed until interrupted, got exit code %d and %q: %s", code, stdout, stderr)
+		}
+	})
+
+	t.Run("purge and delete", func(t *testing.T) {
+		expect(t, "[1]", "", "send", "-queue", "orders")
+		expect(t, "", "Purged 1 messages\n", "purge", "-queue", "orders")
+		expect(t, "", "{\n  \"deleted\": true\n}\n", "-output", "json", "queue", "delete", "orders")
+
+		code, _, stderr := queuectl(t, ctx, endpoint, "", "queue", "delete", "orders")
+		if code != 1 || !strings.Contains(stderr, "queue_not_found") {
+			t.Errorf("expected the queue not to be found, got exit code %d: %s", code, stderr)
+		}
+	})
+
+	t.Run("cluster status", func(t *testing.T) {
+		code, stdout, stderr := queuectl(t, ctx, endpoint, "", "-output", "json", "cluster", "status")
+		var cluster model.Cluster
+		if err := json.Unmarshal([]byte(stdout), &cluster); code != 0 || err != nil {
+			t.Fatalf("expected the cluster as JSON, got exit code %d and error %v: %s", code, err, stderr)
+		}
+		if cluster.Leader != endpoint || len(cluster.Nodes) != 1 {
+			t.Errorf("expected a single node leading at %s, got %+v", endpoint, cluster)
+		}
+
+		code, stdout, _ = queuectl(t, ctx, endpoint, "", "cluster", "status")
+		if lines := strings.Split(strings.TrimSpace(stdout), "\n"); code != 0 || len(lines) != 2 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], endpoint) {
+			t.Errorf("expected a table of the node, got exit code %d:\n%s", code, stdout)
+		}
+
+		code, _, stderr = queuectl(t, ctx, endpoint, "", "cluster", "remove", "missing")
+		if code != 1 || !strings.Contains(stderr, "node_not_found") {
+			t.Errorf("expected the node not to be found, got exit code %d: %s", code, stderr)
+		}
+	})
+
+	t.Run("backup and restore", func(t *testing.T) {
+		expect(t, `{"id": 2}`, "", "send", "-queue", "backups")
+		file := filepath.Join(t.TempDir(), "queue.backup")
+
+		code, stdout, stderr := queuectl(t, ctx, endpoint, "", "backup", "-file", file)
+		if code != 0 || !strings.HasPrefix(stdout, "Wrote backup of ") {
+			t.Fatalf("expected the backup to be written, got exit code %d: %s%s", code, stdout, stderr)
+		}
+		code, stdout, _ = queuectl(t, ctx, endpoint, "", "backup")
+		data, err := os.ReadFile(file)
+		if err != nil || code != 0 || stdout != string(data) {
+			t.Errorf("expected the backup on stdout to match the file, got exit code %d and error %v", code, err)
+		}
+
+		// The backup seeds a new cluster, from the file or from stdin
+		restored := setup(t)
+		expect(t, "", "Restored backup\n", "-endpoint", restored, "restore", "-file", file)
+		expect(t, stdout, "Restored backup\n", "-endpoint", restored, "restore")
+		expect(t, "", "{\"id\":2}\n", "-endpoint", restored, "receive", "-queue", "backups")
+
+		if code, _, stderr := queuectl(t, ctx, restored, "invalid", "restore"); code != 1 || !strings.Contains(stderr, "invalid backup") {
+			t.Errorf("expected the backup to be invalid, got exit code %d: %s", code, stderr)
+		}
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		for _, args := range [][]string{
+			{},
+			{"unknown"},
+			{"-output", "yaml", "queue", "list"},
+			{"queue"},
+			{"queue", "create"},
+			{"receive", "-n", "0"},
+			{"cluster", "join", "node2"},
+		} {
+			if code, _, stderr := queuectl(t, ctx, endpoint, "", args...); code != 2 || !strings.Contains(stderr, "sage") && !strings.Contains(stderr, "unknown output") {
+				t.Errorf("expected %v to print its usage, got exit code %d: %s", args, code, stderr)
+			}
+		}
+	})
+}
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Run a node with a durable log, snapshot it between sends, and stop it
+	node := store.NewStore[model.Payload](logger)
+	address, transport := raft.NewInmemTransport("")
+	ctx, cancel := context.WithCancel(context.Background())
+	shutdown, err := node.Initialize(ctx, &consensus.Config{
+		IsLeader:      true,
+		ServerID:      "node01",
+		BaseDirectory: dir,
+		Address:       string(address),
+		LogStore:      consensus.LogStoreBolt,
+		Transport:     transport,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node.WaitForNodeToBeLeader(testcluster.DefaultTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if err := node.Send("orders", model.NewPayload(model.JSONContentType, []byte(`{"id":1}`))); err != nil {
+		t.Fatal(err)
+	}
+	_, rc, err := node.OpenBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if err := node.Send("orders", model.NewPayload("text/plain", []byte("second"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// The log is locked while the node runs
+	if code, _, stderr := queuectl(t, context.Background(), "", "", "inspect", "state", "-dir", dir); code != 1 || !strings.Contains(stderr, "locked") {
+		t.Errorf("expected the log to be locked, got exit code %d: %s", code, stderr)
+	}
+
+	cancel()
+	select {
+	case <-shutdown:
+	case <-time.After(testcluster.DefaultTimeout):
+		t.Fatal("timed out waiting for the node to stop")
+	}
+
+	inspect := func(t *testing.T, value any, args ...string) {
+		t.Helper()
+		code, stdout, stderr := queuectl(t, context.Background(), "", "", append([]string{"-output", "json", "inspect"}, args...)...)
+		if code != 0 {
+			t.Fatalf("expected %v to succeed, got exit code %d: %s", args, code, stderr)
+		}
+		if err := json.Unmarshal([]byte(stdout), value); err != nil {
+			t.Fatalf("expected %v to print JSON, got %v: %s", args, err, stdout)
+		}
+	}
+
+	t.Run("state", func(t *testing.T) {
+		var state stableState
+		inspect(t, &state, "state", "-dir", dir)
+		if state.CurrentTerm == 0 || state.LastVoteCandidate != string(address) || state.LastIndex < 3 {
+			t.Errorf("expected the term and vote of node01, got %+v", state)
+		}
+	})
+
+	t.Run("log", func(t *testing.T) {
+		var entries []logEntry
+		inspect(t, &entries, "log", "-dir", dir)
+
+		var configurations int
+		var sends []string
+		for _, entry := range entries {
+			if entry.Error != "" {
+				t.Errorf("expected entry %d to be decoded, got: %s", entry.Index, entry.Error)
+			}
+			if len(entry.Configuration) == 1 && entry.Configuration[0].ID == "node01" {
+				configurations++
+			}
+			if entry.Command != nil && entry.Command.Operation == "send" {
+				sends = append(sends, entry.Command.Queue+" "+entry.Command.Message.text())
+			}
+		}
+		if configurations != 1 || strings.Join(sends, ",") != `orders {"id":1},orders second` {
+			t.Errorf("expected the configuration and both sends, got %+v", entries)
+		}
+
+		var limited []logEntry
+		inspect(t, &limited, "log", "-dir", dir, "-from", strconv.FormatUint(entries[1].Index, 10), "-n", "1")
+		if len(limited) != 1 || limited[0].Index != entries[1].Index {
+			t.Errorf("expected entry %d alone, got %+v", entries[1].Index, limited)
+		}
+
+		code, stdout, _ := queuectl(t, context.Background(), "", "", "inspect", "log", "-dir", dir)
+		if code != 0 || !strings.Contains(stdout, "send queue=orders second") {
+			t.Errorf("expected a table of the entries, got exit code %d:\n%s", code, stdout)
+		}
+	})
+
+	t.Run("snapshots", func(t *testing.T) {
+		var snapshots []snapshotMeta
+		inspect(t, &snapshots, "snapshots", "-dir", dir)
+		if len(snapshots) == 0 || snapshots[0].Size == 0 || len(snapshots[0].Configuration) != 1 {
+			t.Fatalf("expected a snapshot of node01, got %+v", snapshots)
+		}
+
+		var contents snapshotContents
+		inspect(t, &contents, "snapshot", "-dir", dir, "-id", snapshots[len(snapshots)-1].ID)
+		if orders := contents.Queues["orders"]; len(orders) != 1 || orders[0].text() != `{"id":1}` {
+			t.Errorf("expected the first order in the snapshot, got %+v", contents.Queues)
+		}
+		if contents.Snapshot.ID != snapshots[len(snapshots)-1].ID {
+			t.Errorf("expected snapshot %s, got %s", snapshots[len(snapshots)-1].ID, contents.Snapshot.ID)
+		}
+
+		if code, _, stderr := queuectl(t, context.Background(), "", "", "inspect", "snapshot", "-dir", dir, "-id", "missing"); code != 1 || !strings.Contains(stderr, "missing") {
+			t.Errorf("expected the snapshot not to be found, got exit code %d: %s", code, stderr)
+		}
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		for _, args := range [][]string{{"inspect"}, {"inspect", "unknown"}, {"inspect", "log", "extra"}} {
+			if code, _, _ := queuectl(t, context.Background(), "", "", args...); code != 2 {
+				t.Errorf("expected %v to print its usage, got exit code %d", args, code)
+			}
+		}
+		if code, _, _ := queuectl(t, context.Background(), "", "", "inspect", "state", "-dir", filepath.Join(dir, "missing")); code != 1 {
+			t.Errorf("expected a missing directory to fail, got exit code %d", code)
+		}
+	})
+}
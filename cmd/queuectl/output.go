@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kavinaravind/go-raft-message-queue/model"
+)
+
+// printer is used to write the results of commands as tables or as JSON
+type printer struct {
+	json bool
+	w    io.Writer
+}
+
+// newPrinter is used to create a printer for the given output format
+func newPrinter(format string, w io.Writer) (*printer, error) {
+	switch format {
+	case "table":
+		return &printer{w: w}, nil
+	case "json":
+		return &printer{json: true, w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q, expected table or json", format)
+	}
+}
+
+// table is used to write the value as JSON, or the rows under the header as an aligned table
+func (p *printer) table(value any, header []string, rows [][]string) error {
+	if p.json {
+		return p.encode(value)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// result is used to write the value as JSON, or the text as a line if not empty
+func (p *printer) result(value any, text string) error {
+	if p.json {
+		return p.encode(value)
+	}
+	if text == "" {
+		return nil
+	}
+	_, err := fmt.Fprintln(p.w, text)
+	return err
+}
+
+// encode is used to write the value as indented JSON
+func (p *printer) encode(value any) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(value)
+}
+
+// message is the output model of a message
+type message struct {
+	ContentType string          `json:"content_type"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// newMessage is used to render a payload, JSON payloads are embedded as is,
+// text payloads as a string, and any other payload as a base64 string
+func newMessage(payload model.Payload) message {
+	m := message{ContentType: payload.ContentType, Data: payload.Body}
+	if !payload.IsJSON() {
+		if isText(payload.ContentType) {
+			m.Data, _ = json.Marshal(string(payload.Body))
+		} else {
+			m.Data, _ = json.Marshal(payload.Body)
+		}
+	}
+	return m
+}
+
+// text is used to render the data of a message on a single line
+// Payloads that are not JSON are shown as is rather than as a quoted string
+func (m message) text() string {
+	if !model.IsJSONContentType(m.ContentType) {
+		var s string
+		if err := json.Unmarshal(m.Data, &s); err == nil {
+			return s
+		}
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, m.Data); err != nil {
+		return string(m.Data)
+	}
+	return compact.String()
+}
+
+// messages is used to write messages, as a JSON array or one message per line
+func (p *printer) messages(messages []message) error {
+	if p.json {
+		if messages == nil {
+			messages = []message{}
+		}
+		return p.encode(messages)
+	}
+	for _, m := range messages {
+		if err := p.line(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// line is used to write a single message, as compact JSON or as its data, on its own line
+func (p *printer) line(m message) error {
+	if p.json {
+		return json.NewEncoder(p.w).Encode(m)
+	}
+	_, err := fmt.Fprintln(p.w, m.text())
+	return err
+}
+
+// isText is used to check if a content type is a text media type
+func isText(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && strings.HasPrefix(mediaType, "text/")
+}
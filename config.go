@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kavinaravind/go-raft-message-queue/consensus"
+	"github.com/kavinaravind/go-raft-message-queue/discovery"
+	"github.com/kavinaravind/go-raft-message-queue/model"
+	"github.com/kavinaravind/go-raft-message-queue/server"
+	"github.com/kavinaravind/go-raft-message-queue/store"
+	"github.com/kavinaravind/go-raft-message-queue/telemetry"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of the environment variables that set the flag of the same name,
+// such as QUEUE_LOG_STORE for -log-store
+const envPrefix = "QUEUE_"
+
+// config is the configuration of a node
+// It is read from a YAML or TOML file, then from the environment, then from flags, each taking precedence over the last
+type config struct {
+	Consensus consensusConfig `yaml:"consensus" toml:"consensus"`
+	Store     storeConfig     `yaml:"store" toml:"store"`
+	Server    serverConfig    `yaml:"server" toml:"server"`
+	Tracing   tracingConfig   `yaml:"tracing" toml:"tracing"`
+}
+
+// consensusConfig is the configuration of the raft node
+type consensusConfig struct {
+	ID              string        `yaml:"id" toml:"id"`
+	Leader          bool          `yaml:"leader" toml:"leader"`
+	Address         string        `yaml:"address" toml:"address"`
+	Dir             string        `yaml:"dir" toml:"dir"`
+	Join            listFlag      `yaml:"join" toml:"join"`
+	JoinTimeout     time.Duration `yaml:"join_timeout" toml:"join_timeout"`
+	BootstrapExpect int           `yaml:"bootstrap_expect" toml:"bootstrap_expect"`
+	Peers           listFlag      `yaml:"peers" toml:"peers"`
+	LogStore        string        `yaml:"log_store" toml:"log_store"`
+	LogCache        int           `yaml:"log_cache" toml:"log_cache"`
+	LogEncoding     string        `yaml:"log_encoding" toml:"log_encoding"`
+}
+
+// storeConfig is the configuration of the state machine
+type storeConfig struct {
+	Storage             string        `yaml:"storage" toml:"storage"`
+	SnapshotCompression string        `yaml:"snapshot_compression" toml:"snapshot_compression"`
+	HashCheckInterval   time.Duration `yaml:"hash_check_interval" toml:"hash_check_interval"`
+	FenceOnDivergence   bool          `yaml:"fence_on_divergence" toml:"fence_on_divergence"`
+}
+
+// serverConfig is the configuration of the HTTP server
+type serverConfig struct {
+	Address        string     `yaml:"address" toml:"address"`
+	Models         modelsFlag `yaml:"models" toml:"models"`
+	ReadyMaxLag    uint64     `yaml:"ready_max_lag" toml:"ready_max_lag"`
+	MaxRestoreSize int64      `yaml:"max_restore_size" toml:"max_restore_size"`
+}
+
+// tracingConfig is the configuration of the OpenTelemetry exporter
+type tracingConfig struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter"`
+	File        string  `yaml:"file" toml:"file"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint"`
+	Insecure    bool    `yaml:"insecure" toml:"insecure"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// newConfig creates a new config with the default values
+func newConfig() *config {
+	return &config{
+		Consensus: consensusConfig{
+			Address:     "localhost:3001",
+			Dir:         "/tmp",
+			JoinTimeout: time.Minute,
+			LogStore:    string(consensus.LogStoreBolt),
+			LogEncoding: "msgpack",
+		},
+		Store: storeConfig{
+			Storage:             string(store.StorageMemory),
+			SnapshotCompression: "zstd",
+			HashCheckInterval:   store.DefaultHashCheckInterval,
+		},
+		Server: serverConfig{
+			Address:        "localhost:3000",
+			Models:         modelsFlag{},
+			ReadyMaxLag:    server.DefaultReadyMaxLag,
+			MaxRestoreSize: server.DefaultMaxRestoreSize,
+		},
+		Tracing: tracingConfig{
+			Exporter:    string(telemetry.ExporterNone),
+			File:        "traces.json",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// bind is used to define a flag for every setting of the config, defaulting to its current value
+func (c *config) bind(fs *flag.FlagSet) {
+	if c.Server.Models == nil {
+		c.Server.Models = modelsFlag{}
+	}
+
+	// Consensus Specific Flags
+	fs.BoolVar(&c.Consensus.Leader, "leader", c.Consensus.Leader, "Set to true if this node is the leader")
+	fs.StringVar(&c.Consensus.ID, "id", c.Consensus.ID, "The unique identifier for this server")
+	fs.StringVar(&c.Consensus.Address, "raddr", c.Consensus.Address, "The address that the Raft consensus group should use")
+	fs.StringVar(&c.Consensus.Dir, "dir", c.Consensus.Dir, "The base directory for storing Raft data")
+	fs.Var(&c.Consensus.Join, "paddr", "The comma separated HTTP addresses of existing nodes to join the cluster through, or dns+, dnssrv+ or file+ peers to discover")
+	fs.DurationVar(&c.Consensus.JoinTimeout, "join-timeout", c.Consensus.JoinTimeout, "How long to retry joining the cluster before giving up")
+	fs.IntVar(&c.Consensus.BootstrapExpect, "bootstrap-expect", c.Consensus.BootstrapExpect, "Bootstrap a new cluster once this many servers are found among the peers (0 disables it)")
+	fs.Var(&c.Consensus.Peers, "peers", "The comma separated HTTP addresses of the nodes to bootstrap the cluster with, or dns+, dnssrv+ or file+ peers to discover")
+	fs.StringVar(&c.Consensus.LogStore, "log-store", c.Consensus.LogStore, "The backend used to store the Raft log (bolt, wal or inmem)")
+	fs.IntVar(&c.Consensus.LogCache, "log-cache", c.Consensus.LogCache, "The number of recent Raft log entries to cache in memory (0 disables the cache)")
+	fs.StringVar(&c.Consensus.LogEncoding, "log-encoding", c.Consensus.LogEncoding, "The encoding of commands written to the Raft log (msgpack or json)")
+	fs.StringVar(&c.Store.Storage, "storage", c.Store.Storage, "The engine queue messages are held in (memory or bolt)")
+	fs.StringVar(&c.Store.SnapshotCompression, "snapshot-compression", c.Store.SnapshotCompression, "The compression of Raft snapshots (zstd, snappy, gzip or none)")
+	fs.DurationVar(&c.Store.HashCheckInterval, "hash-check-interval", c.Store.HashCheckInterval, "How often the leader replicates a check of the state hash (0 disables checks)")
+	fs.BoolVar(&c.Store.FenceOnDivergence, "fence-on-divergence", c.Store.FenceOnDivergence, "Shutdown the Raft node of a follower whose state hash differs from the leader's")
+
+	// Tracing Specific Flags
+	fs.StringVar(&c.Tracing.Exporter, "trace-exporter", c.Tracing.Exporter, "The exporter of OpenTelemetry spans (none, stdout, file or otlp)")
+	fs.StringVar(&c.Tracing.File, "trace-file", c.Tracing.File, "The file spans are appended to by the file exporter")
+	fs.StringVar(&c.Tracing.Endpoint, "trace-endpoint", c.Tracing.Endpoint, "The host and port of the OTLP/HTTP collector (defaults to OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4318)")
+	fs.BoolVar(&c.Tracing.Insecure, "trace-insecure", c.Tracing.Insecure, "Connect to the OTLP collector over plain HTTP")
+	fs.Float64Var(&c.Tracing.SampleRatio, "trace-sample-ratio", c.Tracing.SampleRatio, "The fraction of traces started by this node that are sampled")
+
+	// Server Specific Flags
+	fs.StringVar(&c.Server.Address, "haddr", c.Server.Address, "The address that the HTTP server should use")
+	fs.Uint64Var(&c.Server.ReadyMaxLag, "ready-max-lag", c.Server.ReadyMaxLag, "The number of committed Raft log entries the node may have yet to apply and still be ready")
+	fs.Int64Var(&c.Server.MaxRestoreSize, "max-restore-size", c.Server.MaxRestoreSize, "The largest backup in bytes accepted by /admin/restore")
+	fs.Var(c.Server.Models, "model", "Attach a typed model to a queue as queue=model (repeatable, models: comment)")
+}
+
+// options are the flags that are not settings of the config
+type options struct {
+	configFile  string
+	printConfig bool
+}
+
+// bind is used to define the flags of the options
+func (o *options) bind(fs *flag.FlagSet, getenv func(string) string) {
+	fs.StringVar(&o.configFile, "config", getenv(envPrefix+"CONFIG"), "The YAML (.yaml, .yml) or TOML (.toml) file to read the configuration from (env "+envPrefix+"CONFIG)")
+	fs.BoolVar(&o.printConfig, "print-config", false, "Print the effective configuration as YAML and exit")
+}
+
+// errUsage is returned when the flags cannot be parsed, once the error and usage have been printed
+var errUsage = errors.New("invalid usage")
+
+// envName is used to get the environment variable of a flag
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadConfig is used to build the config from the defaults, the config file, the environment and the flags
+// The flags are parsed once to find the config file and report usage errors against the defaults,
+// then again over the file and environment so that they take precedence
+func loadConfig(name string, args []string, getenv func(string) string, stderr io.Writer) (*config, options, error) {
+	var opts options
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	newConfig().bind(fs)
+	opts.bind(fs, getenv)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage of %s:\n", name)
+		fs.PrintDefaults()
+		fmt.Fprintf(stderr, "\nEvery flag can also be set with an environment variable, such as %s for -log-store.\n", envName("log-store"))
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, opts, err
+		}
+		return nil, opts, errUsage
+	}
+	if fs.NArg() > 0 {
+		return nil, opts, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	conf := newConfig()
+	if opts.configFile != "" {
+		if err := readConfigFile(opts.configFile, conf); err != nil {
+			return nil, opts, err
+		}
+	}
+
+	fs = flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	conf.bind(fs)
+	opts.bind(fs, getenv)
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+		if value := getenv(envName(f.Name)); value != "" {
+			if err := fs.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", envName(f.Name), err))
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, opts, err
+	}
+
+	return conf, opts, fs.Parse(args)
+}
+
+// readConfigFile is used to read the config file over the config, in the format given by its extension
+// Keys that are not settings of the config are rejected, so that misspelled settings are not silently ignored
+func readConfigFile(path string, conf *config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(conf); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), conf)
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, 0, len(undecoded))
+			for _, key := range undecoded {
+				keys = append(keys, key.String())
+			}
+			return fmt.Errorf("failed to parse config file %s: unknown settings %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("unsupported config file extension %q, expected .yaml, .yml or .toml", ext)
+	}
+	return nil
+}
+
+// settings are the values of a validated config, in the types used by the node
+type settings struct {
+	consensus   *consensus.Config
+	server      *server.Config
+	telemetry   *telemetry.Config
+	encoding    store.Encoding
+	storage     store.Storage
+	compression store.Compression
+	seeds       discovery.Peers
+	peers       discovery.Peers
+}
+
+// validate is used to check every setting of the config, and to get the values the node is started with
+// Every invalid setting is reported, each along with the flag and environment variable that set it
+func (c *config) validate() (*settings, error) {
+	var errs []error
+	invalid := func(key, flagName string, err error) {
+		errs = append(errs, fmt.Errorf("%s (-%s, %s): %w", key, flagName, envName(flagName), err))
+	}
+
+	s := &settings{
+		consensus: consensus.NewConsensusConfig(),
+		server:    server.NewServerConfig(),
+		telemetry: telemetry.NewConfig(),
+	}
+
+	s.consensus.IsLeader = c.Consensus.Leader
+	s.consensus.ServerID = c.Consensus.ID
+	s.consensus.Address = c.Consensus.Address
+	s.consensus.BaseDirectory = c.Consensus.Dir
+	s.consensus.LogCacheSize = c.Consensus.LogCache
+	if c.Consensus.ID == "" {
+		invalid("consensus.id", "id", errors.New("required"))
+	}
+	if err := checkAddress(c.Consensus.Address); err != nil {
+		invalid("consensus.address", "raddr", err)
+	}
+	if c.Consensus.Dir == "" {
+		invalid("consensus.dir", "dir", errors.New("required"))
+	}
+	var err error
+	if s.seeds, err = discovery.Parse(c.Consensus.Join, net.DefaultResolver); err != nil {
+		invalid("consensus.join", "paddr", err)
+	}
+	if len(c.Consensus.Join) > 0 && c.Consensus.Leader {
+		invalid("consensus.join", "paddr", errors.New("a node started as the leader cannot join another node"))
+	}
+	if c.Consensus.JoinTimeout <= 0 {
+		invalid("consensus.join_timeout", "join-timeout", errors.New("must be positive"))
+	}
+	if c.Consensus.BootstrapExpect < 0 {
+		invalid("consensus.bootstrap_expect", "bootstrap-expect", errors.New("must not be negative"))
+	}
+	if c.Consensus.BootstrapExpect > 0 {
+		if c.Consensus.Leader {
+			invalid("consensus.bootstrap_expect", "bootstrap-expect", errors.New("a node started as the leader bootstraps a cluster on its own"))
+		}
+		if len(c.Consensus.Join) > 0 {
+			invalid("consensus.bootstrap_expect", "bootstrap-expect", errors.New("a node that joins another node does not bootstrap a cluster"))
+		}
+		if len(c.Consensus.Peers) == 0 {
+			invalid("consensus.peers", "peers", errors.New("required to bootstrap a cluster"))
+		}
+	}
+	if s.peers, err = discovery.Parse(c.Consensus.Peers, net.DefaultResolver); err != nil {
+		invalid("consensus.peers", "peers", err)
+	}
+	logStore, err := consensus.ParseLogStore(c.Consensus.LogStore)
+	if err != nil {
+		invalid("consensus.log_store", "log-store", err)
+	}
+	s.consensus.LogStore = logStore
+	if c.Consensus.LogCache < 0 {
+		invalid("consensus.log_cache", "log-cache", errors.New("must not be negative"))
+	}
+	if s.encoding, err = store.ParseEncoding(c.Consensus.LogEncoding); err != nil {
+		invalid("consensus.log_encoding", "log-encoding", err)
+	}
+
+	if s.storage, err = store.ParseStorage(c.Store.Storage); err != nil {
+		invalid("store.storage", "storage", err)
+	}
+	if s.compression, err = store.ParseCompression(c.Store.SnapshotCompression); err != nil {
+		invalid("store.snapshot_compression", "snapshot-compression", err)
+	}
+	if c.Store.HashCheckInterval < 0 {
+		invalid("store.hash_check_interval", "hash-check-interval", errors.New("must not be negative"))
+	}
+
+	s.server.Address = c.Server.Address
+	if err := checkAddress(c.Server.Address); err != nil {
+		invalid("server.address", "haddr", err)
+	}
+	for queue, name := range c.Server.Models {
+		if err := checkModel(queue, name); err != nil {
+			invalid("server.models", "model", err)
+		}
+	}
+	if c.Server.MaxRestoreSize <= 0 {
+		invalid("server.max_restore_size", "max-restore-size", errors.New("must be positive"))
+	}
+
+	exporter, err := telemetry.ParseExporter(c.Tracing.Exporter)
+	if err != nil {
+		invalid("tracing.exporter", "trace-exporter", err)
+	}
+	s.telemetry.Exporter = exporter
+	s.telemetry.File = c.Tracing.File
+	s.telemetry.Endpoint = c.Tracing.Endpoint
+	s.telemetry.Insecure = c.Tracing.Insecure
+	s.telemetry.SampleRatio = c.Tracing.SampleRatio
+	s.telemetry.InstanceID = c.Consensus.ID
+	if exporter == telemetry.ExporterFile && c.Tracing.File == "" {
+		invalid("tracing.file", "trace-file", errors.New("required by the file exporter"))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		invalid("tracing.sample_ratio", "trace-sample-ratio", fmt.Errorf("must be between 0 and 1, got %v", c.Tracing.SampleRatio))
+	}
+
+	return s, errors.Join(errs...)
+}
+
+// checkAddress is used to check that an address is a host and port
+func checkAddress(address string) error {
+	if address == "" {
+		return errors.New("required")
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// models are the typed models that can be attached to a queue with the -model flag
+var models = map[string]server.Model{
+	"comment": server.TypedModel[model.Comment](),
+}
+
+// checkModel is used to check that a queue is named and attached to a known model
+func checkModel(queue, name string) error {
+	if queue == "" {
+		return fmt.Errorf("expected queue=model, got %q", queue+"="+name)
+	}
+	if _, ok := models[name]; !ok {
+		return fmt.Errorf("unknown model %q", name)
+	}
+	return nil
+}
+
+// modelsFlag maps queue names to model names, set as repeated or comma separated queue=model flags
+type modelsFlag map[string]string
+
+func (m modelsFlag) String() string {
+	pairs := make([]string, 0, len(m))
+	for queue, name := range m {
+		pairs = append(pairs, queue+"="+name)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m modelsFlag) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		queue, name, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("expected queue=model, got %q", pair)
+		}
+		if err := checkModel(queue, name); err != nil {
+			return err
+		}
+		m[queue] = name
+	}
+	return nil
+}
+
+// listFlag is a list of values set as a comma separated flag, each time the flag is set it replaces the list
+// so that a flag overrides the list read from the config file or the environment
+// In a config file it is either a list or a comma separated string
+type listFlag []string
+
+func (l *listFlag) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return l.Set(node.Value)
+	}
+	var items []string
+	if err := node.Decode(&items); err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
+
+func (l *listFlag) UnmarshalTOML(value interface{}) error {
+	switch value := value.(type) {
+	case string:
+		return l.Set(value)
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("expected a list of strings, got %v", value)
+			}
+			items = append(items, s)
+		}
+		*l = items
+		return nil
+	default:
+		return fmt.Errorf("expected a string or a list of strings, got %v", value)
+	}
+}
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/consensus"
+	"github.com/kavinaravind/go-raft-message-queue/store"
+)
+
+// writeFile is used to write a config file with the given name to a temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// environment is used to get a getenv function over the given variables
+func environment(vars map[string]string) func(string) string {
+	return func(key string) string {
+		return vars[key]
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	yamlFile := writeFile(t, "queue.yaml", `
+consensus:
+  id: node01
+  address: localhost:4001
+  dir: /data
+  bootstrap_expect: 3
+  peers: [localhost:4000, localhost:4100]
+  log_store: wal
+store:
+  storage: bolt
+  hash_check_interval: 1m
+server:
+  address: localhost:4000
+  models:
+    comments: comment
+tracing:
+  exporter: file
+`)
+	tomlFile := writeFile(t, "queue.toml", `
+[consensus]
+id = "node01"
+address = "localhost:4001"
+dir = "/data"
+bootstrap_expect = 3
+peers = ["localhost:4000", "localhost:4100"]
+log_store = "wal"
+
+[store]
+storage = "bolt"
+hash_check_interval = "1m"
+
+[server]
+address = "localhost:4000"
+models = { comments = "comment" }
+
+[tracing]
+exporter = "file"
+`)
+
+	for _, file := range []string{yamlFile, tomlFile} {
+		t.Run(filepath.Ext(file), func(t *testing.T) {
+			// The environment overrides the file, and flags override both
+			env := environment(map[string]string{
+				"QUEUE_CONFIG":    file,
+				"QUEUE_LOG_STORE": "inmem",
+				"QUEUE_HADDR":     "localhost:5000",
+				"QUEUE_MODEL":     "other=comment",
+				"QUEUE_PEERS":     "localhost:5000, localhost:5100,localhost:5200",
+			})
+			conf, opts, err := loadConfig("queue", []string{"-haddr", "localhost:6000", "-print-config"}, env, io.Discard)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if opts.configFile != file || !opts.printConfig {
+				t.Errorf("expected the options to be read, got %+v", opts)
+			}
+
+			expected := newConfig()
+			expected.Consensus.ID = "node01"
+			expected.Consensus.Address = "localhost:4001"
+			expected.Consensus.Dir = "/data"
+			expected.Consensus.BootstrapExpect = 3
+			expected.Consensus.Peers = listFlag{"localhost:5000", "localhost:5100", "localhost:5200"}
+			expected.Consensus.LogStore = "inmem"
+			expected.Store.Storage = "bolt"
+			expected.Store.HashCheckInterval = time.Minute
+			expected.Server.Address = "localhost:6000"
+			expected.Server.Models = modelsFlag{"comments": "comment", "other": "comment"}
+			expected.Tracing.Exporter = "file"
+			if !reflect.DeepEqual(conf.Consensus, expected.Consensus) || conf.Store != expected.Store || conf.Tracing != expected.Tracing ||
+				conf.Server.Address != expected.Server.Address || conf.Server.Models.String() != expected.Server.Models.String() {
+				t.Errorf("expected the config\n%+v\ngot\n%+v", expected, conf)
+			}
+
+			settings, err := conf.validate()
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if settings.consensus.LogStore != consensus.LogStoreInmem || settings.storage != store.StorageBolt || settings.telemetry.InstanceID != "node01" {
+				t.Errorf("expected the settings to be converted, got %+v", settings)
+			}
+		})
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		conf, _, err := loadConfig("queue", []string{"-id", "node01"}, environment(nil), io.Discard)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		expected := newConfig()
+		expected.Consensus.ID = "node01"
+		if !reflect.DeepEqual(conf.Consensus, expected.Consensus) || conf.Store != expected.Store || conf.Tracing != expected.Tracing || conf.Server.Address != expected.Server.Address {
+			t.Errorf("expected the defaults\n%+v\ngot\n%+v", expected, conf)
+		}
+	})
+
+	// Lists are read from a config file as a list or as a comma separated string
+	t.Run("lists", func(t *testing.T) {
+		for _, file := range []string{
+			writeFile(t, "lists.yaml", "consensus:\n  join: localhost:3000, localhost:3002\n  peers: [localhost:3004]\n"),
+			writeFile(t, "lists.toml", "[consensus]\njoin = \"localhost:3000,localhost:3002\"\npeers = [\"localhost:3004\"]\n"),
+		} {
+			conf, _, err := loadConfig("queue", []string{"-config", file}, environment(nil), io.Discard)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if !reflect.DeepEqual(conf.Consensus.Join, listFlag{"localhost:3000", "localhost:3002"}) || !reflect.DeepEqual(conf.Consensus.Peers, listFlag{"localhost:3004"}) {
+				t.Errorf("expected the lists to be read from %s, got %v and %v", filepath.Ext(file), conf.Consensus.Join, conf.Consensus.Peers)
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for name, test := range map[string]struct {
+			args     []string
+			env      map[string]string
+			expected string
+		}{
+			"unknown flag":       {[]string{"-unknown"}, nil, "invalid usage"},
+			"help":               {[]string{"-h"}, nil, flag.ErrHelp.Error()},
+			"arguments":          {[]string{"extra"}, nil, "unexpected arguments: extra"},
+			"invalid env":        {nil, map[string]string{"QUEUE_LOG_CACHE": "many"}, "invalid QUEUE_LOG_CACHE"},
+			"missing file":       {[]string{"-config", "/missing.yaml"}, nil, "failed to read config file"},
+			"unknown yaml key":   {[]string{"-config", writeFile(t, "bad.yaml", "consensus:\n  idd: node01\n")}, nil, "field idd not found"},
+			"unknown toml key":   {[]string{"-config", writeFile(t, "bad.toml", "[consensus]\nidd = \"node01\"\n")}, nil, "unknown settings consensus.idd"},
+			"unknown extension":  {[]string{"-config", writeFile(t, "queue.json", "{}")}, nil, "unsupported config file extension"},
+			"invalid yaml value": {[]string{"-config", writeFile(t, "bad.yaml", "consensus:\n  log_cache: many\n")}, nil, "failed to parse config file"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, _, err := loadConfig("queue", test.args, environment(test.env), io.Discard)
+				if err == nil || !strings.Contains(err.Error(), test.expected) {
+					t.Errorf("expected an error containing %q, got: %v", test.expected, err)
+				}
+			})
+		}
+	})
+}
+
+func TestValidateConfig(t *testing.T) {
+	conf := newConfig()
+	conf.Consensus.Address = "localhost"
+	conf.Consensus.Leader = true
+	conf.Consensus.Join = listFlag{"localhost:3000", "localhost"}
+	conf.Consensus.JoinTimeout = 0
+	conf.Consensus.BootstrapExpect = 3
+	conf.Consensus.Peers = listFlag{"localhost"}
+	conf.Consensus.LogCache = -1
+	conf.Consensus.LogEncoding = "xml"
+	conf.Store.Storage = "disk"
+	conf.Store.SnapshotCompression = "lz4"
+	conf.Store.HashCheckInterval = -time.Second
+	conf.Server.Address = "localhost:http"
+	conf.Server.Models["comments"] = "post"
+	conf.Server.MaxRestoreSize = 0
+	conf.Tracing.Exporter = "jaeger"
+	conf.Tracing.SampleRatio = 2
+
+	_, err := conf.validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// Every invalid setting is reported along with the flag and environment variable that set it
+	for _, expected := range []string{
+		"consensus.id (-id, QUEUE_ID): required",
+		"consensus.address (-raddr, QUEUE_RADDR)",
+		"consensus.join (-paddr, QUEUE_PADDR): a node started as the leader cannot join another node",
+		"consensus.join (-paddr, QUEUE_PADDR): invalid peer \"localhost\": address localhost: missing port in address",
+		"consensus.join_timeout (-join-timeout, QUEUE_JOIN_TIMEOUT): must be positive",
+		"consensus.bootstrap_expect (-bootstrap-expect, QUEUE_BOOTSTRAP_EXPECT): a node started as the leader bootstraps a cluster on its own",
+		"consensus.bootstrap_expect (-bootstrap-expect, QUEUE_BOOTSTRAP_EXPECT): a node that joins another node does not bootstrap a cluster",
+		"consensus.peers (-peers, QUEUE_PEERS)",
+		"consensus.log_cache (-log-cache, QUEUE_LOG_CACHE): must not be negative",
+		"consensus.log_encoding (-log-encoding, QUEUE_LOG_ENCODING)",
+		"store.storage (-storage, QUEUE_STORAGE)",
+		"store.snapshot_compression (-snapshot-compression, QUEUE_SNAPSHOT_COMPRESSION)",
+		"store.hash_check_interval (-hash-check-interval, QUEUE_HASH_CHECK_INTERVAL): must not be negative",
+		"server.address (-haddr, QUEUE_HADDR): invalid port \"http\"",
+		"server.models (-model, QUEUE_MODEL): unknown model \"post\"",
+		"server.max_restore_size (-max-restore-size, QUEUE_MAX_RESTORE_SIZE): must be positive",
+		"tracing.exporter (-trace-exporter, QUEUE_TRACE_EXPORTER)",
+		"tracing.sample_ratio (-trace-sample-ratio, QUEUE_TRACE_SAMPLE_RATIO): must be between 0 and 1, got 2",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected the error to contain %q, got:\n%v", expected, err)
+		}
+	}
+	if n := len(strings.Split(err.Error(), "\n")); n != 18 {
+		t.Errorf("expected 18 errors, got %d:\n%v", n, err)
+	}
+}
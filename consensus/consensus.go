@@ -1,19 +1,29 @@
 package consensus
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/hashicorp/raft"
-	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
 )
 
 // Consensus is the consensus module
 type Consensus struct {
 	Node *raft.Raft
+
+	// id and address are the server id and raft address of this node
+	id      raft.ServerID
+	address raft.ServerAddress
+
+	// logStore is closed once the node has shutdown
+	logStore io.Closer
+
+	// snapshots is the snapshot store of the node, backups fall back to its latest snapshot
+	snapshots raft.SnapshotStore
 }
 
 // Config is the configuration for the consensus module
@@ -29,6 +39,37 @@ type Config struct {
 
 	// Address is the address at which the server will be listening
 	Address string
+
+	// LogStore is the backend used to store the raft log, bolt if empty
+	LogStore LogStore
+
+	// LogCacheSize is the number of recent log entries cached in memory, 0 disables the cache
+	LogCacheSize int
+
+	// Transport is used in place of a TCP transport listening on Address when set,
+	// such as an in-memory transport for tests
+	Transport raft.Transport
+
+	// Stores are used in place of the LogStore backend when set, they are not closed
+	// when the node shuts down so that a node can be restarted with the same state
+	Stores *Stores
+
+	// Tune is used to adjust the raft configuration when set, such as to shorten timeouts in tests
+	Tune func(*raft.Config)
+}
+
+// Stores are the stores holding the state of a node
+type Stores struct {
+	Log       raft.LogStore
+	Stable    raft.StableStore
+	Snapshots raft.SnapshotStore
+}
+
+// Resumer is implemented by a fsm that keeps part of its state on disk across restarts
+// Resume is called before raft restores the latest snapshot and replays the log, with the metadata
+// of that snapshot, nil if there is none, and the log, so the fsm can check its state is still part of them
+type Resumer interface {
+	Resume(snapshot *raft.SnapshotMeta, logs raft.LogStore) error
 }
 
 // NewConsensusConfig creates a new consensus config
@@ -41,55 +82,177 @@ func NewConsensus(fsm raft.FSM, conf *Config) (*Consensus, error) {
 	// Create the raft configuration
 	config := raft.DefaultConfig()
 	config.LocalID = raft.ServerID(conf.ServerID)
+	if conf.Tune != nil {
+		conf.Tune(config)
+	}
 
 	// Set the snapshot interval to 1 second and the snapshot threshold to 1
 	// so a snapshot is taken after every log entry for testing
 	// config.SnapshotInterval = 1 * time.Second
 	// config.SnapshotThreshold = 1
 
-	// Create the raft store
-	store, err := raftboltdb.NewBoltStore(filepath.Join(conf.BaseDirectory, "raft.db"))
+	// Create the raft stores
+	stores, closer, err := newStores(conf)
 	if err != nil {
 		return nil, err
 	}
-	logStore, stableStore := store, store
 
-	// Create the snapshot store
-	snapshotStore, err := raft.NewFileSnapshotStore(conf.BaseDirectory, 2, os.Stderr)
-	if err != nil {
-		return nil, err
+	// Let the fsm check the state it kept against the stores before raft restores them
+	if resumer, ok := fsm.(Resumer); ok {
+		if err := resume(resumer, stores); err != nil {
+			closer.Close()
+			return nil, err
+		}
 	}
 
 	// Create the transport
-	address, err := net.ResolveTCPAddr("tcp", conf.Address)
-	if err != nil {
-		return nil, err
-	}
-	transport, err := raft.NewTCPTransport(conf.Address, address, 3, 10*time.Second, os.Stderr)
-	if err != nil {
-		return nil, err
+	transport := conf.Transport
+	if transport == nil {
+		address, err := net.ResolveTCPAddr("tcp", conf.Address)
+		if err != nil {
+			closer.Close()
+			return nil, err
+		}
+		transport, err = raft.NewTCPTransport(conf.Address, address, 3, 10*time.Second, os.Stderr)
+		if err != nil {
+			closer.Close()
+			return nil, err
+		}
 	}
 
 	// Create the raft node
-	node, err := raft.NewRaft(config, fsm, logStore, stableStore, snapshotStore, transport)
+	node, err := raft.NewRaft(config, fsm, stores.Log, stores.Stable, stores.Snapshots, transport)
 	if err != nil {
+		if t, ok := transport.(raft.WithClose); ok {
+			t.Close()
+		}
+		closer.Close()
 		return nil, err
 	}
 
+	// The configured address is kept as given, the transport may have resolved it
+	c := &Consensus{Node: node, id: config.LocalID, address: raft.ServerAddress(conf.Address), logStore: closer, snapshots: stores.Snapshots}
+	if c.address == "" {
+		c.address = transport.LocalAddr()
+	}
+
 	// If the server is the leader, bootstrap the cluster
 	if conf.IsLeader {
-		configuration := raft.Configuration{
-			Servers: []raft.Server{
-				{
-					ID:      raft.ServerID(conf.ServerID),
-					Address: raft.ServerAddress(conf.Address),
-				},
-			},
+		if err := c.Bootstrap([]raft.Server{{ID: c.id, Address: c.address}}); err != nil {
+			c.Shutdown()
+			return nil, err
 		}
-		node.BootstrapCluster(configuration)
 	}
 
-	return &Consensus{Node: node}, nil
+	return c, nil
+}
+
+// newStores is used to create the stores configured for a node
+// The returned closer releases the stores created here, rather than passed in the config
+func newStores(conf *Config) (*Stores, io.Closer, error) {
+	if conf.Stores != nil {
+		return conf.Stores, nopCloser{}, nil
+	}
+
+	store, closer, err := newLogStore(conf.LogStore, conf.BaseDirectory)
+	if err != nil {
+		return nil, nil, err
+	}
+	stores := &Stores{Log: store, Stable: store}
+
+	// Wrap the log store with a cache of the most recent entries
+	if conf.LogCacheSize > 0 {
+		stores.Log, err = raft.NewLogCache(conf.LogCacheSize, store)
+		if err != nil {
+			closer.Close()
+			return nil, nil, err
+		}
+	}
+
+	// Create the snapshot store, an ephemeral log is paired with ephemeral snapshots
+	if conf.LogStore == LogStoreInmem {
+		stores.Snapshots = raft.NewInmemSnapshotStore()
+	} else {
+		stores.Snapshots, err = raft.NewFileSnapshotStore(conf.BaseDirectory, 2, os.Stderr)
+		if err != nil {
+			closer.Close()
+			return nil, nil, err
+		}
+	}
+
+	return stores, closer, nil
+}
+
+// resume is used to call the resumer with the latest snapshot and the log of the stores
+func resume(resumer Resumer, stores *Stores) error {
+	snapshots, err := stores.Snapshots.List()
+	if err != nil {
+		return err
+	}
+
+	var latest *raft.SnapshotMeta
+	if len(snapshots) > 0 {
+		latest = snapshots[0]
+	}
+	return resumer.Resume(latest, stores.Log)
+}
+
+// ID is used to get the server id of this node
+func (c *Consensus) ID() string {
+	return string(c.id)
+}
+
+// Address is used to get the raft address of this node
+func (c *Consensus) Address() string {
+	return string(c.address)
+}
+
+// Bootstrap is used to bootstrap a new cluster with the given voters
+// Every server of a new cluster can bootstrap it with the same configuration, and bootstrapping a node
+// that already has state does nothing, so it is safe to call again after a restart
+func (c *Consensus) Bootstrap(servers []raft.Server) error {
+	err := c.Node.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+	if errors.Is(err, raft.ErrCantBootstrap) {
+		return nil
+	}
+	return err
+}
+
+// Backup is used to take a snapshot of the state and to open it for reading
+// When nothing was applied since the last snapshot, raft refuses to take one and the last snapshot is opened instead
+func (c *Consensus) Backup() (*raft.SnapshotMeta, io.ReadCloser, error) {
+	future := c.Node.Snapshot()
+	err := future.Error()
+	if errors.Is(err, raft.ErrNothingNewToSnapshot) {
+		snapshots, err := c.snapshots.List()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(snapshots) == 0 {
+			return nil, nil, errors.New("no snapshot to back up")
+		}
+		return c.snapshots.Open(snapshots[0].ID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return future.Open()
+}
+
+// Restore is used to replace the state of the cluster with the snapshot of the given size
+// It must be called on the leader, and the configuration of the cluster is kept rather than restored
+func (c *Consensus) Restore(snapshot io.Reader, size int64, timeout time.Duration) error {
+	meta := &raft.SnapshotMeta{Version: raft.SnapshotVersionMax, Size: size}
+	return c.Node.Restore(meta, snapshot, timeout)
+}
+
+// Shutdown is used to shutdown the node and close its log store
+func (c *Consensus) Shutdown() error {
+	err := c.Node.Shutdown().Error()
+	if c.logStore != nil {
+		err = errors.Join(err, c.logStore.Close())
+	}
+	return err
 }
 
 // Join joins the raft cluster
@@ -123,6 +286,11 @@ func (c *Consensus) Join(nodeID, address string) error {
 	return nil
 }
 
+// Remove removes a node from the raft cluster
+func (c *Consensus) Remove(nodeID string) error {
+	return c.Node.RemoveServer(raft.ServerID(nodeID), 0, 0).Error()
+}
+
 // WaitForNodeToBeLeader waits for the node to become the leader
 func (c *Consensus) WaitForNodeToBeLeader(duration time.Duration) error {
 	timeout := time.After(duration)
@@ -61,6 +61,20 @@ func TestNodes(t *testing.T) {
 		}
 	})
 
+	t.Run("TestBootstrapAgain", func(t *testing.T) {
+		servers := []raft.Server{{ID: "node1", Address: "localhost:8000"}, {ID: "node3", Address: "localhost:8002"}}
+		if err := node1.Bootstrap(servers); err != nil {
+			t.Errorf("expected no error, got: %v", err)
+		}
+		future := node1.Node.GetConfiguration()
+		if err := future.Error(); err != nil || len(future.Configuration().Servers) != 1 {
+			t.Errorf("expected the configuration to be unchanged, got %v, %v", future.Configuration().Servers, err)
+		}
+		if node1.ID() != "node1" || node1.Address() != "localhost:8000" {
+			t.Errorf("expected node1 at localhost:8000, got %s at %s", node1.ID(), node1.Address())
+		}
+	})
+
 	tmpDir2, err := os.MkdirTemp("", "node2")
 	if err != nil {
 		t.Fatalf("Failed to create temp dir: %v", err)
@@ -0,0 +1,143 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	raftwal "github.com/hashicorp/raft-wal"
+	"github.com/hashicorp/raft-wal/metadb"
+	"go.etcd.io/bbolt"
+)
+
+// The keys raft keeps its stable state under
+var (
+	keyCurrentTerm  = []byte("CurrentTerm")
+	keyLastVoteTerm = []byte("LastVoteTerm")
+	keyLastVoteCand = []byte("LastVoteCand")
+)
+
+// StableState is the state raft keeps in the stable store of a node
+type StableState struct {
+	// CurrentTerm is the latest term the node has seen
+	CurrentTerm uint64
+
+	// LastVoteTerm and LastVoteCandidate are the term of the last vote the node cast and the raft address
+	// of the server it voted for
+	LastVoteTerm      uint64
+	LastVoteCandidate string
+}
+
+// inspectLockTimeout is how long opening the log of a node waits for the node to release it
+const inspectLockTimeout = time.Second
+
+// OpenStores is used to open the stores a node keeps in the directory without starting raft, to inspect them
+// Opening fails if the node is running: a bolt log is opened read-only, and a wal log, which can only be
+// opened for writing, is only opened once its metadata is known not to be locked by the node
+func OpenStores(backend LogStore, dir string) (*Stores, io.Closer, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, nil, err
+	}
+
+	var store logStore
+	var closer io.Closer
+	switch backend {
+	case LogStoreBolt, "":
+		path := filepath.Join(dir, "raft.db")
+		if _, err := os.Stat(path); err != nil {
+			return nil, nil, err
+		}
+		bolt, err := raftboltdb.New(raftboltdb.Options{
+			Path:        path,
+			BoltOptions: &bbolt.Options{ReadOnly: true, Timeout: inspectLockTimeout},
+		})
+		if errors.Is(err, bbolt.ErrTimeout) {
+			return nil, nil, errLocked(path, err)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		store, closer = bolt, bolt
+	case LogStoreWAL:
+		path := filepath.Join(dir, "wal")
+		if _, err := os.Stat(path); err != nil {
+			return nil, nil, err
+		}
+		if err := checkUnlocked(filepath.Join(path, metadb.FileName)); err != nil {
+			return nil, nil, err
+		}
+		wal, err := raftwal.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		store, closer = wal, wal
+	default:
+		return nil, nil, fmt.Errorf("log store %q can not be inspected", backend)
+	}
+
+	snapshots, err := raft.NewFileSnapshotStore(dir, 2, io.Discard)
+	if err != nil {
+		closer.Close()
+		return nil, nil, err
+	}
+
+	return &Stores{Log: store, Stable: store, Snapshots: snapshots}, closer, nil
+}
+
+// checkUnlocked is used to check that the bolt database at the path is not held by a running node
+// The wal waits for the lock of its metadata without a timeout, so the lock is taken read-only and released first
+func checkUnlocked(path string) error {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{ReadOnly: true, Timeout: inspectLockTimeout})
+	if errors.Is(err, bbolt.ErrTimeout) {
+		return errLocked(path, err)
+	}
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// errLocked is used to get the error for a log that is locked by a running node
+func errLocked(path string, err error) error {
+	return fmt.Errorf("%s is locked, the node may still be running: %w", path, err)
+}
+
+// ReadStableState is used to read the term and vote raft keeps in the stable store
+// A node that never started an election has no vote, which is read as zero values
+func ReadStableState(stable raft.StableStore) (StableState, error) {
+	var state StableState
+	var err error
+	if state.CurrentTerm, err = getUint64(stable, keyCurrentTerm); err != nil {
+		return state, err
+	}
+	if state.LastVoteTerm, err = getUint64(stable, keyLastVoteTerm); err != nil {
+		return state, err
+	}
+
+	candidate, err := stable.Get(keyLastVoteCand)
+	if err != nil && !isNotFound(err) {
+		return state, err
+	}
+	state.LastVoteCandidate = string(candidate)
+	return state, nil
+}
+
+// getUint64 is used to read a key of the stable store, zero if it was never set
+func getUint64(stable raft.StableStore, key []byte) (uint64, error) {
+	value, err := stable.GetUint64(key)
+	if err != nil && !isNotFound(err) {
+		return 0, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// isNotFound is used to check if the error of a stable store is a key that was never set
+// Bolt and wal report it with errors of their own
+func isNotFound(err error) bool {
+	return errors.Is(err, raftboltdb.ErrKeyNotFound) || errors.Is(err, raftwal.ErrNotFound)
+}
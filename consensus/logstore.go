@@ -0,0 +1,80 @@
+package consensus
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	raftwal "github.com/hashicorp/raft-wal"
+)
+
+// LogStore is the backend used to store the raft log and stable state
+type LogStore string
+
+const (
+	// LogStoreBolt stores the log in a BoltDB file at raft.db
+	LogStoreBolt LogStore = "bolt"
+
+	// LogStoreInmem stores the log and snapshots in memory, for tests and ephemeral clusters
+	// Everything is lost when the node stops, so a restarted node must rejoin as a new server
+	LogStoreInmem LogStore = "inmem"
+
+	// LogStoreWAL stores the log in append-only segment files in the wal directory
+	LogStoreWAL LogStore = "wal"
+)
+
+// ParseLogStore is used to parse the name of a log store, defaulting to bolt
+func ParseLogStore(name string) (LogStore, error) {
+	switch store := LogStore(name); store {
+	case "":
+		return LogStoreBolt, nil
+	case LogStoreBolt, LogStoreInmem, LogStoreWAL:
+		return store, nil
+	default:
+		return "", fmt.Errorf("unknown log store %q", name)
+	}
+}
+
+// logStore is a log store that also holds the stable state
+type logStore interface {
+	raft.LogStore
+	raft.StableStore
+}
+
+// newLogStore creates the log store for the given backend in the directory
+// The returned closer releases the files held by the store
+func newLogStore(backend LogStore, dir string) (logStore, io.Closer, error) {
+	switch backend {
+	case LogStoreBolt, "":
+		store, err := raftboltdb.NewBoltStore(filepath.Join(dir, "raft.db"))
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store, nil
+	case LogStoreInmem:
+		return raft.NewInmemStore(), nopCloser{}, nil
+	case LogStoreWAL:
+		dir = filepath.Join(dir, "wal")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, nil, err
+		}
+		store, err := raftwal.Open(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown log store %q", backend)
+	}
+}
+
+// nopCloser is the closer of stores that hold no files
+type nopCloser struct{}
+
+// Close is used to implement the io.Closer interface
+func (nopCloser) Close() error {
+	return nil
+}
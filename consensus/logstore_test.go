@@ -0,0 +1,222 @@
+package consensus
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// backends are the log stores exercised by the tests and benchmarks
+var backends = []LogStore{LogStoreBolt, LogStoreInmem, LogStoreWAL}
+
+func TestParseLogStore(t *testing.T) {
+	for name, expected := range map[string]LogStore{"": LogStoreBolt, "bolt": LogStoreBolt, "inmem": LogStoreInmem, "wal": LogStoreWAL} {
+		if store, err := ParseLogStore(name); err != nil || store != expected {
+			t.Errorf("%q: expected %v, got %v, %v", name, expected, store, err)
+		}
+	}
+	if _, err := ParseLogStore("sqlite"); err == nil {
+		t.Error("expected error for unknown log store")
+	}
+}
+
+func TestLogStores(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(string(backend), func(t *testing.T) {
+			dir := t.TempDir()
+
+			store, closer, err := newLogStore(backend, dir)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			logs := make([]*raft.Log, 10)
+			for i := range logs {
+				logs[i] = &raft.Log{Index: uint64(i + 1), Term: 1, Type: raft.LogCommand, Data: []byte{byte(i)}}
+			}
+			if err := store.StoreLogs(logs); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if err := store.SetUint64([]byte("CurrentTerm"), 1); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			var log raft.Log
+			if err := store.GetLog(5, &log); err != nil || !bytes.Equal(log.Data, []byte{4}) {
+				t.Errorf("expected log 5, got %v, %v", log, err)
+			}
+			if err := store.DeleteRange(1, 5); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if first, _ := store.FirstIndex(); first != 6 {
+				t.Errorf("expected first index 6, got %d", first)
+			}
+
+			if err := closer.Close(); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if backend == LogStoreInmem {
+				return
+			}
+
+			// Durable backends keep the log and stable state when reopened
+			store, closer, err = newLogStore(backend, dir)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			defer closer.Close()
+
+			if last, _ := store.LastIndex(); last != 10 {
+				t.Errorf("expected last index 10, got %d", last)
+			}
+			if term, _ := store.GetUint64([]byte("CurrentTerm")); term != 1 {
+				t.Errorf("expected term 1, got %d", term)
+			}
+		})
+	}
+}
+
+func TestNewConsensusLogStore(t *testing.T) {
+	node, err := NewConsensus(&MockFSM{}, &Config{
+		IsLeader:      true,
+		ServerID:      "node1",
+		BaseDirectory: t.TempDir(),
+		Address:       "localhost:8002",
+		LogStore:      LogStoreWAL,
+		LogCacheSize:  64,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer node.Shutdown()
+
+	if err := node.WaitForNodeToBeLeader(5 * time.Second); err != nil {
+		t.Fatalf("expected node1 to be leader, got: %v", err)
+	}
+	if err := node.Node.Apply([]byte("command"), time.Second).Error(); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+}
+
+// BenchmarkLogStore compares the throughput of each backend, with and without a log cache
+// Run with: go test ./consensus -run XXX -bench LogStore
+func BenchmarkLogStore(b *testing.B) {
+	data := bytes.Repeat([]byte{0xab}, 256)
+	const batch = 64
+
+	for _, backend := range backends {
+		for _, cache := range []int{0, 512} {
+			open := func(b *testing.B) (raft.LogStore, func()) {
+				store, closer, err := newLogStore(backend, b.TempDir())
+				if err != nil {
+					b.Fatal(err)
+				}
+				if cache == 0 {
+					return store, func() { closer.Close() }
+				}
+				cached, err := raft.NewLogCache(cache, store)
+				if err != nil {
+					b.Fatal(err)
+				}
+				return cached, func() { closer.Close() }
+			}
+			name := fmt.Sprintf("%s/cache=%d", backend, cache)
+
+			b.Run(name+"/StoreLogs", func(b *testing.B) {
+				store, done := open(b)
+				defer done()
+
+				logs := make([]*raft.Log, batch)
+				b.SetBytes(int64(batch * len(data)))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					for j := range logs {
+						logs[j] = &raft.Log{Index: uint64(i*batch + j + 1), Term: 1, Data: data}
+					}
+					if err := store.StoreLogs(logs); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+
+			b.Run(name+"/GetLog", func(b *testing.B) {
+				store, done := open(b)
+				defer done()
+
+				// Followers and the leader mostly read back entries that were just written
+				logs := make([]*raft.Log, batch)
+				for j := range logs {
+					logs[j] = &raft.Log{Index: uint64(j + 1), Term: 1, Data: data}
+				}
+				if err := store.StoreLogs(logs); err != nil {
+					b.Fatal(err)
+				}
+
+				var log raft.Log
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := store.GetLog(uint64(i%batch+1), &log); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestOpenStores(t *testing.T) {
+	for _, backend := range []LogStore{LogStoreBolt, LogStoreWAL} {
+		t.Run(string(backend), func(t *testing.T) {
+			dir := t.TempDir()
+
+			store, closer, err := newLogStore(backend, dir)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if err := store.StoreLogs([]*raft.Log{{Index: 1, Term: 3, Type: raft.LogCommand, Data: []byte{1}}}); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if err := store.SetUint64(keyCurrentTerm, 3); err != nil {
+				t.Fatal(err)
+			}
+
+			// A log held by a running node is reported rather than waited on
+			if _, _, err := OpenStores(backend, dir); err == nil || !strings.Contains(err.Error(), "locked") {
+				t.Errorf("expected the log to be locked, got: %v", err)
+			}
+			if err := closer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			stores, closer, err := OpenStores(backend, dir)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			defer closer.Close()
+
+			var log raft.Log
+			if err := stores.Log.GetLog(1, &log); err != nil || log.Term != 3 {
+				t.Errorf("expected log 1 of term 3, got %v, %v", log, err)
+			}
+			state, err := ReadStableState(stores.Stable)
+			if err != nil || state != (StableState{CurrentTerm: 3}) {
+				t.Errorf("expected term 3 without a vote, got %+v, %v", state, err)
+			}
+			if snapshots, err := stores.Snapshots.List(); err != nil || len(snapshots) != 0 {
+				t.Errorf("expected no snapshots, got %v, %v", snapshots, err)
+			}
+		})
+	}
+
+	if _, _, err := OpenStores(LogStoreBolt, filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+	if _, _, err := OpenStores(LogStoreInmem, t.TempDir()); err == nil {
+		t.Error("expected an error for an in-memory log")
+	}
+}
@@ -0,0 +1,33 @@
+package consensus
+
+import (
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	prometheussink "github.com/armon/go-metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsExpiration is how long a raft metric is exported after it was last emitted
+// Raft only emits most metrics while it is the leader, so stale ones are dropped after a failover
+const metricsExpiration = 5 * time.Minute
+
+// RegisterMetrics is used to export the go-metrics emitted by raft, such as commit and replication timings
+// Raft emits them to a process wide sink, so this must be called at most once per process
+func RegisterMetrics(registerer prometheus.Registerer) error {
+	sink, err := prometheussink.NewPrometheusSinkFrom(prometheussink.PrometheusOpts{
+		Name:       "raft_metrics_sink",
+		Expiration: metricsExpiration,
+		Registerer: registerer,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Raft prefixes its own metric names, and the go collector already exports runtime metrics
+	conf := metrics.DefaultConfig("")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+	_, err = metrics.NewGlobal(conf, sink)
+	return err
+}
@@ -0,0 +1,151 @@
+// Package discovery finds the HTTP addresses of the nodes of a cluster
+// Peers are listed statically, resolved from DNS A or SRV records such as those of a headless service,
+// or read from a file that is reloaded whenever it changes, and are looked up again on every call
+// so that nodes added to a deployment are found without restarting the others
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// dnsPrefix marks a host and port whose host is resolved from its A and AAAA records
+	dnsPrefix = "dns+"
+
+	// srvPrefix marks a name resolved from its SRV records, which give the host and port of each peer
+	srvPrefix = "dnssrv+"
+
+	// filePrefix marks a file listing the addresses of the peers
+	filePrefix = "file+"
+)
+
+// Peers is used to get the HTTP addresses of the nodes of the cluster, which may include this node
+type Peers func(ctx context.Context) ([]string, error)
+
+// Static is used to get peers from a fixed list of addresses
+func Static(addresses []string) Peers {
+	return func(ctx context.Context) ([]string, error) {
+		return addresses, nil
+	}
+}
+
+// Resolver is the DNS resolver peers are looked up with, it is implemented by net.Resolver
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNS is used to get a peer at the port for every address the host resolves to
+func DNS(resolver Resolver, host, port string) Peers {
+	return func(ctx context.Context) ([]string, error) {
+		ips, err := resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+
+		addresses := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			addresses = append(addresses, net.JoinHostPort(ip, port))
+		}
+		return addresses, nil
+	}
+}
+
+// SRV is used to get a peer for every SRV record of the name, such as _http._tcp.queue.default.svc.cluster.local
+func SRV(resolver Resolver, name string) Peers {
+	return func(ctx context.Context) ([]string, error) {
+		_, records, err := resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", name, err)
+		}
+
+		addresses := make([]string, 0, len(records))
+		for _, record := range records {
+			addresses = append(addresses, net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))))
+		}
+		return addresses, nil
+	}
+}
+
+// Parse is used to get the peers of every spec, which is one of
+//
+//	host:port          a static address
+//	dns+host:port      every address of the host, at the port
+//	dnssrv+name        every target and port of the SRV records of the name
+//	file+path          every address listed in the file
+//
+// The peers found by every spec are merged, and a spec that fails is only an error if every spec fails
+func Parse(specs []string, resolver Resolver) (Peers, error) {
+	var static []string
+	var dynamic []Peers
+	for _, spec := range specs {
+		switch {
+		case strings.HasPrefix(spec, dnsPrefix):
+			host, port, err := net.SplitHostPort(strings.TrimPrefix(spec, dnsPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("invalid peer %q: %w", spec, err)
+			}
+			dynamic = append(dynamic, DNS(resolver, host, port))
+		case strings.HasPrefix(spec, srvPrefix):
+			name := strings.TrimPrefix(spec, srvPrefix)
+			if name == "" {
+				return nil, fmt.Errorf("invalid peer %q: missing name", spec)
+			}
+			dynamic = append(dynamic, SRV(resolver, name))
+		case strings.HasPrefix(spec, filePrefix):
+			path := strings.TrimPrefix(spec, filePrefix)
+			if path == "" {
+				return nil, fmt.Errorf("invalid peer %q: missing path", spec)
+			}
+			dynamic = append(dynamic, File(path))
+		default:
+			if _, _, err := net.SplitHostPort(spec); err != nil {
+				return nil, fmt.Errorf("invalid peer %q: %w", spec, err)
+			}
+			static = append(static, spec)
+		}
+	}
+
+	if len(dynamic) == 0 {
+		return Static(static), nil
+	}
+	return merge(static, dynamic), nil
+}
+
+// merge is used to get the static addresses along with those found by the dynamic peers, sorted and without duplicates
+func merge(static []string, dynamic []Peers) Peers {
+	return func(ctx context.Context) ([]string, error) {
+		seen := map[string]bool{}
+		for _, address := range static {
+			seen[address] = true
+		}
+
+		var errs []error
+		for _, peers := range dynamic {
+			addresses, err := peers(ctx)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, address := range addresses {
+				seen[address] = true
+			}
+		}
+		if len(errs) == len(dynamic) && len(static) == 0 {
+			return nil, errors.Join(errs...)
+		}
+
+		addresses := make([]string, 0, len(seen))
+		for address := range seen {
+			addresses = append(addresses, address)
+		}
+		sort.Strings(addresses)
+		return addresses, nil
+	}
+}
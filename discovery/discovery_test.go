@@ -0,0 +1,229 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// stub is a DNS server answering A and SRV queries from records that can be changed while it runs
+type stub struct {
+	lock sync.Mutex
+	a    map[string][]string
+	srv  map[string][]net.SRV
+}
+
+// serve is used to answer queries on the connection until it is closed
+func (s *stub) serve(conn net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var query dnsmessage.Message
+		if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+			continue
+		}
+		answer := s.answer(query)
+		response, err := answer.Pack()
+		if err != nil {
+			continue
+		}
+		conn.WriteTo(response, addr)
+	}
+}
+
+// answer is used to build the response to a query
+func (s *stub) answer(query dnsmessage.Message) dnsmessage.Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	question := query.Questions[0]
+	name := question.Name.String()
+	response := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true},
+		Questions: query.Questions,
+	}
+
+	_, hasA := s.a[name]
+	_, hasSRV := s.srv[name]
+	if !hasA && !hasSRV {
+		response.RCode = dnsmessage.RCodeNameError
+		return response
+	}
+
+	header := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 0}
+	switch question.Type {
+	case dnsmessage.TypeA:
+		for _, ip := range s.a[name] {
+			var a dnsmessage.AResource
+			copy(a.A[:], net.ParseIP(ip).To4())
+			header.Type = dnsmessage.TypeA
+			response.Answers = append(response.Answers, dnsmessage.Resource{Header: header, Body: &a})
+		}
+	case dnsmessage.TypeSRV:
+		for _, record := range s.srv[name] {
+			header.Type = dnsmessage.TypeSRV
+			response.Answers = append(response.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.SRVResource{
+				Priority: record.Priority,
+				Weight:   record.Weight,
+				Port:     record.Port,
+				Target:   dnsmessage.MustNewName(record.Target),
+			}})
+		}
+	}
+	return response
+}
+
+// set is used to replace the A records of the name
+func (s *stub) set(name string, ips ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.a[name] = ips
+}
+
+// resolver is used to start a DNS stub with the records, and to get a resolver that queries it
+func resolver(t *testing.T, s *stub) *net.Resolver {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve(conn)
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+}
+
+func equal(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
+
+func TestDNS(t *testing.T) {
+	s := &stub{
+		a: map[string][]string{"queue.test.": {"10.0.0.1", "10.0.0.2"}},
+		srv: map[string][]net.SRV{"_http._tcp.queue.test.": {
+			{Target: "node01.queue.test.", Port: 3000, Priority: 10, Weight: 1},
+			{Target: "node02.queue.test.", Port: 3002, Priority: 10, Weight: 1},
+		}},
+	}
+	r := resolver(t, s)
+	ctx := context.Background()
+
+	// Scaling the deployment adds records, which are found on the next lookup
+	peers := DNS(r, "queue.test", "3000")
+	for _, expected := range [][]string{
+		{"10.0.0.1:3000", "10.0.0.2:3000"},
+		{"10.0.0.1:3000", "10.0.0.2:3000", "10.0.0.3:3000"},
+	} {
+		addresses, err := peers(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if !equal(addresses, expected) {
+			t.Errorf("expected %v, got %v", expected, addresses)
+		}
+		s.set("queue.test.", "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	}
+
+	addresses, err := SRV(r, "_http._tcp.queue.test")(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	sort.Strings(addresses)
+	if !equal(addresses, []string{"node01.queue.test:3000", "node02.queue.test:3002"}) {
+		t.Errorf("expected the targets of the SRV records, got %v", addresses)
+	}
+
+	if _, err := DNS(r, "missing.test", "3000")(ctx); err == nil {
+		t.Error("expected an error for a missing name")
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers")
+	write := func(content string, modified time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	peers := File(path)
+	ctx := context.Background()
+	if _, err := peers(ctx); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+
+	now := time.Now()
+	write("# peers of the cluster\nlocalhost:3000\n\nlocalhost:3002, localhost:3004\n", now)
+	if addresses, err := peers(ctx); err != nil || !equal(addresses, []string{"localhost:3000", "localhost:3002", "localhost:3004"}) {
+		t.Errorf("expected the listed peers, got %v, %v", addresses, err)
+	}
+
+	// The file is read again once it changes
+	write("localhost:3006\n", now.Add(time.Second))
+	if addresses, err := peers(ctx); err != nil || !equal(addresses, []string{"localhost:3006"}) {
+		t.Errorf("expected the changed peers, got %v, %v", addresses, err)
+	}
+
+	write("localhost\n", now.Add(2*time.Second))
+	if _, err := peers(ctx); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("expected an error for the invalid line, got: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	r := resolver(t, &stub{a: map[string][]string{"queue.test.": {"10.0.0.1"}}, srv: map[string][]net.SRV{}})
+	file := filepath.Join(t.TempDir(), "peers")
+	if err := os.WriteFile(file, []byte("localhost:3002\nlocalhost:3000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// The peers of every spec are merged without duplicates
+	peers, err := Parse([]string{"localhost:3000", "dns+queue.test:3000", "file+" + file}, r)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	addresses, err := peers(ctx)
+	if err != nil || !equal(addresses, []string{"10.0.0.1:3000", "localhost:3000", "localhost:3002"}) {
+		t.Errorf("expected the merged peers, got %v, %v", addresses, err)
+	}
+
+	// A spec that fails is skipped while others find peers
+	peers, _ = Parse([]string{"dns+missing.test:3000", "file+" + file}, r)
+	if addresses, err := peers(ctx); err != nil || len(addresses) != 2 {
+		t.Errorf("expected the peers of the file, got %v, %v", addresses, err)
+	}
+	peers, _ = Parse([]string{"dns+missing.test:3000"}, r)
+	if _, err := peers(ctx); err == nil {
+		t.Error("expected an error when no spec finds peers")
+	}
+
+	for _, spec := range []string{"localhost", "dns+queue.test", "dnssrv+", "file+"} {
+		if _, err := Parse([]string{spec}, r); err == nil {
+			t.Errorf("expected %q to be invalid", spec)
+		}
+	}
+}
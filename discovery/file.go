@@ -0,0 +1,77 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileState is the content of a peers file as of its last modification
+type fileState struct {
+	lock      sync.Mutex
+	modified  time.Time
+	size      int64
+	addresses []string
+}
+
+// File is used to get the peers listed in a file, one or more per line separated by commas
+// Blank lines and lines starting with # are ignored, and the file is read again whenever it changes
+func File(path string) Peers {
+	state := &fileState{}
+	return func(ctx context.Context) ([]string, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read peers file: %w", err)
+		}
+
+		state.lock.Lock()
+		defer state.lock.Unlock()
+
+		if state.addresses != nil && info.ModTime().Equal(state.modified) && info.Size() == state.size {
+			return state.addresses, nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read peers file: %w", err)
+		}
+		addresses, err := parseFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse peers file %s: %w", path, err)
+		}
+
+		state.modified = info.ModTime()
+		state.size = info.Size()
+		state.addresses = addresses
+		return addresses, nil
+	}
+}
+
+// parseFile is used to get the addresses listed in the content of a peers file
+func parseFile(data []byte) ([]string, error) {
+	addresses := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, address := range strings.Split(line, ",") {
+			address = strings.TrimSpace(address)
+			if address == "" {
+				continue
+			}
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses, scanner.Err()
+}
@@ -5,6 +5,9 @@ import "sync"
 // Message is a generic message type
 type Message[T any] struct {
 	Data T
+
+	// Headers are the metadata carried along with the data, such as the trace context of the producer
+	Headers map[string]string `json:",omitempty"`
 }
 
 // Queue is a generic queue type
@@ -41,13 +44,31 @@ func (q *Queue[T]) Dequeue() (Message[T], bool) {
 	return message, true
 }
 
-// Copy is used to create a copy of the queue
+// Peek is used to get up to max messages from the front of the queue without removing them
+func (q *Queue[T]) Peek(max int) []Message[T] {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	return append([]Message[T](nil), q.Messages[:min(max, len(q.Messages))]...)
+}
+
+// Copy is used to create a copy of the queue in constant time
+// Messages are never modified in place: Enqueue only writes past the end of the
+// slice and Dequeue only moves its start, so the copy can share the backing array
 func (q *Queue[T]) Copy() *Queue[T] {
 	q.lock.RLock()
 	defer q.lock.RUnlock()
 
 	copy := NewQueue[T]()
-	copy.Messages = append(copy.Messages, q.Messages...)
+	copy.Messages = q.Messages[:len(q.Messages):len(q.Messages)]
 
 	return copy
 }
+
+// Len is used to get the number of messages in the queue
+func (q *Queue[T]) Len() int {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	return len(q.Messages)
+}
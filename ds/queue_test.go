@@ -30,6 +30,19 @@ func TestDequeue(t *testing.T) {
 	}
 }
 
+func TestPeek(t *testing.T) {
+	q := NewQueue[int]()
+	q.Enqueue(Message[int]{Data: 1})
+	q.Enqueue(Message[int]{Data: 2})
+
+	if messages := q.Peek(1); len(messages) != 1 || messages[0].Data != 1 {
+		t.Errorf("Peek(1) = %v; want [1]", messages)
+	}
+	if messages := q.Peek(5); len(messages) != 2 || q.Len() != 2 {
+		t.Errorf("Peek(5) = %v; want [1 2] left in the queue", messages)
+	}
+}
+
 func TestCopy(t *testing.T) {
 	q := NewQueue[int]()
 	q.Enqueue(Message[int]{Data: 1})
@@ -44,3 +57,33 @@ func TestCopy(t *testing.T) {
 		t.Errorf("Copy() = %v; want [1]", copy.Messages)
 	}
 }
+
+func TestCopyIsIndependent(t *testing.T) {
+	q := NewQueue[int]()
+	for i := 0; i < 4; i++ {
+		q.Enqueue(Message[int]{Data: i})
+	}
+	copy := q.Copy()
+
+	// Mutating the original after the copy must not be visible through the copy
+	q.Dequeue()
+	q.Dequeue()
+	for i := 4; i < 16; i++ {
+		q.Enqueue(Message[int]{Data: i})
+	}
+
+	if copy.Len() != 4 {
+		t.Fatalf("Copy() has %d messages; want 4", copy.Len())
+	}
+	for i, message := range copy.Messages {
+		if message.Data != i {
+			t.Errorf("Copy().Messages[%d] = %d; want %d", i, message.Data, i)
+		}
+	}
+
+	// Enqueueing to the copy must not be visible through the original
+	copy.Enqueue(Message[int]{Data: -1})
+	if q.Len() != 14 || q.Messages[2].Data != 4 {
+		t.Errorf("expected original to be unaffected, got %v", q.Messages)
+	}
+}
@@ -0,0 +1,270 @@
+package ds
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultSegmentSize is the number of entries held by a stream segment
+const DefaultSegmentSize = 1024
+
+// StreamEntry is a message retained in a stream at a fixed offset
+type StreamEntry[T any] struct {
+	Offset    uint64
+	Timestamp time.Time
+	Data      T
+}
+
+// Segment is a contiguous run of stream entries that is trimmed as a unit
+type Segment[T any] struct {
+	BaseOffset uint64
+	Entries    []StreamEntry[T]
+}
+
+// Retention is the policy used to trim old segments from a stream
+// A zero value for either field disables that limit
+type Retention struct {
+	// MaxEntries is the number of entries that must be retained at minimum
+	MaxEntries int
+
+	// MaxAge is how long an entry is retained after it was appended
+	MaxAge time.Duration
+}
+
+// Stream is a generic append-only log with consumer group offsets
+type Stream[T any] struct {
+	Segments    []Segment[T]
+	NextOffset  uint64
+	Groups      map[string]uint64
+	SegmentSize int
+	Retention   Retention
+	lock        sync.RWMutex
+}
+
+// NewStream creates a new instance of the Stream
+func NewStream[T any]() *Stream[T] {
+	return &Stream[T]{
+		Groups:      map[string]uint64{},
+		SegmentSize: DefaultSegmentSize,
+	}
+}
+
+// Append is used to add a message to the end of the stream
+// The timestamp is also used as the current time when applying retention
+func (s *Stream[T]) Append(data T, timestamp time.Time) uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	offset := s.NextOffset
+	entry := StreamEntry[T]{Offset: offset, Timestamp: timestamp, Data: data}
+
+	last := len(s.Segments) - 1
+	if last < 0 || len(s.Segments[last].Entries) >= s.segmentSize() {
+		s.Segments = append(s.Segments, Segment[T]{BaseOffset: offset})
+		last++
+	}
+	s.Segments[last].Entries = append(s.Segments[last].Entries, entry)
+	s.NextOffset++
+
+	s.trim(timestamp)
+
+	return offset
+}
+
+// Read is used to read up to max entries starting at the given offset
+// Offsets that have been trimmed are skipped to the first retained entry
+func (s *Stream[T]) Read(offset uint64, max int) []StreamEntry[T] {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	entries := []StreamEntry[T]{}
+	for _, segment := range s.Segments {
+		end := segment.BaseOffset + uint64(len(segment.Entries))
+		if offset >= end {
+			continue
+		}
+
+		start := 0
+		if offset > segment.BaseOffset {
+			start = int(offset - segment.BaseOffset)
+		}
+
+		for _, entry := range segment.Entries[start:] {
+			if max > 0 && len(entries) >= max {
+				return entries
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// Seek is used to find the first offset with a timestamp at or after the given time
+// If every entry is older, the next offset to be appended is returned
+func (s *Stream[T]) Seek(timestamp time.Time) uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, segment := range s.Segments {
+		entries := segment.Entries
+		if len(entries) == 0 || entries[len(entries)-1].Timestamp.Before(timestamp) {
+			continue
+		}
+
+		i := sort.Search(len(entries), func(i int) bool {
+			return !entries[i].Timestamp.Before(timestamp)
+		})
+		return entries[i].Offset
+	}
+
+	return s.NextOffset
+}
+
+// Commit is used to record the next offset the consumer group will read
+func (s *Stream[T]) Commit(group string, offset uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.Groups == nil {
+		s.Groups = map[string]uint64{}
+	}
+	s.Groups[group] = offset
+}
+
+// Offset is used to get the committed offset of the consumer group
+func (s *Stream[T]) Offset(group string) (uint64, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	offset, ok := s.Groups[group]
+	return offset, ok
+}
+
+// Lags is used to get the number of retained entries each consumer group has yet to commit
+// Entries trimmed before a group committed them are no longer counted
+func (s *Stream[T]) Lags() map[string]uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	first := s.NextOffset
+	if len(s.Segments) > 0 {
+		first = s.Segments[0].BaseOffset
+	}
+
+	lags := make(map[string]uint64, len(s.Groups))
+	for group, offset := range s.Groups {
+		lags[group] = s.NextOffset - min(max(offset, first), s.NextOffset)
+	}
+	return lags
+}
+
+// SetRetention is used to replace the retention policy of the stream
+func (s *Stream[T]) SetRetention(retention Retention, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Retention = retention
+	s.trim(now)
+}
+
+// FirstOffset is used to get the offset of the oldest retained entry
+func (s *Stream[T]) FirstOffset() uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if len(s.Segments) == 0 {
+		return s.NextOffset
+	}
+	return s.Segments[0].BaseOffset
+}
+
+// EndOffset is used to get the offset the next entry will be appended at
+// A consumer group that has read every entry commits this offset, so no greater offset can be committed
+func (s *Stream[T]) EndOffset() uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.NextOffset
+}
+
+// SegmentBase is used to get the base offset of the segment holding the entry at the given offset
+// Segments are searched from the newest, as the entry is usually one that was just appended
+func (s *Stream[T]) SegmentBase(offset uint64) uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for i := len(s.Segments) - 1; i >= 0; i-- {
+		if s.Segments[i].BaseOffset <= offset {
+			return s.Segments[i].BaseOffset
+		}
+	}
+	return offset
+}
+
+// Len is used to get the number of retained entries
+func (s *Stream[T]) Len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.len()
+}
+
+// Copy is used to create a copy of the stream
+// Segments are append-only, so the entries backing arrays can be shared
+func (s *Stream[T]) Copy() *Stream[T] {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	copy := &Stream[T]{
+		Segments:    append([]Segment[T]{}, s.Segments...),
+		NextOffset:  s.NextOffset,
+		Groups:      make(map[string]uint64, len(s.Groups)),
+		SegmentSize: s.SegmentSize,
+		Retention:   s.Retention,
+	}
+	for group, offset := range s.Groups {
+		copy.Groups[group] = offset
+	}
+
+	return copy
+}
+
+// trim is used to drop whole segments that fall outside the retention policy
+// The active (last) segment is never dropped
+func (s *Stream[T]) trim(now time.Time) {
+	total := s.len()
+	for len(s.Segments) > 1 {
+		segment := s.Segments[0]
+		size := len(segment.Entries)
+
+		expiredByCount := s.Retention.MaxEntries > 0 && total-size >= s.Retention.MaxEntries
+		expiredByAge := s.Retention.MaxAge > 0 && size > 0 &&
+			now.Sub(segment.Entries[size-1].Timestamp) > s.Retention.MaxAge
+
+		if !expiredByCount && !expiredByAge {
+			return
+		}
+
+		s.Segments = s.Segments[1:]
+		total -= size
+	}
+}
+
+// len is used to count the retained entries, the caller must hold the lock
+func (s *Stream[T]) len() int {
+	total := 0
+	for _, segment := range s.Segments {
+		total += len(segment.Entries)
+	}
+	return total
+}
+
+// segmentSize is used to get the segment size, falling back to the default
+func (s *Stream[T]) segmentSize() int {
+	if s.SegmentSize <= 0 {
+		return DefaultSegmentSize
+	}
+	return s.SegmentSize
+}
@@ -0,0 +1,166 @@
+package ds
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewStream(t *testing.T) {
+	s := NewStream[int]()
+	if s.Len() != 0 || s.NextOffset != 0 {
+		t.Errorf("NewStream() = %d entries, next %d; want 0, 0", s.Len(), s.NextOffset)
+	}
+}
+
+func TestAppendAndRead(t *testing.T) {
+	s := NewStream[int]()
+	s.SegmentSize = 2
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		if offset := s.Append(i, now); offset != uint64(i) {
+			t.Fatalf("Append() = %d; want %d", offset, i)
+		}
+	}
+
+	if len(s.Segments) != 3 {
+		t.Errorf("expected 3 segments, got %d", len(s.Segments))
+	}
+
+	entries := s.Read(1, 3)
+	if len(entries) != 3 || entries[0].Data != 1 || entries[2].Data != 3 {
+		t.Errorf("Read(1, 3) = %v; want [1 2 3]", entries)
+	}
+
+	entries = s.Read(3, 0)
+	if len(entries) != 2 || entries[0].Offset != 3 || entries[1].Offset != 4 {
+		t.Errorf("Read(3, 0) = %v; want offsets [3 4]", entries)
+	}
+
+	if entries := s.Read(5, 0); len(entries) != 0 {
+		t.Errorf("Read(5, 0) = %v; want []", entries)
+	}
+
+	for offset, base := range []uint64{0, 0, 2, 2, 4} {
+		if got := s.SegmentBase(uint64(offset)); got != base {
+			t.Errorf("SegmentBase(%d) = %d; want %d", offset, got, base)
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	s := NewStream[int]()
+	s.SegmentSize = 2
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		s.Append(i, base.Add(time.Duration(i)*time.Minute))
+	}
+
+	if offset := s.Seek(base.Add(90 * time.Second)); offset != 2 {
+		t.Errorf("Seek() = %d; want 2", offset)
+	}
+	if offset := s.Seek(base.Add(-time.Hour)); offset != 0 {
+		t.Errorf("Seek() = %d; want 0", offset)
+	}
+	if offset := s.Seek(base.Add(time.Hour)); offset != 4 {
+		t.Errorf("Seek() = %d; want 4", offset)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	s := NewStream[int]()
+
+	if _, ok := s.Offset("group"); ok {
+		t.Errorf("expected no offset for an unknown group")
+	}
+
+	s.Commit("group", 3)
+	if offset, ok := s.Offset("group"); !ok || offset != 3 {
+		t.Errorf("Offset() = %d, %v; want 3, true", offset, ok)
+	}
+}
+
+func TestLags(t *testing.T) {
+	s := NewStream[int]()
+	s.SegmentSize = 2
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		s.Append(i, base)
+	}
+
+	s.Commit("behind", 1)
+	s.Commit("caught-up", 5)
+	if lags := s.Lags(); lags["behind"] != 4 || lags["caught-up"] != 0 || len(lags) != 2 {
+		t.Errorf("Lags() = %v; want behind 4, caught-up 0", lags)
+	}
+
+	// Entries trimmed before the group committed them are not counted
+	s.SetRetention(Retention{MaxEntries: 1}, base)
+	if lags := s.Lags(); lags["behind"] != s.NextOffset-s.FirstOffset() {
+		t.Errorf("Lags() = %v; want behind %d", lags, s.NextOffset-s.FirstOffset())
+	}
+}
+
+func TestRetention(t *testing.T) {
+	t.Run("MaxEntries", func(t *testing.T) {
+		s := NewStream[int]()
+		s.SegmentSize = 2
+		s.Retention = Retention{MaxEntries: 3}
+
+		now := time.Now()
+		for i := 0; i < 7; i++ {
+			s.Append(i, now)
+		}
+
+		// Segments [0 1] [2 3] are trimmed, [4 5] [6] are retained
+		if first := s.FirstOffset(); first != 4 {
+			t.Errorf("FirstOffset() = %d; want 4", first)
+		}
+		if s.Len() != 3 {
+			t.Errorf("Len() = %d; want 3", s.Len())
+		}
+		if end := s.EndOffset(); end != 7 {
+			t.Errorf("EndOffset() = %d; want 7", end)
+		}
+
+		entries := s.Read(0, 1)
+		if len(entries) != 1 || entries[0].Offset != 4 {
+			t.Errorf("Read(0, 1) = %v; want offset 4", entries)
+		}
+	})
+
+	t.Run("MaxAge", func(t *testing.T) {
+		s := NewStream[int]()
+		s.SegmentSize = 2
+
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < 5; i++ {
+			s.Append(i, base.Add(time.Duration(i)*time.Hour))
+		}
+
+		s.SetRetention(Retention{MaxAge: 90 * time.Minute}, base.Add(4*time.Hour))
+
+		// Segment [0 1] has expired, [2 3] ends within the max age
+		if first := s.FirstOffset(); first != 2 {
+			t.Errorf("FirstOffset() = %d; want 2", first)
+		}
+	})
+}
+
+func TestStreamCopy(t *testing.T) {
+	s := NewStream[int]()
+	s.Append(1, time.Now())
+	s.Commit("group", 1)
+
+	copy := s.Copy()
+	s.Append(2, time.Now())
+	s.Commit("group", 2)
+
+	if copy.Len() != 1 {
+		t.Errorf("Copy() has %d entries; want 1", copy.Len())
+	}
+	if offset, _ := copy.Offset("group"); offset != 1 {
+		t.Errorf("Copy() group offset = %d; want 1", offset)
+	}
+}
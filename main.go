@@ -1,70 +1,67 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
-	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/kavinaravind/go-raft-message-queue/bootstrap"
+	"github.com/kavinaravind/go-raft-message-queue/client"
 	"github.com/kavinaravind/go-raft-message-queue/consensus"
+	"github.com/kavinaravind/go-raft-message-queue/discovery"
 	"github.com/kavinaravind/go-raft-message-queue/model"
 	"github.com/kavinaravind/go-raft-message-queue/server"
 	"github.com/kavinaravind/go-raft-message-queue/store"
+	"github.com/kavinaravind/go-raft-message-queue/telemetry"
+	"gopkg.in/yaml.v3"
 )
 
-type config struct {
-	JoinAddress string
-	Concensus   *consensus.Config
-	Server      *server.Config
-}
+func main() {
+	logger := slog.Default()
 
-func newConfig() *config {
-	return &config{
-		Concensus: consensus.NewConsensusConfig(),
-		Server:    server.NewServerConfig(),
+	conf, opts, err := loadConfig(os.Args[0], os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
 	}
-}
-
-var conf *config
-
-func init() {
-	conf = newConfig()
-
-	// Concensus Specific Flags
-	flag.BoolVar(&conf.Concensus.IsLeader, "leader", false, "Set to true if this node is the leader")
-	flag.StringVar(&conf.Concensus.ServerID, "id", "", "The unique identifier for this server")
-	flag.StringVar(&conf.Concensus.Address, "raddr", "localhost:3001", "The address that the Raft consensus group should use")
-	flag.StringVar(&conf.Concensus.BaseDirectory, "dir", "/tmp", "The base directory for storing Raft data")
-	flag.StringVar(&conf.JoinAddress, "paddr", "", "The address of an existing node to join")
-
-	// Server Specific Flags
-	flag.StringVar(&conf.Server.Address, "haddr", "localhost:3000", "The address that the HTTP server should use")
-
-	// Set Usage Details
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
-		flag.PrintDefaults()
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-}
-
-func main() {
-	flag.Parse()
 
-	logger := slog.Default()
+	if opts.printConfig {
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		if err := enc.Encode(conf); err != nil {
+			logger.Error("Failed to print configuration", "error", err)
+			os.Exit(1)
+		}
+	}
 
-	if conf.Concensus.ServerID == "" {
-		logger.Error("The -id flag is required")
+	settings, err := conf.validate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:")
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintln(os.Stderr, "  "+line)
+		}
 		os.Exit(2)
 	}
+	if opts.printConfig {
+		return
+	}
 
 	// Create the base directory if it does not exist
-	if err := os.MkdirAll(conf.Concensus.BaseDirectory, 0755); err != nil {
+	if err := os.MkdirAll(conf.Consensus.Dir, 0755); err != nil {
 		logger.Error("Failed to create base directory", "error", err)
 		os.Exit(1)
 	}
@@ -72,11 +69,28 @@ func main() {
 	// Create a context with cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 
+	// Install the tracer provider before any spans are started
+	shutdownTracing, err := telemetry.Setup(ctx, settings.telemetry)
+	if err != nil {
+		logger.Error("Failed to setup tracing", "error", err)
+		os.Exit(1)
+	}
+
+	// Messages written before opaque payloads are comments, which the store converts to JSON payloads
+	upgrader := store.NewLegacyUpgrader(model.UpgradeLegacyPayload, model.LegacyData.Payload)
+
 	// Create a new store instance with the given logger
-	store := store.NewStore[model.Comment](logger)
+	store := store.NewStore[model.Payload](logger)
+	store.SetLegacyUpgrader(upgrader)
+	store.SetEncoding(settings.encoding)
+	store.SetSnapshotCompression(settings.compression)
+	store.SetStorage(settings.storage)
+	store.SetHashCheckInterval(conf.Store.HashCheckInterval)
+	store.SetFenceOnDivergence(conf.Store.FenceOnDivergence)
+	store.SetAdvertiseAddress(conf.Server.Address)
 
 	// Initialize the store
-	nodeShutdownComplete, err := store.Initialize(ctx, conf.Concensus)
+	nodeShutdownComplete, err := store.Initialize(ctx, settings.consensus)
 	if err != nil {
 		logger.Error("Failed to initialize store", "error", err)
 		os.Exit(1)
@@ -85,27 +99,41 @@ func main() {
 	// Create a new instance of the server
 	server := server.NewServer(store, logger)
 
+	// Export the metrics emitted by raft along with those of the server and store
+	if err := consensus.RegisterMetrics(server.Registry()); err != nil {
+		logger.Error("Failed to register raft metrics", "error", err)
+	}
+
+	// Set how far behind the commit index the node may be and still be ready
+	server.SetReadyMaxLag(conf.Server.ReadyMaxLag)
+	server.SetMaxRestoreSize(conf.Server.MaxRestoreSize)
+
+	// Attach the typed models to their queues
+	for queue, name := range conf.Server.Models {
+		server.RegisterModel(queue, models[name])
+	}
+
 	// Initialize the server
-	serverShutdownComplete := server.Initialize(ctx, conf.Server)
+	serverShutdownComplete := server.Initialize(ctx, settings.server)
 
-	// If join was specified, make the join request.
-	if conf.JoinAddress != "" {
-		b, err := json.Marshal(map[string]string{"address": conf.Concensus.Address, "id": conf.Concensus.ServerID})
+	// If join was specified, join the cluster through the seeds unless the node is already a member
+	if len(conf.Consensus.Join) > 0 {
+		member, err := store.IsMember()
 		if err != nil {
-			logger.Error("Failed to marshal join request", "error", err)
+			logger.Error("Failed to get raft configuration", "error", err)
 			os.Exit(1)
 		}
-		resp, err := http.Post(fmt.Sprintf("http://%s/join", conf.JoinAddress), "application-type/json", bytes.NewReader(b))
-		if err != nil {
-			logger.Error("Failed to send join request", "error", err)
+		if member {
+			logger.Info("Already a member of the cluster, not joining")
+		} else if err := joinCluster(ctx, settings.seeds, conf); err != nil {
+			logger.Error("Failed to join cluster", "error", err)
 			os.Exit(1)
 		}
-		resp.Body.Close()
+	}
 
-		if resp.StatusCode != http.StatusCreated {
-			logger.Error("Received non-OK response to join request", "status", resp.StatusCode)
-			os.Exit(1)
-		}
+	// If an expected number of servers was specified, bootstrap the cluster with the peers
+	if conf.Consensus.BootstrapExpect > 0 {
+		go runBootstrap(ctx, store, settings.peers, conf, logger)
 	}
 
 	sigs := make(chan os.Signal, 1)
@@ -124,4 +152,66 @@ func main() {
 	// Wait for the server and consensus node to finish shutting down
 	<-nodeShutdownComplete
 	<-serverShutdownComplete
+
+	// Flush the spans buffered by the exporter
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		logger.Error("Failed to flush spans", "error", err)
+	}
+}
+
+// runBootstrap is used to bootstrap the cluster once the expected number of peers are found, or to join
+// the cluster a peer is already part of
+// The node then joins through its peers either way, which registers its HTTP address with the leader and
+// does nothing else for a server already in the configuration
+func runBootstrap(ctx context.Context, store *store.Store[model.Payload], peers discovery.Peers, conf *config, logger *slog.Logger) {
+	err := bootstrap.Run(ctx, store, bootstrap.Config{
+		Expect: conf.Consensus.BootstrapExpect,
+		Peers:  peers,
+		Logger: logger,
+	})
+	if errors.Is(err, bootstrap.ErrClusterExists) {
+		logger.Info("Joining existing cluster", "reason", err)
+	} else if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("Failed to bootstrap cluster", "error", err)
+		}
+		return
+	}
+
+	if err := joinCluster(ctx, peers, conf); err != nil && ctx.Err() == nil {
+		logger.Error("Failed to join cluster", "error", err)
+	}
+}
+
+// joinCluster is used to join the cluster through any of the seeds, retrying with backoff until the join timeout
+// The seeds need not be the leader, the join is sent to the leader they know of, and they are discovered
+// again before every attempt so that nodes started after this one can be joined through
+func joinCluster(ctx context.Context, seeds discovery.Peers, conf *config) error {
+	ctx, cancel := context.WithTimeout(ctx, conf.Consensus.JoinTimeout)
+	defer cancel()
+
+	for {
+		addresses, err := seeds(ctx)
+		if err == nil && len(addresses) == 0 {
+			err = errors.New("no seeds found")
+		}
+		if err == nil {
+			c := client.New[json.RawMessage](addresses, client.WithBackoff(100*time.Millisecond, 2*time.Second))
+			err = c.Join(ctx, conf.Consensus.ID, conf.Consensus.Address, conf.Server.Address)
+
+			var e *model.Error
+			// Joining is idempotent, so it is retried even if the join may have been applied
+			if err == nil || errors.As(err, &e) && !e.Code.Retryable() && !e.Code.MayHaveApplied() {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), err)
+		case <-time.After(time.Second):
+		}
+	}
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/discovery"
+	"github.com/kavinaravind/go-raft-message-queue/model"
+	"github.com/kavinaravind/go-raft-message-queue/server"
+	"github.com/kavinaravind/go-raft-message-queue/store"
+	"github.com/kavinaravind/go-raft-message-queue/testcluster"
+)
+
+// deadAddress is used to get an address nothing listens on
+func deadAddress(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func TestJoinCluster(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cluster := testcluster.New[model.Payload](t, 3, testcluster.WithLogger(logger), testcluster.WithoutBootstrap())
+	nodes := cluster.Nodes()
+
+	addresses := map[string]string{}
+	for _, node := range nodes {
+		srv := httptest.NewServer(server.NewServer(node.Store, logger).Handler())
+		t.Cleanup(srv.Close)
+		addresses[node.ID] = srv.Listener.Addr().String()
+	}
+
+	// node1 forms the cluster on its own, the others join it
+	self := store.Server{Member: store.Member{ID: nodes[0].ID}, RaftAddress: string(nodes[0].Address)}
+	if err := nodes[0].Store.Bootstrap([]store.Server{self}); err != nil {
+		t.Fatal(err)
+	}
+	leader := cluster.Leader()
+	if err := leader.Store.RegisterMember(leader.ID, addresses[leader.ID]); err != nil {
+		t.Fatal(err)
+	}
+
+	join := func(node *testcluster.Node[model.Payload], seeds ...string) error {
+		peers, err := discovery.Parse(seeds, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conf := newConfig()
+		conf.Consensus.ID = node.ID
+		conf.Consensus.Address = string(node.Address)
+		conf.Consensus.JoinTimeout = 5 * time.Second
+		conf.Server.Address = addresses[node.ID]
+		return joinCluster(context.Background(), peers, conf)
+	}
+
+	// Seeds that are down are skipped
+	if err := join(nodes[1], deadAddress(t), addresses[nodes[0].ID]); err != nil {
+		t.Fatalf("expected node2 to join, got: %v", err)
+	}
+	for deadline := time.Now().Add(testcluster.DefaultTimeout); ; time.Sleep(10 * time.Millisecond) {
+		if member, ok := nodes[1].Store.Leader(); ok && member.Address != "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for node2 to learn the address of the leader")
+		}
+	}
+
+	// A follower found in a peers file directs the join to the leader
+	if member, err := nodes[2].Store.IsMember(); err != nil || member {
+		t.Fatalf("expected node3 not to be a member yet, got %v, %v", member, err)
+	}
+	file := writeFile(t, "peers", addresses[nodes[1].ID]+"\n")
+	if err := join(nodes[2], "file+"+file); err != nil {
+		t.Fatalf("expected node3 to join through a follower, got: %v", err)
+	}
+	cluster.WaitForReplication()
+
+	servers, err := leader.Store.Servers()
+	if err != nil || len(servers) != 3 {
+		t.Fatalf("expected 3 servers, got %v, %v", servers, err)
+	}
+	for _, node := range nodes {
+		if member, err := node.Store.IsMember(); err != nil || !member {
+			t.Errorf("expected %s to be a member, got %v, %v", node.ID, member, err)
+		}
+	}
+
+	// Without a live seed, the join gives up at the deadline
+	conf := newConfig()
+	conf.Consensus.ID = "node4"
+	conf.Consensus.JoinTimeout = 200 * time.Millisecond
+	start := time.Now()
+	if err := joinCluster(context.Background(), discovery.Static([]string{deadAddress(t)}), conf); err == nil {
+		t.Error("expected the join to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the join to give up after its timeout, took %v", elapsed)
+	}
+}
@@ -0,0 +1,49 @@
+package model
+
+// Node is a node of the cluster as returned by the /cluster endpoint
+type Node struct {
+	// ID is the raft server id of the node
+	ID string `json:"id"`
+
+	// Address is the HTTP address of the node, empty if the node has not registered one
+	Address string `json:"address,omitempty"`
+
+	// RaftAddress is the address of the raft transport of the node
+	RaftAddress string `json:"raft_address"`
+
+	// Voter is whether the node votes in elections
+	Voter bool `json:"voter"`
+
+	// Leader is whether the node is the current leader
+	Leader bool `json:"leader"`
+}
+
+// Cluster is the response model of the /cluster endpoint
+type Cluster struct {
+	// LeaderID is the raft server id of the current leader, if known
+	LeaderID string `json:"leader_id,omitempty"`
+
+	// Leader is the HTTP address of the current leader, if known
+	Leader string `json:"leader,omitempty"`
+
+	// Nodes are the nodes in the raft configuration
+	Nodes []Node `json:"nodes"`
+}
+
+// BootstrapStatus is the response model of the /bootstrap endpoint
+type BootstrapStatus struct {
+	// ID is the raft server id of the node
+	ID string `json:"id"`
+
+	// Address is the HTTP address of the node, empty if it does not advertise one
+	Address string `json:"address,omitempty"`
+
+	// RaftAddress is the address of the raft transport of the node
+	RaftAddress string `json:"raft_address"`
+
+	// Bootstrapped is whether the node is already part of a cluster
+	Bootstrapped bool `json:"bootstrapped"`
+
+	// Candidates are the ids of the nodes this node would bootstrap the cluster with, sorted
+	Candidates []string `json:"candidates,omitempty"`
+}
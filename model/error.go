@@ -0,0 +1,101 @@
+package model
+
+import "fmt"
+
+// ErrorCode identifies the kind of failure in an error response, so that clients can decide how to retry
+type ErrorCode string
+
+const (
+	// CodeNotLeader is returned by a node that is not the leader, the request can be retried against the leader
+	CodeNotLeader ErrorCode = "not_leader"
+
+	// CodeLeadershipLost is returned when the leader was deposed before the command was committed
+	// The command may still take effect, so the request is only safe to retry if it is idempotent
+	CodeLeadershipLost ErrorCode = "leadership_lost"
+
+	// CodeTimeout is returned when the command could not be submitted in time, the request can be retried
+	CodeTimeout ErrorCode = "timeout"
+
+	// CodeShuttingDown is returned by a node that is shutting down, the command may already have been committed
+	// So like CodeLeadershipLost, the request is only safe to retry against another node if it is idempotent
+	CodeShuttingDown ErrorCode = "shutting_down"
+
+	// CodeQueueNotFound is returned when using a queue that was never sent to or was deleted
+	CodeQueueNotFound ErrorCode = "queue_not_found"
+
+	// CodeStreamNotFound is returned when committing to or setting the retention of a stream that was never appended to
+	CodeStreamNotFound ErrorCode = "stream_not_found"
+
+	// CodeNodeNotFound is returned when a node is not part of the cluster
+	CodeNodeNotFound ErrorCode = "node_not_found"
+
+	// CodeSchemaNotFound is returned when getting the schema of a queue without one
+	CodeSchemaNotFound ErrorCode = "schema_not_found"
+
+	// CodeBadRequest is returned when the request could not be parsed
+	CodeBadRequest ErrorCode = "bad_request"
+
+	// CodeMethodNotAllowed is returned when the endpoint does not accept the request method
+	CodeMethodNotAllowed ErrorCode = "method_not_allowed"
+
+	// CodeInvalidMessage is returned when a message does not match the schema of its queue
+	CodeInvalidMessage ErrorCode = "invalid_message"
+
+	// CodeIncompatibleSchema is returned when a schema update breaks the compatibility of the queue,
+	// or gives a compatibility other than the one the schema of the queue has
+	CodeIncompatibleSchema ErrorCode = "incompatible_schema"
+
+	// CodeTooLarge is returned when the body of a request is larger than the node accepts
+	CodeTooLarge ErrorCode = "too_large"
+
+	// CodeInternal is returned for any other failure
+	CodeInternal ErrorCode = "internal"
+)
+
+// Retryable is used to check if a request that failed with the code can be retried as is
+// A request failing with a code that MayHaveApplied is not retryable
+func (c ErrorCode) Retryable() bool {
+	switch c {
+	case CodeNotLeader, CodeTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// MayHaveApplied is used to check if a request that failed with the code may still have taken effect
+// Such a request is only safe to retry if it is idempotent
+func (c ErrorCode) MayHaveApplied() bool {
+	switch c {
+	case CodeLeadershipLost, CodeShuttingDown:
+		return true
+	default:
+		return false
+	}
+}
+
+// Error is the body of every error response
+type Error struct {
+	// Code identifies the kind of failure
+	Code ErrorCode `json:"code"`
+
+	// Message describes the failure
+	Message string `json:"error"`
+
+	// RequestID is the id of the failed request, as returned in the X-Request-Id header
+	RequestID string `json:"request_id,omitempty"`
+
+	// LeaderID is the raft server id of the current leader, if known
+	LeaderID string `json:"leader_id,omitempty"`
+
+	// Leader is the HTTP address of the current leader, if known
+	Leader string `json:"leader,omitempty"`
+}
+
+// Error is used to implement the error interface
+func (e *Error) Error() string {
+	if e.Leader != "" {
+		return fmt.Sprintf("%s: %s (leader %s)", e.Code, e.Message, e.Leader)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
@@ -0,0 +1,40 @@
+package model
+
+// Health is the response model of the /healthz endpoint
+type Health struct {
+	// Status is ok while the process is serving requests
+	Status string `json:"status"`
+}
+
+// Readiness is the response model of the /readyz endpoint
+type Readiness struct {
+	// Ready is whether the node is ready to serve requests
+	Ready bool `json:"ready"`
+
+	// Reasons are why the node is not ready, empty once it is
+	Reasons []string `json:"reasons,omitempty"`
+
+	// LeaderID is the raft server id of the current leader, if known
+	LeaderID string `json:"leader_id,omitempty"`
+
+	// Leader is the HTTP address of the current leader, if known
+	Leader string `json:"leader,omitempty"`
+
+	// AppliedIndex is the index of the last log entry applied by the node
+	AppliedIndex uint64 `json:"applied_index"`
+
+	// CommitIndex is the index of the last log entry the node knows to be committed
+	CommitIndex uint64 `json:"commit_index"`
+
+	// Restoring is whether the node is restoring a snapshot
+	Restoring bool `json:"restoring"`
+}
+
+// Leader is the response model of the /leader endpoint, which is only successful on the leader
+type Leader struct {
+	// ID is the raft server id of the leader
+	ID string `json:"id"`
+
+	// Address is the HTTP address of the leader, empty if it has not registered one
+	Address string `json:"address,omitempty"`
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// commentFields are the JSON keys of a comment, the only model held before opaque payloads
+var commentFields = map[string]bool{"timestamp": true, "author": true, "content": true}
+
+// UpgradeLegacyPayload is used to convert the JSON data of a message written before opaque payloads
+// Such a comment decodes into an empty payload without error, so the data is read again as a comment
+// Data that is not a comment leaves the payload as it is
+func UpgradeLegacyPayload(raw json.RawMessage, payload *Payload) error {
+	if payload.ContentType != "" || !payload.IsEmpty() {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil || len(fields) == 0 {
+		return nil
+	}
+	for field := range fields {
+		if !commentFields[field] {
+			return nil
+		}
+	}
+
+	var comment Comment
+	if err := json.Unmarshal(raw, &comment); err != nil {
+		return err
+	}
+	converted, err := NewJSONPayload(comment)
+	if err != nil {
+		return err
+	}
+	*payload = converted
+	return nil
+}
+
+// LegacyData holds the fields of both a comment and a payload, so gob can decode the messages of a snapshot
+// written either before or after opaque payloads
+type LegacyData struct {
+	Timestamp *time.Time
+	Author    string
+	Content   string
+
+	ContentType string
+	Body        []byte
+}
+
+// Payload is used to get the payload of the data, converting a comment to a JSON payload
+func (d LegacyData) Payload() (Payload, error) {
+	if d.Timestamp == nil && d.Author == "" && d.Content == "" {
+		return Payload{ContentType: d.ContentType, Body: d.Body}, nil
+	}
+	return NewJSONPayload(Comment{Timestamp: d.Timestamp, Author: d.Author, Content: d.Content})
+}
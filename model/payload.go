@@ -0,0 +1,54 @@
+package model
+
+import (
+	"encoding/json"
+	"mime"
+	"strings"
+)
+
+// JSONContentType is the content type of JSON payloads
+const JSONContentType = "application/json"
+
+// Payload is the model for an opaque message body and its content type
+type Payload struct {
+	ContentType string `json:"contentType,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// NewPayload creates a new payload with the given content type and body
+// An empty content type is treated as an octet stream
+func NewPayload(contentType string, body []byte) Payload {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return Payload{ContentType: contentType, Body: body}
+}
+
+// NewJSONPayload creates a new JSON payload by marshaling the given value
+func NewJSONPayload(v any) (Payload, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return Payload{}, err
+	}
+	return Payload{ContentType: JSONContentType, Body: body}, nil
+}
+
+// IsEmpty is used to check if the payload has no body
+func (p Payload) IsEmpty() bool {
+	return len(p.Body) == 0
+}
+
+// IsJSON is used to check if the payload has a JSON content type
+// This includes structured syntax suffixes such as application/cloudevents+json
+func (p Payload) IsJSON() bool {
+	return IsJSONContentType(p.ContentType)
+}
+
+// IsJSONContentType is used to check if a content type is a JSON media type
+func IsJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == JSONContentType || strings.HasSuffix(mediaType, "+json")
+}
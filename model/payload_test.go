@@ -0,0 +1,54 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewPayload(t *testing.T) {
+	payload := NewPayload("", []byte("raw"))
+	if payload.ContentType != "application/octet-stream" {
+		t.Errorf("expected octet stream, got %s", payload.ContentType)
+	}
+	if payload.IsJSON() {
+		t.Errorf("expected payload not to be JSON")
+	}
+	if payload.IsEmpty() {
+		t.Errorf("expected payload not to be empty")
+	}
+}
+
+func TestNewJSONPayload(t *testing.T) {
+	payload, err := NewJSONPayload(Comment{Author: "test author"})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !payload.IsJSON() {
+		t.Errorf("expected payload to be JSON")
+	}
+
+	var comment Comment
+	if err := json.Unmarshal(payload.Body, &comment); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if comment.Author != "test author" {
+		t.Errorf("expected %s, got %s", "test author", comment.Author)
+	}
+}
+
+func TestIsJSONContentType(t *testing.T) {
+	tests := map[string]bool{
+		"application/json":                  true,
+		"application/json; charset=utf-8":   true,
+		"application/cloudevents+json":      true,
+		"text/plain":                        false,
+		"application/x-www-form-urlencoded": false,
+		"":                                  false,
+	}
+
+	for contentType, expected := range tests {
+		if got := IsJSONContentType(contentType); got != expected {
+			t.Errorf("IsJSONContentType(%q) = %v; want %v", contentType, got, expected)
+		}
+	}
+}
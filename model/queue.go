@@ -0,0 +1,10 @@
+package model
+
+// QueueInfo is a queue as listed by the /queues endpoint
+type QueueInfo struct {
+	// Name is the name of the queue
+	Name string `json:"name"`
+
+	// Depth is the number of messages in the queue
+	Depth int `json:"depth"`
+}
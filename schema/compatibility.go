@@ -0,0 +1,220 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Compatibility is the rule a schema update must satisfy against the current schema
+type Compatibility string
+
+const (
+	// Backward requires the new schema to accept every message the current schema accepts
+	Backward Compatibility = "backward"
+
+	// Forward requires the current schema to accept every message the new schema accepts
+	Forward Compatibility = "forward"
+
+	// Full requires both backward and forward compatibility
+	Full Compatibility = "full"
+
+	// None allows any update
+	None Compatibility = "none"
+)
+
+// ParseCompatibility is used to parse a compatibility, defaulting to backward
+func ParseCompatibility(value string) (Compatibility, error) {
+	switch c := Compatibility(value); c {
+	case "":
+		return Backward, nil
+	case Backward, Forward, Full, None:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unknown compatibility %q", value)
+	}
+}
+
+// Check is used to list the reasons an update from current to next breaks the compatibility
+// The check is conservative: it may reject updates that are compatible in practice
+func (c Compatibility) Check(current, next *Schema) []string {
+	switch c {
+	case Backward:
+		return accepts(next, current, "")
+	case Forward:
+		return accepts(current, next, "")
+	case Full:
+		return append(accepts(next, current, ""), accepts(current, next, "")...)
+	default:
+		return nil
+	}
+}
+
+// accepts is used to list the ways in which a might reject a value that b accepts
+func accepts(a, b *Schema, path string) []string {
+	var problems []string
+	fail := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf("%s: %s", pointer(path), fmt.Sprintf(format, args...)))
+	}
+
+	if b.never || isEmpty(a) {
+		return nil
+	}
+	if a.never {
+		fail("no value is allowed")
+		return problems
+	}
+
+	if len(a.Types) > 0 {
+		if len(b.Types) == 0 {
+			fail("type restricted to %s", joinTypes(a.Types))
+		}
+		for _, t := range b.Types {
+			if !a.allowsType(t) {
+				fail("type %s is no longer allowed", t)
+			}
+		}
+	}
+
+	if len(a.Enum) > 0 {
+		if len(b.Enum) == 0 {
+			fail("values restricted to an enum")
+		}
+		for _, value := range b.Enum {
+			found := false
+			for _, allowed := range a.Enum {
+				if equal(allowed, value) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				fail("enum value %v is no longer allowed", value)
+			}
+		}
+	}
+
+	// Lower bounds on a must be implied by b
+	lower := []struct {
+		name string
+		a, b *float64
+	}{
+		{"minimum", a.Minimum, b.Minimum},
+		{"exclusiveMinimum", a.ExclusiveMinimum, b.ExclusiveMinimum},
+	}
+	for _, bound := range lower {
+		if bound.a != nil && (bound.b == nil || *bound.b < *bound.a) {
+			fail("%s raised to %v", bound.name, *bound.a)
+		}
+	}
+
+	upper := []struct {
+		name string
+		a, b *float64
+	}{
+		{"maximum", a.Maximum, b.Maximum},
+		{"exclusiveMaximum", a.ExclusiveMaximum, b.ExclusiveMaximum},
+	}
+	for _, bound := range upper {
+		if bound.a != nil && (bound.b == nil || *bound.b > *bound.a) {
+			fail("%s lowered to %v", bound.name, *bound.a)
+		}
+	}
+
+	counts := []struct {
+		name  string
+		a, b  *int
+		lower bool
+	}{
+		{"minLength", a.MinLength, b.MinLength, true},
+		{"maxLength", a.MaxLength, b.MaxLength, false},
+		{"minItems", a.MinItems, b.MinItems, true},
+		{"maxItems", a.MaxItems, b.MaxItems, false},
+	}
+	for _, count := range counts {
+		if count.a == nil {
+			continue
+		}
+		if count.b == nil || (count.lower && *count.b < *count.a) || (!count.lower && *count.b > *count.a) {
+			fail("%s changed to %d", count.name, *count.a)
+		}
+	}
+
+	if a.Pattern != "" && a.Pattern != b.Pattern {
+		fail("pattern changed to %q", a.Pattern)
+	}
+
+	if a.Items != nil {
+		items := b.Items
+		if items == nil {
+			items = &Schema{}
+		}
+		problems = append(problems, accepts(a.Items, items, path+"/items")...)
+	}
+
+	// Every property required by a must already be required by b
+	required := map[string]bool{}
+	for _, name := range b.Required {
+		required[name] = true
+	}
+	for _, name := range a.Required {
+		if !required[name] {
+			fail("property %q is now required", name)
+		}
+	}
+
+	// Check the properties in a stable order so problems are reported deterministically
+	names := map[string]bool{}
+	for name := range a.Properties {
+		names[name] = true
+	}
+	for name := range b.Properties {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		problems = append(problems, accepts(a.property(name), b.property(name), path+"/properties/"+escape(name))...)
+	}
+
+	// Properties that b lets through as additional properties must be accepted by a as well
+	if a.AdditionalProperties != nil {
+		additional := b.AdditionalProperties
+		if additional == nil {
+			additional = &Schema{}
+		}
+		problems = append(problems, accepts(a.AdditionalProperties, additional, path+"/additionalProperties")...)
+	}
+
+	return problems
+}
+
+// property is used to get the schema that applies to the named property
+func (s *Schema) property(name string) *Schema {
+	if property, ok := s.Properties[name]; ok {
+		return property
+	}
+	if s.AdditionalProperties != nil {
+		return s.AdditionalProperties
+	}
+	return &Schema{}
+}
+
+// isEmpty is used to check if the schema accepts every value
+func isEmpty(s *Schema) bool {
+	return !s.never &&
+		len(s.Types) == 0 &&
+		len(s.Properties) == 0 &&
+		len(s.Required) == 0 &&
+		(s.AdditionalProperties == nil || isEmpty(s.AdditionalProperties)) &&
+		(s.Items == nil || isEmpty(s.Items)) &&
+		len(s.Enum) == 0 &&
+		s.Minimum == nil && s.Maximum == nil &&
+		s.ExclusiveMinimum == nil && s.ExclusiveMaximum == nil &&
+		s.MinLength == nil && s.MaxLength == nil &&
+		s.MinItems == nil && s.MaxItems == nil &&
+		s.Pattern == ""
+}
@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"testing"
+)
+
+func TestParseCompatibility(t *testing.T) {
+	if c, err := ParseCompatibility(""); err != nil || c != Backward {
+		t.Errorf("ParseCompatibility(\"\") = %v, %v; want backward", c, err)
+	}
+	if _, err := ParseCompatibility("sideways"); err == nil {
+		t.Error("expected error for unknown compatibility")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	const base = `{
+		"type": "object",
+		"properties": {
+			"author": {"type": "string"},
+			"status": {"enum": ["draft", "published"]}
+		},
+		"required": ["author"]
+	}`
+
+	tests := []struct {
+		name     string
+		next     string
+		backward bool
+		forward  bool
+	}{
+		{
+			name:     "identical",
+			next:     base,
+			backward: true,
+			forward:  true,
+		},
+		{
+			name:     "new optional property",
+			next:     `{"type": "object", "properties": {"author": {"type": "string"}, "status": {"enum": ["draft", "published"]}, "likes": {"type": "integer"}}, "required": ["author"]}`,
+			backward: false, // likes was unconstrained before
+			forward:  true,
+		},
+		{
+			name:     "new required property",
+			next:     `{"type": "object", "properties": {"author": {"type": "string"}, "status": {"enum": ["draft", "published"]}, "content": {"type": "string"}}, "required": ["author", "content"]}`,
+			backward: false,
+			forward:  true,
+		},
+		{
+			name:     "dropped required property",
+			next:     `{"type": "object", "properties": {"author": {"type": "string"}, "status": {"enum": ["draft", "published"]}}}`,
+			backward: true,
+			forward:  false,
+		},
+		{
+			name:     "added enum value",
+			next:     `{"type": "object", "properties": {"author": {"type": "string"}, "status": {"enum": ["draft", "published", "deleted"]}}, "required": ["author"]}`,
+			backward: true,
+			forward:  false,
+		},
+		{
+			name:     "changed property type",
+			next:     `{"type": "object", "properties": {"author": {"type": "integer"}, "status": {"enum": ["draft", "published"]}}, "required": ["author"]}`,
+			backward: false,
+			forward:  false,
+		},
+	}
+
+	current, err := Parse([]byte(base))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := Parse([]byte(tt.next))
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			if problems := Backward.Check(current, next); (len(problems) == 0) != tt.backward {
+				t.Errorf("backward: got %v, want compatible = %v", problems, tt.backward)
+			}
+			if problems := Forward.Check(current, next); (len(problems) == 0) != tt.forward {
+				t.Errorf("forward: got %v, want compatible = %v", problems, tt.forward)
+			}
+			if problems := Full.Check(current, next); (len(problems) == 0) != (tt.backward && tt.forward) {
+				t.Errorf("full: got %v, want compatible = %v", problems, tt.backward && tt.forward)
+			}
+			if problems := None.Check(current, next); len(problems) != 0 {
+				t.Errorf("none: got %v, want compatible", problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Version is a single registered revision of a subject's schema
+type Version struct {
+	Version int
+	Schema  []byte
+}
+
+// The errors returned by the registry
+var (
+	// ErrSubjectNotFound is returned when changing a subject that has no schema
+	ErrSubjectNotFound = errors.New("subject not found")
+
+	// ErrCompatibilityMismatch is returned when registering a version with a compatibility other than the subject's
+	// The compatibility of a subject is set when it is created, and only changed with SetCompatibility
+	ErrCompatibilityMismatch = errors.New("compatibility does not match the subject")
+)
+
+// Subject is the versioned schema history attached to a queue
+// Compatibility is set when the subject is created, and every new version is checked against it
+type Subject struct {
+	Compatibility Compatibility
+	Versions      []Version
+}
+
+// IncompatibleError is returned when a schema update breaks the subject's compatibility
+type IncompatibleError struct {
+	Compatibility Compatibility
+	Problems      []string
+}
+
+// Error is used to implement the error interface
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("schema is not %s compatible: %s", e.Compatibility, strings.Join(e.Problems, "; "))
+}
+
+// Registry is a set of versioned schemas keyed by subject
+type Registry struct {
+	Subjects map[string]*Subject
+	compiled map[string]*Schema
+	lock     sync.RWMutex
+}
+
+// NewRegistry creates a new instance of the Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		Subjects: map[string]*Subject{},
+	}
+}
+
+// Register is used to add a new version of the subject's schema
+// A new subject takes the given compatibility, backward if empty, while an update is checked against the latest
+// version with the compatibility of the subject, and is rejected if a different compatibility is given
+func (r *Registry) Register(subject string, raw []byte, compatibility Compatibility) (int, error) {
+	next, err := Parse(raw)
+	if err != nil {
+		return 0, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.Subjects == nil {
+		r.Subjects = map[string]*Subject{}
+	}
+
+	s, ok := r.Subjects[subject]
+	if !ok {
+		if compatibility == "" {
+			compatibility = Backward
+		}
+		s = &Subject{Compatibility: compatibility}
+	}
+	if s.Compatibility == "" {
+		s.Compatibility = Backward
+	}
+	if compatibility != "" && compatibility != s.Compatibility {
+		return 0, fmt.Errorf("%w: %s is %s", ErrCompatibilityMismatch, subject, s.Compatibility)
+	}
+
+	if len(s.Versions) > 0 {
+		current, err := r.latest(subject)
+		if err != nil {
+			return 0, err
+		}
+		if problems := s.Compatibility.Check(current, next); len(problems) > 0 {
+			return 0, &IncompatibleError{Compatibility: s.Compatibility, Problems: problems}
+		}
+	}
+
+	version := 1
+	if len(s.Versions) > 0 {
+		version = s.Versions[len(s.Versions)-1].Version + 1
+	}
+
+	s.Versions = append(s.Versions, Version{Version: version, Schema: raw})
+	r.Subjects[subject] = s
+	r.cache()[subject] = next
+
+	return version, nil
+}
+
+// SetCompatibility is used to change the compatibility new versions of the subject's schema are checked against
+func (r *Registry) SetCompatibility(subject string, compatibility Compatibility) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s, ok := r.Subjects[subject]
+	if !ok {
+		return ErrSubjectNotFound
+	}
+	s.Compatibility = compatibility
+	return nil
+}
+
+// Delete is used to remove every version of the subject's schema
+func (r *Registry) Delete(subject string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	_, ok := r.Subjects[subject]
+	delete(r.Subjects, subject)
+	delete(r.cache(), subject)
+
+	return ok
+}
+
+// Latest is used to get the latest version of the subject's schema
+func (r *Registry) Latest(subject string) (*Schema, Version, bool) {
+	r.lock.RLock()
+	s, ok := r.Subjects[subject]
+	if !ok || len(s.Versions) == 0 {
+		r.lock.RUnlock()
+		return nil, Version{}, false
+	}
+	version := s.Versions[len(s.Versions)-1]
+	compiled, ok := r.compiled[subject]
+	r.lock.RUnlock()
+
+	if ok {
+		return compiled, version, true
+	}
+
+	// Schemas are compiled lazily after a restore
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	compiled, err := r.latest(subject)
+	if err != nil {
+		return nil, Version{}, false
+	}
+	return compiled, version, true
+}
+
+// Get is used to get the subject's schema history
+func (r *Registry) Get(subject string) (Subject, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	s, ok := r.Subjects[subject]
+	if !ok {
+		return Subject{}, false
+	}
+	return Subject{Compatibility: s.Compatibility, Versions: append([]Version{}, s.Versions...)}, true
+}
+
+// Copy is used to create a copy of the registry
+// Registered versions are never modified, so their schemas can be shared
+func (r *Registry) Copy() *Registry {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	copy := NewRegistry()
+	for name, s := range r.Subjects {
+		copy.Subjects[name] = &Subject{
+			Compatibility: s.Compatibility,
+			Versions:      append([]Version{}, s.Versions...),
+		}
+	}
+
+	return copy
+}
+
+// latest is used to get the compiled latest schema, the caller must hold the write lock
+func (r *Registry) latest(subject string) (*Schema, error) {
+	if compiled, ok := r.cache()[subject]; ok {
+		return compiled, nil
+	}
+
+	s, ok := r.Subjects[subject]
+	if !ok || len(s.Versions) == 0 {
+		return nil, fmt.Errorf("subject %q has no schema", subject)
+	}
+
+	compiled, err := Parse(s.Versions[len(s.Versions)-1].Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cache()[subject] = compiled
+	return compiled, nil
+}
+
+// cache is used to get the compiled schemas, the caller must hold the write lock
+func (r *Registry) cache() map[string]*Schema {
+	if r.compiled == nil {
+		r.compiled = map[string]*Schema{}
+	}
+	return r.compiled
+}
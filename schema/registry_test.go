@@ -0,0 +1,106 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	if _, _, ok := r.Latest("comments"); ok {
+		t.Fatal("expected no schema for an unknown subject")
+	}
+
+	version, err := r.Register("comments", []byte(`{"type": "object", "required": ["author"]}`), Backward)
+	if err != nil || version != 1 {
+		t.Fatalf("Register() = %d, %v; want 1, nil", version, err)
+	}
+
+	// Requiring a new property is not backward compatible
+	_, err = r.Register("comments", []byte(`{"type": "object", "required": ["author", "content"]}`), Backward)
+	var incompatible *IncompatibleError
+	if !errors.As(err, &incompatible) || len(incompatible.Problems) != 1 {
+		t.Fatalf("expected an incompatible error, got: %v", err)
+	}
+
+	// Relaxing the schema is backward compatible
+	version, err = r.Register("comments", []byte(`{"type": "object"}`), Backward)
+	if err != nil || version != 2 {
+		t.Fatalf("Register() = %d, %v; want 2, nil", version, err)
+	}
+
+	s, latest, ok := r.Latest("comments")
+	if !ok || latest.Version != 2 || len(s.Validate([]byte(`{}`))) != 0 {
+		t.Errorf("Latest() = %v, %v; want version 2", latest, ok)
+	}
+
+	subject, ok := r.Get("comments")
+	if !ok || len(subject.Versions) != 2 || subject.Compatibility != Backward {
+		t.Errorf("Get() = %v, %v; want 2 backward versions", subject, ok)
+	}
+
+	if !r.Delete("comments") {
+		t.Error("expected subject to be deleted")
+	}
+	if _, _, ok := r.Latest("comments"); ok {
+		t.Error("expected no schema after delete")
+	}
+}
+
+func TestRegistryCopy(t *testing.T) {
+	r := NewRegistry()
+	if _, err := r.Register("comments", []byte(`{"type": "object"}`), None); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	// A copy compiles its schemas lazily
+	copy := r.Copy()
+	if _, err := r.Register("comments", []byte(`{"type": "string"}`), None); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	s, version, ok := copy.Latest("comments")
+	if !ok || version.Version != 1 {
+		t.Fatalf("Latest() = %v, %v; want version 1", version, ok)
+	}
+	if errs := s.Validate([]byte(`{}`)); len(errs) != 0 {
+		t.Errorf("expected copy to keep the object schema, got: %v", errs)
+	}
+}
+
+func TestRegistryCompatibility(t *testing.T) {
+	r := NewRegistry()
+	if _, err := r.Register("comments", []byte(`{"type": "object", "required": ["author"]}`), ""); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if subject, _ := r.Get("comments"); subject.Compatibility != Backward {
+		t.Fatalf("expected a new subject to default to backward, got %q", subject.Compatibility)
+	}
+
+	// An update can not pick a compatibility of its own
+	breaking := []byte(`{"type": "object", "required": ["author", "content"]}`)
+	if _, err := r.Register("comments", breaking, None); !errors.Is(err, ErrCompatibilityMismatch) {
+		t.Errorf("expected a compatibility mismatch, got: %v", err)
+	}
+
+	// Omitting the compatibility checks the update against the subject's
+	var incompatible *IncompatibleError
+	if _, err := r.Register("comments", breaking, ""); !errors.As(err, &incompatible) || incompatible.Compatibility != Backward {
+		t.Errorf("expected a backward incompatible error, got: %v", err)
+	}
+
+	if err := r.SetCompatibility("comments", None); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if version, err := r.Register("comments", breaking, ""); err != nil || version != 2 {
+		t.Errorf("Register() = %d, %v; want 2, nil", version, err)
+	}
+	if version, err := r.Register("comments", []byte(`{"type": "string"}`), None); err != nil || version != 3 {
+		t.Errorf("Register() = %d, %v; want 3, nil", version, err)
+	}
+
+	if err := r.SetCompatibility("unknown", Full); !errors.Is(err, ErrSubjectNotFound) {
+		t.Errorf("expected subject not found, got: %v", err)
+	}
+}
@@ -0,0 +1,430 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Types that a schema can constrain an instance to
+var types = map[string]bool{
+	"null":    true,
+	"boolean": true,
+	"object":  true,
+	"array":   true,
+	"number":  true,
+	"integer": true,
+	"string":  true,
+}
+
+// Schema is a JSON Schema supporting the commonly used validation keywords
+// Unsupported keywords are rejected by Parse rather than silently ignored
+type Schema struct {
+	Types                []string
+	Properties           map[string]*Schema
+	Required             []string
+	AdditionalProperties *Schema
+	Items                *Schema
+	Enum                 []any
+	Minimum              *float64
+	Maximum              *float64
+	ExclusiveMinimum     *float64
+	ExclusiveMaximum     *float64
+	MinLength            *int
+	MaxLength            *int
+	MinItems             *int
+	MaxItems             *int
+	Pattern              string
+
+	// never is set for the false schema, which accepts nothing
+	never bool
+
+	pattern *regexp.Regexp
+}
+
+// ValidationError is a single reason an instance does not conform to a schema
+type ValidationError struct {
+	// Path is the JSON pointer to the offending value
+	Path string `json:"path"`
+
+	// Message describes the violated constraint
+	Message string `json:"message"`
+}
+
+// Error is used to implement the error interface
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Parse is used to parse and check a JSON Schema document
+func Parse(raw []byte) (*Schema, error) {
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return parse(doc, "")
+}
+
+// parse is used to build a schema from a decoded JSON value
+func parse(doc any, path string) (*Schema, error) {
+	switch v := doc.(type) {
+	case bool:
+		// true accepts everything, false accepts nothing
+		return &Schema{never: !v}, nil
+	case map[string]any:
+		s := &Schema{}
+		for keyword, value := range v {
+			if err := s.parseKeyword(keyword, value, path); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("%s: schema must be an object or a boolean", pointer(path))
+	}
+}
+
+// parseKeyword is used to set a single keyword of the schema
+func (s *Schema) parseKeyword(keyword string, value any, path string) error {
+	at := pointer(path + "/" + keyword)
+
+	var err error
+	switch keyword {
+	case "$schema", "$id", "$comment", "title", "description", "default", "examples", "format":
+		// Annotations do not affect validation
+	case "type":
+		s.Types, err = parseTypes(value)
+	case "properties":
+		properties, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: must be an object", at)
+		}
+		s.Properties = make(map[string]*Schema, len(properties))
+		for name, property := range properties {
+			if s.Properties[name], err = parse(property, path+"/properties/"+escape(name)); err != nil {
+				return err
+			}
+		}
+	case "required":
+		s.Required, err = parseStrings(value)
+	case "additionalProperties":
+		s.AdditionalProperties, err = parse(value, path+"/"+keyword)
+	case "items":
+		s.Items, err = parse(value, path+"/"+keyword)
+	case "enum":
+		values, ok := value.([]any)
+		if !ok || len(values) == 0 {
+			return fmt.Errorf("%s: must be a non-empty array", at)
+		}
+		s.Enum = values
+	case "const":
+		s.Enum = []any{value}
+	case "minimum":
+		s.Minimum, err = parseNumber(value)
+	case "maximum":
+		s.Maximum, err = parseNumber(value)
+	case "exclusiveMinimum":
+		s.ExclusiveMinimum, err = parseNumber(value)
+	case "exclusiveMaximum":
+		s.ExclusiveMaximum, err = parseNumber(value)
+	case "minLength":
+		s.MinLength, err = parseCount(value)
+	case "maxLength":
+		s.MaxLength, err = parseCount(value)
+	case "minItems":
+		s.MinItems, err = parseCount(value)
+	case "maxItems":
+		s.MaxItems, err = parseCount(value)
+	case "pattern":
+		pattern, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: must be a string", at)
+		}
+		if s.pattern, err = regexp.Compile(pattern); err == nil {
+			s.Pattern = pattern
+		}
+	default:
+		return fmt.Errorf("%s: unsupported keyword", at)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", at, err)
+	}
+	return nil
+}
+
+// Validate is used to validate a JSON document against the schema
+func (s *Schema) Validate(raw []byte) []ValidationError {
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return []ValidationError{{Path: "/", Message: "invalid JSON: " + err.Error()}}
+	}
+	if dec.More() {
+		return []ValidationError{{Path: "/", Message: "unexpected data after JSON value"}}
+	}
+
+	var errs []ValidationError
+	s.validate(doc, "", &errs)
+	return errs
+}
+
+// validate is used to collect every violation of the schema by the value
+func (s *Schema) validate(value any, path string, errs *[]ValidationError) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, ValidationError{Path: pointer(path), Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.never {
+		fail("no value is allowed")
+		return
+	}
+
+	if len(s.Types) > 0 && !s.allowsType(typeOf(value)) {
+		fail("expected %s, got %s", joinTypes(s.Types), typeOf(value))
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if equal(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value is not one of the allowed values")
+		}
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		n, _ := v.Float64()
+		if s.Minimum != nil && n < *s.Minimum {
+			fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			fail("must be <= %v", *s.Maximum)
+		}
+		if s.ExclusiveMinimum != nil && n <= *s.ExclusiveMinimum {
+			fail("must be > %v", *s.ExclusiveMinimum)
+		}
+		if s.ExclusiveMaximum != nil && n >= *s.ExclusiveMaximum {
+			fail("must be < %v", *s.ExclusiveMaximum)
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("length must be >= %d", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("length must be <= %d", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match pattern %q", s.Pattern)
+		}
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(item, path+"/"+strconv.Itoa(i), errs)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+
+		// Iterate in a stable order so errors are reported deterministically
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			at := path + "/" + escape(name)
+			if property, ok := s.Properties[name]; ok {
+				property.validate(v[name], at, errs)
+			} else if s.AdditionalProperties != nil {
+				if s.AdditionalProperties.never {
+					*errs = append(*errs, ValidationError{Path: pointer(at), Message: "additional property is not allowed"})
+				} else {
+					s.AdditionalProperties.validate(v[name], at, errs)
+				}
+			}
+		}
+	}
+}
+
+// allowsType is used to check if the schema allows the given instance type
+func (s *Schema) allowsType(t string) bool {
+	for _, allowed := range s.Types {
+		if allowed == t || (allowed == "number" && t == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf is used to get the JSON Schema type of a decoded value
+func typeOf(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// equal is used to compare two decoded JSON values
+func equal(a, b any) bool {
+	if na, ok := a.(json.Number); ok {
+		nb, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fa, _ := na.Float64()
+		fb, _ := nb.Float64()
+		return fa == fb
+	}
+
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ja, jb)
+}
+
+// parseTypes is used to parse the type keyword, which is a string or an array of strings
+func parseTypes(value any) ([]string, error) {
+	var names []string
+	switch v := value.(type) {
+	case string:
+		names = []string{v}
+	case []any:
+		var err error
+		if names, err = parseStrings(v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("must be a string or an array of strings")
+	}
+
+	for _, name := range names {
+		if !types[name] {
+			return nil, fmt.Errorf("unknown type %q", name)
+		}
+	}
+	return names, nil
+}
+
+// parseStrings is used to parse an array of strings
+func parseStrings(value any) ([]string, error) {
+	values, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("must be an array of strings")
+	}
+
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be an array of strings")
+		}
+		strs = append(strs, str)
+	}
+	return strs, nil
+}
+
+// parseNumber is used to parse a numeric keyword
+func parseNumber(value any) (*float64, error) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("must be a number")
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// parseCount is used to parse a non-negative integer keyword
+func parseCount(value any) (*int, error) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("must be a non-negative integer")
+	}
+	i, err := n.Int64()
+	if err != nil || i < 0 {
+		return nil, fmt.Errorf("must be a non-negative integer")
+	}
+	count := int(i)
+	return &count, nil
+}
+
+// joinTypes is used to describe a list of types in an error message
+func joinTypes(types []string) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return fmt.Sprintf("one of %v", types)
+}
+
+// escape is used to escape a property name for use in a JSON pointer
+func escape(name string) string {
+	var buf bytes.Buffer
+	for _, r := range name {
+		switch r {
+		case '~':
+			buf.WriteString("~0")
+		case '/':
+			buf.WriteString("~1")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// pointer is used to turn a path into a JSON pointer, the root being "/"
+func pointer(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"testing"
+)
+
+const commentSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"properties": {
+		"author": {"type": "string", "minLength": 1, "maxLength": 32},
+		"content": {"type": "string"},
+		"likes": {"type": "integer", "minimum": 0},
+		"tags": {"type": "array", "items": {"type": "string", "pattern": "^[a-z]+$"}, "maxItems": 2},
+		"status": {"enum": ["draft", "published"]}
+	},
+	"required": ["author", "content"],
+	"additionalProperties": false
+}`
+
+func TestParse(t *testing.T) {
+	if _, err := Parse([]byte(commentSchema)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	invalid := []string{
+		`not json`,
+		`"string"`,
+		`{"type": "unknown"}`,
+		`{"type": "string", "pattern": "("}`,
+		`{"minLength": -1}`,
+		`{"oneOf": []}`,
+		`{"properties": {"a": 1}}`,
+	}
+	for _, raw := range invalid {
+		if _, err := Parse([]byte(raw)); err == nil {
+			t.Errorf("Parse(%s) expected error", raw)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s, err := Parse([]byte(commentSchema))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	tests := []struct {
+		doc    string
+		errors []ValidationError
+	}{
+		{`{"author": "Alice", "content": "hi", "likes": 3, "tags": ["go"], "status": "draft"}`, nil},
+		{`{"author": "Alice"}`, []ValidationError{{"/", `missing required property "content"`}}},
+		{`{"author": "", "content": "hi"}`, []ValidationError{{"/author", "length must be >= 1"}}},
+		{`{"author": "Alice", "content": 1}`, []ValidationError{{"/content", "expected string, got integer"}}},
+		{`{"author": "Alice", "content": "hi", "likes": 1.5}`, []ValidationError{{"/likes", "expected integer, got number"}}},
+		{`{"author": "Alice", "content": "hi", "likes": -1}`, []ValidationError{{"/likes", "must be >= 0"}}},
+		{`{"author": "Alice", "content": "hi", "tags": ["Go"]}`, []ValidationError{{"/tags/0", `must match pattern "^[a-z]+$"`}}},
+		{`{"author": "Alice", "content": "hi", "tags": ["a", "b", "c"]}`, []ValidationError{{"/tags", "must have at most 2 items"}}},
+		{`{"author": "Alice", "content": "hi", "status": "deleted"}`, []ValidationError{{"/status", "value is not one of the allowed values"}}},
+		{`{"author": "Alice", "content": "hi", "extra": true}`, []ValidationError{{"/extra", "additional property is not allowed"}}},
+		{`[]`, []ValidationError{{"/", "expected object, got array"}}},
+		{`{"author": 1, "content": 2}`, []ValidationError{
+			{"/author", "expected string, got integer"},
+			{"/content", "expected string, got integer"},
+		}},
+	}
+
+	for _, tt := range tests {
+		errs := s.Validate([]byte(tt.doc))
+		if len(errs) != len(tt.errors) {
+			t.Errorf("Validate(%s) = %v; want %v", tt.doc, errs, tt.errors)
+			continue
+		}
+		for i := range errs {
+			if errs[i] != tt.errors[i] {
+				t.Errorf("Validate(%s) = %v; want %v", tt.doc, errs, tt.errors)
+				break
+			}
+		}
+	}
+}
+
+func TestValidateInvalidJSON(t *testing.T) {
+	s, err := Parse([]byte(`true`))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	if errs := s.Validate([]byte(`{`)); len(errs) != 1 {
+		t.Errorf("expected a single error for invalid JSON, got: %v", errs)
+	}
+	if errs := s.Validate([]byte(`{} {}`)); len(errs) != 1 {
+		t.Errorf("expected a single error for trailing data, got: %v", errs)
+	}
+}
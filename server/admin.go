@@ -0,0 +1,242 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/kavinaravind/go-raft-message-queue/model"
+)
+
+// defaultPeekLimit is the number of messages returned by a peek when no max is given
+const defaultPeekLimit = 10
+
+// handleQueues is the handler for listing the queues along with their depth
+func (s *Server) handleQueues(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.failMethod(w, r)
+		return
+	}
+
+	queues, err := s.store.Queues()
+	if err != nil {
+		s.failStore(w, r, err, "Failed to list queues")
+		return
+	}
+
+	rendered := make([]model.QueueInfo, 0, len(queues))
+	for _, queue := range queues {
+		rendered = append(rendered, model.QueueInfo{Name: queue.Name, Depth: queue.Depth})
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Queues []model.QueueInfo `json:"queues"`
+	}{rendered})
+}
+
+// handleQueue is the handler for creating and deleting a queue
+// Creating a queue that already exists succeeds with 200 rather than 201
+func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	queue := queueName(r)
+
+	switch r.Method {
+	case http.MethodPut:
+		created, err := s.store.CreateQueue(queue)
+		if err != nil {
+			s.failStore(w, r, err, "Failed to create queue")
+			return
+		}
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+	case http.MethodDelete:
+		if err := s.store.DeleteQueue(queue); err != nil {
+			s.failStore(w, r, err, "Failed to delete queue")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.failMethod(w, r)
+	}
+}
+
+// handleQueuePurge is the handler for deleting every message of a queue
+func (s *Server) handleQueuePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.failMethod(w, r)
+		return
+	}
+
+	purged, err := s.store.PurgeQueue(queueName(r))
+	if err != nil {
+		s.failStore(w, r, err, "Failed to purge queue")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Purged int `json:"purged"`
+	}{purged})
+}
+
+// peekedMessage is the response model for a message peeked from a queue
+type peekedMessage struct {
+	ContentType string
+	Data        json.RawMessage
+}
+
+// handlePeek is the handler for getting messages from the front of a queue without removing them
+func (s *Server) handlePeek(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.failMethod(w, r)
+		return
+	}
+
+	max := defaultPeekLimit
+	if value := r.URL.Query().Get("max"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Invalid max")
+			return
+		}
+		max = parsed
+	}
+
+	messages, err := s.store.Peek(queueName(r), max)
+	if err != nil {
+		s.failStore(w, r, err, "Failed to peek queue")
+		return
+	}
+
+	rendered := make([]peekedMessage, 0, len(messages))
+	for _, message := range messages {
+		rendered = append(rendered, peekedMessage{
+			ContentType: message.Data.ContentType,
+			Data:        renderData(message.Data),
+		})
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Messages []peekedMessage
+	}{rendered})
+}
+
+// handleClusterRemove is the handler for removing a node from the cluster
+func (s *Server) handleClusterRemove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.failMethod(w, r)
+		return
+	}
+
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Failed to decode body: "+err.Error())
+		return
+	}
+	if body.ID == "" {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Missing id")
+		return
+	}
+
+	if err := s.store.Remove(body.ID); err != nil {
+		s.failStore(w, r, err, "Failed to remove node")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleClusterTransfer is the handler for transferring leadership to another node
+// Without an id, leadership is transferred to the most up to date node
+func (s *Server) handleClusterTransfer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.failMethod(w, r)
+		return
+	}
+
+	var body struct {
+		ID string `json:"id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Failed to decode body: "+err.Error())
+			return
+		}
+	}
+
+	if err := s.store.TransferLeadership(body.ID); err != nil {
+		s.failStore(w, r, err, "Failed to transfer leadership")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// The headers of a backup response, holding the position in the raft log the backup was taken at
+const (
+	backupIndexHeader = "X-Backup-Index"
+	backupTermHeader  = "X-Backup-Term"
+)
+
+// handleBackup is the handler for taking a snapshot of the state and streaming it out
+// The backup is taken on the node serving the request, so clients should send it to the leader
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.failMethod(w, r)
+		return
+	}
+
+	info, rc, err := s.store.OpenBackup()
+	if err != nil {
+		s.failStore(w, r, err, "Failed to take backup")
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(backupIndexHeader, strconv.FormatUint(info.Index, 10))
+	w.Header().Set(backupTermHeader, strconv.FormatUint(info.Term, 10))
+	if info.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent, so a failure can only be logged and the response cut short
+	if _, err := io.Copy(w, rc); err != nil {
+		s.logger.Error("Failed to stream backup", "error", err, "request_id", requestID(r))
+	}
+}
+
+// DefaultMaxRestoreSize is the largest backup accepted by a restore
+const DefaultMaxRestoreSize = 4 << 30
+
+// SetMaxRestoreSize is used to set the largest backup in bytes accepted by a restore
+func (s *Server) SetMaxRestoreSize(size int64) {
+	s.maxRestoreSize = size
+}
+
+// handleRestore is the handler for replacing the state of the cluster with a backup
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.failMethod(w, r)
+		return
+	}
+
+	// The backup is spooled to disk before it is restored, so its size is limited
+	var tooLarge *http.MaxBytesError
+	err := s.store.RestoreBackup(http.MaxBytesReader(w, r.Body, s.maxRestoreSize))
+	switch {
+	case errors.As(err, &tooLarge):
+		s.fail(w, r, http.StatusRequestEntityTooLarge, model.CodeTooLarge, fmt.Sprintf("Backup exceeds %d bytes", tooLarge.Limit))
+		return
+	case err != nil:
+		s.failStore(w, r, err, "Failed to restore backup")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
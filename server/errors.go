@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"github.com/kavinaravind/go-raft-message-queue/model"
+	"github.com/kavinaravind/go-raft-message-queue/schema"
+	"github.com/kavinaravind/go-raft-message-queue/store"
+)
+
+// requestIDHeader is the header carrying the id of a request, set by the client or assigned by the server
+const requestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength is the longest request id accepted from a client
+const maxRequestIDLength = 128
+
+// requestIDKey is the context key of the request id
+type requestIDKey struct{}
+
+// withRequestID is used to assign every request an id, which is returned in the response headers
+func withRequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// newRequestID is used to generate a random request id
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestID is used to get the id of the request
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// storeErrors are the status and code of each error returned by the store
+var storeErrors = []struct {
+	err    error
+	status int
+	code   model.ErrorCode
+}{
+	{store.ErrNotLeader, http.StatusServiceUnavailable, model.CodeNotLeader},
+	{store.ErrLeadershipLost, http.StatusServiceUnavailable, model.CodeLeadershipLost},
+	{store.ErrTimeout, http.StatusServiceUnavailable, model.CodeTimeout},
+	{store.ErrShuttingDown, http.StatusServiceUnavailable, model.CodeShuttingDown},
+	{store.ErrQueueNotFound, http.StatusNotFound, model.CodeQueueNotFound},
+	{store.ErrStreamNotFound, http.StatusNotFound, model.CodeStreamNotFound},
+	{store.ErrOffsetOutOfRange, http.StatusBadRequest, model.CodeBadRequest},
+	{store.ErrNodeNotFound, http.StatusNotFound, model.CodeNodeNotFound},
+	{store.ErrDefaultQueue, http.StatusBadRequest, model.CodeBadRequest},
+	{store.ErrInvalidBackup, http.StatusBadRequest, model.CodeBadRequest},
+	{schema.ErrSubjectNotFound, http.StatusNotFound, model.CodeSchemaNotFound},
+	{schema.ErrCompatibilityMismatch, http.StatusConflict, model.CodeIncompatibleSchema},
+}
+
+// newError is used to create the body of an error response, with the id of the request and the current leader
+func (s *Server) newError(r *http.Request, code model.ErrorCode, message string) *model.Error {
+	e := &model.Error{Code: code, Message: message, RequestID: requestID(r)}
+	if leader, ok := s.store.Leader(); ok {
+		e.LeaderID = leader.ID
+		e.Leader = leader.Address
+	}
+	return e
+}
+
+// fail is used to write an error response with the given status and code
+func (s *Server) fail(w http.ResponseWriter, r *http.Request, status int, code model.ErrorCode, message string) {
+	writeJSON(w, status, s.newError(r, code, message))
+}
+
+// failStore is used to write the error response for an error returned by the store
+// Errors the client can act on are returned as is, any other error is logged and described by the message
+func (s *Server) failStore(w http.ResponseWriter, r *http.Request, err error, message string) {
+	for _, e := range storeErrors {
+		if errors.Is(err, e.err) {
+			s.fail(w, r, e.status, e.code, err.Error())
+			return
+		}
+	}
+
+	s.logger.Error(message, "error", err, "request_id", requestID(r))
+	s.fail(w, r, http.StatusInternalServerError, model.CodeInternal, message+": "+err.Error())
+}
+
+// failMethod is used to write the error response for a request method the endpoint does not accept
+func (s *Server) failMethod(w http.ResponseWriter, r *http.Request) {
+	s.fail(w, r, http.StatusMethodNotAllowed, model.CodeMethodNotAllowed, "Invalid request method")
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kavinaravind/go-raft-message-queue/model"
+)
+
+// DefaultReadyMaxLag is the number of committed log entries a node may have yet to apply and still be ready
+const DefaultReadyMaxLag = 1000
+
+// SetReadyMaxLag is used to set the number of committed log entries a node may have yet to apply and still be ready
+func (s *Server) SetReadyMaxLag(lag uint64) {
+	s.readyMaxLag = lag
+}
+
+// handleHealth is the handler for the liveness probe, it succeeds as long as the process serves requests
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s.failMethod(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.Health{Status: "ok"})
+}
+
+// handleReady is the handler for the readiness probe
+// A node is ready once it knows the leader, has applied the log up to the commit index within the allowed lag,
+// and is not restoring a snapshot, otherwise it returns 503 along with the reasons
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s.failMethod(w, r)
+		return
+	}
+
+	readiness := s.store.Readiness()
+	response := model.Readiness{
+		LeaderID:     readiness.Leader.ID,
+		Leader:       readiness.Leader.Address,
+		AppliedIndex: readiness.AppliedIndex,
+		CommitIndex:  readiness.CommitIndex,
+		Restoring:    readiness.Restoring,
+	}
+	if !readiness.LeaderKnown {
+		response.Reasons = append(response.Reasons, "no known leader")
+	}
+	if lag := readiness.Lag(); lag > s.readyMaxLag {
+		response.Reasons = append(response.Reasons, fmt.Sprintf("%d committed entries not applied, more than %d", lag, s.readyMaxLag))
+	}
+	if readiness.Restoring {
+		response.Reasons = append(response.Reasons, "restoring a snapshot")
+	}
+
+	response.Ready = len(response.Reasons) == 0
+	if !response.Ready {
+		writeJSON(w, http.StatusServiceUnavailable, response)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleLeader is the handler for finding the leader, it only succeeds on the leader
+// Load balancers can check it to send writes to the leader only, other nodes return not_leader with the leader
+func (s *Server) handleLeader(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s.failMethod(w, r)
+		return
+	}
+
+	if !s.store.IsLeader() {
+		s.fail(w, r, http.StatusServiceUnavailable, model.CodeNotLeader, "Node is not the leader")
+		return
+	}
+
+	leader, _ := s.store.Leader()
+	writeJSON(w, http.StatusOK, model.Leader{ID: leader.ID, Address: leader.Address})
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/kavinaravind/go-raft-message-queue/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serverMetrics are the prometheus metrics of the HTTP requests served
+type serverMetrics struct {
+	// requests counts the requests served by route and status code
+	requests *prometheus.CounterVec
+
+	// duration is the time taken to serve requests by route and status code
+	duration *prometheus.HistogramVec
+}
+
+// newServerMetrics creates the metrics of the server and registers them along with the go runtime and process metrics
+func newServerMetrics(registry *prometheus.Registry) *serverMetrics {
+	m := &serverMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: store.MetricsNamespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests served, by route and status code.",
+		}, []string{"route", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: store.MetricsNamespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests, by route and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "code"}),
+	}
+
+	registry.MustRegister(
+		m.requests,
+		m.duration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// instrument is used to record the requests served by the handler of the route
+func (m *serverMetrics) instrument(route string, handler http.Handler) http.Handler {
+	labels := prometheus.Labels{"route": route}
+	return promhttp.InstrumentHandlerDuration(m.duration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(m.requests.MustCurryWith(labels), handler),
+	)
+}
+
+// Registry is used to get the registry exported by the /metrics endpoint, so that other metrics can be added to it
+func (s *Server) Registry() *prometheus.Registry {
+	return s.registry
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/kavinaravind/go-raft-message-queue/model"
+)
+
+// maxPayloadSize is the largest message body accepted by the server
+const maxPayloadSize = 1 << 20
+
+// Model is used to validate and normalize the payload of messages sent to a queue
+type Model interface {
+	// Decode is used to turn a request body into the payload that will be stored
+	Decode(contentType string, body []byte) (model.Payload, error)
+}
+
+// typedModel is a model that only accepts JSON matching the type T
+type typedModel[T any] struct{}
+
+// TypedModel creates a model that decodes JSON into T, rejecting unknown fields
+// The payload is stored as the re-encoded value of T
+func TypedModel[T any]() Model {
+	return typedModel[T]{}
+}
+
+// Decode is used to decode the body into T and re-encode it as a JSON payload
+func (typedModel[T]) Decode(contentType string, body []byte) (model.Payload, error) {
+	if !model.IsJSONContentType(contentType) {
+		return model.Payload{}, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+
+	var value T
+	if err := dec.Decode(&value); err != nil {
+		return model.Payload{}, err
+	}
+	if dec.More() {
+		return model.Payload{}, errors.New("unexpected data after JSON value")
+	}
+
+	return model.NewJSONPayload(value)
+}
+
+// opaqueModel is the model used for queues without a typed model
+type opaqueModel struct{}
+
+// Decode is used to accept any body, checking only that JSON bodies are well formed
+func (opaqueModel) Decode(contentType string, body []byte) (model.Payload, error) {
+	if model.IsJSONContentType(contentType) && !json.Valid(body) {
+		return model.Payload{}, errors.New("invalid JSON body")
+	}
+	return model.NewPayload(contentType, body), nil
+}
+
+// readPayload is used to read the body and content type of a request
+// Bodies sent without a content type (or as a form, the curl default) that are valid JSON are treated as JSON
+func readPayload(r *http.Request) (string, []byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize+1))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(body) > maxPayloadSize {
+		return "", nil, fmt.Errorf("body exceeds %d bytes", maxPayloadSize)
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if (mediaType == "" || mediaType == "application/x-www-form-urlencoded") && json.Valid(body) {
+		contentType = model.JSONContentType
+	}
+
+	return contentType, body, nil
+}
+
+// renderData is used to embed a payload in a JSON response
+// JSON payloads are embedded as is, any other payload as a base64 string
+func renderData(payload model.Payload) json.RawMessage {
+	if payload.IsEmpty() {
+		return json.RawMessage("{}")
+	}
+	if payload.IsJSON() {
+		return payload.Body
+	}
+
+	data, _ := json.Marshal(payload.Body)
+	return data
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kavinaravind/go-raft-message-queue/model"
+)
+
+func TestTypedModel(t *testing.T) {
+	m := TypedModel[model.Comment]()
+
+	payload, err := m.Decode("application/json", []byte(`{"author": "Alice"}`))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !payload.IsJSON() || string(payload.Body) != `{"author":"Alice"}` {
+		t.Errorf("expected re-encoded comment, got: %s", payload.Body)
+	}
+
+	if _, err := m.Decode("application/json", []byte(`{"author": "Alice", "extra": 1}`)); err == nil {
+		t.Error("expected error for unknown field")
+	}
+	if _, err := m.Decode("application/json", []byte(`{"author": "Alice"} {}`)); err == nil {
+		t.Error("expected error for trailing data")
+	}
+	if _, err := m.Decode("text/plain", []byte(`{"author": "Alice"}`)); err == nil {
+		t.Error("expected error for non JSON content type")
+	}
+}
+
+func TestOpaqueModel(t *testing.T) {
+	payload, err := opaqueModel{}.Decode("application/octet-stream", []byte{0x00, 0xff})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if payload.IsJSON() || len(payload.Body) != 2 {
+		t.Errorf("expected binary payload, got: %v", payload)
+	}
+
+	if _, err := (opaqueModel{}).Decode("application/json", []byte(`{`)); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestReadPayload(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		expected    string
+	}{
+		{"", `{"a": 1}`, "application/json"},
+		{"application/x-www-form-urlencoded", `{"a": 1}`, "application/json"},
+		{"application/x-www-form-urlencoded", `a=1`, "application/x-www-form-urlencoded"},
+		{"text/plain", `{"a": 1}`, "text/plain"},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodPost, "/send", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+
+		contentType, body, err := readPayload(req)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if contentType != tt.expected || string(body) != tt.body {
+			t.Errorf("readPayload(%q) = %q; want %q", tt.contentType, contentType, tt.expected)
+		}
+	}
+}
+
+func TestRenderData(t *testing.T) {
+	tests := []struct {
+		payload  model.Payload
+		expected string
+	}{
+		{model.Payload{}, `{}`},
+		{model.NewPayload("application/json", []byte(`{"a":1}`)), `{"a":1}`},
+		{model.NewPayload("text/plain", []byte("hi")), `"aGk="`},
+	}
+
+	for _, tt := range tests {
+		if got := string(renderData(tt.payload)); got != tt.expected {
+			t.Errorf("renderData(%v) = %s; want %s", tt.payload, got, tt.expected)
+		}
+	}
+}
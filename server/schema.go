@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/kavinaravind/go-raft-message-queue/model"
+	"github.com/kavinaravind/go-raft-message-queue/schema"
+)
+
+// schemaVersion is the response model for a registered schema version
+type schemaVersion struct {
+	Version int
+	Schema  json.RawMessage
+}
+
+// validationFailure is the response model for a message rejected by its queue's schema
+type validationFailure struct {
+	*model.Error
+	Version int                      `json:"version"`
+	Errors  []schema.ValidationError `json:"errors"`
+}
+
+// validate is used to check the payload against the schema attached to the queue
+// It returns nil if the queue has no schema or the payload conforms
+func (s *Server) validate(queue string, payload model.Payload) *validationFailure {
+	compiled, version, ok := s.store.Schema(queue)
+	if !ok {
+		return nil
+	}
+
+	failure := &validationFailure{Version: version.Version}
+
+	if !payload.IsJSON() {
+		failure.Errors = []schema.ValidationError{{Path: "/", Message: "expected a JSON payload"}}
+		return failure
+	}
+
+	if failure.Errors = compiled.Validate(payload.Body); len(failure.Errors) == 0 {
+		return nil
+	}
+	return failure
+}
+
+// handleSchema is the handler for getting, registering and deleting the schema of a queue
+func (s *Server) handleSchema(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleGetSchema(w, r)
+	case http.MethodPut:
+		s.handleRegisterSchema(w, r)
+	case http.MethodDelete:
+		s.handleDeleteSchema(w, r)
+	default:
+		s.failMethod(w, r)
+	}
+}
+
+// handleGetSchema is the handler for getting every version of the schema of a queue
+func (s *Server) handleGetSchema(w http.ResponseWriter, r *http.Request) {
+	queue := queueName(r)
+
+	subject, ok := s.store.SchemaHistory(queue)
+	if !ok {
+		s.fail(w, r, http.StatusNotFound, model.CodeSchemaNotFound, "No schema attached to queue")
+		return
+	}
+
+	versions := make([]schemaVersion, 0, len(subject.Versions))
+	for _, version := range subject.Versions {
+		versions = append(versions, schemaVersion{Version: version.Version, Schema: version.Schema})
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Queue         string
+		Compatibility schema.Compatibility
+		Versions      []schemaVersion
+	}{queue, subject.Compatibility, versions})
+}
+
+// handleRegisterSchema is the handler for attaching a new schema version to a queue
+func (s *Server) handleRegisterSchema(w http.ResponseWriter, r *http.Request) {
+	// The compatibility only applies to a new subject, that of an existing subject is changed with /schema/compatibility
+	var compatibility schema.Compatibility
+	if value := r.URL.Query().Get("compatibility"); value != "" {
+		parsed, err := schema.ParseCompatibility(value)
+		if err != nil {
+			s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, err.Error())
+			return
+		}
+		compatibility = parsed
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize+1))
+	if err != nil {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Failed to read schema: "+err.Error())
+		return
+	}
+	if len(raw) > maxPayloadSize {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, fmt.Sprintf("Failed to read schema: schema exceeds %d bytes", maxPayloadSize))
+		return
+	}
+
+	// Check the schema before it is replicated
+	if _, err := schema.Parse(raw); err != nil {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, err.Error())
+		return
+	}
+
+	version, err := s.store.RegisterSchema(queueName(r), raw, compatibility)
+	var incompatible *schema.IncompatibleError
+	switch {
+	case errors.As(err, &incompatible):
+		writeJSON(w, http.StatusConflict, struct {
+			*model.Error
+			Problems []string `json:"problems"`
+		}{s.newError(r, model.CodeIncompatibleSchema, incompatible.Error()), incompatible.Problems})
+		return
+	case err != nil:
+		s.failStore(w, r, err, "Failed to register schema")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]int{"Version": version})
+}
+
+// handleSchemaCompatibility is the handler for changing the compatibility of the schema of a queue
+func (s *Server) handleSchemaCompatibility(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		s.failMethod(w, r)
+		return
+	}
+
+	value := r.URL.Query().Get("compatibility")
+	if value == "" {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Missing compatibility")
+		return
+	}
+	compatibility, err := schema.ParseCompatibility(value)
+	if err != nil {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, err.Error())
+		return
+	}
+
+	if err := s.store.SetCompatibility(queueName(r), compatibility); err != nil {
+		s.failStore(w, r, err, "Failed to set compatibility")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeleteSchema is the handler for detaching the schema from a queue
+func (s *Server) handleDeleteSchema(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeleteSchema(queueName(r)); err != nil {
+		s.failStore(w, r, err, "Failed to delete schema")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON is used to write a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -6,11 +6,32 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/kavinaravind/go-raft-message-queue/ds"
 	"github.com/kavinaravind/go-raft-message-queue/model"
 	"github.com/kavinaravind/go-raft-message-queue/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
+// defaultQueue is the queue used when a request does not name one
+const defaultQueue = store.DefaultQueue
+
+// defaultStream is the stream used when a request does not name one
+const defaultStream = "default"
+
+// defaultReadLimit is the number of entries returned by a stream read when no max is given
+const defaultReadLimit = 100
+
+// idempotencyKeyHeader is the header carrying the key a send is deduplicated by
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// replayedHeader is set on the response to a send that was deduplicated by its key
+const replayedHeader = "Idempotent-Replayed"
+
 // Config is the configuration for the server
 type Config struct {
 	// Address is the address at which the server will be listening
@@ -28,36 +49,105 @@ type Server struct {
 	httpServer *http.Server
 
 	// store is the store instance
-	store *store.Store[model.Comment]
+	store *store.Store[model.Payload]
+
+	// models are the typed models registered for specific queues
+	models map[string]Model
+
+	// readyMaxLag is the number of committed log entries the node may have yet to apply and still be ready
+	readyMaxLag uint64
+
+	// maxRestoreSize is the largest backup accepted by a restore
+	maxRestoreSize int64
+
+	// registry holds the metrics exported by the /metrics endpoint
+	registry *prometheus.Registry
+
+	// metrics are the metrics of the HTTP requests served
+	metrics *serverMetrics
 
 	// logger is the logger instance
 	logger *slog.Logger
 }
 
 // NewServer creates a new instance of the Server
-func NewServer(store *store.Store[model.Comment], logger *slog.Logger) *Server {
+// The metrics of the store are exported along with those of the server
+func NewServer(store *store.Store[model.Payload], logger *slog.Logger) *Server {
+	registry := prometheus.NewRegistry()
+	if err := store.RegisterMetrics(registry); err != nil {
+		logger.Error("Failed to register store metrics", "error", err)
+	}
+
 	return &Server{
-		store:  store,
-		logger: logger,
+		store:       store,
+		models:      map[string]Model{},
+		readyMaxLag: DefaultReadyMaxLag,
+		registry:    registry,
+		metrics:     newServerMetrics(registry),
+		logger:      logger,
+
+		maxRestoreSize: DefaultMaxRestoreSize,
 	}
 }
 
-// Initialize starts the HTTP server
-func (s *Server) Initialize(ctx context.Context, conf *Config) chan struct{} {
-	s.logger.Info("Initializing server")
+// RegisterModel is used to validate messages sent to the queue with the given model
+// It must be called before Initialize, queues without a model accept any payload
+func (s *Server) RegisterModel(queue string, m Model) {
+	s.models[queue] = m
+}
 
+// modelFor is used to get the model of the queue
+func (s *Server) modelFor(queue string) Model {
+	if m, ok := s.models[queue]; ok {
+		return m
+	}
+	return opaqueModel{}
+}
+
+// Handler is used to get the handler serving every endpoint of the server
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
+	handle := func(route string, handler http.HandlerFunc) {
+		mux.Handle(route, s.metrics.instrument(route, otelhttp.NewHandler(withRequestID(handler), route)))
+	}
 
 	// Register the handlers
-	mux.HandleFunc("/send", s.handleSend)
-	mux.HandleFunc("/recieve", s.handleRecieve)
-	mux.HandleFunc("/stats", s.handleStats)
-	mux.HandleFunc("/join", s.handleJoin)
+	handle("/send", s.handleSend)
+	handle("/recieve", s.handleRecieve)
+	handle("/stats", s.handleStats)
+	handle("/join", s.handleJoin)
+	handle("/cluster", s.handleCluster)
+	handle("/cluster/remove", s.handleClusterRemove)
+	handle("/cluster/transfer", s.handleClusterTransfer)
+	handle("/bootstrap", s.handleBootstrap)
+	handle("/healthz", s.handleHealth)
+	handle("/readyz", s.handleReady)
+	handle("/leader", s.handleLeader)
+	handle("/queues", s.handleQueues)
+	handle("/queue", s.handleQueue)
+	handle("/queue/purge", s.handleQueuePurge)
+	handle("/peek", s.handlePeek)
+	handle("/stream/append", s.handleStreamAppend)
+	handle("/stream/read", s.handleStreamRead)
+	handle("/stream/commit", s.handleStreamCommit)
+	handle("/stream/retention", s.handleStreamRetention)
+	handle("/schema", s.handleSchema)
+	handle("/schema/compatibility", s.handleSchemaCompatibility)
+	handle("/admin/backup", s.handleBackup)
+	handle("/admin/restore", s.handleRestore)
+	handle("/metrics", promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}).ServeHTTP)
+
+	return mux
+}
+
+// Initialize starts the HTTP server
+func (s *Server) Initialize(ctx context.Context, conf *Config) chan struct{} {
+	s.logger.Info("Initializing server")
 
 	// Create the HTTP server
 	s.httpServer = &http.Server{
 		Addr:    conf.Address,
-		Handler: mux,
+		Handler: s.Handler(),
 	}
 
 	// Start the HTTP server
@@ -86,41 +176,79 @@ func (s *Server) Initialize(ctx context.Context, conf *Config) chan struct{} {
 // handleSend is the handler for sending a message
 func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		s.failMethod(w, r)
+		return
+	}
+
+	queue := queueName(r)
+
+	contentType, body, err := readPayload(r)
+	if err != nil {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Failed to read message: "+err.Error())
 		return
 	}
 
-	var message model.Comment
-	if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
-		http.Error(w, "Failed to decode message", http.StatusBadRequest)
+	payload, err := s.modelFor(queue).Decode(contentType, body)
+	if err != nil {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Failed to decode message: "+err.Error())
 		return
 	}
 
-	if err := s.store.Send(message); err != nil {
-		http.Error(w, "Failed to send message", http.StatusInternalServerError)
+	if failure := s.validate(queue, payload); failure != nil {
+		failure.Error = s.newError(r, model.CodeInvalidMessage, "Message does not match the schema")
+		writeJSON(w, http.StatusBadRequest, failure)
+		return
+	}
+
+	duplicate, err := s.store.SendIdempotent(r.Context(), queue, r.Header.Get(idempotencyKeyHeader), payload)
+	if err != nil {
+		s.failStore(w, r, err, "Failed to send message")
 		return
 	}
 
+	// A retried send is acknowledged in the same way as the original, as the message was enqueued once
+	if duplicate {
+		w.Header().Set(replayedHeader, "true")
+	}
 	w.WriteHeader(http.StatusCreated)
 }
 
 // handleRecieve is the handler for recieving a message
 func (s *Server) handleRecieve(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		s.failMethod(w, r)
 		return
 	}
 
-	message, err := s.store.Recieve()
+	message, err := s.store.RecieveContext(r.Context(), queueName(r))
 	if err != nil {
-		http.Error(w, "Failed to recieve message", http.StatusInternalServerError)
+		s.failStore(w, r, err, "Failed to recieve message")
 		return
 	}
 
+	// The headers of the message, such as the trace context of the producer, are returned as response headers
+	for key, value := range message.Headers {
+		w.Header().Set(key, value)
+	}
+
+	// Payloads that are not JSON are returned as is with their content type
+	payload := message.Data
+	if !payload.IsEmpty() && !payload.IsJSON() {
+		w.Header().Set("Content-Type", payload.ContentType)
+		if _, err := w.Write(payload.Body); err != nil {
+			s.logger.Error("Failed to write message", "error", err)
+		}
+		return
+	}
+
+	// Empty tells an empty queue apart from a message that is an empty JSON object
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(message)
+	err = json.NewEncoder(w).Encode(struct {
+		Data  json.RawMessage
+		Empty bool `json:",omitempty"`
+	}{renderData(payload), payload.IsEmpty()})
 	if err != nil {
-		http.Error(w, "Failed to encode message", http.StatusInternalServerError)
+		s.fail(w, r, http.StatusInternalServerError, model.CodeInternal, "Failed to encode message")
 		return
 	}
 
@@ -134,7 +262,7 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	err := json.NewEncoder(w).Encode(stats)
 	if err != nil {
-		http.Error(w, "Failed to encode message", http.StatusInternalServerError)
+		s.fail(w, r, http.StatusInternalServerError, model.CodeInternal, "Failed to encode message")
 		return
 	}
 
@@ -142,39 +270,296 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleJoin is the handler for joining a remote node to the cluster
+// The HTTP address of the node is optional, it is registered so that clients can be directed to the node
 func (s *Server) handleJoin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		s.failMethod(w, r)
 		return
 	}
 
-	body := map[string]string{}
+	var body struct {
+		ID          string `json:"id"`
+		Address     string `json:"address"`
+		HTTPAddress string `json:"http_address"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Failed to decode body", http.StatusBadRequest)
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Failed to decode body: "+err.Error())
+		return
+	}
+
+	if body.ID == "" || body.Address == "" {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Missing id or address")
+		return
+	}
+
+	if err := s.store.Join(body.ID, body.Address); err != nil {
+		s.failStore(w, r, err, "Failed to join cluster")
+		return
+	}
+
+	if body.HTTPAddress != "" {
+		if err := s.store.RegisterMember(body.ID, body.HTTPAddress); err != nil {
+			s.failStore(w, r, err, "Failed to register node address")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleCluster is the handler for getting the nodes of the cluster and its leader
+// It is served by every node, so clients can discover the leader from any of them
+func (s *Server) handleCluster(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.failMethod(w, r)
 		return
 	}
 
-	if len(body) != 2 {
-		w.WriteHeader(http.StatusBadRequest)
+	servers, err := s.store.Servers()
+	if err != nil {
+		s.failStore(w, r, err, "Failed to get cluster configuration")
+		return
+	}
+
+	cluster := model.Cluster{Nodes: make([]model.Node, 0, len(servers))}
+	for _, server := range servers {
+		cluster.Nodes = append(cluster.Nodes, model.Node{
+			ID:          server.ID,
+			Address:     server.Address,
+			RaftAddress: server.RaftAddress,
+			Voter:       server.Voter,
+			Leader:      server.Leader,
+		})
+	}
+	if leader, ok := s.store.Leader(); ok {
+		cluster.LeaderID = leader.ID
+		cluster.Leader = leader.Address
+	}
+
+	writeJSON(w, http.StatusOK, cluster)
+}
+
+// handleBootstrap is the handler for getting the state of the node while the cluster is formed
+// Nodes started with an expected number of servers poll it on their peers to agree on the configuration
+func (s *Server) handleBootstrap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.failMethod(w, r)
+		return
+	}
+
+	status, err := s.store.BootstrapStatus()
+	if err != nil {
+		s.failStore(w, r, err, "Failed to get bootstrap status")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.BootstrapStatus{
+		ID:           status.Self.ID,
+		Address:      status.Self.Address,
+		RaftAddress:  status.Self.RaftAddress,
+		Bootstrapped: status.Bootstrapped,
+		Candidates:   status.Candidates,
+	})
+}
+
+// queueName is used to get the queue named in the request query
+func queueName(r *http.Request) string {
+	if name := r.URL.Query().Get("queue"); name != "" {
+		return name
+	}
+	return defaultQueue
+}
+
+// streamName is used to get the stream named in the request query
+func streamName(r *http.Request) string {
+	if name := r.URL.Query().Get("stream"); name != "" {
+		return name
+	}
+	return defaultStream
+}
+
+// handleStreamAppend is the handler for appending a message to a stream
+func (s *Server) handleStreamAppend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.failMethod(w, r)
 		return
 	}
 
-	remoteAddress, ok := body["address"]
-	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
+	contentType, body, err := readPayload(r)
+	if err != nil {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Failed to read message: "+err.Error())
 		return
 	}
 
-	nodeID, ok := body["id"]
-	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
+	payload, err := opaqueModel{}.Decode(contentType, body)
+	if err != nil {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Failed to decode message: "+err.Error())
 		return
 	}
 
-	if err := s.store.Join(nodeID, remoteAddress); err != nil {
-		http.Error(w, "Failed to join cluster", http.StatusInternalServerError)
+	offset, err := s.store.Append(streamName(r), payload)
+	if err != nil {
+		s.failStore(w, r, err, "Failed to append message")
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]uint64{"Offset": offset}); err != nil {
+		s.logger.Error("Failed to encode offset", "error", err)
+	}
+}
+
+// streamEntry is the response model for an entry read from a stream
+type streamEntry struct {
+	Offset      uint64
+	Timestamp   time.Time
+	ContentType string
+	Data        json.RawMessage
+}
+
+// handleStreamRead is the handler for reading messages from a stream
+// The starting position is the timestamp, the offset or the group's committed offset, in that order
+func (s *Server) handleStreamRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.failMethod(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	stream := streamName(r)
+
+	max := defaultReadLimit
+	if value := query.Get("max"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Invalid max")
+			return
+		}
+		max = parsed
+	}
+
+	var offset uint64
+	var err error
+	switch {
+	case query.Get("timestamp") != "":
+		timestamp, parseErr := time.Parse(time.RFC3339Nano, query.Get("timestamp"))
+		if parseErr != nil {
+			s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Invalid timestamp")
+			return
+		}
+		offset, err = s.store.Seek(stream, timestamp)
+	case query.Get("offset") != "":
+		offset, err = strconv.ParseUint(query.Get("offset"), 10, 64)
+		if err != nil {
+			s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Invalid offset")
+			return
+		}
+	case query.Get("group") != "":
+		offset, err = s.store.GroupOffset(stream, query.Get("group"))
+	}
+	if err != nil {
+		s.failStore(w, r, err, "Failed to read stream")
+		return
+	}
+
+	entries, err := s.store.Read(stream, offset, max)
+	if err != nil {
+		s.failStore(w, r, err, "Failed to read stream")
+		return
+	}
+
+	// Next is the offset to continue reading from (or commit once processed)
+	next := offset
+	if len(entries) > 0 {
+		next = entries[len(entries)-1].Offset + 1
+	}
+
+	rendered := make([]streamEntry, 0, len(entries))
+	for _, entry := range entries {
+		rendered = append(rendered, streamEntry{
+			Offset:      entry.Offset,
+			Timestamp:   entry.Timestamp,
+			ContentType: entry.Data.ContentType,
+			Data:        renderData(entry.Data),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(struct {
+		Entries []streamEntry
+		Next    uint64
+	}{rendered, next})
+	if err != nil {
+		s.fail(w, r, http.StatusInternalServerError, model.CodeInternal, "Failed to encode entries")
+		return
+	}
+}
+
+// handleStreamCommit is the handler for committing a consumer group offset
+func (s *Server) handleStreamCommit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.failMethod(w, r)
+		return
+	}
+
+	var body struct {
+		Group  string `json:"group"`
+		Offset uint64 `json:"offset"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Failed to decode body: "+err.Error())
+		return
+	}
+
+	if body.Group == "" {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Missing group")
+		return
+	}
+
+	if err := s.store.Commit(streamName(r), body.Group, body.Offset); err != nil {
+		s.failStore(w, r, err, "Failed to commit offset")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleStreamRetention is the handler for setting the retention policy of a stream
+func (s *Server) handleStreamRetention(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.failMethod(w, r)
+		return
+	}
+
+	var body struct {
+		MaxEntries int    `json:"maxEntries"`
+		MaxAge     string `json:"maxAge"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Failed to decode body: "+err.Error())
+		return
+	}
+
+	retention := ds.Retention{MaxEntries: body.MaxEntries}
+	if body.MaxAge != "" {
+		maxAge, err := time.ParseDuration(body.MaxAge)
+		if err != nil {
+			s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Invalid maxAge")
+			return
+		}
+		retention.MaxAge = maxAge
+	}
+
+	if retention.MaxEntries < 0 || retention.MaxAge < 0 {
+		s.fail(w, r, http.StatusBadRequest, model.CodeBadRequest, "Retention must not be negative")
+		return
+	}
+
+	if err := s.store.SetRetention(streamName(r), retention); err != nil {
+		s.failStore(w, r, err, "Failed to set retention")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
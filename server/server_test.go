@@ -1,64 +1,290 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
-	"github.com/kavinaravind/go-raft-message-queue/consensus"
 	"github.com/kavinaravind/go-raft-message-queue/model"
 	"github.com/kavinaravind/go-raft-message-queue/store"
+	"github.com/kavinaravind/go-raft-message-queue/testcluster"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
-func setup(t *testing.T) (*store.Store[model.Comment], *Server) {
-	// Create a new logger
-	logger := slog.Default()
+func setup(t *testing.T) (*store.Store[model.Payload], *Server) {
+	// Start a single node cluster over an in-memory transport
+	cluster := testcluster.New[model.Payload](t, 1)
+	store := cluster.Leader().Store
 
-	// Create a new store
-	store := store.NewStore[model.Comment](logger)
+	// Create a new server with the store of the node
+	server := NewServer(store, slog.Default())
 
-	tmpDir1, err := os.MkdirTemp("", "node1")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
+	return store, server
+}
+
+// TestServerCluster checks that only the leader of a cluster accepts writes over http
+func TestServerCluster(t *testing.T) {
+	t.Parallel()
+	cluster := testcluster.New[model.Payload](t, 3)
+
+	send := func(node *testcluster.Node[model.Payload]) int {
+		server := httptest.NewServer(NewServer(node.Store, slog.Default()).Handler())
+		defer server.Close()
+
+		resp, err := http.Post(server.URL+"/send", "application/json", strings.NewReader(`{"data": "hello"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
 	}
-	t.Cleanup(func() {
-		os.RemoveAll(tmpDir1)
-	})
 
-	// Create a new consensus config
-	conf := &consensus.Config{
-		IsLeader:      true,
-		ServerID:      "node1",
-		BaseDirectory: tmpDir1,
-		Address:       "localhost:8000",
+	if status := send(cluster.Leader()); status != http.StatusCreated {
+		t.Errorf("expected the leader to accept the send, got status %d", status)
+	}
+	for _, follower := range cluster.Followers() {
+		if status := send(follower); status == http.StatusCreated {
+			t.Errorf("expected %s to reject the send as a follower", follower.ID)
+		}
 	}
+}
 
-	// Create a context with a cancel function
-	ctx, cancel := context.WithCancel(context.Background())
+// TestServerErrors checks that failures are returned as typed errors with the request id and the leader
+func TestServerErrors(t *testing.T) {
+	t.Parallel()
+	cluster := testcluster.New[model.Payload](t, 3)
+	leader := cluster.Leader()
+	if err := leader.Store.RegisterMember(leader.ID, "leader.example:3000"); err != nil {
+		t.Fatal(err)
+	}
+	cluster.WaitForReplication()
+
+	do := func(node *testcluster.Node[model.Payload], req *http.Request) (*httptest.ResponseRecorder, model.Error) {
+		rr := httptest.NewRecorder()
+		NewServer(node.Store, slog.Default()).Handler().ServeHTTP(rr, req)
 
-	// Call Initialize
-	shutdownComplete, err := store.Initialize(ctx, conf)
-	if err != nil {
-		t.Fatalf("Expected no error, got: %v", err)
+		var body model.Error
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatalf("expected a JSON error body, got: %v", err)
+		}
+		return rr, body
 	}
-	t.Cleanup(func() {
-		// Cancel the context to trigger store shutdown
-		cancel()
 
-		// Wait for shutdown to complete
-		<-shutdownComplete
+	t.Run("not leader", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/send", strings.NewReader(`{"data": "hello"}`))
+		req.Header.Set(requestIDHeader, "abc123")
+		rr, body := do(cluster.Followers()[0], req)
+
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+		}
+		if body.Code != model.CodeNotLeader || !body.Code.Retryable() {
+			t.Errorf("expected a retryable %s error, got %s", model.CodeNotLeader, body.Code)
+		}
+		if body.RequestID != "abc123" || rr.Header().Get(requestIDHeader) != "abc123" {
+			t.Errorf("expected the request id to be echoed, got %q and %q", body.RequestID, rr.Header().Get(requestIDHeader))
+		}
+		if body.LeaderID != leader.ID || body.Leader != "leader.example:3000" {
+			t.Errorf("expected the leader hint %s at leader.example:3000, got %s at %s", leader.ID, body.LeaderID, body.Leader)
+		}
 	})
 
-	// Create a new server with a mock store and logger
-	server := NewServer(store, logger)
+	t.Run("queue not found", func(t *testing.T) {
+		rr, body := do(leader, httptest.NewRequest(http.MethodGet, "/recieve?queue=missing", nil))
 
-	return store, server
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+		}
+		if body.Code != model.CodeQueueNotFound {
+			t.Errorf("expected a %s error, got %s", model.CodeQueueNotFound, body.Code)
+		}
+		if body.RequestID == "" || body.RequestID != rr.Header().Get(requestIDHeader) {
+			t.Errorf("expected a generated request id, got %q", body.RequestID)
+		}
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		rr, body := do(leader, httptest.NewRequest(http.MethodPost, "/join", strings.NewReader(`{"id": "node4"}`)))
+
+		if rr.Code != http.StatusBadRequest || body.Code != model.CodeBadRequest {
+			t.Errorf("expected a %d %s error, got %d %s", http.StatusBadRequest, model.CodeBadRequest, rr.Code, body.Code)
+		}
+	})
+}
+
+// TestServerHealth checks the probes of the nodes of a cluster, and of a node that is not part of one
+func TestServerHealth(t *testing.T) {
+	t.Parallel()
+	cluster := testcluster.New[model.Payload](t, 3)
+	leader := cluster.Leader()
+	follower := cluster.Followers()[0]
+	cluster.WaitForReplication()
+
+	get := func(node *testcluster.Node[model.Payload], route string, v any) int {
+		rr := httptest.NewRecorder()
+		NewServer(node.Store, slog.Default()).Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, route, nil))
+		if err := json.NewDecoder(rr.Body).Decode(v); err != nil {
+			t.Fatalf("expected a JSON body from %s, got: %v", route, err)
+		}
+		return rr.Code
+	}
+
+	for _, node := range []*testcluster.Node[model.Payload]{leader, follower} {
+		var health model.Health
+		if code := get(node, "/healthz", &health); code != http.StatusOK || health.Status != "ok" {
+			t.Errorf("expected %s to be live, got %d %+v", node.ID, code, health)
+		}
+
+		var readiness model.Readiness
+		if code := get(node, "/readyz", &readiness); code != http.StatusOK || !readiness.Ready || readiness.LeaderID != leader.ID {
+			t.Errorf("expected %s to be ready, got %d %+v", node.ID, code, readiness)
+		}
+	}
+
+	var l model.Leader
+	if code := get(leader, "/leader", &l); code != http.StatusOK || l.ID != leader.ID {
+		t.Errorf("expected the leader to be %s, got %d %+v", leader.ID, code, l)
+	}
+	var e model.Error
+	if code := get(follower, "/leader", &e); code != http.StatusServiceUnavailable || e.Code != model.CodeNotLeader || e.LeaderID != leader.ID {
+		t.Errorf("expected a not_leader error naming %s, got %d %+v", leader.ID, code, e)
+	}
+
+	// A node restoring a snapshot is not ready until the restore completes
+	reader, writer := io.Pipe()
+	restored := make(chan error, 1)
+	go func() { restored <- follower.Store.Restore(reader) }()
+	var readiness model.Readiness
+	code := 0
+	for deadline := time.Now().Add(testcluster.DefaultTimeout); !readiness.Restoring && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		code = get(follower, "/readyz", &readiness)
+	}
+	if code != http.StatusServiceUnavailable || len(readiness.Reasons) != 1 || readiness.Reasons[0] != "restoring a snapshot" {
+		t.Errorf("expected a restoring node not to be ready, got %d %+v", code, readiness)
+	}
+	writer.CloseWithError(io.ErrUnexpectedEOF)
+	<-restored
+	if code := get(follower, "/readyz", &readiness); code != http.StatusOK || readiness.Restoring {
+		t.Errorf("expected the node to be ready once the restore failed, got %d %+v", code, readiness)
+	}
+
+	// A node without a cluster has no leader
+	lone := testcluster.New[model.Payload](t, 1, testcluster.WithoutBootstrap()).Node(0)
+	readiness = model.Readiness{}
+	if code := get(lone, "/readyz", &readiness); code != http.StatusServiceUnavailable || readiness.Ready || readiness.Reasons[0] != "no known leader" {
+		t.Errorf("expected a node without a leader not to be ready, got %d %+v", code, readiness)
+	}
+	var health model.Health
+	if code := get(lone, "/healthz", &health); code != http.StatusOK {
+		t.Errorf("expected a node without a leader to be live, got %d", code)
+	}
+}
+
+// TestServerMetrics checks that the metrics of the store and the requests served are exported
+func TestServerMetrics(t *testing.T) {
+	t.Parallel()
+	_, server := setup(t)
+	handler := server.Handler()
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/send?queue=metrics", strings.NewReader(`{"data": "hello"}`)))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	body := rr.Body.String()
+	for _, metric := range []string{
+		`raftmq_queue_depth{queue="metrics"} 2`,
+		`raftmq_messages_enqueued_total{queue="metrics"} 2`,
+		`raftmq_http_requests_total{code="201",route="/send"} 2`,
+		`raftmq_apply_duration_seconds_count{operation="send"} 2`,
+		`raftmq_raft_state{state="leader"} 1`,
+		`raftmq_state_hash_diverged 0`,
+	} {
+		if !strings.Contains(body, metric+"\n") {
+			t.Errorf("expected the metrics to contain %s", metric)
+		}
+	}
+}
+
+// TestServerTracing checks that a message carries the trace of its send through raft to the receiver
+// The tracer provider is global, so this test is not run in parallel with the others
+func TestServerTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	_, server := setup(t)
+	handler := server.Handler()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/send?queue=traced", strings.NewReader(`{"data": "hello"}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/recieve?queue=traced", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if traceparent := rr.Header().Get("traceparent"); !strings.Contains(traceparent, traceID) {
+		t.Errorf("expected the producer's trace context in the response, got %q", traceparent)
+	}
+
+	// The spans of the send end before those of the recieve, which share their names
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if _, ok := spans[span.Name()]; !ok {
+			spans[span.Name()] = span
+		}
+	}
+
+	// Every span of the send is in the caller's trace, down to the fsm applying the message
+	send, apply := spans["store.Send"], spans["fsm.Apply"]
+	if send == nil || apply == nil || spans["/send"] == nil {
+		t.Fatalf("expected spans for the request, send and fsm apply, got %v", recorder.Ended())
+	}
+	for _, name := range []string{"/send", "store.Send", "raft.Apply", "fsm.Apply"} {
+		if span := spans[name]; span == nil || span.SpanContext().TraceID().String() != traceID {
+			t.Errorf("expected %s to be in trace %s", name, traceID)
+		}
+	}
+
+	if raftApply := spans["raft.Apply"]; raftApply != nil && apply.Parent().SpanID() != raftApply.SpanContext().SpanID() {
+		t.Errorf("expected the fsm apply to be a child of the raft apply")
+	}
+
+	// The receive is its own trace, linked to the span that sent the message
+	recieve := spans["store.Recieve"]
+	if recieve == nil {
+		t.Fatal("expected a span for the recieve")
+	}
+	if links := recieve.Links(); len(links) != 1 || links[0].SpanContext.SpanID() != send.SpanContext().SpanID() {
+		t.Errorf("expected the recieve to link to the send, got %v", links)
+	}
 }
 
 func TestServer(t *testing.T) {
@@ -68,13 +294,15 @@ func TestServer(t *testing.T) {
 		t.Fatalf("expected node1 to be leader, got: %v", err)
 	}
 
+	server.RegisterModel("comments", TypedModel[model.Comment]())
+
 	t.Run("Initialize", func(t *testing.T) {
 		// Create a context with a cancel function
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel() // Ensure cancel is called to clean up resources
 
 		// Initialize the server
-		shutdownServerComplete := server.Initialize(ctx, &Config{Address: ":8080"})
+		shutdownServerComplete := server.Initialize(ctx, &Config{Address: "localhost:0"})
 
 		// Register a cleanup function to shut down the server
 		t.Cleanup(func() {
@@ -127,6 +355,92 @@ func TestServer(t *testing.T) {
 		}
 	})
 
+	t.Run("HandleSend (idempotency key)", func(t *testing.T) {
+		for i, replayed := range []string{"", "true"} {
+			req := httptest.NewRequest(http.MethodPost, "/send?queue=idempotent", strings.NewReader(`{"n":`+strconv.Itoa(i)+`}`))
+			req.Header.Set(idempotencyKeyHeader, "key")
+			rr := httptest.NewRecorder()
+			server.handleSend(rr, req)
+
+			if rr.Code != http.StatusCreated || rr.Header().Get(replayedHeader) != replayed {
+				t.Errorf("expected status %d replayed %q, got %d replayed %q", http.StatusCreated, replayed, rr.Code, rr.Header().Get(replayedHeader))
+			}
+		}
+
+		for _, expected := range []string{`{"Data":{"n":0}}`, `{"Data":{},"Empty":true}`} {
+			rr := httptest.NewRecorder()
+			server.handleRecieve(rr, httptest.NewRequest(http.MethodGet, "/recieve?queue=idempotent", nil))
+			if body := strings.TrimSpace(rr.Body.String()); body != expected {
+				t.Errorf("expected %s, got %s", expected, body)
+			}
+		}
+	})
+
+	t.Run("HandleCluster", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		server.handleCluster(rr, httptest.NewRequest(http.MethodGet, "/cluster", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+
+		var cluster model.Cluster
+		if err := json.NewDecoder(rr.Body).Decode(&cluster); err != nil {
+			t.Fatal(err)
+		}
+		if len(cluster.Nodes) != 1 || !cluster.Nodes[0].Leader || !cluster.Nodes[0].Voter || cluster.LeaderID != cluster.Nodes[0].ID {
+			t.Errorf("expected a single voting leader, got %+v", cluster)
+		}
+	})
+
+	t.Run("HandleBootstrap", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		server.handleBootstrap(rr, httptest.NewRequest(http.MethodGet, "/bootstrap", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+
+		var status model.BootstrapStatus
+		if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		if status.ID == "" || status.RaftAddress == "" || !status.Bootstrapped {
+			t.Errorf("expected a bootstrapped node, got %+v", status)
+		}
+	})
+
+	t.Run("HandleBackup", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		server.handleBackup(rr, httptest.NewRequest(http.MethodGet, "/admin/backup", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		if rr.Header().Get(backupIndexHeader) == "0" || rr.Header().Get("Content-Length") != strconv.Itoa(rr.Body.Len()) {
+			t.Errorf("expected the index and length of the backup, got %v", rr.Header())
+		}
+		backup := rr.Body.Bytes()
+
+		rr = httptest.NewRecorder()
+		server.handleRestore(rr, httptest.NewRequest(http.MethodPost, "/admin/restore", bytes.NewReader(backup)))
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusNoContent, rr.Body)
+		}
+
+		// A backup larger than the limit is rejected before it is spooled to disk
+		server.SetMaxRestoreSize(int64(len(backup) - 1))
+		rr = httptest.NewRecorder()
+		server.handleRestore(rr, httptest.NewRequest(http.MethodPost, "/admin/restore", bytes.NewReader(backup)))
+		server.SetMaxRestoreSize(DefaultMaxRestoreSize)
+		if rr.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rr.Body.String(), string(model.CodeTooLarge)) {
+			t.Errorf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusRequestEntityTooLarge, rr.Body)
+		}
+
+		rr = httptest.NewRecorder()
+		server.handleRestore(rr, httptest.NewRequest(http.MethodGet, "/admin/restore", nil))
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
+		}
+	})
+
 	t.Run("HandleStats", func(t *testing.T) {
 		// Create a new HTTP request
 		req, err := http.NewRequest(http.MethodGet, "/stats", nil)
@@ -157,6 +471,331 @@ func TestServer(t *testing.T) {
 		}
 	})
 
+	t.Run("HandleStreamAppend", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			req, err := http.NewRequest(http.MethodPost, "/stream/append?stream=comments", strings.NewReader(`{"author": "Alice", "content": "test"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(server.handleStreamAppend)
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != http.StatusCreated {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+			}
+		}
+	})
+
+	t.Run("HandleStreamCommit", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/stream/commit?stream=comments", strings.NewReader(`{"group": "workers", "offset": 1}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.handleStreamCommit)
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusNoContent {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+		}
+	})
+
+	t.Run("HandleStreamRead", func(t *testing.T) {
+		tests := []struct {
+			query   string
+			entries int
+			next    uint64
+		}{
+			{"stream=comments", 2, 2},
+			{"stream=comments&offset=1", 1, 2},
+			{"stream=comments&group=workers", 1, 2},
+			{"stream=comments&max=1", 1, 1},
+			{"stream=comments&timestamp=2000-01-01T00:00:00Z", 2, 2},
+			{"stream=unknown", 0, 0},
+		}
+
+		for _, tt := range tests {
+			req, err := http.NewRequest(http.MethodGet, "/stream/read?"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(server.handleStreamRead)
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Fatalf("%s: handler returned wrong status code: got %v want %v", tt.query, status, http.StatusOK)
+			}
+
+			var body struct {
+				Entries []json.RawMessage
+				Next    uint64
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			if len(body.Entries) != tt.entries || body.Next != tt.next {
+				t.Errorf("%s: got %d entries, next %d; want %d, %d", tt.query, len(body.Entries), body.Next, tt.entries, tt.next)
+			}
+		}
+	})
+
+	t.Run("HandleStreamRetention", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/stream/retention?stream=comments", strings.NewReader(`{"maxEntries": 10, "maxAge": "24h"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.handleStreamRetention)
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusNoContent {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+		}
+	})
+	t.Run("HandleSend (typed)", func(t *testing.T) {
+		tests := []struct {
+			body   string
+			status int
+		}{
+			{`{"author": "Alice", "content": "test"}`, http.StatusCreated},
+			{`{"author": "Alice", "unknown": "field"}`, http.StatusBadRequest},
+			{`not json`, http.StatusBadRequest},
+		}
+
+		for _, tt := range tests {
+			req, err := http.NewRequest(http.MethodPost, "/send?queue=comments", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(server.handleSend)
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.status {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v", tt.body, status, tt.status)
+			}
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "/recieve?queue=comments", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.handleRecieve)
+		handler.ServeHTTP(rr, req)
+
+		var body struct {
+			Data model.Comment
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if body.Data.Author != "Alice" || body.Data.Content != "test" {
+			t.Errorf("expected comment from Alice, got: %v", body.Data)
+		}
+	})
+
+	t.Run("HandleSend (opaque)", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/send?queue=raw", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "text/plain")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.handleSend)
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusCreated {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+		}
+
+		req, err = http.NewRequest(http.MethodGet, "/recieve?queue=raw", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr = httptest.NewRecorder()
+		handler = http.HandlerFunc(server.handleRecieve)
+		handler.ServeHTTP(rr, req)
+
+		if contentType := rr.Header().Get("Content-Type"); contentType != "text/plain" {
+			t.Errorf("expected text/plain, got: %s", contentType)
+		}
+		if body := rr.Body.String(); body != "hello" {
+			t.Errorf("expected hello, got: %s", body)
+		}
+	})
+
+	t.Run("HandleSchema", func(t *testing.T) {
+		serve := func(method, target, body string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest(method, target, strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			mux := http.NewServeMux()
+			mux.HandleFunc("/schema", server.handleSchema)
+			mux.HandleFunc("/schema/compatibility", server.handleSchemaCompatibility)
+			mux.HandleFunc("/send", server.handleSend)
+			mux.ServeHTTP(rr, req)
+
+			return rr
+		}
+
+		tests := []struct {
+			name   string
+			method string
+			target string
+			body   string
+			status int
+		}{
+			{"register", http.MethodPut, "/schema?queue=validated", `{"type": "object", "properties": {"author": {"type": "string"}}, "required": ["author"]}`, http.StatusCreated},
+			{"register invalid schema", http.MethodPut, "/schema?queue=validated", `{"type": "unknown"}`, http.StatusBadRequest},
+			{"register oversized", http.MethodPut, "/schema?queue=oversized", `{"type": "object"}` + strings.Repeat(" ", maxPayloadSize), http.StatusBadRequest},
+			{"register unknown compatibility", http.MethodPut, "/schema?queue=validated&compatibility=sideways", `{}`, http.StatusBadRequest},
+			{"register incompatible", http.MethodPut, "/schema?queue=validated", `{"type": "object", "required": ["author", "content"]}`, http.StatusConflict},
+			{"register other compatibility", http.MethodPut, "/schema?queue=validated&compatibility=none", `{"type": "object", "required": ["author", "content"]}`, http.StatusConflict},
+			{"set compatibility", http.MethodPut, "/schema/compatibility?queue=validated&compatibility=full", ``, http.StatusNoContent},
+			{"set missing compatibility", http.MethodPut, "/schema/compatibility?queue=validated", ``, http.StatusBadRequest},
+			{"set compatibility without schema", http.MethodPut, "/schema/compatibility?queue=missing&compatibility=none", ``, http.StatusNotFound},
+			{"set compatibility method", http.MethodGet, "/schema/compatibility?queue=validated&compatibility=none", ``, http.StatusMethodNotAllowed},
+			{"register matching compatibility", http.MethodPut, "/schema?queue=validated&compatibility=full", `{"type": "object", "properties": {"author": {"type": "string"}}, "required": ["author"]}`, http.StatusCreated},
+			{"get", http.MethodGet, "/schema?queue=validated", ``, http.StatusOK},
+			{"send conforming", http.MethodPost, "/send?queue=validated", `{"author": "Alice"}`, http.StatusCreated},
+			{"send non-conforming", http.MethodPost, "/send?queue=validated", `{"author": 1}`, http.StatusBadRequest},
+			{"delete", http.MethodDelete, "/schema?queue=validated", ``, http.StatusNoContent},
+			{"get deleted", http.MethodGet, "/schema?queue=validated", ``, http.StatusNotFound},
+			{"send without schema", http.MethodPost, "/send?queue=validated", `{"author": 1}`, http.StatusCreated},
+		}
+
+		for _, tt := range tests {
+			if rr := serve(tt.method, tt.target, tt.body); rr.Code != tt.status {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v (%s)", tt.name, rr.Code, tt.status, rr.Body)
+			}
+		}
+
+		if _, err := server.store.RegisterSchema("validated", []byte(`{"type": "object", "required": ["author"]}`), "none"); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		// The response lists every validation error
+		rr := serve(http.MethodPost, "/send?queue=validated", `{"content": 1}`)
+		var failure struct {
+			Version int
+			Errors  []struct {
+				Path    string
+				Message string
+			}
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&failure); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if failure.Version != 1 || len(failure.Errors) != 1 || failure.Errors[0].Path != "/" {
+			t.Errorf("expected a missing author error against version 1, got: %+v", failure)
+		}
+	})
+
+	t.Run("HandleQueue", func(t *testing.T) {
+		for _, test := range []struct {
+			method   string
+			queue    string
+			expected int
+		}{
+			{http.MethodPut, "admin", http.StatusCreated},
+			{http.MethodPut, "admin", http.StatusOK},
+			{http.MethodDelete, "admin", http.StatusNoContent},
+			{http.MethodDelete, "admin", http.StatusNotFound},
+			{http.MethodDelete, defaultQueue, http.StatusBadRequest},
+			{http.MethodPost, "admin", http.StatusMethodNotAllowed},
+		} {
+			rr := httptest.NewRecorder()
+			server.handleQueue(rr, httptest.NewRequest(test.method, "/queue?queue="+test.queue, nil))
+			if rr.Code != test.expected {
+				t.Errorf("%s %s returned wrong status code: got %v want %v", test.method, test.queue, rr.Code, test.expected)
+			}
+		}
+	})
+
+	t.Run("HandlePeek", func(t *testing.T) {
+		for _, body := range []string{`{"n":1}`, `{"n":2}`} {
+			rr := httptest.NewRecorder()
+			server.handleSend(rr, httptest.NewRequest(http.MethodPost, "/send?queue=peek", strings.NewReader(body)))
+		}
+
+		for query, expected := range map[string]string{
+			"?queue=peek&max=1": `{"Messages":[{"ContentType":"application/json","Data":{"n":1}}]}`,
+			"?queue=peek":       `{"Messages":[{"ContentType":"application/json","Data":{"n":1}},{"ContentType":"application/json","Data":{"n":2}}]}`,
+		} {
+			rr := httptest.NewRecorder()
+			server.handlePeek(rr, httptest.NewRequest(http.MethodGet, "/peek"+query, nil))
+			if body := strings.TrimSpace(rr.Body.String()); rr.Code != http.StatusOK || body != expected {
+				t.Errorf("expected %s, got %d %s", expected, rr.Code, body)
+			}
+		}
+
+		rr := httptest.NewRecorder()
+		server.handlePeek(rr, httptest.NewRequest(http.MethodGet, "/peek?queue=peek&max=0", nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("HandleQueues", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		server.handleQueues(rr, httptest.NewRequest(http.MethodGet, "/queues", nil))
+
+		var body struct {
+			Queues []model.QueueInfo `json:"queues"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, queue := range body.Queues {
+			found = found || queue == model.QueueInfo{Name: "peek", Depth: 2}
+		}
+		if rr.Code != http.StatusOK || !found {
+			t.Errorf("expected the peek queue with 2 messages, got %d %+v", rr.Code, body.Queues)
+		}
+	})
+
+	t.Run("HandleQueuePurge", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		server.handleQueuePurge(rr, httptest.NewRequest(http.MethodPost, "/queue/purge?queue=peek", nil))
+		if body := strings.TrimSpace(rr.Body.String()); rr.Code != http.StatusOK || body != `{"purged":2}` {
+			t.Errorf("expected 2 messages purged, got %d %s", rr.Code, body)
+		}
+	})
+
+	t.Run("HandleClusterRemove", func(t *testing.T) {
+		for body, expected := range map[string]int{`{}`: http.StatusBadRequest, `{"id": "missing"}`: http.StatusNotFound} {
+			rr := httptest.NewRecorder()
+			server.handleClusterRemove(rr, httptest.NewRequest(http.MethodPost, "/cluster/remove", strings.NewReader(body)))
+			if rr.Code != expected {
+				t.Errorf("%s returned wrong status code: got %v want %v", body, rr.Code, expected)
+			}
+		}
+	})
+
+	t.Run("HandleClusterTransfer", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		server.handleClusterTransfer(rr, httptest.NewRequest(http.MethodPost, "/cluster/transfer", strings.NewReader(`{"id": "missing"}`)))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+		}
+	})
+
 	t.Run("HandleJoin", func(t *testing.T) {
 		// Create a new HTTP request
 		req, err := http.NewRequest(http.MethodPost, "/join", strings.NewReader(`{"address": "localhost:8001", "id": "node2"}`))
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+)
+
+// QueueInfo is the name of a queue along with the number of messages in it
+type QueueInfo struct {
+	Name  string
+	Depth int
+}
+
+// Queues is used to list the queues along with their depth, sorted by name
+func (s *Store[T]) Queues() ([]QueueInfo, error) {
+	if s.consensus.Node.State() != raft.Leader {
+		return nil, ErrNotLeader
+	}
+
+	var queues []QueueInfo
+	for _, name := range s.queues.names() {
+		if depth, ok := s.queues.len(name); ok {
+			queues = append(queues, QueueInfo{Name: name, Depth: depth})
+		}
+	}
+	return queues, nil
+}
+
+// Peek is used to get up to max messages from the front of the named queue without removing them
+func (s *Store[T]) Peek(queue string, max int) ([]ds.Message[T], error) {
+	if s.consensus.Node.State() != raft.Leader {
+		return nil, ErrNotLeader
+	}
+
+	messages, ok, err := s.queues.peek(queueName(queue), max)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrQueueNotFound
+	}
+	return messages, nil
+}
+
+// CreateQueue is used to create an empty queue, it reports whether the queue did not already exist
+func (s *Store[T]) CreateQueue(queue string) (bool, error) {
+	c := newCommand[T](CreateQueue, ds.Message[T]{})
+	c.Queue = queue
+
+	response, err := s.apply(context.Background(), c)
+	if err != nil {
+		return false, err
+	}
+
+	created, ok := response.(bool)
+	if !ok {
+		return false, fmt.Errorf("unexpected response type: %T", response)
+	}
+	return created, nil
+}
+
+// DeleteQueue is used to delete the named queue along with its messages
+func (s *Store[T]) DeleteQueue(queue string) error {
+	c := newCommand[T](DeleteQueue, ds.Message[T]{})
+	c.Queue = queue
+
+	_, err := s.apply(context.Background(), c)
+	return err
+}
+
+// PurgeQueue is used to delete every message of the named queue, and returns how many were deleted
+func (s *Store[T]) PurgeQueue(queue string) (int, error) {
+	c := newCommand[T](PurgeQueue, ds.Message[T]{})
+	c.Queue = queue
+
+	response, err := s.apply(context.Background(), c)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, ok := response.(int)
+	if !ok {
+		return 0, fmt.Errorf("unexpected response type: %T", response)
+	}
+	return purged, nil
+}
+
+// Remove is used to remove a node from the raft cluster, along with its registered address
+func (s *Store[T]) Remove(nodeID string) error {
+	s.logger.Info(fmt.Sprintf("received remove request for node %s", nodeID))
+	if s.consensus.Node.State() != raft.Leader {
+		return ErrNotLeader
+	}
+
+	servers, err := s.Servers()
+	if err != nil {
+		return err
+	}
+	if _, ok := findServer(servers, nodeID); !ok {
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+
+	if err := translateError(s.consensus.Remove(nodeID)); err != nil {
+		return err
+	}
+
+	// A leader that removed itself steps down first, its address is then left registered but no longer used
+	if err := s.RegisterMember(nodeID, ""); err != nil {
+		s.logger.Warn("Failed to remove node address", "node", nodeID, "error", err)
+	}
+	return nil
+}
+
+// TransferLeadership is used to hand leadership to the given node, or to the most up to date node if empty
+func (s *Store[T]) TransferLeadership(nodeID string) error {
+	if s.consensus.Node.State() != raft.Leader {
+		return ErrNotLeader
+	}
+
+	var future raft.Future
+	if nodeID == "" {
+		future = s.consensus.Node.LeadershipTransfer()
+	} else {
+		servers, err := s.Servers()
+		if err != nil {
+			return err
+		}
+		server, ok := findServer(servers, nodeID)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+		}
+		future = s.consensus.Node.LeadershipTransferToServer(raft.ServerID(server.ID), raft.ServerAddress(server.RaftAddress))
+	}
+	return translateError(future.Error())
+}
+
+// findServer is used to look up a server of the configuration by node id
+func findServer(servers []Server, nodeID string) (Server, bool) {
+	for _, server := range servers {
+		if server.ID == nodeID {
+			return server, true
+		}
+	}
+	return Server{}, false
+}
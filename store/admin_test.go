@@ -0,0 +1,105 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/model"
+)
+
+// manage is used to get a command that creates, deletes or purges the named queue
+func manage(operation int, queue string) *command[int] {
+	return &command[int]{Operation: operation, Queue: queue}
+}
+
+func TestQueueOperations(t *testing.T) {
+	store := fuzzStore[int]()
+	apply := func(c *command[int]) interface{} {
+		return store.Apply(&raft.Log{Index: 1, Term: 1, Type: raft.LogCommand, Data: mustEncode(t, c)})
+	}
+
+	for _, test := range []struct {
+		command  *command[int]
+		expected interface{}
+	}{
+		{manage(CreateQueue, "empty"), true},
+		{manage(CreateQueue, "empty"), false},
+		{send(1), nil},
+		{send(2), nil},
+		{manage(PurgeQueue, "numbers"), 2},
+		{manage(PurgeQueue, "missing"), ErrQueueNotFound},
+		{manage(CreateQueue, "deleted"), true},
+		{manage(DeleteQueue, "deleted"), nil},
+		{manage(DeleteQueue, "deleted"), ErrQueueNotFound},
+		{manage(DeleteQueue, DefaultQueue), ErrDefaultQueue},
+		{manage(DeleteQueue, ""), ErrDefaultQueue},
+	} {
+		if response := apply(test.command); response != test.expected {
+			t.Errorf("expected %v applying %d to %q, got %v", test.expected, test.command.Operation, test.command.Queue, response)
+		}
+	}
+
+	// Created queues survive a snapshot even when empty, deleted ones are not restored
+	restored := restore[int](t, persist(t, store))
+	for queue, exists := range map[string]bool{"empty": true, "numbers": true, "deleted": false} {
+		if _, ok := restored.queues.len(queue); ok != exists {
+			t.Errorf("expected queue %q to exist %t after a restore, got %t", queue, exists, ok)
+		}
+	}
+}
+
+func TestStoreAdmin(t *testing.T) {
+	store := setup(t)
+	if err := store.WaitForNodeToBeLeader(5 * time.Second); err != nil {
+		t.Fatalf("expected node1 to be leader, got: %v", err)
+	}
+
+	comment := model.Comment{Author: "Alice", Content: "Hello, World!"}
+	if created, err := store.CreateQueue("comments"); err != nil || !created {
+		t.Fatalf("expected the queue to be created, got %v, %v", created, err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := store.Send("comments", comment); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+
+	queues, err := store.Queues()
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	expected := []QueueInfo{{Name: "comments", Depth: 3}, {Name: DefaultQueue, Depth: 0}}
+	if len(queues) != len(expected) || queues[0] != expected[0] || queues[1] != expected[1] {
+		t.Errorf("expected the queues %v, got %v", expected, queues)
+	}
+
+	messages, err := store.Peek("comments", 2)
+	if err != nil || len(messages) != 2 || messages[0].Data != comment {
+		t.Errorf("expected 2 messages, got %v, %v", messages, err)
+	}
+	if _, err := store.Peek("missing", 1); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected queue not found, got: %v", err)
+	}
+
+	if purged, err := store.PurgeQueue("comments"); err != nil || purged != 3 {
+		t.Errorf("expected 3 messages purged, got %d, %v", purged, err)
+	}
+	if err := store.DeleteQueue("comments"); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+	if err := store.DeleteQueue("comments"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected queue not found, got: %v", err)
+	}
+	if err := store.DeleteQueue(DefaultQueue); !errors.Is(err, ErrDefaultQueue) {
+		t.Errorf("expected the default queue not to be deleted, got: %v", err)
+	}
+
+	if err := store.Remove("missing"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("expected node not found, got: %v", err)
+	}
+	if err := store.TransferLeadership("missing"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("expected node not found, got: %v", err)
+	}
+}
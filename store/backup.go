@@ -0,0 +1,114 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+)
+
+// BackupInfo is the position in the raft log a backup was taken at, along with its size
+type BackupInfo struct {
+	// Index and Term are those of the last log entry applied to the backed up state
+	Index uint64
+	Term  uint64
+
+	// Size is the number of bytes of the backup
+	Size int64
+}
+
+// OpenBackup is used to take a snapshot of the store and to open it for reading, in the format written by Persist
+// The snapshot is taken on this node, so a backup taken on a follower may not hold the latest commands
+func (s *Store[T]) OpenBackup() (BackupInfo, io.ReadCloser, error) {
+	meta, rc, err := s.consensus.Backup()
+	if err != nil {
+		return BackupInfo{}, nil, translateError(err)
+	}
+	return BackupInfo{Index: meta.Index, Term: meta.Term, Size: meta.Size}, rc, nil
+}
+
+// RestoreBackup is used to replace the state of the cluster with a backup taken by OpenBackup
+// It must be called on the leader, and is meant to seed a new cluster: every queue, stream and schema is replaced,
+// while the servers of the cluster along with their addresses are kept
+func (s *Store[T]) RestoreBackup(r io.Reader) error {
+	if !s.IsLeader() {
+		return ErrNotLeader
+	}
+
+	// Raft needs the size of the snapshot up front, and the backup is checked before raft keeps it
+	// The backup is spooled into the data directory of the node, which is sized for its snapshots
+	file, err := os.CreateTemp(s.dir, "restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	size, err := io.Copy(file, r)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, _, err := readSnapshotInto(file, discardLoader[T]{}, s.upgrader); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	servers, err := s.Servers()
+	if err != nil {
+		return err
+	}
+	if err := s.consensus.Restore(file, size, 0); err != nil {
+		return translateError(err)
+	}
+
+	s.logger.Info("Restored backup", "size", size)
+	return s.restoreMembers(servers)
+}
+
+// restoreMembers is used to register the addresses the servers had before a restore, and to
+// remove those of the servers of the backed up cluster that are not part of this one
+func (s *Store[T]) restoreMembers(servers []Server) error {
+	registered := map[string]bool{}
+	for _, server := range servers {
+		registered[server.ID] = true
+		if server.Address == "" {
+			continue
+		}
+		if err := s.RegisterMember(server.ID, server.Address); err != nil {
+			return err
+		}
+	}
+
+	s.lock.RLock()
+	var stale []string
+	for id := range s.members {
+		if !registered[id] {
+			stale = append(stale, id)
+		}
+	}
+	s.lock.RUnlock()
+
+	for _, id := range stale {
+		if err := s.RegisterMember(id, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discardLoader is a queue loader that drops the queues, it is used to check a snapshot can be read
+type discardLoader[T any] struct{}
+
+func (discardLoader[T]) create(name string) error {
+	return nil
+}
+
+func (discardLoader[T]) enqueue(name string, message ds.Message[T]) error {
+	return nil
+}
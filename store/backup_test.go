@@ -0,0 +1,128 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/model"
+	"github.com/kavinaravind/go-raft-message-queue/schema"
+)
+
+// backup is used to take a backup of the store and to read it in full
+func backup(t *testing.T, store *Store[model.Comment]) (BackupInfo, []byte) {
+	t.Helper()
+
+	info, rc, err := store.OpenBackup()
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info, data
+}
+
+func TestBackup(t *testing.T) {
+	source, target := setup(t), setup(t)
+	for _, store := range []*Store[model.Comment]{source, target} {
+		if err := store.WaitForNodeToBeLeader(5 * time.Second); err != nil {
+			t.Fatalf("expected node1 to be leader, got: %v", err)
+		}
+	}
+
+	comments := []model.Comment{{Author: "Alice", Content: "first"}, {Author: "Bob", Content: "second"}}
+	for _, comment := range comments {
+		if err := source.Send("comments", comment); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	if _, err := source.Append("events", comments[0]); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := source.RegisterSchema("comments", []byte(`{"type": "object"}`), schema.None); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := source.RegisterMember("node1", "localhost:3000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.RegisterMember("node9", "localhost:3090"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, data := backup(t, source)
+	if info.Index == 0 || info.Size != int64(len(data)) {
+		t.Errorf("expected the index and size of the backup, got %+v for %d bytes", info, len(data))
+	}
+
+	// Nothing was applied since, so the same snapshot is backed up again
+	if again, _ := backup(t, source); again != info {
+		t.Errorf("expected the backup %+v, got %+v", info, again)
+	}
+
+	t.Run("Restore", func(t *testing.T) {
+		if err := target.RegisterMember("node1", "localhost:4000"); err != nil {
+			t.Fatal(err)
+		}
+		if err := target.Send("discarded", comments[0]); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := target.RestoreBackup(bytes.NewReader(data)); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		queues, err := target.Queues()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []QueueInfo{{Name: "comments", Depth: 2}, {Name: DefaultQueue, Depth: 0}}
+		if len(queues) != len(expected) || queues[0] != expected[0] || queues[1] != expected[1] {
+			t.Errorf("expected the queues %v, got %v", expected, queues)
+		}
+
+		messages, err := target.Peek("comments", 10)
+		if err != nil || len(messages) != 2 || messages[0].Data != comments[0] || messages[1].Data != comments[1] {
+			t.Errorf("expected the backed up messages, got %v, %v", messages, err)
+		}
+		if entries, err := target.Read("events", 0, 10); err != nil || len(entries) != 1 {
+			t.Errorf("expected the backed up stream, got %v, %v", entries, err)
+		}
+		if _, version, ok := target.Schema("comments"); !ok || version.Version != 1 {
+			t.Errorf("expected the backed up schema, got version %d, %v", version.Version, ok)
+		}
+
+		// The servers of the cluster keep their own addresses
+		target.lock.RLock()
+		members := maps.Clone(target.members)
+		target.lock.RUnlock()
+		if expected := map[string]string{"node1": "localhost:4000"}; !maps.Equal(members, expected) {
+			t.Errorf("expected the members %v, got %v", expected, members)
+		}
+
+		// The restored store takes new commands and can be backed up in turn
+		if err := target.Send("comments", comments[0]); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if _, data := backup(t, target); len(data) == 0 {
+			t.Error("expected a backup of the restored store")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, data := range [][]byte{nil, []byte("not a snapshot"), data[:len(data)/2]} {
+			if err := target.RestoreBackup(bytes.NewReader(data)); !errors.Is(err, ErrInvalidBackup) {
+				t.Errorf("expected an invalid backup, got: %v", err)
+			}
+		}
+		if depth, _ := target.queueLen("comments"); depth != 3 {
+			t.Errorf("expected the store to be unchanged, got %d messages", depth)
+		}
+	})
+}
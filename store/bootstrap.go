@@ -0,0 +1,66 @@
+package store
+
+import (
+	"slices"
+
+	"github.com/hashicorp/raft"
+)
+
+// BootstrapStatus is the state of this node while the cluster is formed from its expected servers
+type BootstrapStatus struct {
+	// Self is this node, with the HTTP address it advertises
+	Self Server
+
+	// Bootstrapped is whether the node already has a raft configuration
+	Bootstrapped bool
+
+	// Candidates are the ids of the servers this node would bootstrap the cluster with, sorted
+	Candidates []string
+}
+
+// BootstrapStatus is used to get the state of this node while the cluster is formed
+func (s *Store[T]) BootstrapStatus() (BootstrapStatus, error) {
+	future := s.consensus.Node.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return BootstrapStatus{}, translateError(err)
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return BootstrapStatus{
+		Self: Server{
+			Member:      Member{ID: s.consensus.ID(), Address: s.advertiseAddress},
+			RaftAddress: s.consensus.Address(),
+			Voter:       true,
+		},
+		Bootstrapped: len(future.Configuration().Servers) > 0,
+		Candidates:   slices.Clone(s.bootstrapCandidates),
+	}, nil
+}
+
+// SetBootstrapCandidates is used to publish the ids of the servers this node would bootstrap the cluster with
+// Nodes only bootstrap once every candidate publishes the same ids, so they agree on the configuration
+func (s *Store[T]) SetBootstrapCandidates(ids []string) {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.bootstrapCandidates = ids
+}
+
+// Bootstrap is used to bootstrap a new cluster with the given servers as voters
+// It does nothing if the node already has a raft configuration
+func (s *Store[T]) Bootstrap(servers []Server) error {
+	configuration := make([]raft.Server, 0, len(servers))
+	for _, server := range servers {
+		configuration = append(configuration, raft.Server{
+			Suffrage: raft.Voter,
+			ID:       raft.ServerID(server.ID),
+			Address:  raft.ServerAddress(server.RaftAddress),
+		})
+	}
+	return translateError(s.consensus.Bootstrap(configuration))
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/go-msgpack/v2/codec"
+)
+
+// Encoding is the format used to write commands to the raft log
+type Encoding byte
+
+const (
+	// EncodingJSON is the format of entries written before the binary encoding existed
+	// A JSON entry always starts with '{', so it can not be mistaken for a typed entry
+	EncodingJSON Encoding = '{'
+
+	// EncodingMsgpack is a length-prefixed msgpack encoding of the command
+	EncodingMsgpack Encoding = 0x01
+)
+
+// commandVersion is the version of the command layout written after the encoding header
+const commandVersion byte = 1
+
+// msgpackHandle is the handle used to encode and decode msgpack commands, snapshot records and stored messages
+// Map keys, such as message headers, are sorted so that the same value always encodes to the same bytes,
+// and replicas holding the same state write the same snapshot
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	h.Canonical = true
+	return h
+}()
+
+// encoders and decoders are reused across commands, as creating them dominates the cost of small entries
+var (
+	encoders = sync.Pool{New: func() any { return &msgpackEncoder{enc: codec.NewEncoderBytes(nil, msgpackHandle)} }}
+	decoders = sync.Pool{New: func() any { return codec.NewDecoderBytes(nil, msgpackHandle) }}
+)
+
+// msgpackEncoder is a pooled encoder along with the buffer it encodes into
+type msgpackEncoder struct {
+	enc *codec.Encoder
+	buf []byte
+}
+
+// ParseEncoding is used to parse the name of an encoding
+func ParseEncoding(name string) (Encoding, error) {
+	switch name {
+	case "json":
+		return EncodingJSON, nil
+	case "msgpack":
+		return EncodingMsgpack, nil
+	default:
+		return 0, fmt.Errorf("unknown encoding %q", name)
+	}
+}
+
+// String is used to get the name of the encoding
+func (e Encoding) String() string {
+	switch e {
+	case EncodingJSON:
+		return "json"
+	case EncodingMsgpack:
+		return "msgpack"
+	default:
+		return fmt.Sprintf("unknown(%#x)", byte(e))
+	}
+}
+
+// encodeCommand is used to encode a command for the raft log with the given encoding
+// Binary entries are laid out as [encoding][version][uvarint length][body]
+func encodeCommand[T any](c *command[T], encoding Encoding) ([]byte, error) {
+	switch encoding {
+	case EncodingJSON:
+		return json.Marshal(c)
+	case EncodingMsgpack:
+		e := encoders.Get().(*msgpackEncoder)
+		defer encoders.Put(e)
+
+		e.buf = e.buf[:0]
+		e.enc.ResetBytes(&e.buf)
+		if err := e.enc.Encode(c); err != nil {
+			return nil, err
+		}
+		body := e.buf
+
+		data := make([]byte, 2, 2+binary.MaxVarintLen64+len(body))
+		data[0] = byte(EncodingMsgpack)
+		data[1] = commandVersion
+		data = binary.AppendUvarint(data, uint64(len(body)))
+		return append(data, body...), nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %v", encoding)
+	}
+}
+
+// decodeCommand is used to decode a command from the raft log in any known encoding
+// The message of a JSON command written by an earlier release is converted by the upgrader, if any
+func decodeCommand[T any](data []byte, upgrader *LegacyUpgrader[T]) (*command[T], error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	var c command[T]
+	switch Encoding(data[0]) {
+	case EncodingJSON:
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, err
+		}
+		if err := upgrader.upgradeCommand(data, &c); err != nil {
+			return nil, err
+		}
+	case EncodingMsgpack:
+		if len(data) < 2 {
+			return nil, errors.New("truncated command header")
+		}
+		if version := data[1]; version != commandVersion {
+			return nil, fmt.Errorf("unsupported command version %d", version)
+		}
+
+		length, n := binary.Uvarint(data[2:])
+		if n <= 0 {
+			return nil, errors.New("invalid command length")
+		}
+		body := data[2+n:]
+		if uint64(len(body)) != length {
+			return nil, fmt.Errorf("command length %d does not match body length %d", length, len(body))
+		}
+
+		dec := decoders.Get().(*codec.Decoder)
+		defer decoders.Put(dec)
+
+		dec.ResetBytes(body)
+		if err := dec.Decode(&c); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown command encoding %#x", data[0])
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,179 @@
+package store
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+	"github.com/kavinaravind/go-raft-message-queue/model"
+)
+
+func testCommand() *command[model.Payload] {
+	c := newCommand[model.Payload](Send, ds.Message[model.Payload]{
+		Data: model.NewPayload("application/json", []byte(`{"author":"Alice","content":"Hello, World!"}`)),
+	})
+	c.Queue = "comments"
+	return c
+}
+
+func TestParseEncoding(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingMsgpack} {
+		parsed, err := ParseEncoding(encoding.String())
+		if err != nil || parsed != encoding {
+			t.Errorf("ParseEncoding(%s) = %v, %v", encoding, parsed, err)
+		}
+	}
+	if _, err := ParseEncoding("xml"); err == nil {
+		t.Error("expected error for unknown encoding")
+	}
+}
+
+func TestEncodeCommand(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingMsgpack} {
+		t.Run(encoding.String(), func(t *testing.T) {
+			c := testCommand()
+
+			data, err := encodeCommand(c, encoding)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if Encoding(data[0]) != encoding {
+				t.Errorf("expected header %#x, got %#x", byte(encoding), data[0])
+			}
+
+			decoded, err := decodeCommand[model.Payload](data, nil)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if !decoded.Timestamp.Equal(c.Timestamp) {
+				t.Errorf("expected timestamp %v, got %v", c.Timestamp, decoded.Timestamp)
+			}
+			decoded.Timestamp = c.Timestamp
+			if !reflect.DeepEqual(decoded, c) {
+				t.Errorf("expected %+v, got %+v", c, decoded)
+			}
+		})
+	}
+}
+
+func TestEncodeCommandTypes(t *testing.T) {
+	timestamp := time.Date(2022, 5, 15, 17, 19, 9, 0, time.UTC)
+	c := newCommand[model.Comment](Append, ds.Message[model.Comment]{
+		Data: model.Comment{Timestamp: &timestamp, Author: "Alice"},
+	})
+	c.Stream = "comments"
+	c.Retention = ds.Retention{MaxEntries: 10, MaxAge: time.Hour}
+
+	data, err := encodeCommand(c, EncodingMsgpack)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	decoded, err := decodeCommand[model.Comment](data, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !decoded.Message.Data.Timestamp.Equal(timestamp) || decoded.Message.Data.Author != "Alice" {
+		t.Errorf("expected comment to round trip, got %+v", decoded.Message.Data)
+	}
+	if decoded.Stream != "comments" || decoded.Retention != c.Retention {
+		t.Errorf("expected stream fields to round trip, got %+v", decoded)
+	}
+}
+
+func TestDecodeLegacyCommand(t *testing.T) {
+	// An entry written by a version that only had the default queue and JSON commands
+	data := []byte(`{"operation":0,"message":{"Data":{"author":"Alice","content":"Hello, World!"}}}`)
+
+	decoded, err := decodeCommand[model.Comment](data, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if decoded.Operation != Send || decoded.Queue != "" || decoded.Message.Data.Author != "Alice" {
+		t.Errorf("expected legacy send command, got %+v", decoded)
+	}
+}
+
+func TestDecodeInvalidCommand(t *testing.T) {
+	valid, err := encodeCommand(testCommand(), EncodingMsgpack)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	unsupported := append([]byte{}, valid...)
+	unsupported[1] = commandVersion + 1
+
+	tests := map[string][]byte{
+		"empty":         {},
+		"unknown":       {0x7f, 0x00},
+		"truncated":     {byte(EncodingMsgpack)},
+		"no length":     {byte(EncodingMsgpack), commandVersion},
+		"short body":    valid[:len(valid)-1],
+		"long body":     append(append([]byte{}, valid...), 0x00),
+		"version":       unsupported,
+		"invalid json":  []byte(`{"operation":`),
+		"corrupt body":  {byte(EncodingMsgpack), commandVersion, 0x01, 0xc1},
+		"huge length":   {byte(EncodingMsgpack), commandVersion, 0xff, 0xff, 0xff, 0xff, 0x0f},
+		"varint length": {byte(EncodingMsgpack), commandVersion, 0xff},
+	}
+
+	for name, data := range tests {
+		if _, err := decodeCommand[model.Payload](data, nil); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// benchmarkCommands are the commands used to compare encodings, from a small comment to a 4KiB binary payload
+func benchmarkCommands() map[string]*command[model.Payload] {
+	large := newCommand[model.Payload](Send, ds.Message[model.Payload]{
+		Data: model.NewPayload("application/octet-stream", bytes.Repeat([]byte{0xab}, 4096)),
+	})
+	large.Queue = "comments"
+
+	return map[string]*command[model.Payload]{
+		"small": testCommand(),
+		"4KiB":  large,
+	}
+}
+
+func BenchmarkEncodeCommand(b *testing.B) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingMsgpack} {
+		for size, c := range benchmarkCommands() {
+			b.Run(encoding.String()+"/"+size, func(b *testing.B) {
+				var data []byte
+				var err error
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if data, err = encodeCommand(c, encoding); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(data)), "bytes/entry")
+			})
+		}
+	}
+}
+
+func BenchmarkDecodeCommand(b *testing.B) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingMsgpack} {
+		for size, c := range benchmarkCommands() {
+			b.Run(encoding.String()+"/"+size, func(b *testing.B) {
+				data, err := encodeCommand(c, encoding)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := decodeCommand[model.Payload](data, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(data)), "bytes/entry")
+			})
+		}
+	}
+}
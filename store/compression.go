@@ -0,0 +1,146 @@
+package store
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the algorithm used to compress the records of a snapshot
+// It is stored in the low bits of the snapshot header flags
+type Compression uint16
+
+const (
+	// CompressionNone writes the records as they are
+	CompressionNone Compression = iota
+
+	// CompressionGzip compresses the records with gzip
+	CompressionGzip
+
+	// CompressionSnappy compresses the records with the snappy framing format
+	CompressionSnappy
+
+	// CompressionZstd compresses the records with zstd
+	CompressionZstd
+)
+
+// compressionMask is the bits of the snapshot header flags holding the compression
+const compressionMask uint16 = 0x000f
+
+// ParseCompression is used to parse the name of a compression
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "none", "":
+		return CompressionNone, nil
+	case "gzip":
+		return CompressionGzip, nil
+	case "snappy":
+		return CompressionSnappy, nil
+	case "zstd":
+		return CompressionZstd, nil
+	default:
+		return 0, fmt.Errorf("unknown compression %q", name)
+	}
+}
+
+// String is used to get the name of the compression
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint16(c))
+	}
+}
+
+// compressionFromFlags is used to get the compression recorded in the snapshot header flags
+func compressionFromFlags(flags uint16) Compression {
+	return Compression(flags & compressionMask)
+}
+
+// flags is used to record the compression in the snapshot header flags
+func (c Compression) flags() uint16 {
+	return uint16(c) & compressionMask
+}
+
+// compressWriter is used to wrap w so that everything written to it is compressed
+// The returned writer must be closed to flush the compressed stream, this does not close w
+func compressWriter(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionSnappy:
+		return snappy.NewBufferedWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown compression %v", c)
+	}
+}
+
+// decompressReader is used to wrap r so that everything read from it is decompressed
+func decompressReader(r io.Reader, c Compression) (io.ReadCloser, error) {
+	switch c {
+	case CompressionNone:
+		return io.NopCloser(r), nil
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionSnappy:
+		return io.NopCloser(snappy.NewReader(r)), nil
+	case CompressionZstd:
+		dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown compression %v", ErrSnapshotVersion, c)
+	}
+}
+
+// nopWriteCloser is used to give a writer a Close method that does nothing
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close is used to implement the io.Closer interface
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// countingWriter is used to count the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write is used to implement the io.Writer interface
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingReader is used to count the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read is used to implement the io.Reader interface
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+)
+
+// messageDigest is an order independent digest of a set of messages, the sum of the sha256 of each encoded message
+// Messages can be added and removed in any order, so the digest of a queue is kept up to date as it changes
+type messageDigest [4]uint64
+
+// add is used to add an encoded message to the digest
+func (d *messageDigest) add(value []byte) {
+	sum := sha256.Sum256(value)
+	for i := range d {
+		d[i] += binary.BigEndian.Uint64(sum[i*8:])
+	}
+}
+
+// remove is used to remove an encoded message from the digest
+func (d *messageDigest) remove(value []byte) {
+	sum := sha256.Sum256(value)
+	for i := range d {
+		d[i] -= binary.BigEndian.Uint64(sum[i*8:])
+	}
+}
+
+// subtract is used to remove every message of another digest from the digest
+func (d *messageDigest) subtract(other messageDigest) {
+	for i := range d {
+		d[i] -= other[i]
+	}
+}
+
+// write is used to write the digest to a hash
+func (d messageDigest) write(h hash.Hash) {
+	var buf [32]byte
+	for i, lane := range d {
+		binary.BigEndian.PutUint64(buf[i*8:], lane)
+	}
+	h.Write(buf[:])
+}
+
+// segmentDigest is the digest of the entries of a stream segment, which is trimmed as a unit
+type segmentDigest struct {
+	base   uint64
+	digest messageDigest
+}
+
+// streamDigest is the digest of the retained entries of a stream, kept by segment so trimmed segments can be removed
+type streamDigest struct {
+	segments []segmentDigest
+	digest   messageDigest
+}
+
+// newStreamDigest is used to get the digest of every entry retained by a stream, such as one restored from a snapshot
+func newStreamDigest[T any](stream *ds.Stream[T]) (*streamDigest, error) {
+	d := &streamDigest{}
+	for _, segment := range stream.Copy().Segments {
+		for _, entry := range segment.Entries {
+			if err := d.append(entry, segment.BaseOffset); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return d, nil
+}
+
+// append is used to add an entry appended to the segment starting at base
+func (d *streamDigest) append(entry any, base uint64) error {
+	value, err := encodeValue(entry)
+	if err != nil {
+		return err
+	}
+
+	last := len(d.segments) - 1
+	if last < 0 || d.segments[last].base != base {
+		d.segments = append(d.segments, segmentDigest{base: base})
+		last++
+	}
+	d.segments[last].digest.add(value)
+	d.digest.add(value)
+	return nil
+}
+
+// trim is used to remove the segments before the first offset the stream retains
+func (d *streamDigest) trim(first uint64) {
+	for len(d.segments) > 1 && d.segments[1].base <= first {
+		d.digest.subtract(d.segments[0].digest)
+		d.segments = d.segments[1:]
+	}
+}
+
+// stateDigest is used to get a digest of the queues and streams of the store, it is folded into the state hash
+// when a check command is applied so that replicas whose state has drifted apart are found by that check
+// The queues held in memory are digested message by message, so it is not computed for any other entry
+func (s *Store[T]) stateDigest() ([]byte, error) {
+	sum := sha256.New()
+	for _, name := range s.queues.names() {
+		length, _ := s.queues.len(name)
+		digest, err := s.queues.digest(name)
+		if err != nil {
+			return nil, err
+		}
+		sum.Write([]byte(name))
+		sum.Write(binary.BigEndian.AppendUint64(nil, uint64(length)))
+		digest.write(sum)
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, name := range sortedKeys(s.streams) {
+		stream := s.streams[name]
+		sum.Write([]byte(name))
+		sum.Write(binary.BigEndian.AppendUint64(nil, stream.FirstOffset()))
+		sum.Write(binary.BigEndian.AppendUint64(nil, stream.NextOffset))
+		for _, group := range sortedKeys(stream.Groups) {
+			sum.Write([]byte(group))
+			sum.Write(binary.BigEndian.AppendUint64(nil, stream.Groups[group]))
+		}
+		if digest, ok := s.streamDigests[name]; ok {
+			digest.digest.write(sum)
+		}
+	}
+	return sum.Sum(nil), nil
+}
+
+// digestAppend is used to add the entry appended to a stream at the offset to its digest, and to drop the segments trimmed
+func (s *Store[T]) digestAppend(digest *streamDigest, stream *ds.Stream[T], offset uint64) error {
+	if entries := stream.Read(offset, 1); len(entries) == 1 && entries[0].Offset == offset {
+		if err := digest.append(entries[0], stream.SegmentBase(offset)); err != nil {
+			return fmt.Errorf("failed to digest stream entry: %w", err)
+		}
+	}
+	digest.trim(stream.FirstOffset())
+	return nil
+}
+
+// digestOf is used to get the digest of the named stream, digesting the entries of the stream if there is none
+// It must be called before the stream is changed, so that the change is added to the digest once
+func (s *Store[T]) digestOf(name string, stream *ds.Stream[T]) (*streamDigest, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	digest, ok := s.streamDigests[name]
+	if !ok {
+		var err error
+		if digest, err = newStreamDigest(stream); err != nil {
+			return nil, fmt.Errorf("failed to digest stream: %w", err)
+		}
+		s.streamDigests[name] = digest
+	}
+	return digest, nil
+}
+
+// restoreStreamDigests is used to digest every stream restored from a snapshot
+func restoreStreamDigests[T any](streams map[string]*ds.Stream[T]) (map[string]*streamDigest, error) {
+	digests := make(map[string]*streamDigest, len(streams))
+	for _, name := range sortedKeys(streams) {
+		digest, err := newStreamDigest(streams[name])
+		if err != nil {
+			return nil, err
+		}
+		digests[name] = digest
+	}
+	return digests, nil
+}
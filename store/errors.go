@@ -0,0 +1,65 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// The errors returned by the store, which wrap the raft error they were caused by if any
+var (
+	// ErrNotLeader is returned when a command is submitted to a node that is not the leader
+	// The command was not logged, so it can be retried against the leader
+	ErrNotLeader = errors.New("node is not the leader")
+
+	// ErrLeadershipLost is returned when the leader is deposed before a command is committed
+	// The command may still be committed by the new leader, so it is only safe to retry if it is idempotent
+	ErrLeadershipLost = errors.New("leadership lost before the command was committed")
+
+	// ErrTimeout is returned when a command could not be submitted to raft in time
+	// The command was not logged, so it can be retried
+	ErrTimeout = errors.New("timed out submitting the command")
+
+	// ErrShuttingDown is returned when the node is shutting down
+	// The command may have been applied before the node stopped, so it is only safe to retry if it is idempotent
+	ErrShuttingDown = errors.New("node is shutting down")
+
+	// ErrQueueNotFound is returned when a message is received from a queue that was never sent to or was deleted
+	ErrQueueNotFound = errors.New("queue not found")
+
+	// ErrStreamNotFound is returned when committing to or setting the retention of a stream that was never appended to
+	ErrStreamNotFound = errors.New("stream not found")
+
+	// ErrOffsetOutOfRange is returned when committing an offset past the end of the stream
+	// The consumer group would otherwise skip the entries appended up to that offset
+	ErrOffsetOutOfRange = errors.New("offset is past the end of the stream")
+
+	// ErrNodeNotFound is returned when a node is not in the raft configuration of the cluster
+	ErrNodeNotFound = errors.New("node not found")
+
+	// ErrDefaultQueue is returned when deleting the default queue, which always exists
+	ErrDefaultQueue = errors.New("the default queue cannot be deleted")
+
+	// ErrInvalidBackup is returned when restoring from data that is not a snapshot of the store
+	ErrInvalidBackup = errors.New("invalid backup")
+)
+
+// translateError is used to wrap an error returned by raft in the matching store error
+// The raft error is kept in the chain, so it can still be matched with errors.Is
+func translateError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, raft.ErrNotLeader), errors.Is(err, raft.ErrLeadershipTransferInProgress):
+		return fmt.Errorf("%w: %w", ErrNotLeader, err)
+	case errors.Is(err, raft.ErrLeadershipLost):
+		return fmt.Errorf("%w: %w", ErrLeadershipLost, err)
+	case errors.Is(err, raft.ErrEnqueueTimeout):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	case errors.Is(err, raft.ErrRaftShutdown):
+		return fmt.Errorf("%w: %w", ErrShuttingDown, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,265 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+	"github.com/kavinaravind/go-raft-message-queue/model"
+)
+
+// The fuzz targets run their seed corpus as part of go test, and are fuzzed with:
+// go test ./store -run XXX -fuzz FuzzApply -fuzztime 1m
+
+// fuzzStore is used to create a store that writes uncompressed snapshots and discards its logs
+func fuzzStore[T any]() *Store[T] {
+	store := NewStore[T](slog.New(slog.NewTextHandler(io.Discard, nil)))
+	store.SetSnapshotCompression(CompressionNone)
+	return store
+}
+
+// persist is used to snapshot the store and get the bytes persisted
+func persist[T any](t *testing.T, store *Store[T]) []byte {
+	t.Helper()
+
+	snapshot, err := store.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer snapshot.Release()
+
+	sink := &MockSnapshotSink{}
+	if err := snapshot.Persist(sink); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	return sink.buffer.Bytes()
+}
+
+// restore is used to restore a new store from the snapshot
+func restore[T any](t *testing.T, data []byte) *Store[T] {
+	t.Helper()
+
+	store := fuzzStore[T]()
+	if err := store.Restore(io.NopCloser(bytes.NewReader(data))); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	return store
+}
+
+// fuzzSchemas are the schemas registered by fuzzed programs, along with the raw bytes of the program
+var fuzzSchemas = []string{
+	`{"type": "object", "properties": {"author": {"type": "string"}}}`,
+	`{"type": "object", "required": ["author"], "properties": {"author": {"type": "string"}}}`,
+	`{"type": "string"}`,
+}
+
+// fuzzCommands is used to decode a program of commands from fuzzed bytes
+// Each command is an operation, an argument that selects names and values, and a body of up to 15 bytes
+func fuzzCommands(program []byte) []*command[model.Payload] {
+	queues := []string{"", DefaultQueue, "a", "b"}
+	names := []string{"s", "t"}
+	compatibilities := []string{"", "backward", "forward", "full", "none", "sideways"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var commands []*command[model.Payload]
+	for len(program) >= 3 {
+		operation, arg, n := program[0], int(program[1]), int(program[2]%16)
+		program = program[3:]
+		body := program[:min(n, len(program))]
+		program = program[len(body):]
+
+		c := &command[model.Payload]{
+			Operation: int(operation % 14),
+			Queue:     queues[arg%len(queues)],
+			Stream:    names[arg/4%len(names)],
+			Group:     names[arg/8%len(names)],
+			Offset:    uint64(arg / 16),
+			Timestamp: start.Add(time.Duration(len(commands)) * time.Minute),
+		}
+		switch c.Operation {
+		case Send, Append:
+			c.Message = ds.Message[model.Payload]{Data: model.Payload{ContentType: model.JSONContentType, Body: append([]byte{}, body...)}}
+			if c.Operation == Send && arg%3 == 1 {
+				c.Key = names[arg/2%len(names)]
+			}
+		case Retain:
+			c.Retention = ds.Retention{MaxEntries: arg % 4, MaxAge: time.Duration(arg%3) * time.Minute}
+		case SetCompatibility:
+			c.Compat = compatibilities[arg/4%len(compatibilities)]
+		case RegisterSchema:
+			if i := arg % (len(fuzzSchemas) + 1); i < len(fuzzSchemas) {
+				c.Schema = []byte(fuzzSchemas[i])
+			} else {
+				c.Schema = append([]byte{}, body...)
+			}
+			c.Compat = compatibilities[arg/4%len(compatibilities)]
+		case Check:
+			if arg%2 == 1 {
+				c.Hash = &StateHash{Index: uint64(arg / 2), Hash: append([]byte{}, body...)}
+			}
+		case RegisterMember:
+			if arg%4 != 0 {
+				c.Member = &Member{ID: names[arg%len(names)], Address: string(body)}
+			}
+		}
+		commands = append(commands, c)
+	}
+	return commands
+}
+
+func FuzzDecodeCommand(f *testing.F) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingMsgpack} {
+		for _, c := range benchmarkCommands() {
+			data, err := encodeCommand(c, encoding)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(data)
+		}
+	}
+	f.Add([]byte{})
+	f.Add([]byte{byte(EncodingMsgpack), commandVersion, 0xff, 0xff, 0xff, 0xff, 0x0f})
+	f.Add([]byte(`{"operation": 1, "message": {"Data": {"body": "e30="}}}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c, err := decodeCommand[model.Payload](data, nil)
+		if err != nil {
+			return
+		}
+
+		// Any command that decodes survives being written back to the log in the current encoding
+		encoded, err := encodeCommand(c, EncodingMsgpack)
+		if err != nil {
+			t.Fatalf("failed to encode decoded command: %v", err)
+		}
+		decoded, err := decodeCommand[model.Payload](encoded, nil)
+		if err != nil {
+			t.Fatalf("failed to decode encoded command: %v", err)
+		}
+		again, err := encodeCommand(decoded, EncodingMsgpack)
+		if err != nil {
+			t.Fatalf("failed to encode decoded command: %v", err)
+		}
+		if !bytes.Equal(encoded, again) {
+			t.Errorf("expected the command to encode the same after a round trip\n%x\n%x", encoded, again)
+		}
+	})
+}
+
+func FuzzApply(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{
+		byte(Send), 2, 3, 'a', 'b', 'c',
+		byte(Send), 2, 1, 'd',
+		byte(Recieve), 2, 0,
+		byte(Append), 0, 2, '{', '}',
+		byte(Commit), 16, 0,
+		byte(Retain), 1, 0,
+		byte(RegisterSchema), 1, 0,
+		byte(SetCompatibility), 17, 0,
+		byte(Send), 1, 2, '{', '}',
+		byte(DeleteSchema), 1, 0,
+		byte(Check), 0, 0,
+		byte(RegisterMember), 1, 4, 'h', 'o', 's', 't',
+		byte(RegisterMember), 1, 0,
+		byte(CreateQueue), 3, 0,
+		byte(Send), 3, 1, '1',
+		byte(PurgeQueue), 3, 0,
+		byte(DeleteQueue), 2, 0,
+		byte(DeleteQueue), 1, 0,
+		13, 0, 0,
+	})
+	f.Add([]byte{byte(RegisterSchema), 3, 5, '{', '"', 'a', '"', '}', byte(Append), 4, 1, 'x', byte(Retain), 6, 0})
+
+	f.Fuzz(func(t *testing.T, program []byte) {
+		// Every replica applies the same log, with the fuzzed bytes themselves as the last entry
+		var logs []*raft.Log
+		for i, c := range fuzzCommands(program) {
+			encoding := EncodingMsgpack
+			if i%2 == 1 {
+				encoding = EncodingJSON
+			}
+			data, err := encodeCommand(c, encoding)
+			if err != nil {
+				t.Fatalf("failed to encode command: %v", err)
+			}
+			logs = append(logs, &raft.Log{Index: uint64(i + 1), Term: 1, Type: raft.LogCommand, Data: data})
+		}
+		logs = append(logs, &raft.Log{Index: uint64(len(logs) + 1), Term: 1, Type: raft.LogCommand, Data: program})
+
+		replicas := []*Store[model.Payload]{fuzzStore[model.Payload](), fuzzStore[model.Payload]()}
+		responses := make([][]string, len(replicas))
+		for i, replica := range replicas {
+			for _, log := range logs {
+				responses[i] = append(responses[i], fmt.Sprint(replica.Apply(log)))
+			}
+		}
+		for i := range logs {
+			if responses[0][i] != responses[1][i] {
+				t.Fatalf("expected replicas to respond the same to entry %d, got %s and %s", i+1, responses[0][i], responses[1][i])
+			}
+		}
+
+		snapshot := persist(t, replicas[0])
+		if other := persist(t, replicas[1]); !bytes.Equal(snapshot, other) {
+			t.Fatal("expected replicas that applied the same log to have the same state")
+		}
+
+		// A store restored from the snapshot has the same state as the one it was taken from
+		if restored := persist(t, restore[model.Payload](t, snapshot)); !bytes.Equal(snapshot, restored) {
+			t.Fatal("expected a restored store to have the same state as the snapshot")
+		}
+	})
+}
+
+func FuzzRestore(f *testing.F) {
+	state := testSnapshotState(f)
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionSnappy, CompressionZstd} {
+		var buf bytes.Buffer
+		if _, err := writeSnapshot(&buf, state, compression); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+	}
+	var v1 bytes.Buffer
+	writeSnapshotV1(f, &v1, state)
+	f.Add(v1.Bytes())
+	f.Add([]byte{})
+	f.Add([]byte("RMQS"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		store := fuzzStore[int]()
+		store.Apply(&raft.Log{Index: 1, Data: mustEncode(t, &command[int]{Operation: Send, Queue: "before", Message: ds.Message[int]{Data: 1}})})
+		before := persist(t, store)
+
+		if err := store.Restore(io.NopCloser(bytes.NewReader(data))); err != nil {
+			// A snapshot that fails to restore leaves the store as it was
+			if after := persist(t, store); !bytes.Equal(before, after) {
+				t.Fatalf("expected a failed restore to leave the store untouched: %v", err)
+			}
+			return
+		}
+
+		// Any snapshot that restores is written back in the current version, which restores to the same state
+		snapshot := persist(t, store)
+		if restored := persist(t, restore[int](t, snapshot)); !bytes.Equal(snapshot, restored) {
+			t.Fatal("expected a restored store to have the same state as the snapshot")
+		}
+	})
+}
+
+// mustEncode is used to encode a command in the default encoding
+func mustEncode[T any](t *testing.T, c *command[T]) []byte {
+	t.Helper()
+
+	data, err := encodeCommand(c, EncodingMsgpack)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	return data
+}
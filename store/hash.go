@@ -0,0 +1,259 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-msgpack/v2/codec"
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+)
+
+// DefaultHashCheckInterval is how often the leader replicates a check of the state hash
+const DefaultHashCheckInterval = 30 * time.Second
+
+// StateHash is a rolling hash of the entries applied to the store, the responses to them and the state at each check
+// The hash restarts at every check command, so every node hashes the same window of the log
+type StateHash struct {
+	// Index is the index of the last entry folded into the hash
+	Index uint64
+
+	// Hash is the sha256 of the window, it is nil when the state was restored from a snapshot without one
+	Hash []byte
+}
+
+// String is used to get the hash as hex
+func (h StateHash) String() string {
+	if h.Hash == nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(h.Hash)
+}
+
+// Divergence is a mismatch between the state hash of a node and that of the leader
+type Divergence struct {
+	// Index is the index of the check command both hashes were recorded at
+	Index uint64
+
+	// Leader and Local are the hashes of the window before the check on the leader and on this node
+	Leader, Local []byte
+}
+
+// Error is used to implement the error interface
+func (d *Divergence) Error() string {
+	return fmt.Sprintf("state hash at index %d is %x, the leader has %x", d.Index, d.Local, d.Leader)
+}
+
+// hashRecord is the state hash held in a snapshot, so that restored nodes keep hashing the same window
+type hashRecord struct {
+	Current StateHash
+	Checked StateHash
+}
+
+// stateHasher keeps the rolling hash of the store, it is updated by the fsm and read by stats and checks
+type stateHasher struct {
+	lock sync.Mutex
+
+	// current is the hash of the entries applied since the last check
+	current StateHash
+
+	// checked is the hash recorded when the last check command was applied
+	checked StateHash
+
+	// divergence is the first mismatch found with the leader, if any
+	divergence *Divergence
+
+	enc *codec.Encoder
+	buf []byte
+}
+
+// newStateHasher creates a hasher for a store that applies the log from its first entry
+func newStateHasher() *stateHasher {
+	return &stateHasher{
+		current: StateHash{Hash: seedHash(0)},
+		enc:     codec.NewEncoderBytes(nil, msgpackHandle),
+	}
+}
+
+// seedHash is used to get the hash a window starts from at the given index
+func seedHash(index uint64) []byte {
+	sum := sha256.Sum256(binary.BigEndian.AppendUint64([]byte("check"), index))
+	return sum[:]
+}
+
+// fold is used to add an applied entry and the response to it to the current hash
+func (h *stateHasher) fold(log *raft.Log, response interface{}) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.current.Index = log.Index
+	if h.current.Hash == nil {
+		return
+	}
+
+	sum := sha256.New()
+	sum.Write(h.current.Hash)
+	sum.Write(binary.BigEndian.AppendUint64(nil, log.Index))
+	sum.Write(binary.AppendUvarint(nil, uint64(len(log.Data))))
+	sum.Write(log.Data)
+	sum.Write(h.encode(response))
+	h.current.Hash = sum.Sum(nil)
+}
+
+// encode is used to encode a response in the same way on every node
+func (h *stateHasher) encode(response interface{}) []byte {
+	switch response := response.(type) {
+	case nil:
+		return nil
+	case error:
+		return []byte("error: " + response.Error())
+	}
+
+	h.buf = h.buf[:0]
+	h.enc.ResetBytes(&h.buf)
+	if err := h.enc.Encode(response); err != nil {
+		return []byte(fmt.Sprintf("%T: %v", response, response))
+	}
+	return h.buf
+}
+
+// check is used to compare the hash the leader recorded at the last check with the one of this node
+// The current hash is then recorded for the next check along with the digest of the state at this one,
+// and the window restarts at the check's index
+func (h *stateHasher) check(index uint64, leader *StateHash, digest []byte) *Divergence {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var divergence *Divergence
+	if leader != nil && leader.Index == h.checked.Index && leader.Hash != nil && h.checked.Hash != nil && !bytes.Equal(leader.Hash, h.checked.Hash) {
+		divergence = &Divergence{Index: leader.Index, Leader: leader.Hash, Local: h.checked.Hash}
+		if h.divergence == nil {
+			h.divergence = divergence
+		}
+	}
+
+	h.checked = StateHash{Index: index}
+	if h.current.Hash != nil {
+		sum := sha256.New()
+		sum.Write(h.current.Hash)
+		sum.Write(digest)
+		h.checked.Hash = sum.Sum(nil)
+	}
+	h.current = StateHash{Index: index, Hash: seedHash(index)}
+	return divergence
+}
+
+// record is used to get the hashes held in a snapshot
+func (h *stateHasher) record() *hashRecord {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return &hashRecord{Current: h.current, Checked: h.checked}
+}
+
+// restore is used to continue from the hashes held in a snapshot
+// A snapshot written before state hashing has none, so the hash is unknown until the next check
+func (h *stateHasher) restore(record *hashRecord) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if record == nil {
+		h.current = StateHash{}
+		h.checked = StateHash{}
+		return
+	}
+	h.current = record.Current
+	h.checked = record.Checked
+}
+
+// hashes is used to get the current and checked hashes along with the divergence, if any
+func (h *stateHasher) hashes() (StateHash, StateHash, *Divergence) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.current, h.checked, h.divergence
+}
+
+// SetHashCheckInterval is used to set how often the leader replicates a check of the state hash
+// It must be called before Initialize, an interval of zero disables the checks
+func (s *Store[T]) SetHashCheckInterval(interval time.Duration) {
+	s.hashCheckInterval = interval
+}
+
+// SetFenceOnDivergence is used to shutdown the raft node of a follower whose state hash differs from the leader's
+// Otherwise the divergence is only logged and reported in the stats
+// A diverged follower stops voting and applying entries, and must be rebuilt from a fresh data directory
+func (s *Store[T]) SetFenceOnDivergence(fence bool) {
+	s.fenceOnDivergence = fence
+}
+
+// StateHash is used to get the current state hash and the one recorded at the last check
+func (s *Store[T]) StateHash() (StateHash, StateHash) {
+	current, checked, _ := s.hasher.hashes()
+	return current, checked
+}
+
+// Divergence is used to get the first mismatch found between the state hash of this node and the leader's
+func (s *Store[T]) Divergence() *Divergence {
+	_, _, divergence := s.hasher.hashes()
+	return divergence
+}
+
+// applyCheck is used to apply a check command, raising an alarm if this node has diverged from the leader
+func (s *Store[T]) applyCheck(log *raft.Log, leader *StateHash) interface{} {
+	digest, err := s.stateDigest()
+	if err != nil {
+		s.logger.Error("failed to digest state", "error", err)
+		return err
+	}
+
+	divergence := s.hasher.check(log.Index, leader, digest)
+	if divergence == nil {
+		return nil
+	}
+
+	s.logger.Error("State hash diverged from the leader", "index", divergence.Index, "leader", hex.EncodeToString(divergence.Leader), "local", hex.EncodeToString(divergence.Local))
+	if s.fenceOnDivergence && s.consensus != nil && s.consensus.Node.State() != raft.Leader {
+		// The fsm can not wait for raft to shutdown, as raft waits for the fsm
+		go s.fence()
+	}
+	return nil
+}
+
+// fence is used to shutdown the raft node after a divergence
+func (s *Store[T]) fence() {
+	s.logger.Error("Fencing node after state hash divergence")
+	if err := s.consensus.Node.Shutdown().Error(); err != nil {
+		s.logger.Error("Failed to fence node", "error", err)
+	}
+}
+
+// runHashChecks is used to replicate a check of the state hash while this node is the leader
+func (s *Store[T]) runHashChecks(ctx context.Context) {
+	ticker := time.NewTicker(s.hashCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.consensus.Node.State() != raft.Leader {
+				continue
+			}
+
+			_, checked, _ := s.hasher.hashes()
+			c := newCommand[T](Check, ds.Message[T]{})
+			c.Hash = &checked
+			if _, err := s.apply(ctx, c); err != nil {
+				s.logger.Warn("Failed to replicate state hash check", "error", err)
+			}
+		}
+	}
+}
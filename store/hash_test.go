@@ -0,0 +1,249 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+)
+
+// applyAll is used to apply the commands to the store as consecutive log entries from the given index
+func applyAll(t *testing.T, store *Store[int], index uint64, commands ...*command[int]) uint64 {
+	t.Helper()
+
+	for _, c := range commands {
+		store.Apply(&raft.Log{Index: index, Term: 1, Type: raft.LogCommand, Data: mustEncode(t, c)})
+		index++
+	}
+	return index
+}
+
+// check is used to get a check command carrying the hash the store recorded at the last check
+func check(store *Store[int]) *command[int] {
+	_, checked := store.StateHash()
+	return &command[int]{Operation: Check, Hash: &checked}
+}
+
+func send(value int) *command[int] {
+	return &command[int]{Operation: Send, Queue: "numbers", Message: ds.Message[int]{Data: value}}
+}
+
+func TestStateHash(t *testing.T) {
+	leader, follower := fuzzStore[int](), fuzzStore[int]()
+	for _, store := range []*Store[int]{leader, follower} {
+		applyAll(t, store, 1, send(1), send(2), &command[int]{Operation: Recieve, Queue: "numbers"})
+	}
+
+	current, _ := leader.StateHash()
+	if other, _ := follower.StateHash(); current.Index != 3 || !bytes.Equal(current.Hash, other.Hash) {
+		t.Fatalf("expected replicas to have the same hash at index 3, got %s at %d and %s at %d", current, current.Index, other, other.Index)
+	}
+
+	// The second check compares the hashes recorded by the first one
+	c := check(leader)
+	applyAll(t, leader, 4, c)
+	applyAll(t, follower, 4, c)
+	c = check(leader)
+	applyAll(t, leader, 5, c)
+	applyAll(t, follower, 5, c)
+	if d := follower.Divergence(); d != nil {
+		t.Fatalf("expected no divergence, got: %v", d)
+	}
+
+	// A follower that applied an entry differently diverges at the next check
+	applyAll(t, leader, 6, send(3))
+	follower.Apply(&raft.Log{Index: 6, Term: 1, Type: raft.LogCommand, Data: mustEncode(t, send(4))})
+	c = check(leader)
+	applyAll(t, leader, 7, c)
+	applyAll(t, follower, 7, c)
+	if d := follower.Divergence(); d != nil {
+		t.Fatalf("expected the divergence to be found by the next check, got: %v", d)
+	}
+	c = check(leader)
+	applyAll(t, leader, 8, c)
+	applyAll(t, follower, 8, c)
+
+	d := follower.Divergence()
+	if d == nil || d.Index != 7 {
+		t.Fatalf("expected a divergence at index 7, got: %v", d)
+	}
+	if leader.Divergence() != nil {
+		t.Errorf("expected the leader not to diverge from itself")
+	}
+}
+
+func TestStateHashSnapshot(t *testing.T) {
+	store := fuzzStore[int]()
+	index := applyAll(t, store, 1, send(1), send(2))
+	index = applyAll(t, store, index, check(store), send(3))
+
+	// A restored store continues the same window of the hash
+	restored := restore[int](t, persist(t, store))
+	applyAll(t, store, index, send(4))
+	applyAll(t, restored, index, send(4))
+
+	current, checked := store.StateHash()
+	restoredCurrent, restoredChecked := restored.StateHash()
+	if !bytes.Equal(current.Hash, restoredCurrent.Hash) || current.Index != restoredCurrent.Index {
+		t.Errorf("expected the current hash %s, got %s", current, restoredCurrent)
+	}
+	if !bytes.Equal(checked.Hash, restoredChecked.Hash) || checked.Index != restoredChecked.Index {
+		t.Errorf("expected the checked hash %s, got %s", checked, restoredChecked)
+	}
+}
+
+func TestStateHashLegacySnapshot(t *testing.T) {
+	var v1 bytes.Buffer
+	writeSnapshotV1(t, &v1, testSnapshotState(t))
+	legacy := restore[int](t, v1.Bytes())
+
+	// A snapshot without a hash leaves it unknown, which never diverges
+	if current, _ := legacy.StateHash(); current.Hash != nil {
+		t.Fatalf("expected an unknown hash, got %s", current)
+	}
+
+	// The leader holds the same state, with a known hash
+	leader := restore[int](t, v1.Bytes())
+	leader.hasher.restore(&hashRecord{Current: StateHash{Hash: seedHash(0)}})
+	applyAll(t, leader, 1, send(1))
+	applyAll(t, legacy, 1, send(1))
+	c := check(leader)
+	applyAll(t, leader, 2, c)
+	applyAll(t, legacy, 2, c)
+	if legacy.Divergence() != nil {
+		t.Fatalf("expected no divergence with an unknown hash, got: %v", legacy.Divergence())
+	}
+
+	// The hash is known again from the check on, in the same window as the leader
+	applyAll(t, leader, 3, send(2))
+	applyAll(t, legacy, 3, send(2))
+	current, _ := leader.StateHash()
+	if other, _ := legacy.StateHash(); !bytes.Equal(current.Hash, other.Hash) {
+		t.Errorf("expected the hash %s after the check, got %s", current, other)
+	}
+}
+
+func TestStateHashStorage(t *testing.T) {
+	// Replicas holding their queues in different engines hash the same state
+	memory, bolt := fuzzStore[int](), fuzzStore[int]()
+	queues, err := openBoltQueues[int](filepath.Join(t.TempDir(), "queues.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { queues.close() })
+	bolt.queues = queues
+
+	commands := []*command[int]{
+		send(1), send(2), send(3),
+		{Operation: Recieve, Queue: "numbers"},
+		{Operation: CreateQueue, Queue: "empty"},
+		{Operation: Send, Queue: "purged", Message: ds.Message[int]{Data: 4}},
+		{Operation: PurgeQueue, Queue: "purged"},
+		{Operation: Append, Stream: "events", Message: ds.Message[int]{Data: 5}},
+	}
+	c := check(memory)
+	for _, store := range []*Store[int]{memory, bolt} {
+		index := applyAll(t, store, 1, commands...)
+		applyAll(t, store, index, c)
+	}
+
+	_, checked := memory.StateHash()
+	if _, other := bolt.StateHash(); checked.Hash == nil || !bytes.Equal(checked.Hash, other.Hash) {
+		t.Errorf("expected the hash %s with bolt, got %s", checked, other)
+	}
+}
+
+func TestStateHashDrift(t *testing.T) {
+	leader := fuzzStore[int]()
+
+	// The follower is never elected, so the entries are applied to it directly
+	follower := NewStore[int](slog.New(slog.NewTextHandler(io.Discard, nil)))
+	follower.SetHashCheckInterval(0)
+	follower.SetFenceOnDivergence(true)
+	conf := testConfig(t.TempDir())
+	conf.IsLeader = false
+	ctx, cancel := context.WithCancel(context.Background())
+	shutdown, err := follower.Initialize(ctx, conf)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		<-shutdown
+	})
+
+	index := uint64(1)
+	for _, store := range []*Store[int]{leader, follower} {
+		index = applyAll(t, store, 1, send(1), send(2))
+	}
+
+	// A message lost by the follower outside of the log is only seen in its state
+	if _, ok, err := follower.queues.dequeue("numbers"); !ok || err != nil {
+		t.Fatalf("expected a message to drop, got %v, %v", ok, err)
+	}
+	for _, store := range []*Store[int]{leader, follower} {
+		applyAll(t, store, index, send(3))
+	}
+
+	for i := 0; i < 2; i++ {
+		c := check(leader)
+		applyAll(t, leader, index+1, c)
+		applyAll(t, follower, index+1, c)
+		index++
+	}
+
+	d := follower.Divergence()
+	if d == nil || d.Index != index-1 {
+		t.Fatalf("expected a divergence at index %d, got: %v", index-1, d)
+	}
+
+	// The diverged follower is fenced
+	deadline := time.Now().Add(5 * time.Second)
+	for follower.consensus.Node.State() != raft.Shutdown {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the follower to be fenced, got %v", follower.consensus.Node.State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamDigestError(t *testing.T) {
+	// An entry that can not be digested fails the append, rather than leaving the digest behind the stream
+	store := fuzzStore[[]complex128]()
+	c := &command[[]complex128]{Operation: Append, Stream: "events", Message: ds.Message[[]complex128]{Data: []complex128{1i}}}
+	response := store.applyCommand(store.queues, c)
+	if _, ok := response.(error); !ok {
+		t.Errorf("expected the append to fail, got %v", response)
+	}
+}
+
+func TestStreamDigest(t *testing.T) {
+	store := fuzzStore[int]()
+	stream := ds.NewStream[int]()
+	stream.SegmentSize = 2
+	store.streams["events"] = stream
+
+	index := uint64(1)
+	for i := 0; i < 7; i++ {
+		index = applyAll(t, store, index, &command[int]{Operation: Append, Stream: "events", Message: ds.Message[int]{Data: i}})
+	}
+	applyAll(t, store, index, &command[int]{Operation: Retain, Stream: "events", Retention: ds.Retention{MaxEntries: 3}})
+	if stream.FirstOffset() == 0 {
+		t.Fatal("expected segments to be trimmed")
+	}
+
+	// The digest kept as entries are appended and trimmed is that of the entries retained
+	expected, err := newStreamDigest(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest := store.streamDigests["events"]; digest.digest != expected.digest || len(digest.segments) != len(stream.Segments) {
+		t.Errorf("expected the digest of %d segments, got %d segments", len(stream.Segments), len(digest.segments))
+	}
+}
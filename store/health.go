@@ -0,0 +1,44 @@
+package store
+
+import "github.com/hashicorp/raft"
+
+// Readiness is the state of the node deciding whether it is ready to serve requests
+type Readiness struct {
+	// Leader is the current leader as known by this node, and LeaderKnown is whether there is one
+	Leader      Member
+	LeaderKnown bool
+
+	// AppliedIndex is the index of the last log entry applied to the store
+	AppliedIndex uint64
+
+	// CommitIndex is the index of the last log entry known to be committed by the cluster
+	CommitIndex uint64
+
+	// Restoring is whether the store is being replaced by a snapshot
+	Restoring bool
+}
+
+// Lag is used to get the number of committed log entries the store has yet to apply
+func (r Readiness) Lag() uint64 {
+	if r.CommitIndex <= r.AppliedIndex {
+		return 0
+	}
+	return r.CommitIndex - r.AppliedIndex
+}
+
+// Readiness is used to get the state of the node deciding whether it is ready to serve requests
+func (s *Store[T]) Readiness() Readiness {
+	leader, ok := s.Leader()
+	return Readiness{
+		Leader:       leader,
+		LeaderKnown:  ok,
+		AppliedIndex: s.consensus.Node.AppliedIndex(),
+		CommitIndex:  s.consensus.Node.CommitIndex(),
+		Restoring:    s.restoring.Load(),
+	}
+}
+
+// IsLeader is used to check whether this node is the leader
+func (s *Store[T]) IsLeader() bool {
+	return s.consensus.Node.State() == raft.Leader
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// IdempotencyWindow is how long the key of a send is remembered
+// A send retried with the same key within the window is only enqueued once
+const IdempotencyWindow = 10 * time.Minute
+
+// duplicateSend is the response to a send whose key was already used within the window
+type duplicateSend struct{}
+
+// idempotencyKey is a key used by a send, along with the queue it was sent to and the time of the send
+type idempotencyKey struct {
+	Queue string
+	Key   string
+	Time  time.Time
+}
+
+// idempotencyKeys are the keys of the sends applied within the window
+// The keys are applied with the timestamp assigned by the leader, so every replica expires the same keys
+type idempotencyKeys struct {
+	// seen is the time each key of each queue was used at
+	seen map[[2]string]time.Time
+
+	// order is the keys in the order they were applied, so the oldest are expired first
+	order []idempotencyKey
+}
+
+// newIdempotencyKeys creates an empty set of keys
+func newIdempotencyKeys() *idempotencyKeys {
+	return &idempotencyKeys{seen: map[[2]string]time.Time{}}
+}
+
+// used is used to check whether the key of a send was already used within the window
+func (k *idempotencyKeys) used(queue, key string, now time.Time) bool {
+	k.expire(now)
+
+	_, ok := k.seen[[2]string{queue, key}]
+	return ok
+}
+
+// add is used to record the key of a send once its message is enqueued
+func (k *idempotencyKeys) add(queue, key string, now time.Time) {
+	k.seen[[2]string{queue, key}] = now
+	k.order = append(k.order, idempotencyKey{Queue: queue, Key: key, Time: now})
+}
+
+// expire is used to forget the keys used before the window
+// Keys applied out of time order, after a leader with a skewed clock, are kept until the keys before them expire
+func (k *idempotencyKeys) expire(now time.Time) {
+	cutoff := now.Add(-IdempotencyWindow)
+
+	n := 0
+	for n < len(k.order) && !k.order[n].Time.After(cutoff) {
+		delete(k.seen, [2]string{k.order[n].Queue, k.order[n].Key})
+		n++
+	}
+	if n > 0 {
+		k.order = append(k.order[:0:0], k.order[n:]...)
+	}
+}
+
+// list is used to get a copy of the keys in the order they were applied
+func (k *idempotencyKeys) list() []idempotencyKey {
+	return append([]idempotencyKey(nil), k.order...)
+}
+
+// restoreIdempotencyKeys is used to rebuild the keys from a snapshot
+func restoreIdempotencyKeys(keys []idempotencyKey) *idempotencyKeys {
+	k := newIdempotencyKeys()
+	for _, key := range keys {
+		k.seen[[2]string{key.Queue, key.Key}] = key.Time
+		k.order = append(k.order, key)
+	}
+	return k
+}
+
+// keyUsed is used to check whether the idempotency key of a send was already used
+func (s *Store[T]) keyUsed(queue, key string, now time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.keys.used(queue, key, now)
+}
+
+// addKey is used to record the idempotency key of a send
+// It is only recorded once the message is enqueued, so a send that failed to enqueue can be retried with the same key
+func (s *Store[T]) addKey(queue, key string, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.keys.add(queue, key, now)
+}
+
+// SendIdempotent is used to enqueue a message to the named queue at most once for the key
+// A send retried with the same key within IdempotencyWindow is not enqueued again, and reports a duplicate
+// This makes a send that failed with ErrLeadershipLost or a network error safe to retry, an empty key is never deduplicated
+func (s *Store[T]) SendIdempotent(ctx context.Context, queue, key string, data T) (bool, error) {
+	ctx, span := tracer.Start(ctx, "store.Send", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(attribute.String("messaging.destination.name", queueName(queue))))
+	defer span.End()
+
+	if s.consensus.Node.State() != raft.Leader {
+		return false, recordError(span, ErrNotLeader)
+	}
+
+	c := newCommand[T](Send, ds.Message[T]{Data: data, Headers: injectTrace(ctx)})
+	c.Queue = queue
+	c.Key = key
+
+	future, err := s.replicate(ctx, c)
+	if err != nil {
+		return false, recordError(span, err)
+	}
+
+	_, duplicate := future.Response().(duplicateSend)
+	span.SetAttributes(attribute.Bool("messaging.duplicate", duplicate))
+	return duplicate, nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+)
+
+// errEnqueue is the error returned by failingQueues
+var errEnqueue = errors.New("enqueue failed")
+
+// failingQueues are queues that fail to enqueue while fail is set
+type failingQueues[T any] struct {
+	queueStorage[T]
+	fail bool
+}
+
+func (q *failingQueues[T]) enqueue(name string, message ds.Message[T]) error {
+	if q.fail {
+		return errEnqueue
+	}
+	return q.queueStorage.enqueue(name, message)
+}
+
+// sendKey is used to get a send command with an idempotency key, applied at the given time
+func sendKey(value int, key string, at time.Time) *command[int] {
+	c := send(value)
+	c.Key = key
+	c.Timestamp = at
+	return c
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	store := fuzzStore[int]()
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	apply := func(index uint64, c *command[int]) interface{} {
+		return store.Apply(&raft.Log{Index: index, Term: 1, Type: raft.LogCommand, Data: mustEncode(t, c)})
+	}
+
+	if response := apply(1, sendKey(1, "a", start)); response != nil {
+		t.Fatalf("expected the first send to be enqueued, got %v", response)
+	}
+	if _, ok := apply(2, sendKey(2, "a", start.Add(time.Minute))).(duplicateSend); !ok {
+		t.Fatal("expected a send with the same key to be a duplicate")
+	}
+	if response := apply(3, sendKey(3, "", start)); response != nil {
+		t.Fatalf("expected a send without a key to be enqueued, got %v", response)
+	}
+	if response := apply(4, sendKey(3, "", start)); response != nil {
+		t.Fatalf("expected sends without a key to never be duplicates, got %v", response)
+	}
+
+	// The keys survive a snapshot
+	restored := restore[int](t, persist(t, store))
+	if _, ok := restored.Apply(&raft.Log{Index: 5, Data: mustEncode(t, sendKey(4, "a", start.Add(2*time.Minute)))}).(duplicateSend); !ok {
+		t.Fatal("expected the key to be restored from the snapshot")
+	}
+
+	// A key is forgotten once the window has passed
+	if response := apply(5, sendKey(5, "a", start.Add(IdempotencyWindow))); response != nil {
+		t.Fatalf("expected a send after the window to be enqueued, got %v", response)
+	}
+	if n, _ := store.queueLen("numbers"); n != 4 {
+		t.Errorf("expected 4 messages to be enqueued, got %d", n)
+	}
+}
+
+func TestIdempotencyKeysFailedSend(t *testing.T) {
+	store := fuzzStore[int]()
+	queues := &failingQueues[int]{queueStorage: store.queues, fail: true}
+	store.queues = queues
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	apply := func(index uint64, c *command[int]) interface{} {
+		return store.Apply(&raft.Log{Index: index, Term: 1, Type: raft.LogCommand, Data: mustEncode(t, c)})
+	}
+
+	if err, ok := apply(1, sendKey(1, "a", start)).(error); !ok || !errors.Is(err, errEnqueue) {
+		t.Fatalf("expected the send to fail, got %v", err)
+	}
+
+	// The key of the failed send is not recorded, so the retry is enqueued
+	queues.fail = false
+	if response := apply(2, sendKey(1, "a", start.Add(time.Second))); response != nil {
+		t.Fatalf("expected the retried send to be enqueued, got %v", response)
+	}
+	if _, ok := apply(3, sendKey(1, "a", start.Add(2*time.Second))).(duplicateSend); !ok {
+		t.Fatal("expected a send after the retry to be a duplicate")
+	}
+	if n, _ := store.queueLen("numbers"); n != 1 {
+		t.Errorf("expected 1 message to be enqueued, got %d", n)
+	}
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"io"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+	"github.com/kavinaravind/go-raft-message-queue/schema"
+)
+
+// LogCommand is a command decoded from the data of a raft log entry, for inspecting the log of a node
+type LogCommand[T any] struct {
+	// Encoding is the format the command was written to the log with
+	Encoding Encoding
+
+	// Operation is the operation of the command, named by OperationName
+	Operation int
+
+	Queue         string
+	Stream        string
+	Group         string
+	Offset        uint64
+	Key           string
+	Message       ds.Message[T]
+	Retention     ds.Retention
+	Schema        []byte
+	Compatibility string
+	Timestamp     time.Time
+	Hash          *StateHash
+	Member        *Member
+}
+
+// DecodeLogCommand is used to decode the data of a raft log entry written by the store, in any known encoding
+// The message of a command written by an earlier release is converted by the upgrader, which may be nil
+func DecodeLogCommand[T any](data []byte, upgrader *LegacyUpgrader[T]) (*LogCommand[T], error) {
+	c, err := decodeCommand(data, upgrader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogCommand[T]{
+		Encoding:      Encoding(data[0]),
+		Operation:     c.Operation,
+		Queue:         c.Queue,
+		Stream:        c.Stream,
+		Group:         c.Group,
+		Offset:        c.Offset,
+		Key:           c.Key,
+		Message:       c.Message,
+		Retention:     c.Retention,
+		Schema:        c.Schema,
+		Compatibility: c.Compat,
+		Timestamp:     c.Timestamp,
+		Hash:          c.Hash,
+		Member:        c.Member,
+	}, nil
+}
+
+// SnapshotContents is the state held in a snapshot, for inspecting the snapshots of a node
+type SnapshotContents[T any] struct {
+	// Metrics hold the compression and the size of the snapshot before and after compression
+	Metrics SnapshotMetrics
+
+	Queues  map[string]*ds.Queue[T]
+	Streams map[string]*ds.Stream[T]
+	Schemas map[string]*schema.Subject
+
+	// Members are the HTTP addresses registered by the nodes of the cluster, by node id
+	Members map[string]string
+
+	// IdempotencyKeys is the number of idempotency keys within the window
+	IdempotencyKeys int
+
+	// Hash is the state hash as of the snapshot, nil for snapshots written before state hashing
+	Hash *StateHash
+}
+
+// ReadSnapshotContents is used to read a snapshot of any known version, as written by Persist
+// The messages of a snapshot written by an earlier release are converted by the upgrader, which may be nil
+func ReadSnapshotContents[T any](r io.Reader, upgrader *LegacyUpgrader[T]) (*SnapshotContents[T], error) {
+	state, metrics, err := readSnapshotInto(r, nil, upgrader)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := &SnapshotContents[T]{
+		Metrics:         metrics,
+		Queues:          state.Queues,
+		Streams:         state.Streams,
+		Schemas:         state.Schemas.Subjects,
+		Members:         state.members,
+		IdempotencyKeys: len(state.keys),
+	}
+	if state.hash != nil {
+		contents.Hash = &state.hash.Current
+	}
+	if contents.Members == nil {
+		contents.Members = map[string]string{}
+	}
+	return contents, nil
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+)
+
+// LegacyUpgrader is used to convert the messages written by an earlier release that held another type of message
+// Such messages decode into the zero value of T without error, so they are read again as the earlier type
+// The store knows neither type, so the upgrader is registered by the caller, see SetLegacyUpgrader
+type LegacyUpgrader[T any] struct {
+	// command is used to convert the JSON data of the message of a JSON command
+	command func(raw json.RawMessage, data *T) error
+
+	// snapshot is used to read a version 0 snapshot holding messages of the earlier type
+	snapshot func(r io.Reader) (*snapshotState[T], error)
+}
+
+// NewLegacyUpgrader is used to create an upgrader from messages of type L to messages of type T
+// The command function converts the raw JSON data of a command message that decoded into the zero value, and
+// leaves it as it is when the data is not of the earlier type. The upgrade function converts each message of a
+// version 0 snapshot, which gob decodes as type L, so L should hold the fields of both types
+func NewLegacyUpgrader[T, L any](command func(raw json.RawMessage, data *T) error, upgrade func(L) (T, error)) *LegacyUpgrader[T] {
+	return &LegacyUpgrader[T]{
+		command: command,
+		snapshot: func(r io.Reader) (*snapshotState[T], error) {
+			legacy, err := decodeLegacySnapshot[L](r)
+			if err != nil {
+				return nil, err
+			}
+			state, err := upgradeLegacyState(legacy, upgrade)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert messages: %w", err)
+			}
+			return state.normalize(), nil
+		},
+	}
+}
+
+// upgradeCommand is used to convert the message of a JSON command written by an earlier release, if any
+func (u *LegacyUpgrader[T]) upgradeCommand(data []byte, c *command[T]) error {
+	if u == nil || !reflect.ValueOf(&c.Message.Data).Elem().IsZero() {
+		return nil
+	}
+
+	var raw struct {
+		Message struct {
+			Data json.RawMessage
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw.Message.Data) == 0 {
+		return nil
+	}
+	return u.command(raw.Message.Data, &c.Message.Data)
+}
+
+// readSnapshot is used to read a version 0 snapshot, holding messages of the earlier type if there is an upgrader
+func (u *LegacyUpgrader[T]) readSnapshot(r io.Reader) (*snapshotState[T], error) {
+	if u == nil {
+		return decodeLegacySnapshot[T](r)
+	}
+	return u.snapshot(r)
+}
+
+// upgradeLegacyState is used to convert the messages of a version 0 snapshot
+func upgradeLegacyState[L, T any](legacy *snapshotState[L], upgrade func(L) (T, error)) (*snapshotState[T], error) {
+	state := &snapshotState[T]{
+		Queues:  make(map[string]*ds.Queue[T], len(legacy.Queues)),
+		Streams: make(map[string]*ds.Stream[T], len(legacy.Streams)),
+		Schemas: legacy.Schemas,
+	}
+	for name, queue := range legacy.Queues {
+		converted := ds.NewQueue[T]()
+		for _, message := range queue.Messages {
+			data, err := upgrade(message.Data)
+			if err != nil {
+				return nil, err
+			}
+			converted.Messages = append(converted.Messages, ds.Message[T]{Data: data, Headers: message.Headers})
+		}
+		state.Queues[name] = converted
+	}
+	for name, stream := range legacy.Streams {
+		converted := &ds.Stream[T]{
+			NextOffset:  stream.NextOffset,
+			Groups:      stream.Groups,
+			SegmentSize: stream.SegmentSize,
+			Retention:   stream.Retention,
+		}
+		for _, segment := range stream.Segments {
+			entries := make([]ds.StreamEntry[T], 0, len(segment.Entries))
+			for _, entry := range segment.Entries {
+				data, err := upgrade(entry.Data)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, ds.StreamEntry[T]{Offset: entry.Offset, Timestamp: entry.Timestamp, Data: data})
+			}
+			converted.Segments = append(converted.Segments, ds.Segment[T]{BaseOffset: segment.BaseOffset, Entries: entries})
+		}
+		state.Streams[name] = converted
+	}
+	return state, nil
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+	"github.com/kavinaravind/go-raft-message-queue/model"
+)
+
+// The files in testdata/legacy were written by the store when it only held comments:
+// baseline-* by the first release, and streams-* by the release that added streams
+
+// legacyComments are the comments held by the files in testdata/legacy
+var legacyComments = func() []model.Comment {
+	timestamp := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	return []model.Comment{
+		{Timestamp: &timestamp, Author: "Alice", Content: "first"},
+		{Author: "Bob", Content: "second"},
+	}
+}()
+
+// legacyUpgrader converts the comments held by the files in testdata/legacy to JSON payloads, as the node does
+var legacyUpgrader = NewLegacyUpgrader(model.UpgradeLegacyPayload, model.LegacyData.Payload)
+
+// legacyStore is used to create a store that converts legacy comments
+func legacyStore() *Store[model.Payload] {
+	store := fuzzStore[model.Payload]()
+	store.SetLegacyUpgrader(legacyUpgrader)
+	return store
+}
+
+// legacyPayload is used to get the payload a legacy comment is converted to
+func legacyPayload(t *testing.T, comment model.Comment) model.Payload {
+	t.Helper()
+
+	payload, err := model.NewJSONPayload(comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+// replayLegacyLog is used to apply each line of a legacy log to the store, returning the responses
+func replayLegacyLog(t *testing.T, store *Store[model.Payload], name string) []interface{} {
+	t.Helper()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var responses []interface{}
+	for i, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		response := store.Apply(&raft.Log{Index: uint64(i + 1), Term: 1, Data: line})
+		if err, ok := response.(error); ok {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+// snapshotOf is used to read back the state of the store from a snapshot of it
+func snapshotOf(t *testing.T, store *Store[model.Payload]) *snapshotState[model.Payload] {
+	t.Helper()
+
+	state, _, err := readSnapshot[model.Payload](bytes.NewReader(persist(t, store)))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	return state
+}
+
+func TestLegacyLog(t *testing.T) {
+	t.Run("Queue", func(t *testing.T) {
+		store := legacyStore()
+		responses := replayLegacyLog(t, store, "testdata/legacy/baseline-log.jsonl")
+
+		// The log sends both comments and receives the first
+		received, ok := responses[2].(ds.Message[model.Payload])
+		if !ok || !bytes.Equal(received.Data.Body, legacyPayload(t, legacyComments[0]).Body) {
+			t.Errorf("expected the first comment to be received, got %v", responses[2])
+		}
+
+		messages := snapshotOf(t, store).Queues[DefaultQueue].Messages
+		if len(messages) != 1 || !bytes.Equal(messages[0].Data.Body, legacyPayload(t, legacyComments[1]).Body) {
+			t.Errorf("expected the second comment to be queued, got %v", messages)
+		}
+		if messages[0].Data.ContentType != model.JSONContentType {
+			t.Errorf("expected a JSON payload, got %q", messages[0].Data.ContentType)
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		store := legacyStore()
+		replayLegacyLog(t, store, "testdata/legacy/streams-log.jsonl")
+
+		entries := snapshotOf(t, store).Streams["events"].Read(0, 10)
+		if len(entries) != 1 || !bytes.Equal(entries[0].Data.Body, legacyPayload(t, legacyComments[0]).Body) {
+			t.Errorf("expected the first comment to be appended, got %v", entries)
+		}
+	})
+
+	t.Run("Payload", func(t *testing.T) {
+		// Commands that carry a payload or no data at all are left as they are
+		for _, data := range []string{
+			`{"operation":0,"message":{"Data":{"contentType":"text/plain","body":"aGk="}}}`,
+			`{"operation":1,"message":{"Data":{}}}`,
+		} {
+			c, err := decodeCommand([]byte(data), legacyUpgrader)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if c.Message.Data.ContentType == model.JSONContentType {
+				t.Errorf("expected %s to be decoded as it is, got %+v", data, c.Message.Data)
+			}
+		}
+	})
+}
+
+func TestLegacySnapshot(t *testing.T) {
+	for _, name := range []string{"baseline-snapshot.gob", "streams-snapshot.gob"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/legacy/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The restored store is snapshotted again so the comments are read back as payloads
+			store := legacyStore()
+			if err := store.Restore(io.NopCloser(bytes.NewReader(data))); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			state := snapshotOf(t, store)
+
+			queue := state.Queues[DefaultQueue]
+			if len(queue.Messages) == 0 {
+				t.Fatal("expected the queued comments to be restored")
+			}
+			for i, message := range queue.Messages {
+				if expected := legacyPayload(t, legacyComments[i]); message.Data.ContentType != expected.ContentType || !bytes.Equal(message.Data.Body, expected.Body) {
+					t.Errorf("expected %s, got %s", expected.Body, message.Data.Body)
+				}
+			}
+
+			if name != "streams-snapshot.gob" {
+				return
+			}
+			stream, ok := state.Streams["events"]
+			if !ok {
+				t.Fatal("expected the stream to be restored")
+			}
+			entries := stream.Read(0, 10)
+			if len(entries) != 2 || !bytes.Equal(entries[1].Data.Body, legacyPayload(t, legacyComments[1]).Body) {
+				t.Errorf("expected the appended comments, got %v", entries)
+			}
+			if offset, ok := stream.Offset("readers"); !ok || offset != 1 {
+				t.Errorf("expected the consumer group offset to be restored, got %d, %v", offset, ok)
+			}
+		})
+	}
+}
+
+func TestLegacySnapshotPayloads(t *testing.T) {
+	// Version 0 snapshots written after opaque payloads hold them as they are
+	queue := ds.NewQueue[model.Payload]()
+	queue.Enqueue(ds.Message[model.Payload]{Data: model.NewPayload("text/plain", []byte("hi"))})
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(queue); err != nil {
+		t.Fatal(err)
+	}
+
+	state, _, err := readSnapshotInto(&buf, nil, legacyUpgrader)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	messages := state.Queues[DefaultQueue].Messages
+	if len(messages) != 1 || messages[0].Data.ContentType != "text/plain" || string(messages[0].Data.Body) != "hi" {
+		t.Errorf("expected the payload to be kept, got %v", messages)
+	}
+}
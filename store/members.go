@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+)
+
+// Member is a node of the cluster along with the address its HTTP server is reached at
+type Member struct {
+	// ID is the raft server id of the node
+	ID string
+
+	// Address is the HTTP address of the node, empty if the node has not registered one
+	Address string
+}
+
+// Server is a server in the raft configuration of the cluster
+type Server struct {
+	Member
+
+	// RaftAddress is the address of the raft transport of the node
+	RaftAddress string
+
+	// Voter is whether the node votes in elections, rather than only replicating the log
+	Voter bool
+
+	// Leader is whether the node is the current leader as known by this node
+	Leader bool
+}
+
+// SetAdvertiseAddress is used to set the HTTP address this node registers with the cluster
+// The node registers it whenever it becomes the leader, it must be called before Initialize
+func (s *Store[T]) SetAdvertiseAddress(address string) {
+	s.advertiseAddress = address
+}
+
+// RegisterMember is used to replicate the HTTP address of a node, so that every node can direct clients to it
+func (s *Store[T]) RegisterMember(id, address string) error {
+	c := newCommand[T](RegisterMember, ds.Message[T]{})
+	c.Member = &Member{ID: id, Address: address}
+
+	_, err := s.apply(context.Background(), c)
+	return err
+}
+
+// Leader is used to get the current leader of the cluster as known by this node
+// The address is empty if the leader has not registered one, and ok is false if there is no known leader
+func (s *Store[T]) Leader() (Member, bool) {
+	if s.consensus == nil {
+		return Member{}, false
+	}
+
+	_, id := s.consensus.Node.LeaderWithID()
+	if id == "" {
+		return Member{}, false
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return Member{ID: string(id), Address: s.members[string(id)]}, true
+}
+
+// Servers is used to get the servers in the latest raft configuration along with their HTTP addresses
+// The configuration is read from this node, so it can be called on any node of the cluster
+func (s *Store[T]) Servers() ([]Server, error) {
+	future := s.consensus.Node.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, translateError(err)
+	}
+	_, leader := s.consensus.Node.LeaderWithID()
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var servers []Server
+	for _, server := range future.Configuration().Servers {
+		servers = append(servers, Server{
+			Member:      Member{ID: string(server.ID), Address: s.members[string(server.ID)]},
+			RaftAddress: string(server.Address),
+			Voter:       server.Suffrage == raft.Voter,
+			Leader:      server.ID == leader,
+		})
+	}
+	return servers, nil
+}
+
+// IsMember is used to check whether this node is in the latest raft configuration
+// The configuration is restored from the raft log on startup, so a restarted node is a member without joining again
+func (s *Store[T]) IsMember() (bool, error) {
+	future := s.consensus.Node.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return false, translateError(err)
+	}
+
+	for _, server := range future.Configuration().Servers {
+		if string(server.ID) == s.consensus.ID() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// registerMember is used to record the address of a node, an empty address removes it
+func (s *Store[T]) registerMember(member Member) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if member.Address == "" {
+		delete(s.members, member.ID)
+		return
+	}
+	s.members[member.ID] = member.Address
+}
+
+// runAdvertise is used to register the advertise address of this node every time it becomes the leader
+// Followers register through the join request, the leader registers itself as no node joins it
+func (s *Store[T]) runAdvertise(ctx context.Context, id string) {
+	observations := make(chan raft.Observation, 1)
+	observer := raft.NewObserver(observations, false, func(o *raft.Observation) bool {
+		_, ok := o.Data.(raft.LeaderObservation)
+		return ok
+	})
+	s.consensus.Node.RegisterObserver(observer)
+	defer s.consensus.Node.DeregisterObserver(observer)
+
+	// The node may have become the leader before the observer was registered
+	advertise := func() {
+		if s.consensus.Node.State() != raft.Leader {
+			return
+		}
+		s.lock.RLock()
+		registered := s.members[id]
+		s.lock.RUnlock()
+		if registered == s.advertiseAddress {
+			return
+		}
+		if err := s.RegisterMember(id, s.advertiseAddress); err != nil {
+			s.logger.Warn("Failed to register advertise address", "error", err)
+		}
+	}
+	advertise()
+
+	// Leadership is also checked periodically, as observations are dropped while the channel is full
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-observations:
+			advertise()
+		case <-ticker.C:
+			advertise()
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package store
+
+import (
+	"maps"
+	"testing"
+)
+
+// register is used to get a command recording the HTTP address of a node
+func register(id, address string) *command[int] {
+	return &command[int]{Operation: RegisterMember, Member: &Member{ID: id, Address: address}}
+}
+
+func TestMembers(t *testing.T) {
+	store := fuzzStore[int]()
+	applyAll(t, store, 1, register("node1", "localhost:3000"), register("node2", "localhost:3010"), register("node2", ""))
+
+	expected := map[string]string{"node1": "localhost:3000"}
+	if !maps.Equal(store.members, expected) {
+		t.Fatalf("expected the members %v, got %v", expected, store.members)
+	}
+
+	// The members survive a snapshot, and a snapshot without them restores none
+	if restored := restore[int](t, persist(t, store)); !maps.Equal(restored.members, expected) {
+		t.Errorf("expected the restored members %v, got %v", expected, restored.members)
+	}
+	if restored := restore[int](t, persist(t, fuzzStore[int]())); restored.members == nil || len(restored.members) != 0 {
+		t.Errorf("expected no restored members, got %v", restored.members)
+	}
+}
@@ -0,0 +1,266 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsNamespace is the prefix of every prometheus metric exported by the message queue
+const MetricsNamespace = "raftmq"
+
+// storeMetrics are the prometheus metrics updated as the store applies commands
+type storeMetrics struct {
+	// enqueued and dequeued count the messages applied to each queue
+	enqueued *prometheus.CounterVec
+	dequeued *prometheus.CounterVec
+
+	// apply is the latency of commands from being submitted by the leader to being applied
+	apply *prometheus.HistogramVec
+
+	// fsmApply is the time the fsm takes to apply each log entry
+	fsmApply *prometheus.HistogramVec
+
+	// snapshotPersist and snapshotRestore are the time taken to persist and restore snapshots
+	snapshotPersist prometheus.Histogram
+	snapshotRestore prometheus.Histogram
+}
+
+// newStoreMetrics creates the metrics of a store, they are exported once registered
+func newStoreMetrics() *storeMetrics {
+	return &storeMetrics{
+		enqueued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "messages_enqueued_total",
+			Help:      "Number of messages enqueued to each queue.",
+		}, []string{"queue"}),
+		dequeued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "messages_dequeued_total",
+			Help:      "Number of messages dequeued from each queue.",
+		}, []string{"queue"}),
+		apply: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "apply_duration_seconds",
+			Help:      "Time from the leader submitting a command to raft until it is applied, by operation.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+		}, []string{"operation"}),
+		fsmApply: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "fsm_apply_duration_seconds",
+			Help:      "Time taken by the state machine to apply a log entry, by operation.",
+			Buckets:   prometheus.ExponentialBuckets(0.000001, 4, 12),
+		}, []string{"operation"}),
+		snapshotPersist: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "snapshot_persist_duration_seconds",
+			Help:      "Time taken to persist a snapshot.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+		}),
+		snapshotRestore: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "snapshot_restore_duration_seconds",
+			Help:      "Time taken to restore a snapshot.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+		}),
+	}
+}
+
+// OperationName is used to get the name of an operation, as used in metric labels and by inspection
+func OperationName(operation int) string {
+	switch operation {
+	case Send:
+		return "send"
+	case Recieve:
+		return "recieve"
+	case Append:
+		return "append"
+	case Commit:
+		return "commit"
+	case Retain:
+		return "retain"
+	case RegisterSchema:
+		return "register_schema"
+	case DeleteSchema:
+		return "delete_schema"
+	case Check:
+		return "check"
+	case RegisterMember:
+		return "register_member"
+	case CreateQueue:
+		return "create_queue"
+	case DeleteQueue:
+		return "delete_queue"
+	case PurgeQueue:
+		return "purge_queue"
+	case SetCompatibility:
+		return "set_compatibility"
+	default:
+		return "unknown"
+	}
+}
+
+// RegisterMetrics is used to export the metrics of the store, they are read from the store on every scrape
+func (s *Store[T]) RegisterMetrics(registerer prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{
+		s.metrics.enqueued,
+		s.metrics.dequeued,
+		s.metrics.apply,
+		s.metrics.fsmApply,
+		s.metrics.snapshotPersist,
+		s.metrics.snapshotRestore,
+		&storeCollector[T]{store: s},
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The descriptions of the metrics read from the store when scraped
+var (
+	queueDepthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "", "queue_depth"),
+		"Number of messages in each queue.",
+		[]string{"queue"}, nil,
+	)
+	streamEntriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "", "stream_entries"),
+		"Number of entries retained by each stream.",
+		[]string{"stream"}, nil,
+	)
+	streamLagDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "", "stream_consumer_lag"),
+		"Number of retained entries each consumer group has yet to commit, which are in flight or unread.",
+		[]string{"stream", "group"}, nil,
+	)
+	raftStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "raft", "state"),
+		"Raft state of the node, the current state is 1 and the others are 0.",
+		[]string{"state"}, nil,
+	)
+	raftTermDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "raft", "term"),
+		"Current raft term of the node.",
+		nil, nil,
+	)
+	raftLastIndexDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "raft", "last_index"),
+		"Index of the last entry in the raft log of the node.",
+		nil, nil,
+	)
+	raftCommitIndexDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "raft", "commit_index"),
+		"Index of the last entry known to be committed by the node.",
+		nil, nil,
+	)
+	raftAppliedIndexDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "raft", "applied_index"),
+		"Index of the last entry applied to the store of the node.",
+		nil, nil,
+	)
+	snapshotSizeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "snapshot", "size_bytes"),
+		"Size of the last snapshot persisted, before compression.",
+		nil, nil,
+	)
+	snapshotCompressedSizeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "snapshot", "compressed_size_bytes"),
+		"Size of the last snapshot persisted, after compression.",
+		nil, nil,
+	)
+	stateHashDivergedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(MetricsNamespace, "state_hash", "diverged"),
+		"Set to 1 once the state hash of the node has differed from the leader's.",
+		nil, nil,
+	)
+)
+
+// raftStates are the states reported by the raft state metric
+var raftStates = []raft.RaftState{raft.Follower, raft.Candidate, raft.Leader, raft.Shutdown}
+
+// storeCollector is used to read the state of the store when the metrics are scraped
+type storeCollector[T any] struct {
+	store *Store[T]
+}
+
+// Describe is used to implement the prometheus collector interface
+func (c *storeCollector[T]) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		queueDepthDesc,
+		streamEntriesDesc,
+		streamLagDesc,
+		raftStateDesc,
+		raftTermDesc,
+		raftLastIndexDesc,
+		raftCommitIndexDesc,
+		raftAppliedIndexDesc,
+		snapshotSizeDesc,
+		snapshotCompressedSizeDesc,
+		stateHashDivergedDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect is used to implement the prometheus collector interface
+func (c *storeCollector[T]) Collect(ch chan<- prometheus.Metric) {
+	s := c.store
+
+	for _, name := range s.queues.names() {
+		if depth, ok := s.queues.len(name); ok {
+			ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(depth), name)
+		}
+	}
+
+	s.lock.RLock()
+	for name, st := range s.streams {
+		ch <- prometheus.MustNewConstMetric(streamEntriesDesc, prometheus.GaugeValue, float64(st.Len()), name)
+		for group, lag := range st.Lags() {
+			ch <- prometheus.MustNewConstMetric(streamLagDesc, prometheus.GaugeValue, float64(lag), name, group)
+		}
+	}
+	s.lock.RUnlock()
+
+	if s.consensus != nil {
+		node := s.consensus.Node
+		state := node.State()
+		for _, st := range raftStates {
+			value := 0.0
+			if st == state {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(raftStateDesc, prometheus.GaugeValue, value, strings.ToLower(st.String()))
+		}
+		if term, err := strconv.ParseUint(node.Stats()["term"], 10, 64); err == nil {
+			ch <- prometheus.MustNewConstMetric(raftTermDesc, prometheus.GaugeValue, float64(term))
+		}
+		ch <- prometheus.MustNewConstMetric(raftLastIndexDesc, prometheus.GaugeValue, float64(node.LastIndex()))
+		ch <- prometheus.MustNewConstMetric(raftCommitIndexDesc, prometheus.GaugeValue, float64(node.CommitIndex()))
+		ch <- prometheus.MustNewConstMetric(raftAppliedIndexDesc, prometheus.GaugeValue, float64(node.AppliedIndex()))
+	}
+
+	metrics := s.SnapshotMetrics()
+	ch <- prometheus.MustNewConstMetric(snapshotSizeDesc, prometheus.GaugeValue, float64(metrics.Size))
+	ch <- prometheus.MustNewConstMetric(snapshotCompressedSizeDesc, prometheus.GaugeValue, float64(metrics.CompressedSize))
+
+	diverged := 0.0
+	if s.Divergence() != nil {
+		diverged = 1
+	}
+	ch <- prometheus.MustNewConstMetric(stateHashDivergedDesc, prometheus.GaugeValue, diverged)
+}
+
+// observeApply is used to record the latency of a command submitted by the leader
+func (s *Store[T]) observeApply(operation int, start time.Time) {
+	s.metrics.apply.WithLabelValues(OperationName(operation)).Observe(time.Since(start).Seconds())
+}
+
+// observeFSMApply is used to record the time taken by the fsm to apply a log entry
+func (s *Store[T]) observeFSMApply(operation int, start time.Time) {
+	s.metrics.fsmApply.WithLabelValues(OperationName(operation)).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,298 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+)
+
+// Storage is the engine used to hold the messages of the named queues
+type Storage string
+
+const (
+	// StorageMemory holds every message in memory
+	StorageMemory Storage = "memory"
+
+	// StorageBolt holds messages in a bbolt database, with only the queue indexes in memory
+	StorageBolt Storage = "bolt"
+)
+
+// ParseStorage is used to parse the name of a storage engine
+func ParseStorage(name string) (Storage, error) {
+	switch storage := Storage(name); storage {
+	case StorageMemory, StorageBolt:
+		return storage, nil
+	default:
+		return "", fmt.Errorf("unknown storage %q", name)
+	}
+}
+
+// queueStorage is where the messages of the named queues are kept
+// It is only modified by the fsm, so calls are never concurrent with each other
+type queueStorage[T any] interface {
+	// enqueue is used to add a message to the end of the named queue, creating it if needed
+	enqueue(name string, message ds.Message[T]) error
+
+	// dequeue is used to remove the message at the front of the named queue
+	dequeue(name string) (ds.Message[T], bool, error)
+
+	// len is used to get the number of messages in the named queue
+	len(name string) (int, bool)
+
+	// peek is used to get up to max messages from the front of the named queue without removing them
+	// Unlike the other methods it is called outside the fsm, so it may be concurrent with them
+	peek(name string, max int) ([]ds.Message[T], bool, error)
+
+	// create is used to add an empty queue, it reports whether the queue did not exist
+	create(name string) (bool, error)
+
+	// remove is used to delete the named queue and its messages, it reports whether the queue existed
+	remove(name string) (bool, error)
+
+	// purge is used to delete the messages of the named queue, and returns how many were deleted
+	purge(name string) (int, bool, error)
+
+	// names is used to list the queues, sorted by name
+	names() []string
+
+	// digest is used to get the digest of the messages held in the named queue, zero if it holds none
+	// It is only called when a check command is applied, so it may take time in the number of messages
+	digest(name string) (messageDigest, error)
+
+	// view is used to take a consistent view of every queue, for a snapshot to persist
+	view() (queueView[T], error)
+
+	// restore is used to replace every queue with the queues written to a loader by load
+	restore(load func(queueLoader[T]) error) error
+
+	// close is used to release the resources held by the storage
+	close() error
+}
+
+// persistentQueues is a queue storage that keeps its queues across restarts
+// Every change is written along with the position of the log entry that made it, see Store.Resume
+type persistentQueues interface {
+	// advance is used to set the position of the log entry being applied
+	advance(index, term uint64)
+
+	// applied is used to get the index and term of the last log entry that changed the queues
+	applied() (uint64, uint64, error)
+
+	// discard is used to replace the queues with empty ones, along with the position they were applied up to
+	discard() error
+
+	// begin is used to write the changes of the log entries applied until commit together, see Store.ApplyBatch
+	begin()
+
+	// commit is used to write the changes made since begin, the queues are as they were before begin if it fails
+	commit() error
+}
+
+// queueView is a consistent, read-only view of the named queues
+type queueView[T any] interface {
+	// names is used to list the queues in the view, sorted by name
+	names() []string
+
+	// each is used to call f with every message of the named queue, from front to back
+	each(name string, f func(ds.Message[T]) error) error
+
+	// release is used to release the view once it has been persisted
+	release()
+}
+
+// queueLoader is used to load queues restored from a snapshot
+type queueLoader[T any] interface {
+	// create is used to add an empty queue
+	create(name string) error
+
+	// enqueue is used to add a message to the end of a created queue
+	enqueue(name string, message ds.Message[T]) error
+}
+
+// queueMap is a set of queues held in memory, it is both a view and a loader
+type queueMap[T any] map[string]*ds.Queue[T]
+
+func (m queueMap[T]) names() []string {
+	return sortedKeys(m)
+}
+
+func (m queueMap[T]) each(name string, f func(ds.Message[T]) error) error {
+	queue, ok := m[name]
+	if !ok {
+		return nil
+	}
+	for _, message := range queue.Messages {
+		if err := f(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m queueMap[T]) release() {}
+
+func (m queueMap[T]) create(name string) error {
+	m[name] = ds.NewQueue[T]()
+	return nil
+}
+
+func (m queueMap[T]) enqueue(name string, message ds.Message[T]) error {
+	queue, ok := m[name]
+	if !ok {
+		return fmt.Errorf("queue %q was not created", name)
+	}
+	queue.Messages = append(queue.Messages, message)
+	return nil
+}
+
+// memoryQueues is the storage that holds every message in memory
+type memoryQueues[T any] struct {
+	queues queueMap[T]
+	lock   sync.RWMutex
+}
+
+// newMemoryQueues creates a new in-memory storage with an empty default queue
+func newMemoryQueues[T any]() *memoryQueues[T] {
+	return &memoryQueues[T]{
+		queues: queueMap[T]{DefaultQueue: ds.NewQueue[T]()},
+	}
+}
+
+func (m *memoryQueues[T]) enqueue(name string, message ds.Message[T]) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	queue, ok := m.queues[name]
+	if !ok {
+		queue = ds.NewQueue[T]()
+		m.queues[name] = queue
+	}
+	queue.Enqueue(message)
+	return nil
+}
+
+func (m *memoryQueues[T]) dequeue(name string) (ds.Message[T], bool, error) {
+	queue, ok := m.get(name)
+	if !ok {
+		return ds.Message[T]{}, false, nil
+	}
+	message, ok := queue.Dequeue()
+	return message, ok, nil
+}
+
+func (m *memoryQueues[T]) len(name string) (int, bool) {
+	queue, ok := m.get(name)
+	if !ok {
+		return 0, false
+	}
+	return queue.Len(), true
+}
+
+func (m *memoryQueues[T]) peek(name string, max int) ([]ds.Message[T], bool, error) {
+	queue, ok := m.get(name)
+	if !ok {
+		return nil, false, nil
+	}
+	return queue.Peek(max), true, nil
+}
+
+func (m *memoryQueues[T]) create(name string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.queues[name]; ok {
+		return false, nil
+	}
+	m.queues[name] = ds.NewQueue[T]()
+	return true, nil
+}
+
+func (m *memoryQueues[T]) remove(name string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.queues[name]; !ok {
+		return false, nil
+	}
+	delete(m.queues, name)
+	return true, nil
+}
+
+// purge is used to replace the queue with an empty one, so that views of the queue are unchanged
+func (m *memoryQueues[T]) purge(name string) (int, bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	queue, ok := m.queues[name]
+	if !ok {
+		return 0, false, nil
+	}
+	m.queues[name] = ds.NewQueue[T]()
+	return queue.Len(), true, nil
+}
+
+func (m *memoryQueues[T]) names() []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.queues.names()
+}
+
+// digest is used to digest every message of the named queue, encoded as they are in bbolt
+func (m *memoryQueues[T]) digest(name string) (messageDigest, error) {
+	var digest messageDigest
+	queue, ok := m.get(name)
+	if !ok {
+		return digest, nil
+	}
+	for _, message := range queue.Copy().Messages {
+		value, err := encodeMessage(message)
+		if err != nil {
+			return messageDigest{}, err
+		}
+		digest.add(value)
+	}
+	return digest, nil
+}
+
+// get is used to look up a queue by name
+func (m *memoryQueues[T]) get(name string) (*ds.Queue[T], bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	queue, ok := m.queues[name]
+	return queue, ok
+}
+
+// view is used to copy every queue, which shares their messages so takes constant time per queue
+func (m *memoryQueues[T]) view() (queueView[T], error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	view := make(queueMap[T], len(m.queues))
+	for name, queue := range m.queues {
+		view[name] = queue.Copy()
+	}
+	return view, nil
+}
+
+func (m *memoryQueues[T]) restore(load func(queueLoader[T]) error) error {
+	queues := queueMap[T]{}
+	if err := load(queues); err != nil {
+		return err
+	}
+	if _, ok := queues[DefaultQueue]; !ok {
+		queues[DefaultQueue] = ds.NewQueue[T]()
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.queues = queues
+	return nil
+}
+
+func (m *memoryQueues[T]) close() error {
+	return nil
+}
@@ -0,0 +1,774 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-msgpack/v2/codec"
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// metaBucket holds the name of the generation of queues in use and the position of the log they were applied up to
+	metaBucket = []byte("meta")
+
+	// activeKey is the key of the active generation in the meta bucket
+	activeKey = []byte("active")
+
+	// appliedKey is the key of the index and term of the last log entry that changed the queues, in the meta bucket
+	appliedKey = []byte("applied")
+
+	// generations are the root buckets that queues are kept in
+	// A restore loads into the inactive generation, then switches to it in a single transaction
+	generations = [2][]byte{[]byte("queues-0"), []byte("queues-1")}
+
+	// indexBuckets hold the index and digest of each queue of the generation with the same number
+	indexBuckets = [2][]byte{[]byte("indexes-0"), []byte("indexes-1")}
+)
+
+// boltInitialMmapSize is the size of the memory map reserved up front
+// A write that grows the map must wait for every read transaction to finish,
+// so reserving address space keeps a snapshot being persisted from blocking the fsm
+// Once the database outgrows it, a write that grows the map again waits for the snapshot being persisted,
+// and the fsm stalls until the snapshot is written
+const boltInitialMmapSize = 1 << 30
+
+// boltLoadBatchSize is the number of messages loaded in each transaction of a restore
+const boltLoadBatchSize = 10000
+
+// queueIndex is the range of keys holding the messages of a queue
+// Messages are keyed by big endian sequence numbers from head up to, but not including, tail
+type queueIndex struct {
+	head uint64
+	tail uint64
+}
+
+// queueRecordSize is the size of the index and digest of a queue as stored in an index bucket
+const queueRecordSize = 16 + 32
+
+// boltQueues is the storage that holds messages in a bbolt database
+// Each queue is a bucket keyed by sequence number, only the index of each queue is held in memory
+type boltQueues[T any] struct {
+	db      *bolt.DB
+	active  int
+	indexes map[string]*queueIndex
+	digests map[string]*messageDigest
+	lock    sync.RWMutex
+
+	// position is the index and term of the log entry being applied, written along with every change to the queues
+	position [2]uint64
+
+	// batching is set while a batch of log entries is applied, see begin
+	batching bool
+
+	// batch is the write transaction holding the changes of the batch, it is begun by the first change
+	batch *bolt.Tx
+
+	// changed is the position of the last entry of the batch that changed the queues
+	changed [2]uint64
+}
+
+// openBoltQueues opens the bbolt storage at the given path, creating it if needed
+// Changes are synced along with the position of the last log entry that made one, so a node that restarts
+// keeps its queues and only applies the entries after that position, see Store.Resume
+// A database written before the position was kept is replaced by an empty one
+func openBoltQueues[T any](path string) (*boltQueues[T], error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{
+		Timeout:         time.Second,
+		NoFreelistSync:  true,
+		FreelistType:    bolt.FreelistMapType,
+		InitialMmapSize: boltInitialMmapSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket(metaBucket); meta != nil && meta.Get(appliedKey) != nil {
+			return nil
+		}
+		return resetBolt(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	b := &boltQueues[T]{db: db}
+	if err := b.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// resetBolt is used to replace every bucket of the database with an empty generation of queues
+func resetBolt(tx *bolt.Tx) error {
+	for _, name := range [][]byte{metaBucket, generations[0], generations[1], indexBuckets[0], indexBuckets[1]} {
+		if err := tx.DeleteBucket(name); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+	}
+
+	meta, err := tx.CreateBucket(metaBucket)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucket(generations[0]); err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucket(indexBuckets[0]); err != nil {
+		return err
+	}
+	if err := meta.Put(activeKey, generations[0]); err != nil {
+		return err
+	}
+	return meta.Put(appliedKey, encodePosition(0, 0))
+}
+
+// load is used to read the active generation and the index and digest of each of its queues
+func (b *boltQueues[T]) load() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.reload()
+}
+
+// reload is used to read the queues as they were last committed, the caller must hold the write lock
+func (b *boltQueues[T]) reload() error {
+	b.active = 0
+	b.indexes = map[string]*queueIndex{}
+	b.digests = map[string]*messageDigest{}
+	return b.db.View(func(tx *bolt.Tx) error {
+		if bytes.Equal(tx.Bucket(metaBucket).Get(activeKey), generations[1]) {
+			b.active = 1
+		}
+		indexes := tx.Bucket(indexBuckets[b.active])
+		if indexes == nil {
+			return fmt.Errorf("index bucket %s is missing from the database", indexBuckets[b.active])
+		}
+		return indexes.ForEach(func(name, value []byte) error {
+			index, digest, err := decodeQueueRecord(value)
+			if err != nil {
+				return fmt.Errorf("queue %q: %w", name, err)
+			}
+			b.indexes[string(name)] = &index
+			b.digests[string(name)] = &digest
+			return nil
+		})
+	})
+}
+
+// advance is used to set the position of the log entry being applied
+func (b *boltQueues[T]) advance(index, term uint64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.position = [2]uint64{index, term}
+}
+
+// applied is used to get the index and term of the last log entry that changed the queues
+func (b *boltQueues[T]) applied() (uint64, uint64, error) {
+	var index, term uint64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		index, term, err = decodePosition(tx.Bucket(metaBucket).Get(appliedKey))
+		return err
+	})
+	return index, term, err
+}
+
+// discard is used to replace the queues with empty ones, along with the position they were applied up to
+func (b *boltQueues[T]) discard() error {
+	if err := b.db.Update(resetBolt); err != nil {
+		return err
+	}
+	return b.load()
+}
+
+// begin is used to write the changes of the log entries applied until commit in a single transaction
+func (b *boltQueues[T]) begin() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.batching = true
+}
+
+// commit is used to sync the changes of the batch, along with the position of the last entry that made one
+// When it fails, the queues are reloaded as they were before the batch
+func (b *boltQueues[T]) commit() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	tx := b.batch
+	b.batching, b.batch = false, nil
+	if tx == nil {
+		return nil
+	}
+
+	err := tx.Bucket(metaBucket).Put(appliedKey, encodePosition(b.changed[0], b.changed[1]))
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		if reloadErr := b.reload(); reloadErr != nil {
+			return errors.Join(err, reloadErr)
+		}
+	}
+	return err
+}
+
+// update is used to write a change to the queues, along with the position of the entry being applied
+// During a batch the change is written to the transaction of the batch, which is only synced by commit,
+// so fn must make every check that can fail before it writes anything
+// The caller must hold the write lock
+func (b *boltQueues[T]) update(fn func(tx *bolt.Tx) error) error {
+	if !b.batching {
+		return b.db.Update(func(tx *bolt.Tx) error {
+			if err := fn(tx); err != nil {
+				return err
+			}
+			return tx.Bucket(metaBucket).Put(appliedKey, encodePosition(b.position[0], b.position[1]))
+		})
+	}
+
+	if b.batch == nil {
+		tx, err := b.db.Begin(true)
+		if err != nil {
+			return err
+		}
+		b.batch = tx
+	}
+	if err := fn(b.batch); err != nil {
+		return err
+	}
+	b.changed = b.position
+	return nil
+}
+
+// putQueue is used to write the index and digest of a queue
+func (b *boltQueues[T]) putQueue(tx *bolt.Tx, name string, index queueIndex, digest messageDigest) error {
+	return tx.Bucket(indexBuckets[b.active]).Put([]byte(name), encodeQueueRecord(index, digest))
+}
+
+func (b *boltQueues[T]) enqueue(name string, message ds.Message[T]) error {
+	value, err := encodeMessage(message)
+	if err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var index queueIndex
+	if current, ok := b.indexes[name]; ok {
+		index = *current
+	}
+	digest := b.queueDigest(name)
+	digest.add(value)
+
+	err = b.update(func(tx *bolt.Tx) error {
+		queue, err := tx.Bucket(generations[b.active]).CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+		if err := queue.Put(sequenceKey(index.tail), value); err != nil {
+			return err
+		}
+		index.tail++
+		return b.putQueue(tx, name, index, digest)
+	})
+	if err != nil {
+		return err
+	}
+
+	b.indexes[name] = &index
+	b.digests[name] = &digest
+	return nil
+}
+
+func (b *boltQueues[T]) dequeue(name string) (ds.Message[T], bool, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	index, ok := b.indexes[name]
+	if !ok || index.head == index.tail {
+		return ds.Message[T]{}, false, nil
+	}
+
+	var message ds.Message[T]
+	digest := b.queueDigest(name)
+	err := b.update(func(tx *bolt.Tx) error {
+		queue := tx.Bucket(generations[b.active]).Bucket([]byte(name))
+		if queue == nil {
+			return fmt.Errorf("queue %q is missing from the database", name)
+		}
+
+		key := sequenceKey(index.head)
+		value := queue.Get(key)
+		if value == nil {
+			return fmt.Errorf("queue %q is missing message %d", name, index.head)
+		}
+		if err := decodeMessage(value, &message); err != nil {
+			return err
+		}
+		digest.remove(value)
+		if err := queue.Delete(key); err != nil {
+			return err
+		}
+		return b.putQueue(tx, name, queueIndex{head: index.head + 1, tail: index.tail}, digest)
+	})
+	if err != nil {
+		return ds.Message[T]{}, false, err
+	}
+
+	index.head++
+	b.digests[name] = &digest
+	return message, true, nil
+}
+
+func (b *boltQueues[T]) len(name string) (int, bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	index, ok := b.indexes[name]
+	if !ok {
+		return 0, name == DefaultQueue
+	}
+	return int(index.tail - index.head), true
+}
+
+func (b *boltQueues[T]) peek(name string, max int) ([]ds.Message[T], bool, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	index, ok := b.indexes[name]
+	if !ok {
+		return nil, name == DefaultQueue, nil
+	}
+
+	var messages []ds.Message[T]
+	err := b.db.View(func(tx *bolt.Tx) error {
+		queue := tx.Bucket(generations[b.active]).Bucket([]byte(name))
+		if queue == nil {
+			return nil
+		}
+
+		cursor := queue.Cursor()
+		for key, value := cursor.Seek(sequenceKey(index.head)); key != nil && len(messages) < max; key, value = cursor.Next() {
+			var message ds.Message[T]
+			if err := decodeMessage(value, &message); err != nil {
+				return err
+			}
+			messages = append(messages, message)
+		}
+		return nil
+	})
+	return messages, true, err
+}
+
+func (b *boltQueues[T]) create(name string) (bool, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if _, ok := b.indexes[name]; ok {
+		return false, nil
+	}
+
+	err := b.update(func(tx *bolt.Tx) error {
+		if _, err := tx.Bucket(generations[b.active]).CreateBucketIfNotExists([]byte(name)); err != nil {
+			return err
+		}
+		return b.putQueue(tx, name, queueIndex{}, messageDigest{})
+	})
+	if err != nil {
+		return false, err
+	}
+
+	b.indexes[name] = &queueIndex{}
+	return name != DefaultQueue, nil
+}
+
+// remove is used to delete the bucket of the queue
+func (b *boltQueues[T]) remove(name string) (bool, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if _, ok := b.indexes[name]; !ok {
+		return false, nil
+	}
+
+	err := b.update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(generations[b.active]).DeleteBucket([]byte(name))
+		if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+		return tx.Bucket(indexBuckets[b.active]).Delete([]byte(name))
+	})
+	if err != nil {
+		return false, err
+	}
+
+	delete(b.indexes, name)
+	delete(b.digests, name)
+	return true, nil
+}
+
+// purge is used to replace the bucket of the queue with an empty one
+func (b *boltQueues[T]) purge(name string) (int, bool, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	index, ok := b.indexes[name]
+	if !ok {
+		return 0, name == DefaultQueue, nil
+	}
+
+	err := b.update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(generations[b.active])
+		if err := root.DeleteBucket([]byte(name)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+		if _, err := root.CreateBucket([]byte(name)); err != nil {
+			return err
+		}
+		return b.putQueue(tx, name, queueIndex{}, messageDigest{})
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	purged := int(index.tail - index.head)
+	b.indexes[name] = &queueIndex{}
+	delete(b.digests, name)
+	return purged, true, nil
+}
+
+// digest is used to get the digest of the named queue, which is kept up to date as messages are written
+func (b *boltQueues[T]) digest(name string) (messageDigest, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.queueDigest(name), nil
+}
+
+// queueDigest is used to get a copy of the digest of the named queue, the caller must hold the lock
+func (b *boltQueues[T]) queueDigest(name string) messageDigest {
+	if digest, ok := b.digests[name]; ok {
+		return *digest
+	}
+	return messageDigest{}
+}
+
+// names is used to list the queues with an index, along with the default queue which always exists
+func (b *boltQueues[T]) names() []string {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	names := sortedKeys(b.indexes)
+	if _, ok := b.indexes[DefaultQueue]; !ok {
+		i := sort.SearchStrings(names, DefaultQueue)
+		names = append(names[:i], append([]string{DefaultQueue}, names[i:]...)...)
+	}
+	return names
+}
+
+// view is used to begin a read transaction, which sees the queues as they are now
+// until it is released, however many messages are applied in the meantime
+func (b *boltQueues[T]) view() (queueView[T], error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	tx, err := b.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	return &boltView[T]{tx: tx, root: tx.Bucket(generations[b.active])}, nil
+}
+
+// restore is used to load the queues into the inactive generation, in batches so that
+// memory use is bounded, then to switch to it once every queue has been loaded
+// The position of the snapshot is not known to the fsm, so the queues are recorded as applied up to no entry
+// until the next change, and a node that restarts before then restores them from its latest snapshot again
+func (b *boltQueues[T]) restore(load func(queueLoader[T]) error) error {
+	b.lock.RLock()
+	inactive := 1 - b.active
+	b.lock.RUnlock()
+
+	loader := &boltLoader[T]{db: b.db, root: generations[inactive], indexes: map[string]*queueIndex{}, digests: map[string]*messageDigest{}}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(loader.root); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+		_, err := tx.CreateBucket(loader.root)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := load(loader); err != nil {
+		loader.rollback()
+		return err
+	}
+	if err := loader.commit(); err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(indexBuckets[inactive]); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+		indexes, err := tx.CreateBucket(indexBuckets[inactive])
+		if err != nil {
+			return err
+		}
+		for name, index := range loader.indexes {
+			if err := indexes.Put([]byte(name), encodeQueueRecord(*index, loader.digest(name))); err != nil {
+				return err
+			}
+		}
+
+		meta := tx.Bucket(metaBucket)
+		if err := meta.Put(activeKey, generations[inactive]); err != nil {
+			return err
+		}
+		if err := meta.Put(appliedKey, encodePosition(0, 0)); err != nil {
+			return err
+		}
+		if err := tx.DeleteBucket(indexBuckets[b.active]); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+		return tx.DeleteBucket(generations[b.active])
+	})
+	if err != nil {
+		return err
+	}
+
+	b.active = inactive
+	b.indexes = loader.indexes
+	b.digests = loader.digests
+	return nil
+}
+
+func (b *boltQueues[T]) close() error {
+	return b.db.Close()
+}
+
+// boltView is a read transaction over the active generation of queues
+type boltView[T any] struct {
+	tx   *bolt.Tx
+	root *bolt.Bucket
+}
+
+func (v *boltView[T]) names() []string {
+	var names []string
+	v.root.ForEach(func(name, _ []byte) error {
+		names = append(names, string(name))
+		return nil
+	})
+	return names
+}
+
+func (v *boltView[T]) each(name string, f func(ds.Message[T]) error) error {
+	queue := v.root.Bucket([]byte(name))
+	if queue == nil {
+		return nil
+	}
+
+	cursor := queue.Cursor()
+	for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+		var message ds.Message[T]
+		if err := decodeMessage(value, &message); err != nil {
+			return err
+		}
+		if err := f(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *boltView[T]) release() {
+	v.tx.Rollback()
+}
+
+// boltLoader is used to write restored queues, committing every boltLoadBatchSize messages
+type boltLoader[T any] struct {
+	db      *bolt.DB
+	root    []byte
+	tx      *bolt.Tx
+	pending int
+	indexes map[string]*queueIndex
+	digests map[string]*messageDigest
+}
+
+func (l *boltLoader[T]) create(name string) error {
+	tx, err := l.begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Bucket(l.root).CreateBucketIfNotExists([]byte(name)); err != nil {
+		return err
+	}
+	if _, ok := l.indexes[name]; !ok {
+		l.indexes[name] = &queueIndex{}
+	}
+	return nil
+}
+
+func (l *boltLoader[T]) enqueue(name string, message ds.Message[T]) error {
+	index, ok := l.indexes[name]
+	if !ok {
+		return fmt.Errorf("queue %q was not created", name)
+	}
+
+	value, err := encodeMessage(message)
+	if err != nil {
+		return err
+	}
+
+	tx, err := l.begin()
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(l.root).Bucket([]byte(name)).Put(sequenceKey(index.tail), value); err != nil {
+		return err
+	}
+	index.tail++
+
+	digest, ok := l.digests[name]
+	if !ok {
+		digest = &messageDigest{}
+		l.digests[name] = digest
+	}
+	digest.add(value)
+
+	l.pending++
+	if l.pending >= boltLoadBatchSize {
+		return l.commit()
+	}
+	return nil
+}
+
+// digest is used to get the digest of the messages loaded into the named queue
+func (l *boltLoader[T]) digest(name string) messageDigest {
+	if digest, ok := l.digests[name]; ok {
+		return *digest
+	}
+	return messageDigest{}
+}
+
+// begin is used to get the open transaction, beginning one if needed
+func (l *boltLoader[T]) begin() (*bolt.Tx, error) {
+	if l.tx != nil {
+		return l.tx, nil
+	}
+	tx, err := l.db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	l.tx = tx
+	return tx, nil
+}
+
+// commit is used to commit the open transaction, if any
+func (l *boltLoader[T]) commit() error {
+	if l.tx == nil {
+		return nil
+	}
+	err := l.tx.Commit()
+	l.tx = nil
+	l.pending = 0
+	return err
+}
+
+// rollback is used to discard the open transaction, if any
+func (l *boltLoader[T]) rollback() {
+	if l.tx != nil {
+		l.tx.Rollback()
+		l.tx = nil
+	}
+}
+
+// sequenceKey is used to encode a sequence number so that keys sort in order
+func sequenceKey(sequence uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, sequence)
+}
+
+// encodePosition is used to encode the index and term of a log entry
+func encodePosition(index, term uint64) []byte {
+	return binary.BigEndian.AppendUint64(binary.BigEndian.AppendUint64(nil, index), term)
+}
+
+// decodePosition is used to decode the index and term of a log entry
+func decodePosition(value []byte) (uint64, uint64, error) {
+	if len(value) != 16 {
+		return 0, 0, fmt.Errorf("invalid applied position of %d bytes", len(value))
+	}
+	return binary.BigEndian.Uint64(value), binary.BigEndian.Uint64(value[8:]), nil
+}
+
+// encodeQueueRecord is used to encode the index and digest of a queue
+func encodeQueueRecord(index queueIndex, digest messageDigest) []byte {
+	value := make([]byte, 0, queueRecordSize)
+	value = binary.BigEndian.AppendUint64(value, index.head)
+	value = binary.BigEndian.AppendUint64(value, index.tail)
+	for _, lane := range digest {
+		value = binary.BigEndian.AppendUint64(value, lane)
+	}
+	return value
+}
+
+// decodeQueueRecord is used to decode the index and digest of a queue
+func decodeQueueRecord(value []byte) (queueIndex, messageDigest, error) {
+	if len(value) != queueRecordSize {
+		return queueIndex{}, messageDigest{}, fmt.Errorf("invalid index of %d bytes", len(value))
+	}
+	index := queueIndex{head: binary.BigEndian.Uint64(value), tail: binary.BigEndian.Uint64(value[8:])}
+	var digest messageDigest
+	for i := range digest {
+		digest[i] = binary.BigEndian.Uint64(value[16+i*8:])
+	}
+	return index, digest, nil
+}
+
+// encodeMessage is used to encode a message stored in bbolt, which is also the encoding messages are digested in
+func encodeMessage[T any](message ds.Message[T]) ([]byte, error) {
+	return encodeValue(message)
+}
+
+// encodeValue is used to encode a value in the canonical msgpack encoding
+// The value is copied out of the pooled buffer, as bbolt holds on to it until the transaction commits
+func encodeValue(value any) ([]byte, error) {
+	e := encoders.Get().(*msgpackEncoder)
+	defer encoders.Put(e)
+
+	e.buf = e.buf[:0]
+	e.enc.ResetBytes(&e.buf)
+	if err := e.enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), e.buf...), nil
+}
+
+// decodeMessage is used to decode a message stored in bbolt
+// Decoded values are copied, so they remain valid after the transaction ends
+func decodeMessage[T any](value []byte, message *ds.Message[T]) error {
+	dec := decoders.Get().(*codec.Decoder)
+	defer decoders.Put(dec)
+
+	dec.ResetBytes(value)
+	return dec.Decode(message)
+}
@@ -0,0 +1,413 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+	bolt "go.etcd.io/bbolt"
+)
+
+// storages is used to run a test against every queue storage
+func storages(t *testing.T) map[Storage]func() queueStorage[int] {
+	return map[Storage]func() queueStorage[int]{
+		StorageMemory: func() queueStorage[int] {
+			return newMemoryQueues[int]()
+		},
+		StorageBolt: func() queueStorage[int] {
+			queues, err := openBoltQueues[int](filepath.Join(t.TempDir(), "queues.db"))
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			t.Cleanup(func() { queues.close() })
+			return queues
+		},
+	}
+}
+
+// drain is used to dequeue every message of the named queue
+func drain(t *testing.T, queues queueStorage[int], name string) []int {
+	t.Helper()
+
+	var data []int
+	for {
+		message, ok, err := queues.dequeue(name)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if !ok {
+			return data
+		}
+		data = append(data, message.Data)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestQueueStorage(t *testing.T) {
+	for storage, open := range storages(t) {
+		t.Run(string(storage), func(t *testing.T) {
+			queues := open()
+
+			if n, ok := queues.len(DefaultQueue); !ok || n != 0 {
+				t.Errorf("expected empty default queue, got %d, %v", n, ok)
+			}
+			if _, ok := queues.len("missing"); ok {
+				t.Error("expected missing queue not to exist")
+			}
+			if _, ok, err := queues.dequeue("missing"); ok || err != nil {
+				t.Errorf("expected nothing from missing queue, got %v, %v", ok, err)
+			}
+
+			for i := 1; i <= 3; i++ {
+				if err := queues.enqueue("numbers", ds.Message[int]{Data: i}); err != nil {
+					t.Fatalf("expected no error, got: %v", err)
+				}
+			}
+			if n, _ := queues.len("numbers"); n != 3 {
+				t.Errorf("expected 3 messages, got %d", n)
+			}
+
+			// The view is unaffected by messages applied after it was taken
+			view, err := queues.view()
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			queues.enqueue("numbers", ds.Message[int]{Data: 4})
+			message, _, _ := queues.dequeue("numbers")
+			if message.Data != 1 {
+				t.Errorf("expected 1, got %d", message.Data)
+			}
+
+			var viewed []int
+			view.each("numbers", func(message ds.Message[int]) error {
+				viewed = append(viewed, message.Data)
+				return nil
+			})
+			view.release()
+			if !equalInts(viewed, []int{1, 2, 3}) {
+				t.Errorf("expected view of [1 2 3], got %v", viewed)
+			}
+
+			if data := drain(t, queues, "numbers"); !equalInts(data, []int{2, 3, 4}) {
+				t.Errorf("expected [2 3 4], got %v", data)
+			}
+		})
+	}
+}
+
+func TestQueueStorageAdmin(t *testing.T) {
+	for storage, open := range storages(t) {
+		t.Run(string(storage), func(t *testing.T) {
+			queues := open()
+
+			if created, err := queues.create("numbers"); err != nil || !created {
+				t.Fatalf("expected the queue to be created, got %v, %v", created, err)
+			}
+			if created, err := queues.create("numbers"); err != nil || created {
+				t.Errorf("expected the existing queue not to be created, got %v, %v", created, err)
+			}
+			if n, ok := queues.len("numbers"); !ok || n != 0 {
+				t.Errorf("expected an empty queue, got %d, %v", n, ok)
+			}
+
+			for i := 1; i <= 3; i++ {
+				queues.enqueue("numbers", ds.Message[int]{Data: i})
+			}
+			queues.dequeue("numbers")
+
+			// Peeking does not remove messages, and starts from the front of the queue
+			for _, test := range []struct {
+				max      int
+				expected []int
+			}{{1, []int{2}}, {5, []int{2, 3}}} {
+				messages, ok, err := queues.peek("numbers", test.max)
+				if err != nil || !ok {
+					t.Fatalf("expected messages, got %v, %v", ok, err)
+				}
+				var data []int
+				for _, message := range messages {
+					data = append(data, message.Data)
+				}
+				if !equalInts(data, test.expected) {
+					t.Errorf("expected %v, got %v", test.expected, data)
+				}
+			}
+			if _, ok, err := queues.peek("missing", 1); ok || err != nil {
+				t.Errorf("expected nothing from missing queue, got %v, %v", ok, err)
+			}
+
+			// A purged queue remains, and takes new messages
+			if n, ok, err := queues.purge("numbers"); err != nil || !ok || n != 2 {
+				t.Fatalf("expected 2 messages purged, got %d, %v, %v", n, ok, err)
+			}
+			if _, ok, _ := queues.purge("missing"); ok {
+				t.Error("expected missing queue not to be purged")
+			}
+			queues.enqueue("numbers", ds.Message[int]{Data: 4})
+			if data := drain(t, queues, "numbers"); !equalInts(data, []int{4}) {
+				t.Errorf("expected [4], got %v", data)
+			}
+
+			if removed, err := queues.remove("numbers"); err != nil || !removed {
+				t.Fatalf("expected the queue to be removed, got %v, %v", removed, err)
+			}
+			if removed, err := queues.remove("numbers"); err != nil || removed {
+				t.Errorf("expected the removed queue not to be removed again, got %v, %v", removed, err)
+			}
+			if _, ok := queues.len("numbers"); ok {
+				t.Error("expected the removed queue not to exist")
+			}
+		})
+	}
+}
+
+func TestQueueStorageRestore(t *testing.T) {
+	for storage, open := range storages(t) {
+		t.Run(string(storage), func(t *testing.T) {
+			queues := open()
+			queues.enqueue("old", ds.Message[int]{Data: 1})
+
+			// A failed restore leaves the queues untouched
+			err := queues.restore(func(loader queueLoader[int]) error {
+				loader.create("new")
+				loader.enqueue("new", ds.Message[int]{Data: 2})
+				return errors.New("failed")
+			})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if n, ok := queues.len("old"); !ok || n != 1 {
+				t.Errorf("expected old queue to remain, got %d, %v", n, ok)
+			}
+
+			// Enough messages to span several batches
+			count := 2*boltLoadBatchSize + 1
+			err = queues.restore(func(loader queueLoader[int]) error {
+				if err := loader.create("new"); err != nil {
+					return err
+				}
+				for i := 0; i < count; i++ {
+					if err := loader.enqueue("new", ds.Message[int]{Data: i}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			if _, ok := queues.len("old"); ok {
+				t.Error("expected old queue to be replaced")
+			}
+			if n, ok := queues.len(DefaultQueue); !ok || n != 0 {
+				t.Errorf("expected empty default queue, got %d, %v", n, ok)
+			}
+			if n, _ := queues.len("new"); n != count {
+				t.Errorf("expected %d messages, got %d", count, n)
+			}
+			data := drain(t, queues, "new")
+			if len(data) != count || data[0] != 0 || data[count-1] != count-1 {
+				t.Errorf("expected %d messages in order, got %d", count, len(data))
+			}
+
+			// Messages enqueued after a restore follow the restored ones
+			queues.enqueue("new", ds.Message[int]{Data: 5})
+			if data := drain(t, queues, "new"); !equalInts(data, []int{5}) {
+				t.Errorf("expected [5], got %v", data)
+			}
+		})
+	}
+}
+
+func TestQueueStorageSnapshot(t *testing.T) {
+	for storage, open := range storages(t) {
+		t.Run(string(storage), func(t *testing.T) {
+			queues := open()
+			queues.enqueue(DefaultQueue, ds.Message[int]{Data: 1})
+			queues.enqueue("numbers", ds.Message[int]{Data: 2})
+			queues.enqueue("numbers", ds.Message[int]{Data: 3})
+
+			view, err := queues.view()
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			defer view.release()
+
+			var buf bytes.Buffer
+			if _, err := writeSnapshot(&buf, &snapshotState[int]{view: view}, CompressionNone); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			// Restore into a storage of the same kind, as well as into memory
+			restored := open()
+			err = restored.restore(func(loader queueLoader[int]) error {
+				_, _, err := readSnapshotInto[int](bytes.NewReader(buf.Bytes()), loader, nil)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if data := drain(t, restored, "numbers"); !equalInts(data, []int{2, 3}) {
+				t.Errorf("expected [2 3], got %v", data)
+			}
+			if data := drain(t, restored, DefaultQueue); !equalInts(data, []int{1}) {
+				t.Errorf("expected [1], got %v", data)
+			}
+
+			state, _, err := readSnapshot[int](&buf)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if state.Queues["numbers"].Len() != 2 || state.Queues[DefaultQueue].Len() != 1 {
+				t.Errorf("expected queues to be read into memory, got %v", state.Queues)
+			}
+		})
+	}
+}
+
+func TestBoltQueuesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queues.db")
+	reopen := func(queues *boltQueues[int]) *boltQueues[int] {
+		t.Helper()
+
+		if queues != nil {
+			queues.close()
+		}
+		queues, err := openBoltQueues[int](path)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		return queues
+	}
+
+	queues := reopen(nil)
+	queues.advance(3, 1)
+	queues.enqueue("numbers", ds.Message[int]{Data: 1})
+	queues.enqueue("numbers", ds.Message[int]{Data: 2})
+	queues.create("empty")
+	queues.advance(4, 2)
+	queues.dequeue("numbers")
+	digest, _ := queues.digest("numbers")
+
+	// The queues are kept along with the position of the last change
+	queues = reopen(queues)
+	if index, term, err := queues.applied(); err != nil || index != 4 || term != 2 {
+		t.Errorf("expected the queues to be applied up to 4 in term 2, got %d in term %d, %v", index, term, err)
+	}
+	if names := queues.names(); !slices.Equal(names, []string{DefaultQueue, "empty", "numbers"}) {
+		t.Errorf("expected the queues to be kept, got %v", names)
+	}
+	if kept, _ := queues.digest("numbers"); kept != digest {
+		t.Error("expected the digest of the queue to be kept")
+	}
+	queues.enqueue("numbers", ds.Message[int]{Data: 3})
+	if data := drain(t, queues, "numbers"); !equalInts(data, []int{2, 3}) {
+		t.Errorf("expected [2 3], got %v", data)
+	}
+
+	// The position of a restored snapshot is unknown, so it is reset
+	err := queues.restore(func(loader queueLoader[int]) error {
+		if err := loader.create("restored"); err != nil {
+			return err
+		}
+		return loader.enqueue("restored", ds.Message[int]{Data: 4})
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	queues = reopen(queues)
+	if index, _, _ := queues.applied(); index != 0 {
+		t.Errorf("expected the position to be reset by the restore, got %d", index)
+	}
+	if data := drain(t, queues, "restored"); !equalInts(data, []int{4}) {
+		t.Errorf("expected [4], got %v", data)
+	}
+
+	// A database written before the position was kept is replaced
+	queues.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Delete(appliedKey)
+	})
+	queues = reopen(queues)
+	defer queues.close()
+	if names := queues.names(); !slices.Equal(names, []string{DefaultQueue}) {
+		t.Errorf("expected the queues to be replaced, got %v", names)
+	}
+}
+
+func TestStoreBolt(t *testing.T) {
+	store := NewStore[int](slog.Default())
+	store.SetStorage(StorageBolt)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	shutdownComplete, err := store.Initialize(ctx, testConfig(t.TempDir()))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case <-shutdownComplete:
+		case <-time.After(5 * time.Second):
+			t.Error("timeout waiting for shutdown to complete")
+		}
+	})
+
+	if err := store.WaitForNodeToBeLeader(5 * time.Second); err != nil {
+		t.Fatalf("expected node1 to be leader, got: %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err := store.Send("numbers", i); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	if msg, err := store.Recieve("numbers"); err != nil || msg.Data != 1 {
+		t.Fatalf("expected 1, got %v, %v", msg, err)
+	}
+
+	snapshot, err := store.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	sink := &MockSnapshotSink{}
+	if err := snapshot.Persist(sink); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	snapshot.Release()
+
+	// Drain the queue, then restore it from the snapshot
+	store.Recieve("numbers")
+	store.Recieve("numbers")
+	if err := store.Restore(io.NopCloser(&sink.buffer)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	for _, expected := range []int{2, 3, 0} {
+		msg, err := store.Recieve("numbers")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if msg.Data != expected {
+			t.Errorf("expected %d, got %d", expected, msg.Data)
+		}
+	}
+}
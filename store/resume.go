@@ -0,0 +1,112 @@
+package store
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+)
+
+// resumePoint is the position the persisted queues were applied up to when the node started
+type resumePoint struct {
+	// index is the last log entry that changed the persisted queues, queue commands up to it are not applied again
+	index uint64
+
+	// snapshot is the index of the snapshot raft restores on start, the persisted queues are kept rather than replaced by it
+	snapshot uint64
+
+	// pending is set until that snapshot has been restored
+	pending bool
+}
+
+// Resume is used to keep the queues persisted by the storage when the node starts, it is called before raft
+// restores the latest snapshot and replays the log. The queues are kept when they were applied up to an entry
+// that is part of the snapshot or the log, and queue commands up to that entry are then skipped as they are
+// replayed. Queues that are behind the snapshot are replaced when it is restored, and queues that are ahead of
+// both, such as when the raft data was lost, are discarded so the node is rebuilt from the cluster
+func (s *Store[T]) Resume(snapshot *raft.SnapshotMeta, logs raft.LogStore) error {
+	queues, ok := s.queues.(persistentQueues)
+	if !ok {
+		return nil
+	}
+
+	index, term, err := queues.applied()
+	if err != nil {
+		return err
+	}
+	if index == 0 {
+		return nil
+	}
+
+	var snapshotIndex uint64
+	if snapshot != nil {
+		snapshotIndex = snapshot.Index
+	}
+	if index < snapshotIndex {
+		s.logger.Info("Restoring queues from the latest snapshot", "applied", index, "snapshot", snapshotIndex)
+		return nil
+	}
+
+	if !inLog(index, term, snapshot, logs) {
+		s.logger.Warn("Discarding queues that are ahead of the raft log", "applied", index, "term", term)
+		return queues.discard()
+	}
+
+	s.logger.Info("Resuming persisted queues", "applied", index, "snapshot", snapshotIndex)
+	s.resume = resumePoint{index: index, snapshot: snapshotIndex, pending: snapshot != nil}
+
+	// The state hash folds the response to each entry, which is not known for the entries replayed before the
+	// resume point as they leave the queues unchanged, so the hash is unknown until the next check
+	if snapshot == nil {
+		s.hasher.restore(nil)
+	}
+	return nil
+}
+
+// inLog is used to check that the log entry at the index has the term, in either the snapshot or the log
+func inLog(index, term uint64, snapshot *raft.SnapshotMeta, logs raft.LogStore) bool {
+	if snapshot != nil && snapshot.Index == index {
+		return snapshot.Term == term
+	}
+
+	var entry raft.Log
+	if err := logs.GetLog(index, &entry); err != nil {
+		return false
+	}
+	return entry.Term == term
+}
+
+// replayedQueues are the queues seen by log entries replayed up to the resume point
+// The persisted queues already hold the changes of those entries, so every change is dropped
+type replayedQueues[T any] struct {
+	queueStorage[T]
+}
+
+func (replayedQueues[T]) enqueue(name string, message ds.Message[T]) error {
+	return nil
+}
+
+func (replayedQueues[T]) dequeue(name string) (ds.Message[T], bool, error) {
+	return ds.Message[T]{}, false, nil
+}
+
+func (replayedQueues[T]) create(name string) (bool, error) {
+	return false, nil
+}
+
+func (replayedQueues[T]) remove(name string) (bool, error) {
+	return true, nil
+}
+
+func (replayedQueues[T]) purge(name string) (int, bool, error) {
+	return 0, true, nil
+}
+
+// queuesAt is used to get the queues the log entry is applied to, and to record its position with persisted queues
+func (s *Store[T]) queuesAt(log *raft.Log) queueStorage[T] {
+	if log.Index <= s.resume.index {
+		return replayedQueues[T]{s.queues}
+	}
+	if queues, ok := s.queues.(persistentQueues); ok {
+		queues.advance(log.Index, log.Term)
+	}
+	return s.queues
+}
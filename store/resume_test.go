@@ -0,0 +1,243 @@
+package store
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/consensus"
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+)
+
+// startBolt is used to start a single node store holding its queues in bolt, with raft stores that outlive it
+// The returned function stops the store
+func startBolt(t *testing.T, dir string, stores *consensus.Stores) (*Store[int], func()) {
+	t.Helper()
+
+	store := NewStore[int](slog.New(slog.NewTextHandler(io.Discard, nil)))
+	store.SetStorage(StorageBolt)
+	store.SetHashCheckInterval(0)
+
+	// The transport is closed when the node shuts down, so a new one is created at the same address
+	_, transport := raft.NewInmemTransport("node1")
+	ctx, cancel := context.WithCancel(context.Background())
+	shutdown, err := store.Initialize(ctx, &consensus.Config{
+		IsLeader:      true,
+		ServerID:      "node1",
+		BaseDirectory: dir,
+		Address:       "node1",
+		Transport:     transport,
+		Stores:        stores,
+	})
+	if err != nil {
+		cancel()
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	stop := func() {
+		cancel()
+		select {
+		case <-shutdown:
+		case <-time.After(5 * time.Second):
+			t.Error("timeout waiting for shutdown to complete")
+		}
+	}
+	if err := store.WaitForNodeToBeLeader(5 * time.Second); err != nil {
+		stop()
+		t.Fatalf("expected node1 to be leader, got: %v", err)
+	}
+	return store, stop
+}
+
+// openApplied is used to get the position the bolt queues at the path were applied up to
+func openApplied(t *testing.T, path string) (uint64, uint64) {
+	t.Helper()
+
+	queues, err := openBoltQueues[int](path)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer queues.close()
+
+	index, term, err := queues.applied()
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	return index, term
+}
+
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	inmem := raft.NewInmemStore()
+	stores := &consensus.Stores{Log: inmem, Stable: inmem, Snapshots: raft.NewInmemSnapshotStore()}
+
+	store, stop := startBolt(t, dir, stores)
+	for i := 1; i <= 3; i++ {
+		if err := store.Send("numbers", i); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	if msg, err := store.Recieve("numbers"); err != nil || msg.Data != 1 {
+		t.Fatalf("expected 1, got %v, %v", msg, err)
+	}
+	if err := store.consensus.Node.Snapshot().Error(); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	// The entries after the snapshot are replayed on restart, and must not be applied to the queues again
+	if err := store.Send("numbers", 4); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := store.Append("events", 5); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	applied := store.consensus.Node.AppliedIndex()
+	stop()
+
+	// The queues were persisted up to the last send, the append after it does not change them
+	index, term := openApplied(t, filepath.Join(dir, "queues.db"))
+	if index != applied-1 || term == 0 {
+		t.Fatalf("expected the queues to be applied up to %d, got %d in term %d", applied-1, index, term)
+	}
+
+	store, stop = startBolt(t, dir, stores)
+	defer stop()
+
+	if store.resume.index != index {
+		t.Errorf("expected the store to resume from %d, got %d", index, store.resume.index)
+	}
+	for _, expected := range []int{2, 3, 4, 0} {
+		msg, err := store.Recieve("numbers")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if msg.Data != expected {
+			t.Errorf("expected %d, got %d", expected, msg.Data)
+		}
+	}
+	if entries, err := store.Read("events", 0, 10); err != nil || len(entries) != 1 {
+		t.Errorf("expected the stream to be rebuilt from the log, got %v, %v", entries, err)
+	}
+}
+
+func TestResumePosition(t *testing.T) {
+	// The queues were applied up to index 5 in term 2
+	open := func(t *testing.T) (*Store[int], *boltQueues[int]) {
+		store := fuzzStore[int]()
+		queues, err := openBoltQueues[int](filepath.Join(t.TempDir(), "queues.db"))
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		t.Cleanup(func() { queues.close() })
+		store.queues = queues
+
+		queues.advance(5, 2)
+		if err := queues.enqueue("numbers", ds.Message[int]{Data: 1}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		return store, queues
+	}
+	logs := func(terms ...uint64) raft.LogStore {
+		store := raft.NewInmemStore()
+		for i, term := range terms {
+			store.StoreLog(&raft.Log{Index: uint64(i + 1), Term: term})
+		}
+		return store
+	}
+
+	tests := []struct {
+		name     string
+		snapshot *raft.SnapshotMeta
+		logs     raft.LogStore
+		resume   resumePoint
+		kept     bool
+	}{
+		{"InLog", nil, logs(1, 1, 2, 2, 2, 2), resumePoint{index: 5}, true},
+		{"AtSnapshot", &raft.SnapshotMeta{Index: 5, Term: 2}, logs(), resumePoint{index: 5, snapshot: 5, pending: true}, true},
+		{"AfterSnapshot", &raft.SnapshotMeta{Index: 4, Term: 2}, logs(1, 1, 2, 2, 2), resumePoint{index: 5, snapshot: 4, pending: true}, true},
+		{"BehindSnapshot", &raft.SnapshotMeta{Index: 7, Term: 3}, logs(), resumePoint{}, true},
+		{"AheadOfLog", nil, logs(1, 1, 2), resumePoint{}, false},
+		{"AheadOfSnapshot", &raft.SnapshotMeta{Index: 3, Term: 2}, logs(), resumePoint{}, false},
+		{"OtherTerm", nil, logs(1, 1, 2, 2, 3), resumePoint{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, queues := open(t)
+			if err := store.Resume(test.snapshot, test.logs); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if store.resume != test.resume {
+				t.Errorf("expected to resume from %+v, got %+v", test.resume, store.resume)
+			}
+
+			n, _ := queues.len("numbers")
+			index, _, _ := queues.applied()
+			if test.kept && (n != 1 || index != 5) {
+				t.Errorf("expected the queues to be kept, got %d messages applied up to %d", n, index)
+			}
+			if !test.kept && (n != 0 || index != 0) {
+				t.Errorf("expected the queues to be discarded, got %d messages applied up to %d", n, index)
+			}
+		})
+	}
+}
+
+func TestApplyBatch(t *testing.T) {
+	store := fuzzStore[int]()
+	queues, err := openBoltQueues[int](filepath.Join(t.TempDir(), "queues.db"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	t.Cleanup(func() { queues.close() })
+	store.queues = queues
+
+	// txid is used to get the id of the last transaction committed to the database
+	txid := func() int {
+		tx, err := queues.db.Begin(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		return tx.ID()
+	}
+	entry := func(index uint64, c *command[int]) *raft.Log {
+		return &raft.Log{Index: index, Term: 2, Type: raft.LogCommand, Data: mustEncode(t, c)}
+	}
+
+	before := txid()
+	responses := store.ApplyBatch([]*raft.Log{
+		entry(1, send(1)),
+		entry(2, send(2)),
+		{Index: 3, Term: 2, Type: raft.LogConfiguration},
+		entry(4, &command[int]{Operation: Recieve, Queue: "numbers"}),
+		entry(5, &command[int]{Operation: Append, Stream: "events", Message: ds.Message[int]{Data: 3}}),
+	})
+	if len(responses) != 5 {
+		t.Fatalf("expected a response for each entry, got %v", responses)
+	}
+	if msg, ok := responses[3].(ds.Message[int]); !ok || msg.Data != 1 {
+		t.Errorf("expected 1 to be received, got %v", responses[3])
+	}
+
+	// The queues are written in one transaction, along with the last entry that changed them
+	if n := txid() - before; n != 1 {
+		t.Errorf("expected the batch to be written in one transaction, got %d", n)
+	}
+	if index, term, err := queues.applied(); err != nil || index != 4 || term != 2 {
+		t.Errorf("expected the queues to be applied up to 4 in term 2, got %d in term %d, %v", index, term, err)
+	}
+	if data := drain(t, queues, "numbers"); !equalInts(data, []int{2}) {
+		t.Errorf("expected [2], got %v", data)
+	}
+
+	// A batch that does not change the queues writes nothing
+	before = txid()
+	store.ApplyBatch([]*raft.Log{entry(6, &command[int]{Operation: Append, Stream: "events", Message: ds.Message[int]{Data: 4}})})
+	if n := txid() - before; n != 0 {
+		t.Errorf("expected no transaction, got %d", n)
+	}
+}
@@ -1,28 +1,139 @@
 package store
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
 	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
 
 	"github.com/hashicorp/raft"
 	"github.com/kavinaravind/go-raft-message-queue/ds"
+	"github.com/kavinaravind/go-raft-message-queue/schema"
 )
 
+// snapshotMagic identifies a snapshot written with a header
+var snapshotMagic = [4]byte{'R', 'M', 'Q', 'S'}
+
+// SnapshotVersion is the version of the snapshot format written by Persist
+// Version 0 is the headerless gob stream written before the header existed,
+// version 1 a single checksummed gob body, and version 2 a stream of checksummed records
+const SnapshotVersion uint16 = 2
+
+// snapshotHeaderSize is the size of the header written before the snapshot body
+const snapshotHeaderSize = 20
+
+// crcTable is the table used to checksum snapshot bodies
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrSnapshotChecksum is returned when a snapshot body does not match its checksum
+	ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+
+	// ErrSnapshotVersion is returned when a snapshot was written by a newer version
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+)
+
+// SnapshotHeader is written at the start of every snapshot
+// It is laid out as [magic][version uint16][flags uint16][length uint64][crc32c uint32], big endian
+// Length and checksum cover a version 1 body, version 2 records carry their own checksums
+// The low bits of the flags hold the compression of the version 2 records
+type SnapshotHeader struct {
+	Version  uint16
+	Flags    uint16
+	Length   uint64
+	Checksum uint32
+}
+
+// Compression is used to get the compression of the records following the header
+func (h SnapshotHeader) Compression() Compression {
+	return compressionFromFlags(h.Flags)
+}
+
+// SnapshotMetrics are the measurements of the snapshots persisted and restored by a node
+type SnapshotMetrics struct {
+	// Compression is the compression of the last snapshot
+	Compression Compression
+
+	// Size is the size of the last snapshot before compression
+	Size int64
+
+	// CompressedSize is the size of the last snapshot as written or read
+	CompressedSize int64
+
+	// PersistTime is how long the last snapshot took to persist
+	PersistTime time.Duration
+
+	// RestoreTime is how long the last snapshot took to restore
+	RestoreTime time.Duration
+}
+
+// Ratio is used to get the compression ratio of the last snapshot
+func (m SnapshotMetrics) Ratio() float64 {
+	if m.CompressedSize == 0 {
+		return 0
+	}
+	return float64(m.Size) / float64(m.CompressedSize)
+}
+
+// snapshotState is the body of a snapshot, holding everything distributed across each node
+type snapshotState[T any] struct {
+	Queues  map[string]*ds.Queue[T]
+	Streams map[string]*ds.Stream[T]
+	Schemas *schema.Registry
+
+	// view is written in place of Queues when set, for queues that are not held in memory
+	view queueView[T]
+
+	// hash is the state hash of the store, snapshots written before state hashing have none
+	hash *hashRecord
+
+	// members are the HTTP addresses registered by the nodes of the cluster, by node id
+	members map[string]string
+
+	// keys are the idempotency keys of the sends applied within the window, in the order they were applied
+	keys []idempotencyKey
+}
+
+// queues is used to get the view of the queues to write
+func (s *snapshotState[T]) queues() queueView[T] {
+	if s.view != nil {
+		return s.view
+	}
+	return queueMap[T](s.Queues)
+}
+
 // Snapshot is used to create a snapshot of the queue
 type Snapshot[T any] struct {
-	queue *ds.Queue[T]
+	queues  queueView[T]
+	streams map[string]*ds.Stream[T]
+	schemas *schema.Registry
+	hash    *hashRecord
+	members map[string]string
+	keys    []idempotencyKey
+
+	// compression is the compression of the records written by Persist
+	compression Compression
+
+	// persisted is called with the measurements of a successful Persist, if set
+	persisted func(SnapshotMetrics)
 }
 
 // Persist is used to persist the snapshot to the sink
 func (s *Snapshot[T]) Persist(sink raft.SnapshotSink) error {
-	err := func() error {
-		// Create a gob encoder and encode the queue
-		enc := gob.NewEncoder(sink)
-		if err := enc.Encode(s.queue); err != nil {
-			return err
-		}
-
-		return nil
-	}()
+	start := time.Now()
+	metrics, err := writeSnapshot(sink, &snapshotState[T]{
+		Streams: s.streams,
+		Schemas: s.schemas,
+		view:    s.queues,
+		hash:    s.hash,
+		members: s.members,
+		keys:    s.keys,
+	}, s.compression)
 
 	// If there was an error, cancel the sink and return the error
 	if err != nil {
@@ -31,9 +142,229 @@ func (s *Snapshot[T]) Persist(sink raft.SnapshotSink) error {
 	}
 
 	// Otherwise, close the sink and return any errors
-	return sink.Close()
+	if err := sink.Close(); err != nil {
+		return err
+	}
+
+	metrics.PersistTime = time.Since(start)
+	if s.persisted != nil {
+		s.persisted(metrics)
+	}
+	return nil
 }
 
 // Release is used to release any resources acquired during the snapshot
-// In this case, we don't have any resources to clean up (noop)
-func (s *Snapshot[T]) Release() {}
+// Queues held on disk are read through a transaction that must be released
+func (s *Snapshot[T]) Release() {
+	if s.queues != nil {
+		s.queues.release()
+	}
+}
+
+// writeSnapshot is used to write the header and the records of a snapshot with the given compression
+// The returned metrics hold the size of the records before and after compression
+func writeSnapshot[T any](w io.Writer, state *snapshotState[T], compression Compression) (SnapshotMetrics, error) {
+	metrics := SnapshotMetrics{Compression: compression}
+
+	header := SnapshotHeader{Version: SnapshotVersion, Flags: compression.flags()}
+	if _, err := w.Write(header.marshal()); err != nil {
+		return metrics, err
+	}
+
+	compressed := &countingWriter{w: w}
+	cw, err := compressWriter(compressed, compression)
+	if err != nil {
+		return metrics, err
+	}
+
+	raw := &countingWriter{w: cw}
+	if err := writeSnapshotRecords(raw, state); err != nil {
+		return metrics, err
+	}
+	if err := cw.Close(); err != nil {
+		return metrics, err
+	}
+
+	metrics.Size = raw.n
+	metrics.CompressedSize = compressed.n
+	return metrics, nil
+}
+
+// readSnapshot is used to read a snapshot of any known version, migrating it to the current state
+// The returned metrics hold the compression and the size of the snapshot before and after compression
+func readSnapshot[T any](r io.Reader) (*snapshotState[T], SnapshotMetrics, error) {
+	return readSnapshotInto[T](r, nil, nil)
+}
+
+// readSnapshotInto is used to read a snapshot, writing its queues to the loader rather than the state
+// The messages of a version 0 snapshot are converted by the upgrader, if any
+func readSnapshotInto[T any](r io.Reader, loader queueLoader[T], upgrader *LegacyUpgrader[T]) (*snapshotState[T], SnapshotMetrics, error) {
+	var metrics SnapshotMetrics
+
+	compressed := &countingReader{r: r}
+	br := bufio.NewReader(compressed)
+
+	magic, err := br.Peek(len(snapshotMagic))
+	if err != nil && err != io.EOF {
+		return nil, metrics, err
+	}
+	if !bytes.Equal(magic, snapshotMagic[:]) {
+		state, err := upgrader.readSnapshot(br)
+		metrics.Size, metrics.CompressedSize = compressed.n, compressed.n
+		if err != nil {
+			return nil, metrics, err
+		}
+		return state, metrics, state.load(loader)
+	}
+
+	header, err := ReadSnapshotHeader(br)
+	if err != nil {
+		return nil, metrics, err
+	}
+
+	switch header.Version {
+	case 1:
+		state, err := readSnapshotV1[T](br, header)
+		metrics.Size, metrics.CompressedSize = int64(header.Length), int64(header.Length)
+		if err != nil {
+			return nil, metrics, err
+		}
+		return state, metrics, state.load(loader)
+	case 2:
+		metrics.Compression = header.Compression()
+		dr, err := decompressReader(br, metrics.Compression)
+		if err != nil {
+			return nil, metrics, err
+		}
+		defer dr.Close()
+
+		raw := &countingReader{r: dr}
+		state, err := readSnapshotRecords[T](raw, loader)
+		metrics.Size = raw.n
+		metrics.CompressedSize = compressed.n - snapshotHeaderSize
+		return state, metrics, err
+	default:
+		return nil, metrics, fmt.Errorf("%w: %d", ErrSnapshotVersion, header.Version)
+	}
+}
+
+// ReadSnapshotHeader is used to read and check the header at the start of a snapshot
+func ReadSnapshotHeader(r io.Reader) (SnapshotHeader, error) {
+	buf := make([]byte, snapshotHeaderSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return SnapshotHeader{}, fmt.Errorf("failed to read snapshot header: %w", err)
+	}
+	if !bytes.Equal(buf[:4], snapshotMagic[:]) {
+		return SnapshotHeader{}, errors.New("snapshot header has an invalid magic number")
+	}
+
+	return SnapshotHeader{
+		Version:  binary.BigEndian.Uint16(buf[4:]),
+		Flags:    binary.BigEndian.Uint16(buf[6:]),
+		Length:   binary.BigEndian.Uint64(buf[8:]),
+		Checksum: binary.BigEndian.Uint32(buf[16:]),
+	}, nil
+}
+
+// marshal is used to encode the header
+func (h SnapshotHeader) marshal() []byte {
+	buf := make([]byte, snapshotHeaderSize)
+	copy(buf, snapshotMagic[:])
+	binary.BigEndian.PutUint16(buf[4:], h.Version)
+	binary.BigEndian.PutUint16(buf[6:], h.Flags)
+	binary.BigEndian.PutUint64(buf[8:], h.Length)
+	binary.BigEndian.PutUint32(buf[16:], h.Checksum)
+	return buf
+}
+
+// readSnapshotV1 is used to verify and decode the body of a version 1 snapshot
+func readSnapshotV1[T any](r io.Reader, header SnapshotHeader) (*snapshotState[T], error) {
+	body, err := io.ReadAll(io.LimitReader(r, int64(header.Length)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(body)) != header.Length {
+		return nil, fmt.Errorf("snapshot body is truncated: read %d of %d bytes", len(body), header.Length)
+	}
+	if checksum := crc32.Checksum(body, crcTable); checksum != header.Checksum {
+		return nil, fmt.Errorf("%w: expected %08x, got %08x", ErrSnapshotChecksum, header.Checksum, checksum)
+	}
+
+	var state snapshotState[T]
+	if err := gob.NewDecoder(bytes.NewReader(body)).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	return state.normalize(), nil
+}
+
+// decodeLegacySnapshot is used to decode the gob values of a version 0 snapshot holding messages of type T
+func decodeLegacySnapshot[T any](r io.Reader) (*snapshotState[T], error) {
+	dec := gob.NewDecoder(r)
+
+	// Decode the entire default queue
+	var queue ds.Queue[T]
+	if err := dec.Decode(&queue); err != nil {
+		return nil, fmt.Errorf("failed to decode queue: %w", err)
+	}
+
+	// Decode the streams, snapshots taken before streams existed end here
+	streams := map[string]*ds.Stream[T]{}
+	if err := dec.Decode(&streams); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to decode streams: %w", err)
+	}
+
+	// Decode the named queues, snapshots taken before named queues existed end here
+	queues := map[string]*ds.Queue[T]{}
+	if err := dec.Decode(&queues); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to decode queues: %w", err)
+	}
+	queues[DefaultQueue] = &queue
+
+	// Decode the schema registry, snapshots taken before the registry existed end here
+	schemas := schema.NewRegistry()
+	if err := dec.Decode(schemas); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to decode schemas: %w", err)
+	}
+
+	state := &snapshotState[T]{Queues: queues, Streams: streams, Schemas: schemas}
+	return state.normalize(), nil
+}
+
+// load is used to write the queues of a state decoded in memory to the loader, if any
+func (s *snapshotState[T]) load(loader queueLoader[T]) error {
+	if loader == nil {
+		return nil
+	}
+	for _, name := range sortedKeys(s.Queues) {
+		if err := loader.create(name); err != nil {
+			return err
+		}
+		for _, message := range s.Queues[name].Messages {
+			if err := loader.enqueue(name, message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// normalize is used to replace the empty values gob leaves as nil
+func (s *snapshotState[T]) normalize() *snapshotState[T] {
+	if s.Queues == nil {
+		s.Queues = map[string]*ds.Queue[T]{}
+	}
+	if _, ok := s.Queues[DefaultQueue]; !ok {
+		s.Queues[DefaultQueue] = ds.NewQueue[T]()
+	}
+	if s.Streams == nil {
+		s.Streams = map[string]*ds.Stream[T]{}
+	}
+	if s.Schemas == nil {
+		s.Schemas = schema.NewRegistry()
+	}
+	if s.Schemas.Subjects == nil {
+		s.Schemas.Subjects = map[string]*schema.Subject{}
+	}
+	return s
+}
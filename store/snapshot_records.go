@@ -0,0 +1,435 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	"github.com/hashicorp/go-msgpack/v2/codec"
+	"github.com/kavinaravind/go-raft-message-queue/ds"
+	"github.com/kavinaravind/go-raft-message-queue/schema"
+)
+
+// Kinds of records in a version 2 snapshot body
+const (
+	// recordQueue starts a queue, payload: queueRecord
+	recordQueue byte = iota + 1
+
+	// recordMessages appends to the current queue, payload: a chunk of ds.Message
+	recordMessages
+
+	// recordStream starts a stream, payload: streamRecord
+	recordStream
+
+	// recordSegment starts a segment of the current stream, payload: the base offset
+	recordSegment
+
+	// recordEntries appends to the current segment, payload: a chunk of ds.StreamEntry
+	recordEntries
+
+	// recordSchemas holds the schema registry, payload: schema.Registry
+	recordSchemas
+
+	// recordEnd terminates the body, payload: the number of records before it
+	recordEnd
+
+	// recordHash holds the state hash of the store, payload: hashRecord
+	recordHash
+
+	// recordMembers holds the HTTP addresses of the nodes, payload: a map of node id to address
+	recordMembers
+
+	// recordKeys holds the idempotency keys of recent sends, payload: a list of idempotencyKey
+	recordKeys
+)
+
+// snapshotChunkSize is the encoded size at which a chunk of messages or entries is flushed
+// A single message larger than this is written as a chunk of its own
+const snapshotChunkSize = 1 << 20
+
+// maxRecordSize is the largest record accepted when reading, to bound memory on corruption
+const maxRecordSize = 64 << 20
+
+// queueRecord is the payload of a recordQueue
+type queueRecord struct {
+	Name string
+}
+
+// streamRecord is the payload of a recordStream
+type streamRecord struct {
+	Name        string
+	NextOffset  uint64
+	Groups      map[string]uint64
+	SegmentSize int
+	Retention   ds.Retention
+}
+
+// recordWriter is used to write framed records to a snapshot
+// Each record is laid out as [kind][uvarint length][payload][crc32c of kind and payload]
+// Chunks of messages or entries are laid out as [uvarint count][msgpack value]...
+type recordWriter struct {
+	w       *bufio.Writer
+	enc     *codec.Encoder
+	value   []byte
+	chunk   []byte
+	count   uint64
+	records uint64
+}
+
+// newRecordWriter creates a new record writer
+func newRecordWriter(w io.Writer) *recordWriter {
+	return &recordWriter{
+		w:   bufio.NewWriter(w),
+		enc: codec.NewEncoderBytes(nil, msgpackHandle),
+	}
+}
+
+// encode is used to encode a value into the reused value buffer
+func (rw *recordWriter) encode(v any) ([]byte, error) {
+	rw.value = rw.value[:0]
+	rw.enc.ResetBytes(&rw.value)
+	if err := rw.enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return rw.value, nil
+}
+
+// write is used to encode a value as a record of its own
+func (rw *recordWriter) write(kind byte, v any) error {
+	payload, err := rw.encode(v)
+	if err != nil {
+		return err
+	}
+	return rw.frame(kind, payload)
+}
+
+// append is used to add a value to the chunk, flushing it as a record once it is large enough
+func (rw *recordWriter) append(kind byte, v any) error {
+	value, err := rw.encode(v)
+	if err != nil {
+		return err
+	}
+	rw.chunk = append(rw.chunk, value...)
+	rw.count++
+
+	if len(rw.chunk) >= snapshotChunkSize {
+		return rw.flush(kind)
+	}
+	return nil
+}
+
+// flush is used to write the pending chunk as a record of the given kind
+func (rw *recordWriter) flush(kind byte) error {
+	if rw.count == 0 {
+		return nil
+	}
+
+	count := binary.AppendUvarint(nil, rw.count)
+	err := rw.frame(kind, count, rw.chunk)
+	rw.chunk = rw.chunk[:0]
+	rw.count = 0
+	return err
+}
+
+// frame is used to write a single record whose payload is the concatenation of parts
+func (rw *recordWriter) frame(kind byte, parts ...[]byte) error {
+	length := 0
+	for _, part := range parts {
+		length += len(part)
+	}
+
+	header := make([]byte, 1, 1+binary.MaxVarintLen64)
+	header[0] = kind
+	header = binary.AppendUvarint(header, uint64(length))
+	if _, err := rw.w.Write(header); err != nil {
+		return err
+	}
+
+	crc := crc32.New(crcTable)
+	crc.Write(header[:1])
+	for _, part := range parts {
+		crc.Write(part)
+		if _, err := rw.w.Write(part); err != nil {
+			return err
+		}
+	}
+	if err := binary.Write(rw.w, binary.BigEndian, crc.Sum32()); err != nil {
+		return err
+	}
+
+	rw.records++
+	return nil
+}
+
+// close is used to write the end record and flush the underlying writer
+func (rw *recordWriter) close() error {
+	if err := rw.write(recordEnd, rw.records); err != nil {
+		return err
+	}
+	return rw.w.Flush()
+}
+
+// writeSnapshotRecords is used to stream the state as a version 2 snapshot body
+// Only one chunk of messages or entries is held in memory at a time
+func writeSnapshotRecords[T any](w io.Writer, state *snapshotState[T]) error {
+	rw := newRecordWriter(w)
+
+	queues := state.queues()
+	for _, name := range queues.names() {
+		if err := rw.write(recordQueue, queueRecord{Name: name}); err != nil {
+			return err
+		}
+		err := queues.each(name, func(message ds.Message[T]) error {
+			return rw.append(recordMessages, message)
+		})
+		if err != nil {
+			return err
+		}
+		if err := rw.flush(recordMessages); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range sortedKeys(state.Streams) {
+		st := state.Streams[name]
+		err := rw.write(recordStream, streamRecord{
+			Name:        name,
+			NextOffset:  st.NextOffset,
+			Groups:      st.Groups,
+			SegmentSize: st.SegmentSize,
+			Retention:   st.Retention,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, segment := range st.Segments {
+			if err := rw.write(recordSegment, segment.BaseOffset); err != nil {
+				return err
+			}
+			for _, entry := range segment.Entries {
+				if err := rw.append(recordEntries, entry); err != nil {
+					return err
+				}
+			}
+			if err := rw.flush(recordEntries); err != nil {
+				return err
+			}
+		}
+	}
+
+	if state.Schemas != nil {
+		if err := rw.write(recordSchemas, state.Schemas); err != nil {
+			return err
+		}
+	}
+
+	if state.hash != nil {
+		if err := rw.write(recordHash, state.hash); err != nil {
+			return err
+		}
+	}
+
+	if len(state.members) > 0 {
+		if err := rw.write(recordMembers, state.members); err != nil {
+			return err
+		}
+	}
+
+	if len(state.keys) > 0 {
+		if err := rw.write(recordKeys, state.keys); err != nil {
+			return err
+		}
+	}
+
+	return rw.close()
+}
+
+// recordReader is used to read framed records from a snapshot
+type recordReader struct {
+	r       *bufio.Reader
+	records uint64
+}
+
+// next is used to read and verify the next record
+func (rr *recordReader) next() (byte, []byte, error) {
+	kind, err := rr.r.ReadByte()
+	if err == io.EOF {
+		return 0, nil, errors.New("snapshot is truncated: missing end record")
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, err := binary.ReadUvarint(rr.r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read record length: %w", err)
+	}
+	if length > maxRecordSize {
+		return 0, nil, fmt.Errorf("record of %d bytes exceeds the maximum of %d", length, maxRecordSize)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(rr.r, payload); err != nil {
+		return 0, nil, fmt.Errorf("failed to read record: %w", err)
+	}
+
+	var checksum uint32
+	if err := binary.Read(rr.r, binary.BigEndian, &checksum); err != nil {
+		return 0, nil, fmt.Errorf("failed to read record checksum: %w", err)
+	}
+
+	crc := crc32.New(crcTable)
+	crc.Write([]byte{kind})
+	crc.Write(payload)
+	if sum := crc.Sum32(); sum != checksum {
+		return 0, nil, fmt.Errorf("%w: record %d expected %08x, got %08x", ErrSnapshotChecksum, rr.records, checksum, sum)
+	}
+
+	rr.records++
+	return kind, payload, nil
+}
+
+// readSnapshotRecords is used to rebuild the state from a version 2 snapshot body
+// Queues are written to the loader as they are read, or to the state if it is nil
+func readSnapshotRecords[T any](r io.Reader, loader queueLoader[T]) (*snapshotState[T], error) {
+	rr := &recordReader{r: bufio.NewReader(r)}
+	state := &snapshotState[T]{
+		Queues:  map[string]*ds.Queue[T]{},
+		Streams: map[string]*ds.Stream[T]{},
+	}
+	if loader == nil {
+		loader = queueMap[T](state.Queues)
+	}
+
+	var queue string
+	var stream *ds.Stream[T]
+	for {
+		kind, payload, err := rr.next()
+		if err != nil {
+			return nil, err
+		}
+
+		dec := codec.NewDecoderBytes(payload, msgpackHandle)
+		switch kind {
+		case recordQueue:
+			var record queueRecord
+			if err := dec.Decode(&record); err != nil {
+				return nil, fmt.Errorf("failed to decode queue: %w", err)
+			}
+			if err := loader.create(record.Name); err != nil {
+				return nil, err
+			}
+			queue = record.Name
+		case recordMessages:
+			if queue == "" {
+				return nil, errors.New("messages record before any queue record")
+			}
+			err := decodeChunk(payload, func(message ds.Message[T]) error {
+				return loader.enqueue(queue, message)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode messages: %w", err)
+			}
+		case recordStream:
+			var record streamRecord
+			if err := dec.Decode(&record); err != nil {
+				return nil, fmt.Errorf("failed to decode stream: %w", err)
+			}
+			stream = ds.NewStream[T]()
+			stream.NextOffset = record.NextOffset
+			stream.SegmentSize = record.SegmentSize
+			stream.Retention = record.Retention
+			if record.Groups != nil {
+				stream.Groups = record.Groups
+			}
+			state.Streams[record.Name] = stream
+		case recordSegment:
+			if stream == nil {
+				return nil, errors.New("segment record before any stream record")
+			}
+			var baseOffset uint64
+			if err := dec.Decode(&baseOffset); err != nil {
+				return nil, fmt.Errorf("failed to decode segment: %w", err)
+			}
+			stream.Segments = append(stream.Segments, ds.Segment[T]{BaseOffset: baseOffset})
+		case recordEntries:
+			if stream == nil || len(stream.Segments) == 0 {
+				return nil, errors.New("entries record before any segment record")
+			}
+			segment := &stream.Segments[len(stream.Segments)-1]
+			err := decodeChunk(payload, func(entry ds.StreamEntry[T]) error {
+				segment.Entries = append(segment.Entries, entry)
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode entries: %w", err)
+			}
+		case recordSchemas:
+			schemas := schema.NewRegistry()
+			if err := dec.Decode(schemas); err != nil {
+				return nil, fmt.Errorf("failed to decode schemas: %w", err)
+			}
+			state.Schemas = schemas
+		case recordHash:
+			var record hashRecord
+			if err := dec.Decode(&record); err != nil {
+				return nil, fmt.Errorf("failed to decode state hash: %w", err)
+			}
+			state.hash = &record
+		case recordMembers:
+			if err := dec.Decode(&state.members); err != nil {
+				return nil, fmt.Errorf("failed to decode members: %w", err)
+			}
+		case recordKeys:
+			if err := dec.Decode(&state.keys); err != nil {
+				return nil, fmt.Errorf("failed to decode idempotency keys: %w", err)
+			}
+		case recordEnd:
+			var records uint64
+			if err := dec.Decode(&records); err != nil {
+				return nil, fmt.Errorf("failed to decode end record: %w", err)
+			}
+			if records != rr.records-1 {
+				return nil, fmt.Errorf("snapshot has %d records, end record expected %d", rr.records-1, records)
+			}
+			return state.normalize(), nil
+		default:
+			return nil, fmt.Errorf("unknown snapshot record kind %d", kind)
+		}
+	}
+}
+
+// decodeChunk is used to decode a chunk of count-prefixed msgpack values
+func decodeChunk[V any](payload []byte, f func(V) error) error {
+	count, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return errors.New("invalid chunk count")
+	}
+
+	dec := codec.NewDecoderBytes(payload[n:], msgpackHandle)
+	for i := uint64(0); i < count; i++ {
+		var value V
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		if err := f(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedKeys is used to iterate over a map in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,11 +1,19 @@
 package store
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"io"
+	"maps"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/kavinaravind/go-raft-message-queue/ds"
+	"github.com/kavinaravind/go-raft-message-queue/schema"
 )
 
 type MockSnapshotSink struct {
@@ -31,13 +39,13 @@ func (m *MockSnapshotSink) Write(p []byte) (n int, err error) {
 	return m.buffer.Write(p)
 }
 
-func queuesAreEqual(q1, q2 *ds.Queue[int]) bool {
+func queuesAreEqual[T comparable](q1, q2 *ds.Queue[T]) bool {
 	if len(q1.Messages) != len(q2.Messages) {
 		return false
 	}
 
 	for i := 0; i < len(q1.Messages); i++ {
-		if q1.Messages[i] != q2.Messages[i] {
+		if q1.Messages[i].Data != q2.Messages[i].Data || !maps.Equal(q1.Messages[i].Headers, q2.Messages[i].Headers) {
 			return false
 		}
 	}
@@ -52,7 +60,7 @@ func TestPersist(t *testing.T) {
 	queue.Enqueue(ds.Message[int]{Data: 2})
 	queue.Enqueue(ds.Message[int]{Data: 3})
 
-	snapshot := Snapshot[int]{queue: queue}
+	snapshot := Snapshot[int]{queues: queueMap[int]{DefaultQueue: queue}}
 
 	sink := &MockSnapshotSink{}
 
@@ -65,18 +73,391 @@ func TestPersist(t *testing.T) {
 		t.Errorf("expected sink to be closed")
 	}
 
-	dec := gob.NewDecoder(&sink.buffer)
-	var decodedQueue ds.Queue[int]
-	if err := dec.Decode(&decodedQueue); err != nil {
+	state, _, err := readSnapshot[int](&sink.buffer)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	if !queuesAreEqual(queue, state.Queues[DefaultQueue]) {
+		t.Errorf("expected %v, got %v", queue, state.Queues[DefaultQueue])
+	}
+}
+
+func TestPersistStreams(t *testing.T) {
+	stream := ds.NewStream[int]()
+	stream.Append(1, time.Now())
+	stream.Append(2, time.Now())
+	stream.Commit("group", 1)
+
+	snapshot := Snapshot[int]{
+		queues:  queueMap[int]{DefaultQueue: ds.NewQueue[int]()},
+		streams: map[string]*ds.Stream[int]{"numbers": stream},
+	}
+
+	sink := &MockSnapshotSink{}
+	if err := snapshot.Persist(sink); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	state, _, err := readSnapshot[int](&sink.buffer)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	decoded, ok := state.Streams["numbers"]
+	if !ok {
+		t.Fatalf("expected stream to be persisted")
+	}
+	if decoded.Len() != 2 || decoded.NextOffset != 2 {
+		t.Errorf("expected 2 entries and next offset 2, got %d, %d", decoded.Len(), decoded.NextOffset)
+	}
+	if offset, _ := decoded.Offset("group"); offset != 1 {
+		t.Errorf("expected group offset 1, got %d", offset)
+	}
+}
+
+// testSnapshotState is used to build a state with every kind of distributed ds
+func testSnapshotState(t testing.TB) *snapshotState[int] {
+	queue := ds.NewQueue[int]()
+	queue.Enqueue(ds.Message[int]{Data: 1})
+
+	named := ds.NewQueue[int]()
+	named.Enqueue(ds.Message[int]{Data: 2})
+
+	stream := ds.NewStream[int]()
+	stream.Append(3, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	stream.Commit("group", 1)
+
+	schemas := schema.NewRegistry()
+	if _, err := schemas.Register("numbers", []byte(`{"type": "integer"}`), schema.Backward); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	return &snapshotState[int]{
+		Queues:  map[string]*ds.Queue[int]{DefaultQueue: queue, "numbers": named},
+		Streams: map[string]*ds.Stream[int]{"numbers": stream},
+		Schemas: schemas,
+	}
+}
+
+// checkSnapshotState is used to compare a read state with testSnapshotState
+func checkSnapshotState(t *testing.T, state *snapshotState[int]) {
+	t.Helper()
+
+	expected := testSnapshotState(t)
+	for name, queue := range expected.Queues {
+		if !queuesAreEqual(queue, state.Queues[name]) {
+			t.Errorf("queue %s: expected %v, got %v", name, queue.Messages, state.Queues[name])
+		}
+	}
+
+	stream, ok := state.Streams["numbers"]
+	if !ok {
+		t.Fatal("expected stream to be restored")
+	}
+	entries := stream.Read(0, 0)
+	if len(entries) != 1 || entries[0].Data != 3 || !entries[0].Timestamp.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected stream entry 3, got %v", entries)
+	}
+	if offset, _ := stream.Offset("group"); offset != 1 {
+		t.Errorf("expected group offset 1, got %d", offset)
+	}
+
+	if _, version, ok := state.Schemas.Latest("numbers"); !ok || version.Version != 1 {
+		t.Errorf("expected schema version 1, got %v", version)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := writeSnapshot(&buf, testSnapshotState(t), CompressionNone); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	header, err := ReadSnapshotHeader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if header.Version != SnapshotVersion {
+		t.Errorf("unexpected header: %+v", header)
+	}
+
+	state, _, err := readSnapshot[int](&buf)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	checkSnapshotState(t, state)
+}
+
+func TestSnapshotCompression(t *testing.T) {
+	// A queue of repetitive messages, so every compression shrinks it
+	queue := ds.NewQueue[string]()
+	for i := 0; i < 1000; i++ {
+		queue.Enqueue(ds.Message[string]{Data: strings.Repeat("message ", 16)})
+	}
+	state := &snapshotState[string]{Queues: map[string]*ds.Queue[string]{DefaultQueue: queue}}
+
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionSnappy, CompressionZstd} {
+		t.Run(compression.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			written, err := writeSnapshot(&buf, state, compression)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if written.CompressedSize != int64(buf.Len()-snapshotHeaderSize) {
+				t.Errorf("expected compressed size %d, got %d", buf.Len()-snapshotHeaderSize, written.CompressedSize)
+			}
+			if compression != CompressionNone && written.Ratio() <= 1 {
+				t.Errorf("expected records to be compressed, got ratio %.2f", written.Ratio())
+			}
+
+			header, err := ReadSnapshotHeader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if header.Compression() != compression {
+				t.Errorf("expected header compression %v, got %v", compression, header.Compression())
+			}
+
+			restored, read, err := readSnapshot[string](&buf)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if read.Compression != compression || read.Size != written.Size || read.CompressedSize != written.CompressedSize {
+				t.Errorf("expected read metrics %+v to match written %+v", read, written)
+			}
+			if !queuesAreEqual(queue, restored.Queues[DefaultQueue]) {
+				t.Errorf("expected queue to be restored")
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		header := SnapshotHeader{Version: SnapshotVersion, Flags: 0x000e}
+		if _, _, err := readSnapshot[string](bytes.NewReader(header.marshal())); !errors.Is(err, ErrSnapshotVersion) {
+			t.Errorf("expected %v, got %v", ErrSnapshotVersion, err)
+		}
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := writeSnapshot(&buf, state, CompressionZstd); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		data := buf.Bytes()
+		data[len(data)/2] ^= 0xff
+		if _, _, err := readSnapshot[string](bytes.NewReader(data)); err == nil {
+			t.Error("expected error for corrupt compressed records")
+		}
+	})
+}
+
+func TestSnapshotCorruption(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := writeSnapshot(&buf, testSnapshotState(t), CompressionNone); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	valid := buf.Bytes()
+
+	corrupt := func(f func(data []byte) []byte) []byte {
+		return f(append([]byte{}, valid...))
+	}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		target error
+	}{
+		{"flipped record byte", corrupt(func(d []byte) []byte { d[snapshotHeaderSize+2] ^= 0xff; return d }), ErrSnapshotChecksum},
+		{"flipped record checksum", corrupt(func(d []byte) []byte { d[len(d)-1] ^= 0xff; return d }), ErrSnapshotChecksum},
+		{"unknown record", corrupt(func(d []byte) []byte { d[snapshotHeaderSize] = 0x7f; return d }), ErrSnapshotChecksum},
+		{"missing end record", corrupt(func(d []byte) []byte { return d[:len(d)-8] }), nil},
+		{"future version", corrupt(func(d []byte) []byte { d[5] = byte(SnapshotVersion + 1); return d }), ErrSnapshotVersion},
+		{"truncated body", valid[:len(valid)-1], nil},
+		{"truncated header", valid[:snapshotHeaderSize-1], nil},
+		{"empty", []byte{}, nil},
+		{"garbage", []byte("not a snapshot"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readSnapshot[int](bytes.NewReader(tt.data))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if tt.target != nil && !errors.Is(err, tt.target) {
+				t.Errorf("expected %v, got %v", tt.target, err)
+			}
+		})
+	}
+}
+
+// writeSnapshotV1 is used to write a snapshot as the version 1 format did
+func writeSnapshotV1(t testing.TB, w io.Writer, state *snapshotState[int]) {
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(state); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	header := SnapshotHeader{
+		Version:  1,
+		Length:   uint64(body.Len()),
+		Checksum: crc32.Checksum(body.Bytes(), crcTable),
+	}
+	w.Write(header.marshal())
+	body.WriteTo(w)
+}
+
+func TestSnapshotV1(t *testing.T) {
+	var buf bytes.Buffer
+	writeSnapshotV1(t, &buf, testSnapshotState(t))
+	valid := append([]byte{}, buf.Bytes()...)
+
+	state, _, err := readSnapshot[int](&buf)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	checkSnapshotState(t, state)
+
+	valid[len(valid)-1] ^= 0xff
+	if _, _, err := readSnapshot[int](bytes.NewReader(valid)); !errors.Is(err, ErrSnapshotChecksum) {
+		t.Errorf("expected %v, got %v", ErrSnapshotChecksum, err)
+	}
+	if _, _, err := readSnapshot[int](bytes.NewReader(valid[:len(valid)-1])); err == nil {
+		t.Error("expected error for truncated body")
+	}
+}
+
+func TestSnapshotChunks(t *testing.T) {
+	// Enough messages and entries that each is split over several records
+	payload := bytes.Repeat([]byte{0xab}, 64<<10)
+	count := 3 * snapshotChunkSize / len(payload)
+
+	queue := ds.NewQueue[[]byte]()
+	stream := ds.NewStream[[]byte]()
+	stream.SegmentSize = count / 2
+	for i := 0; i < count; i++ {
+		queue.Enqueue(ds.Message[[]byte]{Data: payload})
+		stream.Append(payload, time.Now())
+	}
+
+	var buf bytes.Buffer
+	state := &snapshotState[[]byte]{
+		Queues:  map[string]*ds.Queue[[]byte]{DefaultQueue: queue},
+		Streams: map[string]*ds.Stream[[]byte]{"bytes": stream},
+	}
+	if _, err := writeSnapshot(&buf, state, CompressionNone); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	// Count the records to check messages were chunked
+	rr := &recordReader{r: bufio.NewReader(bytes.NewReader(buf.Bytes()[snapshotHeaderSize:]))}
+	kinds := map[byte]int{}
+	for {
+		kind, _, err := rr.next()
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		kinds[kind]++
+		if kind == recordEnd {
+			break
+		}
+	}
+	if kinds[recordMessages] < 3 || kinds[recordEntries] < 4 || kinds[recordSegment] != 2 {
+		t.Errorf("expected messages and entries to be chunked, got %v", kinds)
+	}
+
+	restored, _, err := readSnapshot[[]byte](&buf)
+	if err != nil {
 		t.Fatalf("expected no error, got: %v", err)
 	}
+	if restored.Queues[DefaultQueue].Len() != count {
+		t.Errorf("expected %d messages, got %d", count, restored.Queues[DefaultQueue].Len())
+	}
+	restoredStream := restored.Streams["bytes"]
+	if restoredStream.Len() != count || len(restoredStream.Segments) != 2 || restoredStream.NextOffset != uint64(count) {
+		t.Errorf("expected %d entries in 2 segments, got %d in %d", count, restoredStream.Len(), len(restoredStream.Segments))
+	}
+	if entries := restoredStream.Read(uint64(count-1), 1); len(entries) != 1 || !bytes.Equal(entries[0].Data, payload) {
+		t.Errorf("expected last entry to be restored")
+	}
+}
+
+func BenchmarkPersist(b *testing.B) {
+	queue := ds.NewQueue[[]byte]()
+	for i := 0; i < 100000; i++ {
+		queue.Enqueue(ds.Message[[]byte]{Data: bytes.Repeat([]byte{byte(i)}, 256)})
+	}
+	snapshot := Snapshot[[]byte]{queues: queueMap[[]byte]{DefaultQueue: queue.Copy()}}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := snapshot.Persist(&discardSink{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// discardSink is a snapshot sink that discards what is written to it
+type discardSink struct {
+	MockSnapshotSink
+}
+
+func (d *discardSink) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func TestSnapshotMigration(t *testing.T) {
+	state := testSnapshotState(t)
+
+	named := map[string]*ds.Queue[int]{"numbers": state.Queues["numbers"]}
+
+	// Each release appended a value to the version 0 gob stream
+	stages := []struct {
+		name   string
+		values []any
+	}{
+		{"queue", []any{state.Queues[DefaultQueue]}},
+		{"streams", []any{state.Queues[DefaultQueue], state.Streams}},
+		{"named queues", []any{state.Queues[DefaultQueue], state.Streams, named}},
+		{"schemas", []any{state.Queues[DefaultQueue], state.Streams, named, state.Schemas}},
+	}
+
+	for i, stage := range stages {
+		t.Run(stage.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := gob.NewEncoder(&buf)
+			for _, value := range stage.values {
+				if err := enc.Encode(value); err != nil {
+					t.Fatalf("expected no error, got: %v", err)
+				}
+			}
+
+			migrated, _, err := readSnapshot[int](&buf)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
 
-	if !queuesAreEqual(queue, &decodedQueue) {
-		t.Errorf("expected %v, got %v", queue, &decodedQueue)
+			if !queuesAreEqual(state.Queues[DefaultQueue], migrated.Queues[DefaultQueue]) {
+				t.Errorf("expected default queue to be migrated")
+			}
+			if _, ok := migrated.Streams["numbers"]; ok != (i >= 1) {
+				t.Errorf("expected stream to be migrated: %v", i >= 1)
+			}
+			if _, ok := migrated.Queues["numbers"]; ok != (i >= 2) {
+				t.Errorf("expected named queue to be migrated: %v", i >= 2)
+			}
+			if _, _, ok := migrated.Schemas.Latest("numbers"); ok != (i >= 3) {
+				t.Errorf("expected schema to be migrated: %v", i >= 3)
+			}
+			if i == len(stages)-1 {
+				checkSnapshotState(t, migrated)
+			}
+		})
 	}
 }
 
 func TestRelease(t *testing.T) {
-	snapshot := Snapshot[int]{queue: ds.NewQueue[int]()}
+	snapshot := Snapshot[int]{queues: queueMap[int]{}}
 	snapshot.Release() // should not panic
 }
@@ -2,42 +2,141 @@ package store
 
 import (
 	"context"
-	"encoding/gob"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/raft"
 	"github.com/kavinaravind/go-raft-message-queue/consensus"
 	"github.com/kavinaravind/go-raft-message-queue/ds"
+	"github.com/kavinaravind/go-raft-message-queue/schema"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// DefaultQueue is the queue used by commands that do not name one
+const DefaultQueue = "default"
+
 // Specific operations that can be applied to the store
 const (
 	Send = iota
 	Recieve
+	Append
+	Commit
+	Retain
+	RegisterSchema
+	DeleteSchema
+	Check
+	RegisterMember
+	CreateQueue
+	DeleteQueue
+	PurgeQueue
+	SetCompatibility
 )
 
 // command is used to represent the command that will be applied to the store
+// In the msgpack encoding fields are positional, so new fields must only be appended
 type command[T any] struct {
+	_struct   bool          `codec:",toarray"`
 	Operation int           `json:"operation"`
 	Message   ds.Message[T] `json:"message"`
+	Queue     string        `json:"queue,omitempty"`
+	Stream    string        `json:"stream,omitempty"`
+	Group     string        `json:"group,omitempty"`
+	Offset    uint64        `json:"offset,omitempty"`
+	Retention ds.Retention  `json:"retention"`
+	Schema    []byte        `json:"schema,omitempty"`
+	Compat    string        `json:"compatibility,omitempty"`
+	Timestamp time.Time     `json:"timestamp"`
+	Hash      *StateHash    `json:"hash,omitempty"`
+	Trace     traceContext  `json:"trace,omitempty"`
+	Member    *Member       `json:"member,omitempty"`
+	Key       string        `json:"key,omitempty"`
 }
 
 // newCommand is used to create a new command instance
+// The timestamp is assigned by the leader so that every replica applies the same value
 func newCommand[T any](operation int, message ds.Message[T]) *command[T] {
 	return &command[T]{
 		Operation: operation,
 		Message:   message,
+		Timestamp: time.Now().UTC(),
 	}
 }
 
 type Store[T any] struct {
-	// ds that will be distributed across each node
-	queue *ds.Queue[T]
+	// queues are the named queues that will be distributed across each node
+	queues queueStorage[T]
+
+	// storage is the engine the queues are held in once the store is initialized
+	storage Storage
+
+	// resume is the position the persisted queues were applied up to when the node started
+	resume resumePoint
+
+	// dir is the data directory of the node once the store is initialized
+	dir string
+
+	// streams are the append-only logs that will be distributed across each node
+	streams map[string]*ds.Stream[T]
+
+	// streamDigests are the digests of the entries retained by each stream, folded into the state hash
+	streamDigests map[string]*streamDigest
+
+	// schemas is the registry of schemas attached to queues
+	schemas *schema.Registry
+
+	// members are the HTTP addresses registered by the nodes of the cluster, by node id
+	members map[string]string
+
+	// advertiseAddress is the HTTP address this node registers once it is the leader
+	advertiseAddress string
+
+	// bootstrapCandidates are the ids of the servers this node would bootstrap the cluster with
+	bootstrapCandidates []string
+
+	// keys are the idempotency keys of the sends applied within the window
+	keys *idempotencyKeys
+
+	// upgrader converts the messages of commands and snapshots written by an earlier release, if any
+	upgrader *LegacyUpgrader[T]
+
+	// encoding is the format used to write commands to the raft log
+	encoding Encoding
+
+	// compression is the compression of the snapshots written by the store
+	compression Compression
+
+	// hasher keeps the rolling hash of the entries applied to the store
+	hasher *stateHasher
+
+	// hashCheckInterval is how often the leader replicates a check of the state hash
+	hashCheckInterval time.Duration
+
+	// fenceOnDivergence is set to shutdown the node when its state hash differs from the leader's
+	fenceOnDivergence bool
+
+	// metrics are the prometheus metrics updated as commands are applied
+	metrics *storeMetrics
+
+	// restoring is set while the store is being replaced by a snapshot
+	restoring atomic.Bool
+
+	// snapshotMetrics are the measurements of the last snapshots persisted and restored
+	snapshotMetrics SnapshotMetrics
+
+	// metricsLock guards the snapshot metrics, which are written outside of the fsm
+	metricsLock sync.Mutex
+
+	// lock guards the replacement of the distributed ds on restore
+	lock sync.RWMutex
 
 	// consensus instance that will be used to replicate the ds
 	consensus *consensus.Consensus
@@ -49,119 +148,567 @@ type Store[T any] struct {
 // NewStore creates a new store instance with the given logger
 func NewStore[T any](logger *slog.Logger) *Store[T] {
 	return &Store[T]{
-		queue:  ds.NewQueue[T](),
-		logger: logger,
+		queues:      newMemoryQueues[T](),
+		storage:     StorageMemory,
+		streams:     map[string]*ds.Stream[T]{},
+		schemas:     schema.NewRegistry(),
+		members:     map[string]string{},
+		keys:        newIdempotencyKeys(),
+		encoding:    EncodingMsgpack,
+		compression: CompressionZstd,
+		hasher:      newStateHasher(),
+		metrics:     newStoreMetrics(),
+		logger:      logger,
+
+		streamDigests:     map[string]*streamDigest{},
+		hashCheckInterval: DefaultHashCheckInterval,
 	}
 }
 
+// SetEncoding is used to set the format used to write commands to the raft log
+// Entries in every encoding can always be read, so this only needs to be set to
+// EncodingJSON while a cluster is upgraded from a version without binary commands
+func (s *Store[T]) SetEncoding(encoding Encoding) {
+	s.encoding = encoding
+}
+
+// SetSnapshotCompression is used to set the compression of the snapshots written by the store
+// Snapshots with any compression can always be restored, as it is recorded in the snapshot header
+func (s *Store[T]) SetSnapshotCompression(compression Compression) {
+	s.compression = compression
+}
+
+// SetLegacyUpgrader is used to convert the messages of commands and snapshots written by an earlier release
+// that held another type of message, it must be called before Initialize
+func (s *Store[T]) SetLegacyUpgrader(upgrader *LegacyUpgrader[T]) {
+	s.upgrader = upgrader
+}
+
+// SetStorage is used to set the engine the queues are held in, it must be called before Initialize
+// The memory engine rebuilds the queues from the latest snapshot and the raft log on start, while the bolt
+// engine keeps them and only applies the entries after those it persisted, see Resume
+// The engine of a node can be changed between restarts
+func (s *Store[T]) SetStorage(storage Storage) {
+	s.storage = storage
+}
+
+// SnapshotMetrics is used to get the measurements of the last snapshots persisted and restored
+func (s *Store[T]) SnapshotMetrics() SnapshotMetrics {
+	s.metricsLock.Lock()
+	defer s.metricsLock.Unlock()
+	return s.snapshotMetrics
+}
+
 // Initialize is used to initialize the store with the given config
 func (s *Store[T]) Initialize(ctx context.Context, conf *consensus.Config) (chan struct{}, error) {
-	s.logger.Info("Initializing store")
+	s.logger.Info("Initializing store", "storage", s.storage)
+	s.dir = conf.BaseDirectory
+
+	if s.storage == StorageBolt {
+		queues, err := openBoltQueues[T](filepath.Join(conf.BaseDirectory, "queues.db"))
+		if err != nil {
+			return nil, err
+		}
+		s.queues = queues
+	}
 
 	consensus, err := consensus.NewConsensus(s, conf)
 	if err != nil {
+		s.queues.close()
 		return nil, err
 	}
 
 	s.consensus = consensus
 
+	if s.hashCheckInterval > 0 {
+		go s.runHashChecks(ctx)
+	}
+	if s.advertiseAddress != "" {
+		go s.runAdvertise(ctx, conf.ServerID)
+	}
+
 	// Listen for context cancellation and shutdown the server
 	shutdownComplete := make(chan struct{})
 	go func() {
 		<-ctx.Done()
-		future := s.consensus.Node.Shutdown()
-		if err := future.Error(); err != nil {
+		if err := s.consensus.Shutdown(); err != nil {
 			s.logger.Error("Failed to shutdown node", "error", err)
 		} else {
 			s.logger.Info("Node shutdown")
 		}
+		if err := s.queues.close(); err != nil {
+			s.logger.Error("Failed to close queue storage", "error", err)
+		}
 		close(shutdownComplete)
 	}()
 
 	return shutdownComplete, nil
 }
 
-// Send is used to enqueue a message into the queue
-func (s *Store[T]) Send(data T) error {
-	if s.consensus.Node.State() != raft.Leader {
-		return errors.New("not the leader")
-	}
+// Send is used to enqueue a message into the named queue
+func (s *Store[T]) Send(queue string, data T) error {
+	return s.SendContext(context.Background(), queue, data)
+}
 
-	c := newCommand[T](Send, ds.Message[T]{Data: data})
-	bytes, err := json.Marshal(c)
-	if err != nil {
-		return err
-	}
+// SendContext is used to enqueue a message into the named queue
+// The trace context of the send is carried in the message headers, so that the receiver can link to it
+func (s *Store[T]) SendContext(ctx context.Context, queue string, data T) error {
+	_, err := s.SendIdempotent(ctx, queue, "", data)
+	return err
+}
 
-	future := s.consensus.Node.Apply(bytes, 10*time.Second)
-	return future.Error()
+// Recieve is used to dequeue a message from the named queue
+func (s *Store[T]) Recieve(queue string) (*ds.Message[T], error) {
+	return s.RecieveContext(context.Background(), queue)
 }
 
-// Recieve is used to dequeue a message from the queue
-func (s *Store[T]) Recieve() (*ds.Message[T], error) {
+// RecieveContext is used to dequeue a message from the named queue
+// The span of the recieve is linked to the span that sent the message, if the message carries one
+func (s *Store[T]) RecieveContext(ctx context.Context, queue string) (*ds.Message[T], error) {
+	ctx, span := tracer.Start(ctx, "store.Recieve", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(attribute.String("messaging.destination.name", queueName(queue))))
+	defer span.End()
+
 	if s.consensus.Node.State() != raft.Leader {
-		return nil, errors.New("node is not the leader")
+		return nil, recordError(span, ErrNotLeader)
 	}
 
 	c := newCommand[T](Recieve, ds.Message[T]{})
-	bytes, err := json.Marshal(c)
-	if err != nil {
-		s.logger.Error("failed to marshal message", "error", err)
-		return nil, err
-	}
+	c.Queue = queue
 
-	future := s.consensus.Node.Apply(bytes, 10*time.Second)
-	if err := future.Error(); err != nil {
-		s.logger.Error("failed to apply message", "error", err)
-		return nil, err
+	future, err := s.replicate(ctx, c)
+	if err != nil {
+		return nil, recordError(span, err)
 	}
 
 	switch response := future.Response().(type) {
 	case nil:
-		// The Apply method returned an empty response
+		// The Apply method returned an empty response, as the queue is empty or does not exist
+		// A queue that does not exist now did not exist when the command was applied, or was deleted since,
+		// in which case the receive is reported as if it was applied just after the delete
+		if _, ok := s.queueLen(queue); !ok {
+			return nil, recordError(span, ErrQueueNotFound)
+		}
 		return &ds.Message[T]{}, nil
 	case ds.Message[T]:
 		// The Apply method returned a message
+		linkProducer(span, response.Headers)
 		return &response, nil
 	default:
 		// The Apply method returned an unexpected type
-		return nil, fmt.Errorf("unexpected response type: %T", response)
+		return nil, recordError(span, fmt.Errorf("unexpected response type: %T", response))
+	}
+}
+
+// Append is used to append a message to the end of the named stream
+func (s *Store[T]) Append(stream string, data T) (uint64, error) {
+	c := newCommand[T](Append, ds.Message[T]{Data: data})
+	c.Stream = stream
+
+	response, err := s.apply(context.Background(), c)
+	if err != nil {
+		return 0, err
+	}
+
+	offset, ok := response.(uint64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected response type: %T", response)
+	}
+	return offset, nil
+}
+
+// Read is used to read up to max entries from the named stream starting at offset
+func (s *Store[T]) Read(stream string, offset uint64, max int) ([]ds.StreamEntry[T], error) {
+	if s.consensus.Node.State() != raft.Leader {
+		return nil, ErrNotLeader
+	}
+
+	st, ok := s.getStream(stream)
+	if !ok {
+		return []ds.StreamEntry[T]{}, nil
+	}
+	return st.Read(offset, max), nil
+}
+
+// Seek is used to find the first offset in the named stream at or after the timestamp
+func (s *Store[T]) Seek(stream string, timestamp time.Time) (uint64, error) {
+	if s.consensus.Node.State() != raft.Leader {
+		return 0, ErrNotLeader
+	}
+
+	st, ok := s.getStream(stream)
+	if !ok {
+		return 0, nil
+	}
+	return st.Seek(timestamp), nil
+}
+
+// GroupOffset is used to get the next offset the consumer group will read
+// A group that has never committed starts at the oldest retained entry
+func (s *Store[T]) GroupOffset(stream, group string) (uint64, error) {
+	if s.consensus.Node.State() != raft.Leader {
+		return 0, ErrNotLeader
+	}
+
+	st, ok := s.getStream(stream)
+	if !ok {
+		return 0, nil
+	}
+	if offset, ok := st.Offset(group); ok {
+		return offset, nil
+	}
+	return st.FirstOffset(), nil
+}
+
+// Commit is used to commit the next offset the consumer group will read
+// An offset past the end of the stream is rejected before it is replicated, as offsets only move forward
+func (s *Store[T]) Commit(stream, group string, offset uint64) error {
+	if st, ok := s.getStream(stream); !ok {
+		return ErrStreamNotFound
+	} else if offset > st.EndOffset() {
+		return fmt.Errorf("%w: %d is past %d", ErrOffsetOutOfRange, offset, st.EndOffset())
+	}
+
+	c := newCommand[T](Commit, ds.Message[T]{})
+	c.Stream = stream
+	c.Group = group
+	c.Offset = offset
+
+	_, err := s.apply(context.Background(), c)
+	return err
+}
+
+// SetRetention is used to replace the retention policy of the named stream
+func (s *Store[T]) SetRetention(stream string, retention ds.Retention) error {
+	c := newCommand[T](Retain, ds.Message[T]{})
+	c.Stream = stream
+	c.Retention = retention
+
+	_, err := s.apply(context.Background(), c)
+	return err
+}
+
+// RegisterSchema is used to attach a new version of a JSON Schema to the named queue
+// The compatibility is that of a new subject, an update is checked against the compatibility the subject has and
+// rejected with a schema.IncompatibleError if it breaks it, or schema.ErrCompatibilityMismatch if another is given
+func (s *Store[T]) RegisterSchema(queue string, raw []byte, compatibility schema.Compatibility) (int, error) {
+	c := newCommand[T](RegisterSchema, ds.Message[T]{})
+	c.Queue = queue
+	c.Schema = raw
+	c.Compat = string(compatibility)
+
+	response, err := s.apply(context.Background(), c)
+	if err != nil {
+		return 0, err
+	}
+
+	version, ok := response.(int)
+	if !ok {
+		return 0, fmt.Errorf("unexpected response type: %T", response)
+	}
+	return version, nil
+}
+
+// SetCompatibility is used to change the compatibility new versions of the schema of the named queue are checked against
+func (s *Store[T]) SetCompatibility(queue string, compatibility schema.Compatibility) error {
+	c := newCommand[T](SetCompatibility, ds.Message[T]{})
+	c.Queue = queue
+	c.Compat = string(compatibility)
+
+	_, err := s.apply(context.Background(), c)
+	return err
+}
+
+// DeleteSchema is used to detach every version of the schema from the named queue
+func (s *Store[T]) DeleteSchema(queue string) error {
+	c := newCommand[T](DeleteSchema, ds.Message[T]{})
+	c.Queue = queue
+
+	_, err := s.apply(context.Background(), c)
+	return err
+}
+
+// Schema is used to get the latest schema attached to the named queue
+func (s *Store[T]) Schema(queue string) (*schema.Schema, schema.Version, bool) {
+	return s.registry().Latest(queueName(queue))
+}
+
+// SchemaHistory is used to get every version of the schema attached to the named queue
+func (s *Store[T]) SchemaHistory(queue string) (schema.Subject, bool) {
+	return s.registry().Get(queueName(queue))
+}
+
+// apply is used to replicate a command and return the response of the fsm
+func (s *Store[T]) apply(ctx context.Context, c *command[T]) (interface{}, error) {
+	if s.consensus.Node.State() != raft.Leader {
+		return nil, ErrNotLeader
+	}
+
+	future, err := s.replicate(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err, ok := future.Response().(error); ok {
+		return nil, err
 	}
+	return future.Response(), nil
 }
 
-// Stats is used to return the stats of the raft instance
+// replicate is used to submit a command to raft and wait for it to be committed and applied
+// The command carries the trace context of the apply span, so the fsm spans of every node are its children
+func (s *Store[T]) replicate(ctx context.Context, c *command[T]) (raft.ApplyFuture, error) {
+	ctx, span := tracer.Start(ctx, "raft.Apply", withCommandAttributes(c.Operation, 0))
+	defer span.End()
+
+	c.Trace = injectTrace(ctx)
+	bytes, err := encodeCommand(c, s.encoding)
+	if err != nil {
+		s.logger.Error("failed to marshal command", "error", err)
+		return nil, recordError(span, err)
+	}
+
+	defer s.observeApply(c.Operation, time.Now())
+	future := s.consensus.Node.Apply(bytes, 10*time.Second)
+	if err := future.Error(); err != nil {
+		s.logger.Error("failed to apply command", "error", err)
+		return nil, recordError(span, translateError(err))
+	}
+
+	span.SetAttributes(attribute.Int64("raft.index", int64(future.Index())))
+	return future, nil
+}
+
+// queueLen is used to get the number of messages in the named queue
+func (s *Store[T]) queueLen(name string) (int, bool) {
+	return s.queues.len(queueName(name))
+}
+
+// queueName is used to map commands written before named queues to the default queue
+func queueName(name string) string {
+	if name == "" {
+		return DefaultQueue
+	}
+	return name
+}
+
+// registry is used to get the schema registry
+func (s *Store[T]) registry() *schema.Registry {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.schemas
+}
+
+// getStream is used to look up a stream by name
+func (s *Store[T]) getStream(name string) (*ds.Stream[T], bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	st, ok := s.streams[name]
+	return st, ok
+}
+
+// getOrCreateStream is used to look up a stream by name, creating it if needed
+func (s *Store[T]) getOrCreateStream(name string) *ds.Stream[T] {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	st, ok := s.streams[name]
+	if !ok {
+		st = ds.NewStream[T]()
+		s.streams[name] = st
+	}
+	return st
+}
+
+// Stats is used to return the stats of the raft instance along with the snapshot metrics
 func (s *Store[T]) Stats() map[string]string {
-	return s.consensus.Node.Stats()
+	stats := s.consensus.Node.Stats()
+
+	metrics := s.SnapshotMetrics()
+	stats["snapshot_compression"] = metrics.Compression.String()
+	stats["snapshot_size"] = strconv.FormatInt(metrics.Size, 10)
+	stats["snapshot_compressed_size"] = strconv.FormatInt(metrics.CompressedSize, 10)
+	stats["snapshot_ratio"] = strconv.FormatFloat(metrics.Ratio(), 'f', 2, 64)
+	stats["snapshot_persist_time"] = metrics.PersistTime.String()
+	stats["snapshot_restore_time"] = metrics.RestoreTime.String()
+
+	current, checked, divergence := s.hasher.hashes()
+	stats["state_hash"] = current.String()
+	stats["state_hash_index"] = strconv.FormatUint(current.Index, 10)
+	stats["state_hash_checked"] = checked.String()
+	stats["state_hash_checked_index"] = strconv.FormatUint(checked.Index, 10)
+	stats["state_hash_diverged"] = strconv.FormatBool(divergence != nil)
+
+	return stats
 }
 
 // Join is used to join a remote node to the raft cluster
 func (s *Store[T]) Join(nodeID, address string) error {
 	s.logger.Info(fmt.Sprintf("received join request for remote node %s at %s", nodeID, address))
-	return s.consensus.Join(nodeID, address)
+	return translateError(s.consensus.Join(nodeID, address))
 }
 
 // implement the raft fsm interface
 
 // Apply is used to apply a log entry to the store
+// Every entry and the response to it is folded into the state hash, other than check commands
 func (s *Store[T]) Apply(log *raft.Log) interface{} {
-	var command command[T]
-	err := json.Unmarshal(log.Data, &command)
+	start := time.Now()
+	command, err := decodeCommand(log.Data, s.upgrader)
 	if err != nil {
-		s.logger.Error("failed to unmarshal message", "error", err)
+		s.logger.Error("failed to decode command", "error", err)
+		s.hasher.fold(log, err)
 		return err
 	}
+	defer s.observeFSMApply(command.Operation, start)
+	defer traceApply(log, command.Operation, command.Trace)()
+	if command.Operation == Check {
+		return s.applyCheck(log, command.Hash)
+	}
+
+	response := s.applyCommand(s.queuesAt(log), command)
+	s.hasher.fold(log, response)
+	return response
+}
+
+// ApplyBatch is used to apply a batch of committed log entries, implementing raft.BatchingFSM
+// Persisted queues write the changes of the whole batch in one transaction rather than one for each entry,
+// and if it fails every command of the batch fails with it, as its changes to the queues are lost
+func (s *Store[T]) ApplyBatch(logs []*raft.Log) []interface{} {
+	queues, persistent := s.queues.(persistentQueues)
+	if persistent {
+		queues.begin()
+	}
+
+	responses := make([]interface{}, len(logs))
+	for i, log := range logs {
+		if log.Type == raft.LogCommand {
+			responses[i] = s.Apply(log)
+		}
+	}
 
+	if persistent {
+		if err := queues.commit(); err != nil {
+			s.logger.Error("failed to commit queues", "error", err)
+			for i, log := range logs {
+				if log.Type == raft.LogCommand {
+					responses[i] = err
+				}
+			}
+		}
+	}
+	return responses
+}
+
+// applyCommand is used to apply a decoded command to the store, with the queues the entry is applied to
+func (s *Store[T]) applyCommand(queues queueStorage[T], command *command[T]) interface{} {
 	switch command.Operation {
 	case Send:
-		s.queue.Enqueue(command.Message)
+		if command.Key != "" && s.keyUsed(queueName(command.Queue), command.Key, command.Timestamp) {
+			return duplicateSend{}
+		}
+		if err := queues.enqueue(queueName(command.Queue), command.Message); err != nil {
+			s.logger.Error("failed to enqueue message", "error", err)
+			return err
+		}
+		if command.Key != "" {
+			s.addKey(queueName(command.Queue), command.Key, command.Timestamp)
+		}
+		s.metrics.enqueued.WithLabelValues(queueName(command.Queue)).Inc()
 		return nil
 	case Recieve:
-		val, ok := s.queue.Dequeue()
-		// If the queue is empty, return nil
+		val, ok, err := queues.dequeue(queueName(command.Queue))
+		if err != nil {
+			s.logger.Error("failed to dequeue message", "error", err)
+			return err
+		}
+		// If the queue does not exist or is empty, return nil
 		if !ok {
 			return nil
 		}
+		s.metrics.dequeued.WithLabelValues(queueName(command.Queue)).Inc()
 		return val
+	case Append:
+		stream := s.getOrCreateStream(command.Stream)
+		digest, err := s.digestOf(command.Stream, stream)
+		if err != nil {
+			s.logger.Error("failed to append entry", "error", err)
+			return err
+		}
+		offset := stream.Append(command.Message.Data, command.Timestamp)
+		if err := s.digestAppend(digest, stream, offset); err != nil {
+			s.logger.Error("failed to append entry", "error", err)
+			return err
+		}
+		return offset
+	case Commit:
+		stream, ok := s.getStream(command.Stream)
+		if !ok {
+			return ErrStreamNotFound
+		}
+		stream.Commit(command.Group, command.Offset)
+		return nil
+	case Retain:
+		stream, ok := s.getStream(command.Stream)
+		if !ok {
+			return ErrStreamNotFound
+		}
+		digest, err := s.digestOf(command.Stream, stream)
+		if err != nil {
+			s.logger.Error("failed to set retention", "error", err)
+			return err
+		}
+		stream.SetRetention(command.Retention, command.Timestamp)
+		digest.trim(stream.FirstOffset())
+		return nil
+	case RegisterSchema:
+		version, err := s.registry().Register(queueName(command.Queue), command.Schema, schema.Compatibility(command.Compat))
+		if err != nil {
+			return err
+		}
+		return version
+	case DeleteSchema:
+		s.registry().Delete(queueName(command.Queue))
+		return nil
+	case SetCompatibility:
+		return s.registry().SetCompatibility(queueName(command.Queue), schema.Compatibility(command.Compat))
+	case RegisterMember:
+		if command.Member == nil || command.Member.ID == "" {
+			return errors.New("missing member")
+		}
+		s.registerMember(*command.Member)
+		return nil
+	case CreateQueue:
+		created, err := queues.create(queueName(command.Queue))
+		if err != nil {
+			s.logger.Error("failed to create queue", "error", err)
+			return err
+		}
+		return created
+	case DeleteQueue:
+		if queueName(command.Queue) == DefaultQueue {
+			return ErrDefaultQueue
+		}
+		ok, err := queues.remove(queueName(command.Queue))
+		if err != nil {
+			s.logger.Error("failed to delete queue", "error", err)
+			return err
+		}
+		if !ok {
+			return ErrQueueNotFound
+		}
+		return nil
+	case PurgeQueue:
+		purged, ok, err := queues.purge(queueName(command.Queue))
+		if err != nil {
+			s.logger.Error("failed to purge queue", "error", err)
+			return err
+		}
+		if !ok {
+			return ErrQueueNotFound
+		}
+		return purged
 	default:
 		return fmt.Errorf("unknown operation: %v", command.Operation)
 	}
@@ -169,24 +716,116 @@ func (s *Store[T]) Apply(log *raft.Log) interface{} {
 
 // Snapshot is used to create a snapshot of the store
 func (s *Store[T]) Snapshot() (raft.FSMSnapshot, error) {
+	queues, err := s.queues.view()
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	streams := make(map[string]*ds.Stream[T], len(s.streams))
+	for name, st := range s.streams {
+		streams[name] = st.Copy()
+	}
+
 	return &Snapshot[T]{
-		queue: s.queue.Copy(),
+		queues:      queues,
+		streams:     streams,
+		schemas:     s.schemas.Copy(),
+		hash:        s.hasher.record(),
+		members:     maps.Clone(s.members),
+		keys:        s.keys.list(),
+		compression: s.compression,
+		persisted:   s.snapshotPersisted,
 	}, nil
 }
 
+// snapshotPersisted is used to record and log the measurements of a persisted snapshot
+func (s *Store[T]) snapshotPersisted(metrics SnapshotMetrics) {
+	s.logger.Info("Persisted snapshot",
+		"compression", metrics.Compression,
+		"size", metrics.Size,
+		"compressed_size", metrics.CompressedSize,
+		"ratio", fmt.Sprintf("%.2f", metrics.Ratio()),
+		"duration", metrics.PersistTime,
+	)
+
+	s.metrics.snapshotPersist.Observe(metrics.PersistTime.Seconds())
+
+	s.metricsLock.Lock()
+	defer s.metricsLock.Unlock()
+
+	metrics.RestoreTime = s.snapshotMetrics.RestoreTime
+	s.snapshotMetrics = metrics
+}
+
 // Restore is used to restore the store from a snapshot
 func (s *Store[T]) Restore(rc io.ReadCloser) error {
 	defer rc.Close()
 
-	dec := gob.NewDecoder(rc)
+	s.restoring.Store(true)
+	defer s.restoring.Store(false)
 
-	// Decode the entire queue
-	var queue ds.Queue[T]
-	if err := dec.Decode(&queue); err != nil {
-		return fmt.Errorf("failed to decode queue: %w", err)
+	// The persisted queues are kept rather than replaced by the snapshot raft restores on start,
+	// any later snapshot replaces them and every entry after it is applied
+	resume := s.resume
+	s.resume.pending = false
+	if !resume.pending {
+		s.resume = resumePoint{}
 	}
 
-	s.queue = &queue
+	// The queues are only replaced once the whole snapshot has been read
+	start := time.Now()
+	var state *snapshotState[T]
+	var metrics SnapshotMetrics
+	var err error
+	if resume.pending {
+		state, metrics, err = readSnapshotInto(rc, discardLoader[T]{}, s.upgrader)
+	} else {
+		err = s.queues.restore(func(loader queueLoader[T]) error {
+			var err error
+			state, metrics, err = readSnapshotInto(rc, loader, s.upgrader)
+			return err
+		})
+	}
+	if err != nil {
+		return err
+	}
+	digests, err := restoreStreamDigests(state.Streams)
+	if err != nil {
+		return err
+	}
+	duration := time.Since(start)
+
+	s.logger.Info("Restored snapshot",
+		"compression", metrics.Compression,
+		"size", metrics.Size,
+		"compressed_size", metrics.CompressedSize,
+		"ratio", fmt.Sprintf("%.2f", metrics.Ratio()),
+		"duration", duration,
+	)
+
+	s.metrics.snapshotRestore.Observe(duration.Seconds())
+	s.metricsLock.Lock()
+	s.snapshotMetrics.RestoreTime = duration
+	s.metricsLock.Unlock()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.streams = state.Streams
+	s.streamDigests = digests
+	s.schemas = state.Schemas
+	s.members = state.members
+	if s.members == nil {
+		s.members = map[string]string{}
+	}
+	s.keys = restoreIdempotencyKeys(state.keys)
+	s.hasher.restore(state.hash)
+	if resume.pending && resume.index > resume.snapshot {
+		s.hasher.restore(nil)
+	}
 
 	return nil
 }
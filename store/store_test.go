@@ -4,15 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
+	"errors"
 	"io"
 	"log/slog"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/raft"
 	"github.com/kavinaravind/go-raft-message-queue/consensus"
 	"github.com/kavinaravind/go-raft-message-queue/ds"
 	"github.com/kavinaravind/go-raft-message-queue/model"
+	"github.com/kavinaravind/go-raft-message-queue/schema"
 )
 
 func TestNewStore(t *testing.T) {
@@ -23,8 +26,8 @@ func TestNewStore(t *testing.T) {
 	store := NewStore[int](logger)
 
 	// Check that the store was created correctly
-	if store.queue == nil {
-		t.Error("Expected queue to be initialized, but it was nil")
+	if _, ok := store.queueLen(DefaultQueue); !ok {
+		t.Error("Expected default queue to be initialized, but it was nil")
 	}
 	if store.logger != logger {
 		t.Error("Expected logger to be the same, but it was different")
@@ -46,12 +49,7 @@ func TestStore_Initialize(t *testing.T) {
 		os.RemoveAll(tmpDir1)
 	})
 	// Create a new consensus config
-	conf := &consensus.Config{
-		IsLeader:      true,
-		ServerID:      "node1",
-		BaseDirectory: tmpDir1,
-		Address:       "localhost:8000",
-	}
+	conf := testConfig(tmpDir1)
 
 	// Create a context that will be cancelled after a delay
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
@@ -77,6 +75,19 @@ func TestStore_Initialize(t *testing.T) {
 	}
 }
 
+// testConfig is used to create the config of a node that bootstraps itself over an in-memory transport
+func testConfig(dir string) *consensus.Config {
+	address, transport := raft.NewInmemTransport("")
+	return &consensus.Config{
+		IsLeader:      true,
+		ServerID:      "node1",
+		BaseDirectory: dir,
+		Address:       string(address),
+		LogStore:      consensus.LogStoreInmem,
+		Transport:     transport,
+	}
+}
+
 func setup(t *testing.T) *Store[model.Comment] {
 	// Create a new logger
 	logger := slog.Default()
@@ -93,12 +104,7 @@ func setup(t *testing.T) *Store[model.Comment] {
 	})
 
 	// Create a new consensus config
-	conf := &consensus.Config{
-		IsLeader:      true,
-		ServerID:      "node1",
-		BaseDirectory: tmpDir1,
-		Address:       "localhost:8000",
-	}
+	conf := testConfig(tmpDir1)
 
 	// Create a context with a cancel function
 	ctx, cancel := context.WithCancel(context.Background())
@@ -139,14 +145,14 @@ func TestStore(t *testing.T) {
 
 	t.Run("Send", func(t *testing.T) {
 		// Send a message
-		if err := store.Send(comment); err != nil {
+		if err := store.Send(DefaultQueue, comment); err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
 	})
 
 	t.Run("Recieve", func(t *testing.T) {
 		// Recieve a message
-		msg, err := store.Recieve()
+		msg, err := store.Recieve(DefaultQueue)
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
@@ -160,7 +166,7 @@ func TestStore(t *testing.T) {
 
 	t.Run("Recieve (empty)", func(t *testing.T) {
 		// Recieve a message
-		msg, err := store.Recieve()
+		msg, err := store.Recieve(DefaultQueue)
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
@@ -171,7 +177,7 @@ func TestStore(t *testing.T) {
 
 	t.Run("Snapshot", func(t *testing.T) {
 		// Push a message
-		if err := store.Send(comment); err != nil {
+		if err := store.Send(DefaultQueue, comment); err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
 
@@ -207,13 +213,272 @@ func TestStore(t *testing.T) {
 		}
 
 		// Check that the store's queue contains the data from the snapshot
-		storeData, ok := store.queue.Dequeue()
-		if !ok {
+		storeData, ok, err := store.queues.dequeue(DefaultQueue)
+		if err != nil || !ok {
 			t.Fatalf("Expected string, got: %v", ok)
 		}
 
-		if storeData != message {
+		if storeData.Data != message.Data {
 			t.Errorf("Expected %v, got: %v", message, storeData.Data)
 		}
 	})
+
+	t.Run("Send (named)", func(t *testing.T) {
+		if err := store.Send("comments", comment); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		// The default queue is independent of the named queue
+		msg, err := store.Recieve(DefaultQueue)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if (msg.Data != model.Comment{}) {
+			t.Errorf("Expected empty default queue, got %v", msg.Data)
+		}
+
+		msg, err = store.Recieve("comments")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if msg.Data != comment {
+			t.Errorf("Expected comment to be %v, got %v", comment, msg.Data)
+		}
+	})
+
+	t.Run("Send (json encoding)", func(t *testing.T) {
+		// Commands written in the legacy encoding are still applied
+		store.SetEncoding(EncodingJSON)
+		defer store.SetEncoding(EncodingMsgpack)
+
+		if err := store.Send("comments", comment); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		msg, err := store.Recieve("comments")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if msg.Data != comment {
+			t.Errorf("Expected comment to be %v, got %v", comment, msg.Data)
+		}
+	})
+
+	t.Run("Recieve (unknown queue)", func(t *testing.T) {
+		_, err := store.Recieve("unknown")
+		if !errors.Is(err, ErrQueueNotFound) {
+			t.Fatalf("Expected queue not found, got: %v", err)
+		}
+	})
+
+	t.Run("Append", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			offset, err := store.Append("comments", comment)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if offset != uint64(i) {
+				t.Errorf("Expected offset %d, got: %d", i, offset)
+			}
+		}
+	})
+
+	t.Run("Read", func(t *testing.T) {
+		entries, err := store.Read("comments", 1, 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(entries) != 2 || entries[0].Offset != 1 || entries[0].Data != comment {
+			t.Errorf("Expected entries at offsets 1 and 2, got: %v", entries)
+		}
+
+		// Reading is not destructive, so the history can be read again
+		entries, err = store.Read("comments", 0, 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(entries) != 3 {
+			t.Errorf("Expected 3 entries, got: %d", len(entries))
+		}
+	})
+
+	t.Run("Seek", func(t *testing.T) {
+		offset, err := store.Seek("comments", time.Now().Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if offset != 0 {
+			t.Errorf("Expected offset 0, got: %d", offset)
+		}
+
+		offset, err = store.Seek("comments", time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if offset != 3 {
+			t.Errorf("Expected offset 3, got: %d", offset)
+		}
+	})
+
+	t.Run("Commit", func(t *testing.T) {
+		offset, err := store.GroupOffset("comments", "group")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if offset != 0 {
+			t.Errorf("Expected offset 0 before commit, got: %d", offset)
+		}
+
+		if err := store.Commit("comments", "group", 2); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		offset, err = store.GroupOffset("comments", "group")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if offset != 2 {
+			t.Errorf("Expected offset 2 after commit, got: %d", offset)
+		}
+
+		// A group can not commit past the end of the stream, nor to a stream that does not exist
+		if err := store.Commit("comments", "group", 100); !errors.Is(err, ErrOffsetOutOfRange) {
+			t.Errorf("Expected %v, got: %v", ErrOffsetOutOfRange, err)
+		}
+		if err := store.Commit("missing", "group", 0); !errors.Is(err, ErrStreamNotFound) {
+			t.Errorf("Expected %v, got: %v", ErrStreamNotFound, err)
+		}
+		if _, ok := store.getStream("missing"); ok {
+			t.Error("Expected the commit not to create the stream")
+		}
+	})
+
+	t.Run("SetRetention", func(t *testing.T) {
+		if err := store.SetRetention("comments", ds.Retention{MaxEntries: 1}); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if err := store.SetRetention("missing", ds.Retention{MaxEntries: 1}); !errors.Is(err, ErrStreamNotFound) {
+			t.Errorf("Expected %v, got: %v", ErrStreamNotFound, err)
+		}
+		if _, ok := store.getStream("missing"); ok {
+			t.Error("Expected the retention not to create the stream")
+		}
+	})
+
+	t.Run("RegisterSchema", func(t *testing.T) {
+		version, err := store.RegisterSchema("comments", []byte(`{"type": "object", "required": ["author"]}`), schema.Backward)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if version != 1 {
+			t.Errorf("Expected version 1, got: %d", version)
+		}
+
+		// Requiring a new property is rejected by every replica
+		_, err = store.RegisterSchema("comments", []byte(`{"type": "object", "required": ["author", "content"]}`), schema.Backward)
+		var incompatible *schema.IncompatibleError
+		if !errors.As(err, &incompatible) {
+			t.Fatalf("Expected incompatible error, got: %v", err)
+		}
+
+		s, latest, ok := store.Schema("comments")
+		if !ok || latest.Version != 1 {
+			t.Fatalf("Expected version 1 to be the latest, got: %v", latest)
+		}
+		if errs := s.Validate([]byte(`{}`)); len(errs) != 1 {
+			t.Errorf("Expected a missing author error, got: %v", errs)
+		}
+	})
+
+	t.Run("SetCompatibility", func(t *testing.T) {
+		if _, err := store.RegisterSchema("compat", []byte(`{"type": "object", "required": ["author"]}`), ""); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		breaking := []byte(`{"type": "object", "required": ["author", "content"]}`)
+		if _, err := store.RegisterSchema("compat", breaking, schema.None); !errors.Is(err, schema.ErrCompatibilityMismatch) {
+			t.Fatalf("Expected compatibility mismatch, got: %v", err)
+		}
+
+		if err := store.SetCompatibility("compat", schema.None); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if version, err := store.RegisterSchema("compat", breaking, ""); err != nil || version != 2 {
+			t.Fatalf("Expected version 2, got: %d, %v", version, err)
+		}
+		if subject, _ := store.SchemaHistory("compat"); subject.Compatibility != schema.None {
+			t.Errorf("Expected none compatibility, got: %q", subject.Compatibility)
+		}
+
+		if err := store.SetCompatibility("missing", schema.Full); !errors.Is(err, schema.ErrSubjectNotFound) {
+			t.Errorf("Expected subject not found, got: %v", err)
+		}
+	})
+
+	t.Run("DeleteSchema", func(t *testing.T) {
+		if _, err := store.RegisterSchema("deleted", []byte(`{}`), schema.None); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if err := store.DeleteSchema("deleted"); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if _, _, ok := store.Schema("deleted"); ok {
+			t.Error("Expected schema to be deleted")
+		}
+	})
+
+	t.Run("Restore (streams)", func(t *testing.T) {
+		if err := store.Send("comments", comment); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		// Take a snapshot of the store with the stream and named queue
+		snapshot, err := store.Snapshot()
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		sink := &MockSnapshotSink{}
+		if err := snapshot.Persist(sink); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		metrics := store.SnapshotMetrics()
+		if metrics.Compression != CompressionZstd || metrics.CompressedSize != int64(sink.buffer.Len()-snapshotHeaderSize) {
+			t.Errorf("Expected zstd snapshot metrics, got: %+v", metrics)
+		}
+
+		// Restore into a fresh store
+		restored := NewStore[model.Comment](slog.Default())
+		if err := restored.Restore(io.NopCloser(&sink.buffer)); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		st, ok := restored.getStream("comments")
+		if !ok {
+			t.Fatal("Expected stream to be restored")
+		}
+		if st.Len() != 3 || st.NextOffset != 3 {
+			t.Errorf("Expected 3 entries and next offset 3, got: %d, %d", st.Len(), st.NextOffset)
+		}
+		if offset, ok := st.Offset("group"); !ok || offset != 2 {
+			t.Errorf("Expected group offset 2, got: %d", offset)
+		}
+		if st.Retention.MaxEntries != 1 {
+			t.Errorf("Expected retention to be restored, got: %v", st.Retention)
+		}
+
+		if msg, ok, _ := restored.queues.dequeue("comments"); !ok || msg.Data != comment {
+			t.Errorf("Expected %v, got: %v", comment, msg.Data)
+		}
+		if _, ok := restored.queueLen(DefaultQueue); !ok {
+			t.Error("Expected default queue to be restored")
+		}
+		if restored.SnapshotMetrics().RestoreTime == 0 {
+			t.Error("Expected restore time to be recorded")
+		}
+		if _, version, ok := restored.Schema("comments"); !ok || version.Version != 1 {
+			t.Errorf("Expected schema version 1 to be restored, got: %v", version)
+		}
+	})
 }
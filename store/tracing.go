@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+
+	"github.com/hashicorp/raft"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is used to trace commands from the leader submitting them to every node applying them
+// It uses the global tracer provider, so spans are only exported once tracing is set up
+var tracer = otel.Tracer("github.com/kavinaravind/go-raft-message-queue/store")
+
+// traceContext is the trace context of a span as propagated headers, such as traceparent
+type traceContext map[string]string
+
+// injectTrace is used to get the trace context of the span in the context, nil if there is none
+// Entries written without a span encode the same as they did before tracing
+func injectTrace(ctx context.Context) traceContext {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return traceContext(carrier)
+}
+
+// extractTrace is used to get a context holding the propagated trace context
+func extractTrace(headers map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(headers))
+}
+
+// linkProducer is used to link the span to the span that sent the message, if the message carries one
+func linkProducer(span trace.Span, headers map[string]string) {
+	if len(headers) == 0 {
+		return
+	}
+	if producer := trace.SpanContextFromContext(extractTrace(headers)); producer.IsValid() {
+		span.AddLink(trace.Link{SpanContext: producer, Attributes: []attribute.KeyValue{attribute.String("link.kind", "producer")}})
+	}
+}
+
+// traceApply is used to start the span of the fsm applying an entry, as a child of the leader's apply span
+// Entries written without a trace context are not traced
+func traceApply(log *raft.Log, operation int, trace traceContext) func() {
+	if len(trace) == 0 {
+		return func() {}
+	}
+	_, span := tracer.Start(extractTrace(trace), "fsm.Apply", withCommandAttributes(operation, log.Index))
+	return func() { span.End() }
+}
+
+// withCommandAttributes is used to describe a command in the attributes of a span
+func withCommandAttributes(operation int, index uint64) trace.SpanStartEventOption {
+	attributes := []attribute.KeyValue{attribute.String("raft.operation", OperationName(operation))}
+	if index > 0 {
+		attributes = append(attributes, attribute.Int64("raft.index", int64(index)))
+	}
+	return trace.WithAttributes(attributes...)
+}
+
+// recordError is used to mark the span as failed with the error, which is returned
+func recordError(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
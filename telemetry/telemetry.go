@@ -0,0 +1,150 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ServiceName is the name spans are exported under
+const ServiceName = "go-raft-message-queue"
+
+// Exporter is the destination spans are exported to
+type Exporter string
+
+const (
+	// ExporterNone disables tracing, trace context is still propagated from requests to messages
+	ExporterNone Exporter = "none"
+
+	// ExporterStdout writes spans to stdout as indented JSON, for local debugging
+	ExporterStdout Exporter = "stdout"
+
+	// ExporterFile appends spans to a file as JSON, one span per line
+	ExporterFile Exporter = "file"
+
+	// ExporterOTLP sends spans to an OpenTelemetry collector over OTLP/HTTP
+	ExporterOTLP Exporter = "otlp"
+)
+
+// ParseExporter is used to parse the name of an exporter
+func ParseExporter(name string) (Exporter, error) {
+	switch exporter := Exporter(name); exporter {
+	case ExporterNone, ExporterStdout, ExporterFile, ExporterOTLP:
+		return exporter, nil
+	default:
+		return "", fmt.Errorf("unknown trace exporter %q", name)
+	}
+}
+
+// Config is the configuration for tracing
+type Config struct {
+	// Exporter is the destination spans are exported to
+	Exporter Exporter
+
+	// File is the path spans are appended to by the file exporter
+	File string
+
+	// Endpoint is the host and port of the collector used by the otlp exporter
+	// If empty, the OTEL_EXPORTER_OTLP_ENDPOINT environment variable or localhost:4318 is used
+	Endpoint string
+
+	// Insecure is set to connect to the collector over plain HTTP
+	Insecure bool
+
+	// SampleRatio is the fraction of traces started by this node that are sampled
+	// Traces started by a caller follow the caller's sampling decision
+	SampleRatio float64
+
+	// InstanceID identifies the node in the spans it exports
+	InstanceID string
+}
+
+// NewConfig creates a new tracing config with tracing disabled
+func NewConfig() *Config {
+	return &Config{
+		Exporter:    ExporterNone,
+		SampleRatio: 1,
+	}
+}
+
+// Setup is used to install the global tracer provider and propagator
+// The returned function flushes any buffered spans and must be called before the process exits
+func Setup(ctx context.Context, conf *Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if conf.Exporter == ExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, closer, err := newExporter(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+		semconv.ServiceInstanceID(conf.InstanceID),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			err = errors.Join(err, closer.Close())
+		}
+		return err
+	}, nil
+}
+
+// newExporter is used to create the exporter of the config, along with the file it writes to if any
+func newExporter(ctx context.Context, conf *Config) (sdktrace.SpanExporter, *os.File, error) {
+	switch conf.Exporter {
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exporter, nil, err
+	case ExporterFile:
+		if conf.File == "" {
+			return nil, nil, errors.New("the file exporter requires a file")
+		}
+		file, err := os.OpenFile(conf.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return exporter, file, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if conf.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(conf.Endpoint))
+		}
+		if conf.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, opts...)
+		return exporter, nil, err
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q", conf.Exporter)
+	}
+}
@@ -0,0 +1,60 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestParseExporter(t *testing.T) {
+	for _, name := range []string{"none", "stdout", "file", "otlp"} {
+		if exporter, err := ParseExporter(name); err != nil || string(exporter) != name {
+			t.Errorf("ParseExporter(%q) = %q, %v", name, exporter, err)
+		}
+	}
+	if _, err := ParseExporter("jaeger"); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}
+
+func TestSetupFile(t *testing.T) {
+	conf := NewConfig()
+	conf.Exporter = ExporterFile
+	conf.File = filepath.Join(t.TempDir(), "traces.json")
+	conf.InstanceID = "node1"
+
+	shutdown, err := Setup(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "test.Span")
+	span.End()
+
+	// Spans are buffered until the provider is shutdown
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	data, err := os.ReadFile(conf.File)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, expected := range []string{`"Name":"test.Span"`, `"Value":"node1"`, ServiceName} {
+		if !bytes.Contains(data, []byte(expected)) {
+			t.Errorf("expected the exported span to contain %s, got %s", expected, data)
+		}
+	}
+}
+
+func TestSetupFileRequired(t *testing.T) {
+	conf := NewConfig()
+	conf.Exporter = ExporterFile
+	if _, err := Setup(context.Background(), conf); err == nil {
+		t.Error("expected an error without a file")
+	}
+}
@@ -0,0 +1,465 @@
+// Package testcluster runs raft clusters of stores within a single process for tests
+// Nodes communicate over in-memory transports and keep their raft state in memory,
+// so clusters start in milliseconds and tests using them can run in parallel
+package testcluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/consensus"
+	"github.com/kavinaravind/go-raft-message-queue/store"
+)
+
+// DefaultTimeout is how long the wait helpers wait before failing the test
+const DefaultTimeout = 5 * time.Second
+
+// Option is used to configure a cluster
+type Option func(*options)
+
+// options are the settings shared by every node of a cluster
+type options struct {
+	storage           store.Storage
+	logger            *slog.Logger
+	hashCheckInterval time.Duration
+	withoutBootstrap  bool
+}
+
+// WithStorage is used to set the engine the queues of each node are held in
+func WithStorage(storage store.Storage) Option {
+	return func(o *options) {
+		o.storage = storage
+	}
+}
+
+// WithLogger is used to log the output of each node, which is discarded by default
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithHashCheckInterval is used to set how often the leader checks the state hash of the nodes
+// Checks are disabled by default, so that they do not add entries to the log of a test
+func WithHashCheckInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.hashCheckInterval = interval
+	}
+}
+
+// WithoutBootstrap is used to start every node without a raft configuration
+// New then returns without waiting for a leader, so the test can bootstrap the cluster itself
+func WithoutBootstrap() Option {
+	return func(o *options) {
+		o.withoutBootstrap = true
+	}
+}
+
+// Node is a member of the cluster
+type Node[T any] struct {
+	// ID is the raft server id of the node
+	ID string
+
+	// Address is the in-memory address of the node
+	Address raft.ServerAddress
+
+	// Store is the store of the node, it is replaced when the node is restarted
+	Store *store.Store[T]
+
+	// Dir is the temporary directory of the node
+	Dir string
+
+	stores    *consensus.Stores
+	transport *raft.InmemTransport
+	cancel    context.CancelFunc
+	done      chan struct{}
+	running   bool
+	group     int
+}
+
+// AppliedIndex is used to get the index of the last log entry applied to the node's store
+func (n *Node[T]) AppliedIndex() uint64 {
+	applied, _ := strconv.ParseUint(n.Store.Stats()["applied_index"], 10, 64)
+	return applied
+}
+
+// LastIndex is used to get the index of the last log entry stored by the node
+func (n *Node[T]) LastIndex() uint64 {
+	last, _ := strconv.ParseUint(n.Store.Stats()["last_log_index"], 10, 64)
+	return last
+}
+
+// Cluster is a set of nodes replicating a store
+type Cluster[T any] struct {
+	t       testing.TB
+	options options
+	nodes   []*Node[T]
+	delay   atomic.Int64
+	lock    sync.Mutex
+}
+
+// New starts a cluster of n nodes and waits for it to elect a leader
+// The first node bootstraps the cluster and the others join it, as they do outside of tests,
+// unless the cluster is started WithoutBootstrap
+// Every node is stopped when the test completes
+func New[T any](t testing.TB, n int, opts ...Option) *Cluster[T] {
+	t.Helper()
+
+	c := &Cluster[T]{
+		t: t,
+		options: options{
+			storage: store.StorageMemory,
+			logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		},
+	}
+	for _, opt := range opts {
+		opt(&c.options)
+	}
+	t.Cleanup(c.Shutdown)
+
+	for i := 0; i < n; i++ {
+		address, transport := raft.NewInmemTransport("")
+		c.nodes = append(c.nodes, &Node[T]{
+			ID:        "node" + strconv.Itoa(i+1),
+			Address:   address,
+			Dir:       t.TempDir(),
+			transport: transport,
+			stores: &consensus.Stores{
+				Log:       raft.NewInmemStore(),
+				Stable:    raft.NewInmemStore(),
+				Snapshots: raft.NewInmemSnapshotStore(),
+			},
+		})
+	}
+
+	c.lock.Lock()
+	for i, node := range c.nodes {
+		if err := c.start(node, i == 0 && !c.options.withoutBootstrap); err != nil {
+			c.lock.Unlock()
+			t.Fatalf("failed to start %s: %v", node.ID, err)
+		}
+	}
+	c.connect()
+	c.lock.Unlock()
+
+	if c.options.withoutBootstrap {
+		return c
+	}
+
+	leader := c.Leader()
+	for _, node := range c.nodes[1:] {
+		if err := leader.Store.Join(node.ID, string(node.Address)); err != nil {
+			t.Fatalf("failed to join %s: %v", node.ID, err)
+		}
+	}
+	c.WaitForReplication()
+
+	return c
+}
+
+// Nodes is used to get every node of the cluster, whether running or not
+func (c *Cluster[T]) Nodes() []*Node[T] {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]*Node[T]{}, c.nodes...)
+}
+
+// Node is used to get the node with the given index
+func (c *Cluster[T]) Node(i int) *Node[T] {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.nodes[i]
+}
+
+// Leader is used to wait for a running node to become the leader
+func (c *Cluster[T]) Leader() *Node[T] {
+	c.t.Helper()
+
+	leader, err := c.WaitForLeader(DefaultTimeout)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return leader
+}
+
+// WaitForLeader is used to wait for a running node to become the leader
+// Once a partition is healed, a stale leader may briefly remain, so the leader with the latest term is used
+func (c *Cluster[T]) WaitForLeader(timeout time.Duration) (*Node[T], error) {
+	leader, _, err := c.waitForLeader(timeout)
+	return leader, err
+}
+
+// LeaderStore is used to wait for a running node to become the leader and get its store
+// Unlike reading the Store of a node, it is safe to call while other goroutines kill and restart nodes
+func (c *Cluster[T]) LeaderStore(timeout time.Duration) (*store.Store[T], error) {
+	_, s, err := c.waitForLeader(timeout)
+	return s, err
+}
+
+// Followers is used to get every running node other than the leader
+func (c *Cluster[T]) Followers() []*Node[T] {
+	c.t.Helper()
+
+	leader := c.Leader()
+	var followers []*Node[T]
+	for _, node := range c.Running() {
+		if node != leader {
+			followers = append(followers, node)
+		}
+	}
+	return followers
+}
+
+// Running is used to get the nodes that have not been killed or crashed
+func (c *Cluster[T]) Running() []*Node[T] {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var running []*Node[T]
+	for _, node := range c.nodes {
+		if node.running {
+			running = append(running, node)
+		}
+	}
+	return running
+}
+
+// WaitForReplication is used to wait for every running node to apply the leader's last log entry
+func (c *Cluster[T]) WaitForReplication() {
+	c.t.Helper()
+
+	target := c.Leader().LastIndex()
+	err := c.waitFor(DefaultTimeout, func() bool {
+		for _, node := range c.Running() {
+			if node.AppliedIndex() < target {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		c.t.Fatalf("nodes did not apply index %d: %v", target, err)
+	}
+}
+
+// Delay is used to delay every rpc between nodes by a random duration up to max, zero removes the delay
+func (c *Cluster[T]) Delay(max time.Duration) {
+	c.delay.Store(int64(max))
+}
+
+// Partition is used to split the running nodes into groups that can only reach nodes in the same group
+// Nodes that are not named are placed in a group of their own
+func (c *Cluster[T]) Partition(groups ...[]*Node[T]) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i, node := range c.nodes {
+		node.group = -1 - i
+	}
+	for i, group := range groups {
+		for _, node := range group {
+			node.group = i
+		}
+	}
+	c.connect()
+}
+
+// Heal is used to reconnect every running node after a partition
+func (c *Cluster[T]) Heal() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, node := range c.nodes {
+		node.group = 0
+	}
+	c.connect()
+}
+
+// Kill is used to stop a node, its raft state is kept so that it can be restarted
+func (c *Cluster[T]) Kill(node *Node[T]) {
+	c.t.Helper()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.stop(node)
+	c.connect()
+}
+
+// Crash is used to stop a node as if its process died, rather than shutting it down
+// The node is disconnected and its raft state copied as it is at that moment, then the abandoned instance is
+// shut down only to release its resources, so anything it writes after the copy is lost
+// Restart starts the node from the copy
+func (c *Cluster[T]) Crash(node *Node[T]) {
+	c.t.Helper()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !node.running {
+		return
+	}
+	node.running = false
+	node.transport.DisconnectAll()
+	c.connect()
+
+	stores, err := copyStores(node.stores)
+	if err != nil {
+		c.t.Fatalf("failed to copy the raft state of %s: %v", node.ID, err)
+	}
+	node.stores = stores
+	c.shutdown(node)
+}
+
+// Restart is used to start a killed or crashed node with a new store, which is rebuilt from its raft state
+func (c *Cluster[T]) Restart(node *Node[T]) {
+	c.t.Helper()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if node.running {
+		c.stop(node)
+	}
+
+	// The transport is closed when the node shuts down, so it is replaced at the same address
+	_, node.transport = raft.NewInmemTransport(node.Address)
+	if err := c.start(node, false); err != nil {
+		c.t.Fatalf("failed to restart %s: %v", node.ID, err)
+	}
+	c.connect()
+}
+
+// Shutdown is used to stop every running node
+func (c *Cluster[T]) Shutdown() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, node := range c.nodes {
+		if node.running {
+			c.stop(node)
+		}
+	}
+}
+
+// start is used to initialize a new store for the node, the caller must hold the lock
+func (c *Cluster[T]) start(node *Node[T], bootstrap bool) error {
+	s := store.NewStore[T](c.options.logger.With("node", node.ID))
+	s.SetStorage(c.options.storage)
+	s.SetHashCheckInterval(c.options.hashCheckInterval)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := s.Initialize(ctx, &consensus.Config{
+		IsLeader:      bootstrap,
+		ServerID:      node.ID,
+		BaseDirectory: node.Dir,
+		Address:       string(node.Address),
+		Transport:     &delayedTransport{InmemTransport: node.transport, delay: &c.delay},
+		Stores:        node.stores,
+		Tune:          tune,
+	})
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	node.Store = s
+	node.cancel = cancel
+	node.done = done
+	node.running = true
+	return nil
+}
+
+// stop is used to shutdown the store of the node, the caller must hold the lock
+func (c *Cluster[T]) stop(node *Node[T]) {
+	if !node.running {
+		return
+	}
+
+	c.shutdown(node)
+	node.running = false
+}
+
+// shutdown is used to cancel the store of the node and wait for it to shutdown, the caller must hold the lock
+func (c *Cluster[T]) shutdown(node *Node[T]) {
+	node.cancel()
+	select {
+	case <-node.done:
+	case <-time.After(DefaultTimeout):
+		c.t.Errorf("timed out waiting for %s to shutdown", node.ID)
+	}
+}
+
+// connect is used to connect every pair of running nodes in the same group, the caller must hold the lock
+func (c *Cluster[T]) connect() {
+	for _, a := range c.nodes {
+		if !a.running {
+			continue
+		}
+		a.transport.DisconnectAll()
+		for _, b := range c.nodes {
+			if a != b && b.running && a.group == b.group {
+				a.transport.Connect(b.Address, b.transport)
+			}
+		}
+	}
+}
+
+// waitForLeader is used to wait for a leader, reading the store of each node under the lock
+func (c *Cluster[T]) waitForLeader(timeout time.Duration) (*Node[T], *store.Store[T], error) {
+	var leader *Node[T]
+	var leaderStore *store.Store[T]
+	err := c.waitFor(timeout, func() bool {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		leader, leaderStore = nil, nil
+		var term uint64
+		for _, node := range c.nodes {
+			if !node.running {
+				continue
+			}
+			stats := node.Store.Stats()
+			current, _ := strconv.ParseUint(stats["term"], 10, 64)
+			if stats["state"] == raft.Leader.String() && current >= term {
+				leader, leaderStore, term = node, node.Store, current
+			}
+		}
+		return leader != nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("no leader was elected: %w", err)
+	}
+	return leader, leaderStore, nil
+}
+
+// waitFor is used to poll the condition until it holds or the timeout elapses
+func (c *Cluster[T]) waitFor(timeout time.Duration, condition func() bool) error {
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v", timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// tune is used to shorten the raft timeouts, as in-memory transports have no latency
+func tune(config *raft.Config) {
+	config.HeartbeatTimeout = 50 * time.Millisecond
+	config.ElectionTimeout = 50 * time.Millisecond
+	config.LeaderLeaseTimeout = 50 * time.Millisecond
+	config.CommitTimeout = 5 * time.Millisecond
+	config.LogOutput = io.Discard
+}
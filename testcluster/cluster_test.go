@@ -0,0 +1,212 @@
+package testcluster
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/store"
+)
+
+// entries is used to read every entry of the stream from the leader
+func entries[T any](t *testing.T, c *Cluster[T], stream string) []T {
+	t.Helper()
+
+	read, err := c.Leader().Store.Read(stream, 0, 0)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	data := make([]T, len(read))
+	for i, entry := range read {
+		data[i] = entry.Data
+	}
+	return data
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCluster(t *testing.T) {
+	t.Parallel()
+	c := New[int](t, 3)
+
+	leader := c.Leader()
+	if err := leader.Store.Send("numbers", 1); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, follower := range c.Followers() {
+		if err := follower.Store.Send("numbers", 2); err == nil {
+			t.Errorf("expected %s to reject a send as a follower", follower.ID)
+		}
+	}
+
+	c.WaitForReplication()
+	for _, node := range c.Nodes() {
+		if node.AppliedIndex() != leader.LastIndex() {
+			t.Errorf("expected %s to apply index %d, got %d", node.ID, leader.LastIndex(), node.AppliedIndex())
+		}
+	}
+
+	msg, err := leader.Store.Recieve("numbers")
+	if err != nil || msg.Data != 1 {
+		t.Errorf("expected 1, got %v, %v", msg, err)
+	}
+}
+
+func TestClusterFailover(t *testing.T) {
+	t.Parallel()
+	c := New[int](t, 3, WithStorage(store.StorageBolt))
+
+	old := c.Leader()
+	if _, err := old.Store.Append("numbers", 1); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	c.WaitForReplication()
+
+	// The new leader has every entry committed by the old one
+	c.Kill(old)
+	leader := c.Leader()
+	if leader == old {
+		t.Fatal("expected a new leader to be elected")
+	}
+	if _, err := leader.Store.Append("numbers", 2); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if data := entries(t, c, "numbers"); !equal(data, []int{1, 2}) {
+		t.Errorf("expected [1 2], got %v", data)
+	}
+
+	// The restarted node rebuilds its store from its log and catches up
+	c.Restart(old)
+	c.WaitForReplication()
+
+	// The entries survive losing the second leader, with the restarted node part of the quorum
+	c.Kill(leader)
+	if data := entries(t, c, "numbers"); !equal(data, []int{1, 2}) {
+		t.Errorf("expected [1 2] after restart, got %v", data)
+	}
+}
+
+func TestClusterCrash(t *testing.T) {
+	t.Parallel()
+	c := New[int](t, 3, WithStorage(store.StorageBolt))
+
+	leader := c.Leader()
+	for i := 1; i <= 3; i++ {
+		if err := leader.Store.Send("numbers", i); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	c.WaitForReplication()
+
+	// A crashed follower restarts from the raft state it had when it crashed and catches up
+	follower := c.Followers()[0]
+	c.Crash(follower)
+	if err := leader.Store.Send("numbers", 4); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	c.Restart(follower)
+	c.WaitForReplication()
+	if follower.AppliedIndex() != leader.LastIndex() {
+		t.Errorf("expected %s to apply index %d, got %d", follower.ID, leader.LastIndex(), follower.AppliedIndex())
+	}
+
+	// The messages committed by a crashed leader are kept by the new one
+	c.Crash(leader)
+	msg, err := c.Leader().Store.Recieve("numbers")
+	if err != nil || msg.Data != 1 {
+		t.Errorf("expected 1, got %v, %v", msg, err)
+	}
+	if messages, err := c.Leader().Store.Peek("numbers", 10); err != nil || len(messages) != 3 {
+		t.Errorf("expected 3 messages, got %v, %v", messages, err)
+	}
+	c.Restart(leader)
+	c.WaitForReplication()
+}
+
+func TestClusterPartition(t *testing.T) {
+	t.Parallel()
+	c := New[int](t, 5)
+
+	// Isolate the leader and one follower in the minority
+	old := c.Leader()
+	followers := c.Followers()
+	minority := []*Node[int]{old, followers[0]}
+	c.Partition(minority, followers[1:])
+
+	// The old leader steps down once it can no longer reach a quorum
+	var leader *Node[int]
+	for leader == nil || leader == old {
+		var err error
+		if leader, err = c.WaitForLeader(DefaultTimeout); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := leader.Store.Append("numbers", 1); err != nil {
+		t.Fatalf("expected majority to accept writes, got: %v", err)
+	}
+	for _, node := range minority {
+		if node.LastIndex() >= leader.LastIndex() {
+			t.Errorf("expected %s not to receive writes while partitioned", node.ID)
+		}
+	}
+
+	c.Heal()
+	c.WaitForReplication()
+
+	// Only nodes from the old minority remain with a quorum once two majority nodes are killed,
+	// so the leader elected from them must have caught up
+	for _, node := range followers[1:3] {
+		c.Kill(node)
+	}
+	if data := entries(t, c, "numbers"); !equal(data, []int{1}) {
+		t.Errorf("expected [1] after healing, got %v", data)
+	}
+}
+
+func TestClusterStateHash(t *testing.T) {
+	t.Parallel()
+	c := New[int](t, 3, WithHashCheckInterval(50*time.Millisecond))
+
+	leader := c.Leader()
+	for i := 0; i < 10; i++ {
+		if err := leader.Store.Send("numbers", i); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+
+	// Every node records the same hash at each check, so they agree once a check covering the sends is applied everywhere
+	if err := c.waitFor(DefaultTimeout, func() bool {
+		_, expected := leader.Store.StateHash()
+		if expected.Index <= 10 {
+			return false
+		}
+		for _, node := range c.Followers() {
+			_, checked := node.Store.StateHash()
+			if checked.Index != expected.Index || !bytes.Equal(checked.Hash, expected.Hash) {
+				return false
+			}
+		}
+		return true
+	}); err != nil {
+		t.Fatalf("expected every node to check the same state hash: %v", err)
+	}
+
+	for _, node := range c.Nodes() {
+		if d := node.Store.Divergence(); d != nil {
+			t.Errorf("expected %s not to diverge, got: %v", node.ID, d)
+		}
+		if stats := node.Store.Stats(); stats["state_hash_diverged"] != "false" || stats["state_hash_checked"] == "unknown" {
+			t.Errorf("expected %s to report a checked hash, got %v", node.ID, stats)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package linearizability
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AnomalyKind is the kind of an anomaly found in a history
+type AnomalyKind string
+
+const (
+	// Lost is a value that was sent but never received, although the queue was later seen empty
+	Lost AnomalyKind = "lost"
+
+	// Duplicated is a value that was received more than once
+	Duplicated AnomalyKind = "duplicated"
+
+	// Reordered is a value that was received before a value sent ahead of it
+	Reordered AnomalyKind = "reordered"
+)
+
+// Anomaly is a violation of the FIFO queue model that is found without a search
+type Anomaly struct {
+	Kind  AnomalyKind
+	Queue string
+	Value int
+
+	// Operations are the operations that show the anomaly
+	Operations []Operation
+}
+
+// String is used to describe the anomaly
+func (a Anomaly) String() string {
+	var description string
+	switch a.Kind {
+	case Lost:
+		description = fmt.Sprintf("value %d was sent but never received, and the queue was then seen empty", a.Value)
+	case Duplicated:
+		description = fmt.Sprintf("value %d was received %d times", a.Value, len(a.Operations)-1)
+	case Reordered:
+		description = fmt.Sprintf("value %d was received before value %d, which was sent ahead of it", a.Value, a.Operations[0].Value)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s on queue %q: %s", a.Kind, a.Queue, description)
+	for _, operation := range a.Operations {
+		fmt.Fprintf(&b, "\n\t%s", operation)
+	}
+	return b.String()
+}
+
+// Result is the outcome of checking a history
+type Result struct {
+	// Ok is set when the history of every queue is linearizable
+	Ok bool
+
+	// Unknown is set when the search did not complete before the timeout
+	Unknown bool
+
+	// Queues are the queues whose history is not linearizable
+	Queues []string
+
+	// Anomalies are the lost, duplicated and reordered values found in the history
+	Anomalies []Anomaly
+}
+
+// String is used to describe the result
+func (r Result) String() string {
+	if r.Ok {
+		return "history is linearizable"
+	}
+
+	var b strings.Builder
+	if r.Unknown {
+		b.WriteString("history could not be checked before the timeout")
+	} else {
+		fmt.Fprintf(&b, "history is not linearizable for queues %q", r.Queues)
+	}
+	for _, anomaly := range r.Anomalies {
+		fmt.Fprintf(&b, "\n%s", anomaly)
+	}
+	return b.String()
+}
+
+// Check is used to check that the history is linearizable with respect to a FIFO queue
+func Check(operations []Operation) Result {
+	return CheckTimeout(operations, 0)
+}
+
+// CheckTimeout is used to check the history, giving up once the timeout elapses
+// A timeout of zero searches until the history is found to be linearizable or not
+func CheckTimeout(operations []Operation, timeout time.Duration) Result {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	queues := make(map[string][]Operation)
+	for _, operation := range operations {
+		queues[operation.Queue] = append(queues[operation.Queue], operation)
+	}
+	names := make([]string, 0, len(queues))
+	for name := range queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := Result{Ok: true}
+	for _, name := range names {
+		result.Anomalies = append(result.Anomalies, anomalies(name, queues[name])...)
+
+		linearizable, complete := search(queues[name], deadline)
+		switch {
+		case !complete:
+			result.Ok = false
+			result.Unknown = true
+		case !linearizable:
+			result.Ok = false
+			result.Queues = append(result.Queues, name)
+		}
+	}
+	return result
+}
+
+// anomalies is used to find the values of a queue that were lost, duplicated or reordered
+// Each anomaly found is a violation on its own, so the search is only needed to find subtler ones
+func anomalies(queue string, operations []Operation) []Anomaly {
+	sends := make(map[int]Operation)
+	received := make(map[int][]Operation)
+	var empty, ambiguous []Operation
+	for _, operation := range operations {
+		switch {
+		case operation.Kind == Send:
+			sends[operation.Value] = operation
+		case operation.Ambiguous:
+			ambiguous = append(ambiguous, operation)
+		case operation.Value == 0:
+			empty = append(empty, operation)
+		default:
+			received[operation.Value] = append(received[operation.Value], operation)
+		}
+	}
+
+	var found []Anomaly
+	values := make([]int, 0, len(sends))
+	for value := range sends {
+		values = append(values, value)
+	}
+	sort.Ints(values)
+
+	for _, value := range values {
+		send := sends[value]
+		if receives := received[value]; len(receives) > 1 {
+			found = append(found, Anomaly{Kind: Duplicated, Queue: queue, Value: value, Operations: append([]Operation{send}, receives...)})
+		}
+	}
+
+	for _, value := range values {
+		send := sends[value]
+		if send.Ambiguous || len(received[value]) > 0 {
+			continue
+		}
+
+		// The value was in the queue when the empty recieve was called, unless an ambiguous recieve took it
+		for _, recieve := range empty {
+			if recieve.Call > send.Return && !overlaps(ambiguous, recieve) {
+				found = append(found, Anomaly{Kind: Lost, Queue: queue, Value: value, Operations: []Operation{send, recieve}})
+				break
+			}
+		}
+	}
+
+	for _, first := range values {
+		for _, second := range values {
+			a, b := sends[first], sends[second]
+			if a.Ambiguous || len(received[first]) == 0 || len(received[second]) == 0 || a.Return > b.Call {
+				continue
+			}
+
+			// The first value was sent before the second was, but the second was received before the first could be
+			ra, rb := received[first][0], received[second][0]
+			if rb.Return < ra.Call {
+				found = append(found, Anomaly{Kind: Reordered, Queue: queue, Value: second, Operations: []Operation{a, b, rb, ra}})
+			}
+		}
+	}
+	return found
+}
+
+// overlaps is used to check whether any of the ambiguous operations could have taken effect before the operation returned
+func overlaps(ambiguous []Operation, operation Operation) bool {
+	for _, other := range ambiguous {
+		if other.Call < operation.Return {
+			return true
+		}
+	}
+	return false
+}
+
+// entry is the call or return of an operation in the doubly linked list searched for a linearization
+type entry struct {
+	id         int
+	operation  *Operation
+	call       bool
+	time       int64
+	match      *entry
+	prev, next *entry
+}
+
+// frame is a linearized call and the states before it, used to backtrack
+type frame struct {
+	entry  *entry
+	states []state
+}
+
+// search is used to find a linearization of the operations of a single queue
+// It reports whether the history is linearizable and whether the search completed before the deadline
+func search(operations []Operation, deadline time.Time) (bool, bool) {
+	head := list(operations)
+	linearized := make(bitset, (len(operations)+63)/64)
+	cache := make(map[string]struct{})
+	states := []state{{}}
+	var stack []frame
+
+	current := head.next
+	for steps := 0; head.next != nil; steps++ {
+		if steps%1024 == 0 && !deadline.IsZero() && time.Now().After(deadline) {
+			return false, false
+		}
+
+		if !current.call {
+			// Every call before this return has been tried, so the last linearized call is undone
+			if len(stack) == 0 {
+				return false, true
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			states = top.states
+			linearized.clear(top.entry.id)
+			unlift(top.entry)
+			current = top.entry.next
+			continue
+		}
+
+		next := step(states, current.operation)
+		if len(next) > 0 {
+			linearized.set(current.id)
+			k := linearized.key() + key(next)
+			if _, seen := cache[k]; !seen {
+				cache[k] = struct{}{}
+				stack = append(stack, frame{entry: current, states: states})
+				states = next
+				lift(current)
+				current = head.next
+				continue
+			}
+			linearized.clear(current.id)
+		}
+		current = current.next
+	}
+	return true, true
+}
+
+// list is used to order the calls and returns of the operations after a sentinel head
+// Ambiguous operations return after every other operation, as they may take effect at any later point
+func list(operations []Operation) *entry {
+	entries := make([]*entry, 0, 2*len(operations))
+	for i := range operations {
+		operation := &operations[i]
+		ret := operation.Return
+		if operation.Ambiguous {
+			ret = math.MaxInt64
+		}
+
+		call := &entry{id: i, operation: operation, call: true, time: operation.Call}
+		call.match = &entry{id: i, operation: operation, time: ret}
+		entries = append(entries, call, call.match)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].time < entries[j].time
+	})
+
+	head := &entry{}
+	last := head
+	for _, e := range entries {
+		e.prev = last
+		last.next = e
+		last = e
+	}
+	return head
+}
+
+// lift is used to remove a call and its return from the list
+func lift(call *entry) {
+	call.prev.next = call.next
+	call.next.prev = call.prev
+
+	ret := call.match
+	ret.prev.next = ret.next
+	if ret.next != nil {
+		ret.next.prev = ret.prev
+	}
+}
+
+// unlift is used to put back a call and its return removed by lift
+func unlift(call *entry) {
+	ret := call.match
+	ret.prev.next = ret
+	if ret.next != nil {
+		ret.next.prev = ret
+	}
+
+	call.prev.next = call
+	call.next.prev = call
+}
+
+// state is the contents of the queue in the sequential model
+type state []int
+
+// step is used to apply the operation to every possible state of the queue
+// Ambiguous operations may or may not take effect, so the model keeps every state that is still possible
+func step(states []state, operation *Operation) []state {
+	var next []state
+	for _, s := range states {
+		if operation.Ambiguous {
+			next = append(next, s)
+		}
+
+		switch {
+		case operation.Kind == Send:
+			next = append(next, append(append(state{}, s...), operation.Value))
+		case operation.Ambiguous:
+			if len(s) > 0 {
+				next = append(next, s[1:])
+			}
+		case operation.Value == 0:
+			if len(s) == 0 {
+				next = append(next, s)
+			}
+		default:
+			if len(s) > 0 && s[0] == operation.Value {
+				next = append(next, s[1:])
+			}
+		}
+	}
+	return unique(next)
+}
+
+// unique is used to remove duplicate states, keeping them sorted so that equal sets share a key
+func unique(states []state) []state {
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].key() < states[j].key()
+	})
+
+	var result []state
+	for i, s := range states {
+		if i == 0 || s.key() != states[i-1].key() {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// key is used to get a key that is equal for equal states
+func (s state) key() string {
+	var b strings.Builder
+	for _, value := range s {
+		b.WriteString(strconv.Itoa(value))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+// key is used to get a key that is equal for equal sets of states
+func key(states []state) string {
+	var b strings.Builder
+	for _, s := range states {
+		b.WriteByte('|')
+		b.WriteString(s.key())
+	}
+	return b.String()
+}
+
+// bitset records which operations have been linearized
+type bitset []uint64
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+func (b bitset) clear(i int) {
+	b[i/64] &^= 1 << (i % 64)
+}
+
+// key is used to get a key that is equal for equal bitsets
+func (b bitset) key() string {
+	var k strings.Builder
+	for _, word := range b {
+		k.WriteString(strconv.FormatUint(word, 36))
+		k.WriteByte('.')
+	}
+	return k.String()
+}
@@ -0,0 +1,236 @@
+package linearizability
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// op is used to build an operation that took effect
+func op(client int, kind Kind, value int, call, ret int64) Operation {
+	return Operation{Client: client, Kind: kind, Queue: "q", Value: value, Call: call, Return: ret}
+}
+
+// ambiguous is used to build an operation whose outcome is unknown
+func ambiguous(client int, kind Kind, value int, call int64) Operation {
+	return Operation{Client: client, Kind: kind, Queue: "q", Value: value, Call: call, Ambiguous: true}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations []Operation
+		ok         bool
+		anomaly    AnomalyKind
+	}{
+		{
+			name: "sequential",
+			operations: []Operation{
+				op(1, Send, 1, 1, 2),
+				op(1, Send, 2, 3, 4),
+				op(1, Recieve, 1, 5, 6),
+				op(1, Recieve, 2, 7, 8),
+				op(1, Recieve, 0, 9, 10),
+			},
+			ok: true,
+		},
+		{
+			// The concurrent sends may take effect in either order
+			name: "concurrent",
+			operations: []Operation{
+				op(1, Send, 1, 1, 4),
+				op(2, Send, 2, 2, 3),
+				op(1, Recieve, 2, 5, 6),
+				op(2, Recieve, 1, 7, 8),
+			},
+			ok: true,
+		},
+		{
+			name: "lost",
+			operations: []Operation{
+				op(1, Send, 1, 1, 2),
+				op(1, Recieve, 0, 3, 4),
+			},
+			anomaly: Lost,
+		},
+		{
+			name: "duplicated",
+			operations: []Operation{
+				op(1, Send, 1, 1, 2),
+				op(1, Recieve, 1, 3, 4),
+				op(2, Recieve, 1, 5, 6),
+			},
+			anomaly: Duplicated,
+		},
+		{
+			name: "reordered",
+			operations: []Operation{
+				op(1, Send, 1, 1, 2),
+				op(1, Send, 2, 3, 4),
+				op(2, Recieve, 2, 5, 6),
+				op(2, Recieve, 1, 7, 8),
+			},
+			anomaly: Reordered,
+		},
+		{
+			// A value cannot be received before it is sent
+			name: "early",
+			operations: []Operation{
+				op(1, Recieve, 1, 1, 2),
+				op(2, Send, 1, 3, 4),
+			},
+		},
+		{
+			// The timed out send took effect, as its value was received
+			name: "ambiguous send applied",
+			operations: []Operation{
+				ambiguous(1, Send, 1, 1),
+				op(2, Recieve, 1, 2, 3),
+			},
+			ok: true,
+		},
+		{
+			name: "ambiguous send not applied",
+			operations: []Operation{
+				ambiguous(1, Send, 1, 1),
+				op(2, Recieve, 0, 2, 3),
+			},
+			ok: true,
+		},
+		{
+			// The timed out recieve may have taken the value, so it is not reported as lost
+			name: "ambiguous recieve",
+			operations: []Operation{
+				op(1, Send, 1, 1, 2),
+				ambiguous(2, Recieve, 0, 3),
+				op(1, Recieve, 0, 4, 5),
+			},
+			ok: true,
+		},
+		{
+			// The timed out recieve cannot account for values received out of order
+			name: "ambiguous recieve reordered",
+			operations: []Operation{
+				op(1, Send, 1, 1, 2),
+				op(1, Send, 2, 3, 4),
+				ambiguous(2, Recieve, 0, 5),
+				op(1, Recieve, 2, 6, 7),
+				op(1, Recieve, 1, 8, 9),
+			},
+			anomaly: Reordered,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := Check(test.operations)
+			if result.Ok != test.ok {
+				t.Fatalf("expected ok to be %v, got: %s", test.ok, result)
+			}
+			if !test.ok && len(result.Queues) != 1 {
+				t.Errorf("expected queue q not to be linearizable, got %v", result.Queues)
+			}
+
+			var kinds []AnomalyKind
+			for _, anomaly := range result.Anomalies {
+				kinds = append(kinds, anomaly.Kind)
+			}
+			if test.anomaly == "" && len(kinds) != 0 || test.anomaly != "" && (len(kinds) != 1 || kinds[0] != test.anomaly) {
+				t.Errorf("expected anomaly %q, got %v", test.anomaly, kinds)
+			}
+		})
+	}
+}
+
+func TestCheckQueues(t *testing.T) {
+	// Each queue is checked on its own, so values of one queue do not affect another
+	operations := []Operation{
+		{Client: 1, Kind: Send, Queue: "a", Value: 1, Call: 1, Return: 2},
+		{Client: 1, Kind: Send, Queue: "b", Value: 2, Call: 3, Return: 4},
+		{Client: 2, Kind: Recieve, Queue: "b", Value: 2, Call: 5, Return: 6},
+		{Client: 2, Kind: Recieve, Queue: "a", Value: 0, Call: 7, Return: 8},
+	}
+
+	result := Check(operations)
+	if result.Ok || len(result.Queues) != 1 || result.Queues[0] != "a" {
+		t.Fatalf("expected only queue a not to be linearizable, got: %s", result)
+	}
+	if len(result.Anomalies) != 1 || result.Anomalies[0].Kind != Lost || result.Anomalies[0].Value != 1 {
+		t.Errorf("expected value 1 to be lost, got %v", result.Anomalies)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	history := NewHistory()
+
+	send := history.Invoke(1, Send, "q", 1)
+	recieve := history.Invoke(2, Recieve, "q", 0)
+	history.Ok(send, 0)
+	history.Ok(recieve, 1)
+
+	failed := history.Invoke(1, Send, "q", 2)
+	history.Fail(failed)
+	timedOut := history.Invoke(1, Send, "q", 3)
+	history.Info(timedOut)
+	history.Invoke(2, Recieve, "q", 0)
+
+	operations := history.Operations()
+	if len(operations) != 4 {
+		t.Fatalf("expected 4 operations, got %v", operations)
+	}
+	if operations[0].Value != 1 || operations[0].Call != 1 || operations[0].Return != 3 {
+		t.Errorf("expected send of 1 over [1, 3], got %s", operations[0])
+	}
+	if operations[1].Value != 1 || operations[1].Return != 4 {
+		t.Errorf("expected recieve of 1 returning at 4, got %s", operations[1])
+	}
+	if !operations[2].Ambiguous || !operations[3].Ambiguous {
+		t.Errorf("expected timed out and pending operations to be ambiguous, got %v", operations[2:])
+	}
+
+	if result := Check(operations); !result.Ok {
+		t.Errorf("expected history to be linearizable, got: %s", result)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	// Many concurrent sends that are never received leave an exponential number of orders to search
+	var operations []Operation
+	for i := 1; i <= 40; i++ {
+		operations = append(operations, op(i, Send, i, int64(i), int64(100+i)))
+	}
+	operations = append(operations, op(0, Recieve, 41, 200, 201))
+
+	start := time.Now()
+	result := CheckTimeout(operations, 100*time.Millisecond)
+	if !result.Unknown || result.Ok {
+		t.Errorf("expected the check to time out, got: %s", result)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the check to stop soon after the timeout, took %v", elapsed)
+	}
+}
+
+func BenchmarkCheck(b *testing.B) {
+	// Four clients alternate sends and recieves with overlapping calls
+	var operations []Operation
+	var clock int64
+	for i := 1; i <= 250; i++ {
+		for client := 0; client < 4; client++ {
+			value := 4*i + client
+			operations = append(operations, op(client, Send, value, clock+int64(client), clock+int64(client)+4))
+		}
+		clock += 8
+		for client := 0; client < 4; client++ {
+			operations = append(operations, op(client, Recieve, 4*i+client, clock+int64(client), clock+int64(client)+1))
+		}
+		clock += 8
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if result := Check(operations); !result.Ok {
+			b.Fatal(fmt.Sprint(result))
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Package linearizability checks histories of concurrent queue operations against a sequential FIFO queue
+// The search follows the algorithm of Wing & Gong with the memoization of Lowe, as used by Porcupine and Knossos,
+// and histories are split by queue so that each queue is checked on its own
+package linearizability
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Kind is the kind of an operation
+type Kind int
+
+const (
+	// Send enqueues the value of the operation
+	Send Kind = iota
+
+	// Recieve dequeues a value, which is 0 when the queue is empty
+	Recieve
+)
+
+// Operation is a call made by a client and its outcome
+type Operation struct {
+	// Client is the id of the client that made the call
+	Client int
+
+	// Kind is the kind of the operation
+	Kind Kind
+
+	// Queue is the name of the queue the operation was made against
+	Queue string
+
+	// Value is the value sent or received, values sent must be unique and not 0
+	Value int
+
+	// Call and Return order the operation against others
+	Call, Return int64
+
+	// Ambiguous is set when the operation may or may not have taken effect, its Value is unknown for a Recieve
+	Ambiguous bool
+}
+
+// String is used to describe the operation
+func (o Operation) String() string {
+	end := "?"
+	if !o.Ambiguous {
+		end = fmt.Sprint(o.Return)
+	}
+
+	switch {
+	case o.Kind == Send:
+		return fmt.Sprintf("client %d: send(%q, %d) [%d, %s]", o.Client, o.Queue, o.Value, o.Call, end)
+	case o.Ambiguous:
+		return fmt.Sprintf("client %d: recieve(%q) -> ? [%d, %s]", o.Client, o.Queue, o.Call, end)
+	default:
+		return fmt.Sprintf("client %d: recieve(%q) -> %d [%d, %s]", o.Client, o.Queue, o.Value, o.Call, end)
+	}
+}
+
+// Call is an operation that has been invoked and has not returned yet
+type Call struct {
+	operation Operation
+}
+
+// History records the operations made by concurrent clients
+// Calls and returns are ordered by a logical clock shared by every client
+type History struct {
+	clock      atomic.Int64
+	lock       sync.Mutex
+	operations []Operation
+	pending    map[*Call]struct{}
+}
+
+// NewHistory creates a new instance of the History
+func NewHistory() *History {
+	return &History{pending: make(map[*Call]struct{})}
+}
+
+// Invoke is used to record the call of an operation, one of Ok, Fail or Info must be called once it returns
+// The value is the value to send and is ignored for a Recieve
+func (h *History) Invoke(client int, kind Kind, queue string, value int) *Call {
+	call := &Call{operation: Operation{
+		Client: client,
+		Kind:   kind,
+		Queue:  queue,
+		Value:  value,
+		Call:   h.clock.Add(1),
+	}}
+	if kind == Recieve {
+		call.operation.Value = 0
+	}
+
+	h.lock.Lock()
+	h.pending[call] = struct{}{}
+	h.lock.Unlock()
+	return call
+}
+
+// Ok is used to record an operation that took effect, with the value received for a Recieve
+func (h *History) Ok(call *Call, value int) {
+	operation := call.operation
+	operation.Return = h.clock.Add(1)
+	if operation.Kind == Recieve {
+		operation.Value = value
+	}
+	h.complete(call, &operation)
+}
+
+// Fail is used to record an operation that certainly did not take effect, it is left out of the history
+func (h *History) Fail(call *Call) {
+	h.complete(call, nil)
+}
+
+// Info is used to record an operation whose outcome is unknown, such as one that timed out
+// It may take effect at any point after its call, even after every other operation has returned
+func (h *History) Info(call *Call) {
+	operation := call.operation
+	operation.Ambiguous = true
+	h.complete(call, &operation)
+}
+
+// complete is used to move a returned call into the history
+func (h *History) complete(call *Call, operation *Operation) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	delete(h.pending, call)
+	if operation != nil {
+		h.operations = append(h.operations, *operation)
+	}
+}
+
+// Operations is used to get the recorded operations ordered by call
+// Calls that have not returned are included as ambiguous operations
+func (h *History) Operations() []Operation {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	operations := append([]Operation{}, h.operations...)
+	for call := range h.pending {
+		operation := call.operation
+		operation.Ambiguous = true
+		operations = append(operations, operation)
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].Call < operations[j].Call
+	})
+	return operations
+}
@@ -0,0 +1,210 @@
+package testcluster
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kavinaravind/go-raft-message-queue/store"
+	"github.com/kavinaravind/go-raft-message-queue/testcluster/linearizability"
+)
+
+// client runs operations against whichever node is the leader and records them in the history
+type client struct {
+	id      int
+	cluster *Cluster[int]
+	history *linearizability.History
+	values  *atomic.Int64
+}
+
+// timeout is how long a client waits for an operation before recording it as ambiguous
+// The futures of commands in flight on a node that crashes are never resolved, so clients cannot wait on them
+const timeout = 2 * time.Second
+
+// send is used to send a new unique value to the queue
+func (c *client) send(queue string) {
+	s, err := c.cluster.LeaderStore(time.Second)
+	if err != nil {
+		return
+	}
+
+	value := int(c.values.Add(1))
+	call := c.history.Invoke(c.id, linearizability.Send, queue, value)
+	c.do(call, func() (int, error) {
+		return 0, s.Send(queue, value)
+	})
+}
+
+// recieve is used to dequeue a value from the queue, it reports whether a value or an empty queue was seen
+func (c *client) recieve(queue string) (int, bool) {
+	s, err := c.cluster.LeaderStore(time.Second)
+	if err != nil {
+		return 0, false
+	}
+
+	call := c.history.Invoke(c.id, linearizability.Recieve, queue, 0)
+	return c.do(call, func() (int, error) {
+		msg, err := s.Recieve(queue)
+		if errors.Is(err, store.ErrQueueNotFound) {
+			// A queue that was never sent to is empty
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		return msg.Data, nil
+	})
+}
+
+// do is used to run an operation and record its outcome, it reports whether the operation took effect
+// Raft rejects commands on a follower before they are logged, any other error may follow the command being committed
+func (c *client) do(call *linearizability.Call, operation func() (int, error)) (int, bool) {
+	type outcome struct {
+		value int
+		err   error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		value, err := operation()
+		done <- outcome{value: value, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		switch {
+		case o.err == nil:
+			c.history.Ok(call, o.value)
+			return o.value, true
+		case errors.Is(o.err, store.ErrNotLeader):
+			c.history.Fail(call)
+		default:
+			c.history.Info(call)
+		}
+	case <-time.After(timeout):
+		c.history.Info(call)
+	}
+	return 0, false
+}
+
+// nemesis injects a random fault into the cluster and reverts it after a while
+func nemesis(c *Cluster[int], random *rand.Rand) {
+	pause := func() {
+		time.Sleep(time.Duration(100+random.Intn(200)) * time.Millisecond)
+	}
+
+	leader, err := c.WaitForLeader(time.Second)
+	if err != nil {
+		return
+	}
+
+	switch random.Intn(4) {
+	case 0:
+		// Isolate the leader with one follower in the minority
+		var followers []*Node[int]
+		for _, node := range c.Nodes() {
+			if node != leader {
+				followers = append(followers, node)
+			}
+		}
+		random.Shuffle(len(followers), func(i, j int) {
+			followers[i], followers[j] = followers[j], followers[i]
+		})
+		c.Partition([]*Node[int]{leader, followers[0]}, followers[1:])
+		pause()
+		c.Heal()
+	case 1:
+		c.Crash(leader)
+		pause()
+		c.Restart(leader)
+	case 2:
+		// Crash a random node, which may or may not be the leader
+		node := c.Node(random.Intn(len(c.Nodes())))
+		c.Crash(node)
+		pause()
+		c.Restart(node)
+	case 3:
+		c.Delay(time.Duration(5+random.Intn(30)) * time.Millisecond)
+		pause()
+		c.Delay(0)
+	}
+	pause()
+}
+
+func TestLinearizability(t *testing.T) {
+	t.Parallel()
+	c := New[int](t, 5, WithStorage(store.StorageBolt))
+	history := linearizability.NewHistory()
+	values := &atomic.Int64{}
+	queues := []string{"a", "b"}
+
+	const (
+		clients  = 4
+		duration = 2 * time.Second
+	)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 1; i <= clients; i++ {
+		wg.Add(1)
+		go func(client *client) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(int64(client.id)))
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(time.Duration(random.Intn(10)) * time.Millisecond):
+				}
+
+				queue := queues[random.Intn(len(queues))]
+				if random.Intn(2) == 0 {
+					client.send(queue)
+				} else {
+					client.recieve(queue)
+				}
+			}
+		}(&client{id: i, cluster: c, history: history, values: values})
+	}
+
+	seed := time.Now().UnixNano()
+	t.Logf("injecting faults with seed %d", seed)
+	faults := make(chan struct{})
+	go func() {
+		defer close(faults)
+		random := rand.New(rand.NewSource(seed))
+		for deadline := time.Now().Add(duration); time.Now().Before(deadline); {
+			nemesis(c, random)
+		}
+	}()
+	<-faults
+	close(stop)
+	wg.Wait()
+
+	// Once the faults are reverted, every queue is drained so that lost values are detected
+	drainer := &client{id: 0, cluster: c, history: history, values: values}
+	for _, queue := range queues {
+		for deadline := time.Now().Add(DefaultTimeout); ; {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out draining queue %q", queue)
+			}
+			if value, ok := drainer.recieve(queue); ok && value == 0 {
+				break
+			}
+		}
+	}
+
+	ops := history.Operations()
+	var ambiguous int
+	for _, op := range ops {
+		if op.Ambiguous {
+			ambiguous++
+		}
+	}
+	t.Logf("checking %d operations, %d of which are ambiguous", len(ops), ambiguous)
+	if result := linearizability.CheckTimeout(ops, 30*time.Second); !result.Ok {
+		t.Fatal(result)
+	}
+}
@@ -0,0 +1,100 @@
+package testcluster
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/raft"
+	"github.com/kavinaravind/go-raft-message-queue/consensus"
+)
+
+// termKeys and voteKey are the keys raft writes to its stable store, as integers and bytes respectively
+var (
+	termKeys = [][]byte{[]byte("CurrentTerm"), []byte("LastVoteTerm")}
+	voteKey  = []byte("LastVoteCand")
+)
+
+// copyStores is used to copy the raft state of a node into new in-memory stores, as it is at that moment
+// The node may still be writing to the stores, so the log is copied first and the term and snapshot copied
+// after it are at least as recent as its entries
+func copyStores(stores *consensus.Stores) (*consensus.Stores, error) {
+	log, stable := raft.NewInmemStore(), raft.NewInmemStore()
+	if err := copyLog(log, stores.Log); err != nil {
+		return nil, fmt.Errorf("failed to copy log: %w", err)
+	}
+	for _, key := range termKeys {
+		term, err := stores.Stable.GetUint64(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := stable.SetUint64(key, term); err != nil {
+			return nil, err
+		}
+	}
+	if vote, err := stores.Stable.Get(voteKey); err == nil {
+		if err := stable.Set(voteKey, vote); err != nil {
+			return nil, err
+		}
+	}
+
+	snapshots := raft.NewInmemSnapshotStore()
+	if err := copySnapshot(snapshots, stores.Snapshots); err != nil {
+		return nil, fmt.Errorf("failed to copy snapshot: %w", err)
+	}
+	return &consensus.Stores{Log: log, Stable: stable, Snapshots: snapshots}, nil
+}
+
+// copyLog is used to copy every entry of the log
+// Entries compacted while they are copied are skipped, as they are covered by a snapshot
+func copyLog(dst, src raft.LogStore) error {
+	first, err := src.FirstIndex()
+	if err != nil {
+		return err
+	}
+	last, err := src.LastIndex()
+	if err != nil {
+		return err
+	}
+
+	var copied bool
+	for index := first; first > 0 && index <= last; index++ {
+		var entry raft.Log
+		err := src.GetLog(index, &entry)
+		if errors.Is(err, raft.ErrLogNotFound) && !copied {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", index, err)
+		}
+		if err := dst.StoreLog(&entry); err != nil {
+			return err
+		}
+		copied = true
+	}
+	return nil
+}
+
+// copySnapshot is used to copy the latest snapshot, if any
+func copySnapshot(dst, src raft.SnapshotStore) error {
+	metas, err := src.List()
+	if err != nil || len(metas) == 0 {
+		return err
+	}
+
+	meta, rc, err := src.Open(metas[0].ID)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	sink, err := dst.Create(meta.Version, meta.Index, meta.Term, meta.Configuration, meta.ConfigurationIndex, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(sink, rc); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
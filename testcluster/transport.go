@@ -0,0 +1,53 @@
+package testcluster
+
+import (
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// delayedTransport delays the rpcs sent by a node by a random duration up to the delay of the cluster
+// Pipelining is disabled so that every append entries rpc is delayed
+type delayedTransport struct {
+	*raft.InmemTransport
+	delay *atomic.Int64
+}
+
+// sleep is used to wait for a random duration up to the delay
+func (t *delayedTransport) sleep() {
+	if max := t.delay.Load(); max > 0 {
+		time.Sleep(time.Duration(rand.Int63n(max)))
+	}
+}
+
+// AppendEntriesPipeline is used to implement the raft.Transport interface
+func (t *delayedTransport) AppendEntriesPipeline(id raft.ServerID, target raft.ServerAddress) (raft.AppendPipeline, error) {
+	return nil, raft.ErrPipelineReplicationNotSupported
+}
+
+// AppendEntries is used to implement the raft.Transport interface
+func (t *delayedTransport) AppendEntries(id raft.ServerID, target raft.ServerAddress, args *raft.AppendEntriesRequest, resp *raft.AppendEntriesResponse) error {
+	t.sleep()
+	return t.InmemTransport.AppendEntries(id, target, args, resp)
+}
+
+// RequestVote is used to implement the raft.Transport interface
+func (t *delayedTransport) RequestVote(id raft.ServerID, target raft.ServerAddress, args *raft.RequestVoteRequest, resp *raft.RequestVoteResponse) error {
+	t.sleep()
+	return t.InmemTransport.RequestVote(id, target, args, resp)
+}
+
+// InstallSnapshot is used to implement the raft.Transport interface
+func (t *delayedTransport) InstallSnapshot(id raft.ServerID, target raft.ServerAddress, args *raft.InstallSnapshotRequest, resp *raft.InstallSnapshotResponse, data io.Reader) error {
+	t.sleep()
+	return t.InmemTransport.InstallSnapshot(id, target, args, resp, data)
+}
+
+// TimeoutNow is used to implement the raft.Transport interface
+func (t *delayedTransport) TimeoutNow(id raft.ServerID, target raft.ServerAddress, args *raft.TimeoutNowRequest, resp *raft.TimeoutNowResponse) error {
+	t.sleep()
+	return t.InmemTransport.TimeoutNow(id, target, args, resp)
+}